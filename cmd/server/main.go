@@ -3,10 +3,20 @@ package main
 import (
 	"NodePassDash/internal/api"
 	"NodePassDash/internal/auth"
+	"NodePassDash/internal/backup"
+	"NodePassDash/internal/config"
 	"NodePassDash/internal/dashboard"
 	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/eventbus"
 	log "NodePassDash/internal/log"
+	"NodePassDash/internal/migrate"
+	"NodePassDash/internal/reconcile"
+	"NodePassDash/internal/retention"
+	"NodePassDash/internal/schedule"
+	"NodePassDash/internal/spec"
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/storage"
+	"NodePassDash/internal/traffic"
 	"NodePassDash/internal/tunnel"
 	"context"
 	"database/sql"
@@ -15,10 +25,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
+	"path/filepath"
 	"strings"
 	"syscall"
-	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
@@ -29,74 +38,196 @@ var Version = "dev"
 
 func main() {
 	// 命令行参数处理
+	configFile := flag.String("config", "", "配置文件路径（.yaml / .yml / .toml），也可通过环境变量 NODEPASS_CONFIG 指定")
+	printConfig := flag.Bool("print-config", false, "输出合并后的最终配置并退出")
 	resetPwdCmd := flag.Bool("resetpwd", false, "重置管理员密码")
 	portFlag := flag.String("port", "", "HTTP 服务端口 (优先级高于环境变量 PORT)，默认 3000")
+	dbDSNFlag := flag.String("db", "", "数据库 DSN (优先级高于环境变量 DB_DSN)，支持 SQLite 文件路径、postgres://、mysql://")
+	logLevelFlag := flag.String("log-level", "", "日志级别 debug / info / warn / error (优先级高于环境变量 LOG_LEVEL)")
+	sseWorkersFlag := flag.Int("sse-workers", -1, "SSE 消息处理 worker 数量，0 表示自动")
+	migrateStatusCmd := flag.Bool("migrate-status", false, "查看数据库迁移状态")
+	migrateDownCmd := flag.Bool("migrate-down", false, "回滚数据库迁移（配合 --migrate-steps 指定步数）")
+	migrateSteps := flag.Int("migrate-steps", 1, "--migrate-down 回滚的迁移数量")
+	restoreFile := flag.String("restore", "", "从指定备份文件恢复数据库（校验后暂存，下次启动时生效）")
+	specPlanFile := flag.String("plan", "", "比较声明式隧道配置文件（YAML）与当前隧道的差异后退出")
+	specApplyFile := flag.String("apply", "", "应用声明式隧道配置文件（YAML）后退出")
+	specPrune := flag.Bool("prune", false, "配合 --plan / --apply 使用，同时删除配置中各主控上未声明的隧道")
 	flag.Parse()
 
+	// 加载配置：默认值 < 配置文件 < 环境变量 < 命令行
+	if *configFile == "" {
+		*configFile = os.Getenv("NODEPASS_CONFIG")
+	}
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Errorf("加载配置失败: %v", err)
+		os.Exit(1)
+	}
+	if *portFlag != "" {
+		cfg.Server.Port = *portFlag
+	}
+	if *dbDSNFlag != "" {
+		cfg.Database.DSN = *dbDSNFlag
+	}
+	if *logLevelFlag != "" {
+		cfg.Log.Level = *logLevelFlag
+	}
+	if *sseWorkersFlag >= 0 {
+		cfg.SSE.Workers = *sseWorkersFlag
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		format := "yaml"
+		if strings.HasSuffix(strings.ToLower(*configFile), ".toml") {
+			format = "toml"
+		}
+		out, err := cfg.Dump(format)
+		if err != nil {
+			log.Errorf("输出配置失败: %v", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	if err := log.Setup(cfg.Log.Options()); err != nil {
+		log.Errorf("初始化日志失败: %v", err)
+	}
+	defer log.Close()
+
 	// 确保public目录存在
 	dbDir := "public"
 	if err := ensureDir(dbDir); err != nil {
 		log.Errorf("创建数据库目录失败: %v", err)
 		return
 	}
-	// 如果指定了 --resetpwd，则进入密码重置流程后退出
-	if *resetPwdCmd {
-		// 打开数据库
-		db, err := sql.Open("sqlite3", "file:public/sqlite.db?_journal_mode=WAL&_busy_timeout=5000&_fk=1")
+
+	dsn := cfg.Database.DSN
+	dbPath, _ := storage.SQLitePath(dsn)
+	migrateLegacyDatabase(dbPath)
+
+	// --restore：校验并暂存备份文件后退出，失败时以非零状态退出
+	if *restoreFile != "" {
+		err := backup.ErrUnsupported
+		if dbPath != "" {
+			err = backup.StageRestoreFile(*restoreFile, dbPath)
+		}
 		if err != nil {
-			log.Errorf("连接数据库失败: %v", err)
+			log.Errorf("恢复失败: %v", err)
+			log.Close()
+			os.Exit(1)
+		}
+		fmt.Println("备份校验通过，重新启动服务后生效")
+		return
+	}
+
+	// 存在待恢复的备份时，在打开数据库之前替换数据库文件
+	if dbPath != "" {
+		if _, err := backup.ApplyPendingRestore(dbPath); err != nil {
+			log.Errorf("恢复数据库失败: %v", err)
 		}
-		defer db.Close()
+	}
 
-		authService := auth.NewService(db)
+	db, dialect, err := storage.Open(dsn)
+	if err != nil {
+		log.Errorf("连接数据库失败: %v", err)
+		return
+	}
+	defer db.Close()
+	log.Infof("使用 %s 数据库", dialect)
+
+	// 如果指定了 --resetpwd，则进入密码重置流程后退出
+	if *resetPwdCmd {
+		authService := auth.NewService(db, cfg.Auth.Options())
 		if _, _, err := authService.ResetAdminPassword(); err != nil {
 			log.Errorf("重置密码失败: %v", err)
 		}
 		return
 	}
 
-	// 打开数据库连接
-	db, err := sql.Open("sqlite3", "/tmp/sqlite.db")
-	if err != nil {
-		log.Errorf("连接数据库失败: %v", err)
+	// 迁移相关命令执行后直接退出
+	if *migrateStatusCmd || *migrateDownCmd {
+		if err := runMigrateCommand(db, *migrateDownCmd, *migrateSteps); err != nil {
+			log.Errorf("%v", err)
+			// os.Exit 不会执行 defer，需手动关闭数据库与日志
+			db.Close()
+			log.Close()
+			os.Exit(1)
+		}
+		return
 	}
-	defer db.Close()
 
-	// 优化连接池配置，避免过多并发连接
-	db.SetMaxOpenConns(6)
-	db.SetMaxIdleConns(3)
-	db.SetConnMaxLifetime(0)               // 连接不过期
-	db.SetConnMaxIdleTime(5 * time.Minute) // 空闲连接5分钟后关闭
+	// 执行数据库迁移
+	if n, err := migrate.New(db).Up(); err != nil {
+		log.Errorf("数据库迁移失败: %v", err)
+		return
+	} else if n > 0 {
+		log.Infof("数据库迁移完成，本次应用 %d 个迁移", n)
+	}
 
-	// 初始化数据库表结构
-	if err := initDatabase(db); err != nil {
-		log.Errorf("初始化数据库失败: %v", err)
+	// --plan / --apply：声明式隧道配置
+	if *specPlanFile != "" || *specApplyFile != "" {
+		if err := runSpecCommand(db, cfg.Ports.Options(), *specPlanFile, *specApplyFile, *specPrune); err != nil {
+			log.Errorf("%v", err)
+			// 以非零状态退出，便于 CI / GitOps 任务发现失败
+			db.Close()
+			log.Close()
+			os.Exit(1)
+		}
+		return
 	}
 
 	// 初始化服务
-	authService := auth.NewService(db)
+	authService := auth.NewService(db, cfg.Auth.Options())
 	endpointService := endpoint.NewService(db)
-	tunnelService := tunnel.NewService(db)
+	tunnelService := tunnel.NewService(db, cfg.Ports.Options())
 	dashboardService := dashboard.NewService(db)
 
+	// 内部事件总线，用于推送端点状态变更
+	bus := eventbus.New()
+
 	// 创建SSE服务和管理器（需先于处理器创建）
-	sseService := sse.NewService(db)
-	sseManager := sse.NewManager(db, sseService)
-	// 适当减少 worker 数量，避免过多并发写入
-	workerCount := runtime.NumCPU()
-	if workerCount > 4 {
-		workerCount = 4 // 最多4个worker
+	sseConfig := cfg.SSE.Options()
+	sseService := sse.NewService(db, bus, sseConfig)
+	sseManager := sse.NewManager(db, sseService, sseConfig)
+	sseManager.StartWorkers(sseConfig.WorkerCount())
+
+	// 启动 EndpointSSE 事件数据清理任务
+	janitor := retention.NewJanitor(db, cfg.Retention.Options())
+	janitor.Start()
+
+	// 启动流量汇总任务（累计计数 -> 分钟/小时/天增量）
+	aggregator := traffic.NewAggregator(db, cfg.Traffic.Options())
+	if err := aggregator.Start(bus); err != nil {
+		log.Errorf("启动流量汇总任务失败: %v", err)
+	}
+
+	// 启动定时备份（仅 SQLite）
+	backupService := backup.NewService(db, dbPath, cfg.Backup.Options())
+	backupService.Start()
+
+	// 启动主控对账任务，有修正时通知前端刷新端点状态
+	reconciler := reconcile.NewReconciler(db, cfg.Reconcile.Options(), sseManager.NotifyEndpointState)
+	reconciler.Start()
+
+	// 启动隧道定时任务（启动时处理停机期间错过的执行）
+	scheduler := schedule.NewService(db, tunnelService, cfg.Schedule.Options())
+	if err := scheduler.Start(); err != nil {
+		log.Errorf("启动定时任务失败: %v", err)
 	}
-	sseManager.StartWorkers(workerCount)
 
 	// 初始化处理器
 	authHandler := api.NewAuthHandler(authService)
-	endpointHandler := api.NewEndpointHandler(endpointService, sseManager)
+	endpointHandler := api.NewEndpointHandler(endpointService, sseManager, bus, reconciler)
 	tunnelHandler := api.NewTunnelHandler(tunnelService)
 	dashboardHandler := api.NewDashboardHandler(dashboardService)
 
 	// 创建API路由器 (仅处理 /api/*)
-	apiRouter := api.NewRouter(db, sseService, sseManager)
+	apiRouter := api.NewRouter(cfg, db, sseService, sseManager, bus, janitor, backupService, reconciler, scheduler)
 
 	// 顶层路由器，用于同时处理 API 和静态资源
 	rootRouter := mux.NewRouter()
@@ -106,7 +237,8 @@ func main() {
 	rootRouter.PathPrefix("/api/").Handler(apiRouter)
 
 	// 静态文件服务
-	fs := http.FileServer(http.Dir("dist"))
+	staticDir := cfg.Server.StaticDir
+	fs := http.FileServer(http.Dir(staticDir))
 	rootRouter.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 如果请求路径以 /api/ 开头，交给 API 处理器（理论上不会进入该函数，但保险起见）
 		if strings.HasPrefix(r.URL.Path, "/api/") {
@@ -115,9 +247,9 @@ func main() {
 		}
 
 		// 检查文件是否存在
-		if _, err := http.Dir("dist").Open(r.URL.Path); err != nil {
+		if _, err := http.Dir(staticDir).Open(r.URL.Path); err != nil {
 			// 如果文件不存在，返回 index.html 以支持 SPA
-			http.ServeFile(w, r, "dist/index.html")
+			http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
 			return
 		}
 
@@ -125,14 +257,7 @@ func main() {
 		fs.ServeHTTP(w, r)
 	})
 
-	// 读取端口：命令行 > 环境变量 > 默认值
-	port := "3000"
-	if env := os.Getenv("PORT"); env != "" {
-		port = env
-	}
-	if *portFlag != "" {
-		port = *portFlag
-	}
+	port := cfg.Server.Port
 	addr := fmt.Sprintf(":%s", port)
 
 	// 创建上下文和取消函数
@@ -178,12 +303,21 @@ func main() {
 	// 关闭服务
 	log.Infof("正在关闭服务器...")
 
+	// 停止后台清理、备份、对账与定时任务
+	janitor.Stop()
+	backupService.Stop()
+	reconciler.Stop()
+	scheduler.Stop()
+
 	// 关闭SSE系统
 	sseManager.Close()
 	sseService.Close()
 
+	// SSE 关闭后再停止流量汇总，写入剩余增量
+	aggregator.Stop()
+
 	// 优雅关闭HTTP服务器
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.D())
 	defer shutdownCancel()
 
 	if err := server.Shutdown(shutdownCtx); err != nil {
@@ -193,196 +327,105 @@ func main() {
 	log.Infof("服务器已关闭")
 }
 
-// initDatabase 创建必须的表结构（如不存在）
-func initDatabase(db *sql.DB) error {
-	createEndpointsTable := `
-	CREATE TABLE IF NOT EXISTS "Endpoint" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		url TEXT NOT NULL UNIQUE,
-		apiPath TEXT NOT NULL,
-		apiKey TEXT NOT NULL,
-		status TEXT NOT NULL DEFAULT 'OFFLINE',
-		color TEXT DEFAULT 'default',
-		lastCheck DATETIME DEFAULT CURRENT_TIMESTAMP,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		tunnelCount INTEGER DEFAULT 0
-	);`
-
-	createTunnelTable := `
-	CREATE TABLE IF NOT EXISTS "Tunnel" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		endpointId INTEGER NOT NULL,
-		mode TEXT NOT NULL,
-		status TEXT NOT NULL DEFAULT 'stopped',
-		tunnelAddress TEXT NOT NULL,
-		tunnelPort TEXT NOT NULL,
-		targetAddress TEXT NOT NULL,
-		targetPort TEXT NOT NULL,
-		tlsMode TEXT NOT NULL,
-		certPath TEXT,
-		keyPath TEXT,
-		logLevel TEXT NOT NULL DEFAULT 'info',
-		commandLine TEXT NOT NULL,
-		instanceId TEXT,
-		tcpRx INTEGER DEFAULT 0,
-		tcpTx INTEGER DEFAULT 0,
-		udpRx INTEGER DEFAULT 0,
-		udpTx INTEGER DEFAULT 0,
-		min INTEGER,
-		max INTEGER,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		lastEventTime DATETIME,
-		FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
-	);`
-
-	createTunnelRecycleTable := `
-	CREATE TABLE IF NOT EXISTS "TunnelRecycle" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		endpointId INTEGER NOT NULL,
-		mode TEXT NOT NULL,
-		tunnelAddress TEXT NOT NULL,
-		tunnelPort TEXT NOT NULL,
-		targetAddress TEXT NOT NULL,
-		targetPort TEXT NOT NULL,
-		tlsMode TEXT NOT NULL,
-		certPath TEXT,
-		keyPath TEXT,
-		logLevel TEXT NOT NULL DEFAULT 'info',
-		commandLine TEXT NOT NULL,
-		instanceId TEXT,
-		tcpRx INTEGER DEFAULT 0,
-		tcpTx INTEGER DEFAULT 0,
-		udpRx INTEGER DEFAULT 0,
-		udpTx INTEGER DEFAULT 0,
-		min INTEGER,
-		max INTEGER,
-		FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
-	);`
-
-	createEndpointSSE := `
-	CREATE TABLE IF NOT EXISTS "EndpointSSE" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		eventType TEXT NOT NULL,
-		pushType TEXT NOT NULL,
-		eventTime DATETIME NOT NULL,
-		endpointId INTEGER NOT NULL,
-		instanceId TEXT NOT NULL,
-		instanceType TEXT,
-		status TEXT,
-		url TEXT,
-		tcpRx INTEGER DEFAULT 0,
-		tcpTx INTEGER DEFAULT 0,
-		udpRx INTEGER DEFAULT 0,
-		udpTx INTEGER DEFAULT 0,
-		logs TEXT,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
-	);`
-
-	createTunnelLog := `
-	CREATE TABLE IF NOT EXISTS "TunnelOperationLog" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		tunnelId INTEGER,
-		tunnelName TEXT NOT NULL,
-		action TEXT NOT NULL,
-		status TEXT NOT NULL,
-		message TEXT,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createSystemConfig := `
-	CREATE TABLE IF NOT EXISTS "SystemConfig" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		KEY TEXT NOT NULL UNIQUE,
-		value TEXT NOT NULL,
-		description TEXT,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createUserSession := `
-	CREATE TABLE IF NOT EXISTS "UserSession" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		sessionId TEXT NOT NULL UNIQUE,
-		username TEXT NOT NULL,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		expiresAt DATETIME NOT NULL,
-		isActive BOOLEAN NOT NULL DEFAULT 1
-	);`
-
-	// 依次执行创建表 SQL
-	if _, err := db.Exec(createEndpointsTable); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createTunnelTable); err != nil {
-		return err
+// ensureDir 确保目录存在，如果不存在则创建
+func ensureDir(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		log.Infof("创建目录: %s", dir)
+		return os.MkdirAll(dir, 0755)
 	}
-	if _, err := db.Exec(createTunnelRecycleTable); err != nil {
-		return err
+	return nil
+}
+
+// migrateLegacyDatabase 旧版本默认将数据库放在 /tmp/sqlite.db。
+// 使用默认数据库位置且新位置尚无数据库时，将旧数据库校验后复制到新位置（旧文件保留不动）
+func migrateLegacyDatabase(dbPath string) {
+	const legacyPath = "/tmp/sqlite.db"
+	defaultPath, _ := storage.SQLitePath(storage.DefaultDSN)
+	if dbPath == "" || dbPath != defaultPath {
+		return
 	}
-	if _, err := db.Exec(createEndpointSSE); err != nil {
-		return err
+	if _, err := os.Stat(dbPath); err == nil {
+		return
 	}
-	if _, err := db.Exec(createTunnelLog); err != nil {
-		return err
+	if _, err := os.Stat(legacyPath); err != nil {
+		return
 	}
-	if _, err := db.Exec(createSystemConfig); err != nil {
-		return err
+	if err := backup.CopyDatabase(legacyPath, dbPath); err != nil {
+		log.Errorf("迁移旧版本数据库 %s 失败: %v；如需沿用旧数据，请通过 --db / DB_DSN 指定", legacyPath, err)
+		return
 	}
-	if _, err := db.Exec(createUserSession); err != nil {
-		return err
+	log.Infof("检测到旧版本数据库 %s，已复制到 %s", legacyPath, dbPath)
+}
+
+// runMigrateCommand 处理 --migrate-status / --migrate-down 命令，失败时返回错误
+func runMigrateCommand(db *sql.DB, down bool, steps int) error {
+	m := migrate.New(db)
+	if down {
+		n, err := m.Down(steps)
+		if err != nil {
+			return fmt.Errorf("回滚迁移失败（已回滚 %d 个）: %w", n, err)
+		}
+		fmt.Printf("已回滚 %d 个迁移\n", n)
 	}
 
-	// ---- 旧库兼容：为 Tunnel 表添加 min / max 列 ----
-	if err := ensureColumn(db, "Tunnel", "min", "INTEGER"); err != nil {
-		return err
+	list, err := m.Status()
+	if err != nil {
+		return fmt.Errorf("查询迁移状态失败: %w", err)
 	}
-	if err := ensureColumn(db, "Tunnel", "max", "INTEGER"); err != nil {
-		return err
+	for _, st := range list {
+		state := "pending"
+		appliedAt := ""
+		if st.Applied {
+			state = "applied"
+			appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d  %-24s %-8s %s\n", st.Version, st.Name, state, appliedAt)
 	}
-
 	return nil
 }
 
-// ensureDir 确保目录存在，如果不存在则创建
-func ensureDir(dir string) error {
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		log.Infof("创建目录: %s", dir)
-		return os.MkdirAll(dir, 0755)
+// runSpecCommand 处理 --plan / --apply 命令
+func runSpecCommand(db *sql.DB, tunnelCfg tunnel.Config, planFile, applyFile string, prune bool) error {
+	file := planFile
+	if applyFile != "" {
+		file = applyFile
 	}
-	return nil
-}
-
-// ensureColumn 若列不存在则 ALTER TABLE 添加，幂等安全
-func ensureColumn(db *sql.DB, table, column, typ string) error {
-	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	s, err := spec.Parse(data)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	var exists bool
-	for rows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull int
-		var dfltValue interface{}
-		var pk int
-		_ = rows.Scan(&cid, &name, &ctype, &notnull, &dfltValue, &pk)
-		if name == column {
-			exists = true
-			break
+
+	// 命令行模式下没有 SSE 监听同步删除本地记录，删除实例后无需等待
+	svc := spec.NewService(db, tunnel.NewService(db, tunnelCfg), spec.Config{})
+	if applyFile == "" {
+		plan, err := svc.Plan(s, prune)
+		if err != nil {
+			return err
 		}
+		fmt.Print(plan.Text())
+		return nil
 	}
 
-	if !exists {
-		_, err := db.Exec(`ALTER TABLE "` + table + `" ADD COLUMN ` + column + ` ` + typ)
+	plan, results, err := svc.Apply(s, prune)
+	if err != nil {
 		return err
 	}
+	fmt.Print(plan.Text())
+	failed := 0
+	for _, res := range results {
+		status := "成功"
+		if !res.Success {
+			status = "失败: " + res.Error
+			failed++
+		}
+		fmt.Printf("%-8s %s/%s %s\n", res.Action, res.Endpoint, res.Tunnel, status)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个变更执行失败", failed)
+	}
 	return nil
 }
@@ -2,7 +2,8 @@ package api
 
 import (
 	"database/sql"
-	"log"
+
+	"NodePassDash/internal/config"
 
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
@@ -17,11 +18,11 @@ func SetupRoutes(parent *mux.Router) {
 	// 打开数据库连接
 	db, err := sql.Open("sqlite3", "./public/sqlite.db")
 	if err != nil {
-		log.Printf("初始化数据库失败: %v", err)
+		log.Errorf("初始化数据库失败: %v", err)
 		return
 	}
 
 	// 创建 API Router 并挂载到父级路由器（此处不共享 SSE 实例，传入 nil 即由内部创建）
-	apiRouter := NewRouter(db, nil, nil)
+	apiRouter := NewRouter(config.Default(), db, nil, nil, nil, nil, nil, nil, nil)
 	parent.PathPrefix("/").Handler(apiRouter)
 }
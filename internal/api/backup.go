@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"NodePassDash/internal/backup"
+
+	"github.com/gorilla/mux"
+)
+
+// maxBackupUploadSize 上传备份文件的大小上限
+const maxBackupUploadSize = 1 << 30
+
+// BackupHandler 数据库备份相关的处理器
+type BackupHandler struct {
+	backupService *backup.Service
+}
+
+// NewBackupHandler 创建备份处理器实例
+func NewBackupHandler(backupService *backup.Service) *BackupHandler {
+	return &BackupHandler{backupService: backupService}
+}
+
+// available 检查备份服务是否可用，不可用时直接写入错误响应
+func (h *BackupHandler) available(w http.ResponseWriter) bool {
+	if h.backupService != nil && h.backupService.Supported() {
+		return true
+	}
+	w.WriteHeader(http.StatusNotImplemented)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   backup.ErrUnsupported.Error(),
+	})
+	return false
+}
+
+// HandleListBackups GET /api/system/backups
+func (h *BackupHandler) HandleListBackups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.available(w) {
+		return
+	}
+
+	list, err := h.backupService.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取备份列表失败: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":        true,
+		"backups":        list,
+		"pendingRestore": h.backupService.PendingRestore(),
+	})
+}
+
+// HandleCreateBackup POST /api/system/backups
+// 立即创建一个手动备份
+func (h *BackupHandler) HandleCreateBackup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.available(w) {
+		return
+	}
+
+	info, err := h.backupService.Create(backup.KindManual)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"backup":  info,
+	})
+}
+
+// HandleDownloadBackup GET /api/system/backups/{name}
+func (h *BackupHandler) HandleDownloadBackup(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	path, err := h.backupService.Path(name)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeContent(w, r, filepath.Base(path), fi.ModTime(), f)
+}
+
+// HandleDeleteBackup DELETE /api/system/backups/{name}
+func (h *BackupHandler) HandleDeleteBackup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.available(w) {
+		return
+	}
+
+	if err := h.backupService.Delete(mux.Vars(r)["name"]); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "备份已删除",
+	})
+}
+
+// HandleUploadBackup POST /api/system/backups/upload
+// 上传备份文件（multipart 字段 file），校验通过后保存到备份目录
+func (h *BackupHandler) HandleUploadBackup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.available(w) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackupUploadSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "读取上传文件失败: " + err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	info, err := h.backupService.Import(file)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "备份文件无效: " + err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"backup":  info,
+	})
+}
+
+// HandleRestoreBackup POST /api/system/backups/{name}/restore
+// 校验备份并暂存，服务重启后替换当前数据库
+func (h *BackupHandler) HandleRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.available(w) {
+		return
+	}
+
+	if err := h.backupService.StageRestore(mux.Vars(r)["name"]); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "备份校验通过，重启服务后生效",
+	})
+}
+
+// HandleCancelRestore DELETE /api/system/backups/restore
+// 取消尚未生效的恢复
+func (h *BackupHandler) HandleCancelRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.available(w) {
+		return
+	}
+
+	if err := h.backupService.CancelRestore(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "已取消恢复",
+	})
+}
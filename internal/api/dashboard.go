@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"NodePassDash/internal/dashboard"
+	"NodePassDash/internal/labels"
 )
 
 // DashboardHandler 仪表盘相关的处理器
@@ -53,8 +54,19 @@ func (h *DashboardHandler) HandleGetStats(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// 可选的标签选择器，仅统计匹配的隧道
+	sel, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
 	// 获取统计数据
-	stats, err := h.dashboardService.GetStats(dashboard.TimeRange(timeRange))
+	stats, err := h.dashboardService.GetStats(dashboard.TimeRange(timeRange), sel)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -5,20 +5,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	log "NodePassDash/internal/log"
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/nodepassurl"
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/tunnel"
 )
 
 // DataHandler 负责导入/导出数据
 type DataHandler struct {
 	db         *sql.DB
 	sseManager *sse.Manager
+	tunnels    *tunnel.Service
 }
 
-func NewDataHandler(db *sql.DB, mgr *sse.Manager) *DataHandler {
-	return &DataHandler{db: db, sseManager: mgr}
+func NewDataHandler(db *sql.DB, mgr *sse.Manager, tunnels *tunnel.Service) *DataHandler {
+	return &DataHandler{db: db, sseManager: mgr, tunnels: tunnels}
 }
 
 // EndpointExport 导出端点结构
@@ -29,28 +34,31 @@ type EndpointExport struct {
 	APIKey  string         `json:"apiKey"`
 	Status  string         `json:"status"`
 	Color   string         `json:"color,omitempty"`
+	Labels  labels.Set     `json:"labels,omitempty"`
 	Tunnels []TunnelExport `json:"tunnels,omitempty"`
 }
 
 // TunnelExport 导出隧道结构
 type TunnelExport struct {
-	Name          string `json:"name"`
-	Mode          string `json:"mode"`
-	Status        string `json:"status"`
-	TunnelAddress string `json:"tunnelAddress"`
-	TunnelPort    string `json:"tunnelPort"`
-	TargetAddress string `json:"targetAddress"`
-	TargetPort    string `json:"targetPort"`
-	TLSMode       string `json:"tlsMode"`
-	CertPath      string `json:"certPath,omitempty"`
-	KeyPath       string `json:"keyPath,omitempty"`
-	LogLevel      string `json:"logLevel"`
-	CommandLine   string `json:"commandLine"`
-	InstanceID    string `json:"instanceId,omitempty"`
-	TCPRx         string `json:"tcpRx,omitempty"`
-	TCPTx         string `json:"tcpTx,omitempty"`
-	UDPRx         string `json:"udpRx,omitempty"`
-	UDPTx         string `json:"udpTx,omitempty"`
+	Name          string            `json:"name"`
+	Mode          string            `json:"mode"`
+	Status        string            `json:"status"`
+	TunnelAddress string            `json:"tunnelAddress"`
+	TunnelPort    string            `json:"tunnelPort"`
+	TargetAddress string            `json:"targetAddress"`
+	TargetPort    string            `json:"targetPort"`
+	TLSMode       string            `json:"tlsMode"`
+	CertPath      string            `json:"certPath,omitempty"`
+	KeyPath       string            `json:"keyPath,omitempty"`
+	LogLevel      string            `json:"logLevel"`
+	CommandLine   string            `json:"commandLine"`
+	InstanceID    string            `json:"instanceId,omitempty"`
+	TCPRx         string            `json:"tcpRx,omitempty"`
+	TCPTx         string            `json:"tcpTx,omitempty"`
+	UDPRx         string            `json:"udpRx,omitempty"`
+	UDPTx         string            `json:"udpTx,omitempty"`
+	ExtraParams   map[string]string `json:"extraParams,omitempty"`
+	Labels        labels.Set        `json:"labels,omitempty"`
 }
 
 // ---------- 导出 ----------
@@ -61,9 +69,9 @@ func (h *DataHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 查询端点
-	rows, err := h.db.Query(`SELECT id, name, url, apiPath, apiKey, status, color FROM "Endpoint" ORDER BY id`)
+	rows, err := h.db.Query(`SELECT id, name, url, apiPath, apiKey, status, color, labels FROM "Endpoint" ORDER BY id`)
 	if err != nil {
-		log.Errorf("export query endpoints: %v", err)
+		log.Ctx(r.Context()).Errorf("export query endpoints: %v", err)
 		http.Error(w, "export failed", http.StatusInternalServerError)
 		return
 	}
@@ -73,18 +81,20 @@ func (h *DataHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var epID int64
 		var ep EndpointExport
-		if err := rows.Scan(&epID, &ep.Name, &ep.URL, &ep.APIPath, &ep.APIKey, &ep.Status, &ep.Color); err != nil {
+		var epLabels sql.NullString
+		if err := rows.Scan(&epID, &ep.Name, &ep.URL, &ep.APIPath, &ep.APIKey, &ep.Status, &ep.Color, &epLabels); err != nil {
 			continue
 		}
+		ep.Labels = labels.Decode(epLabels.String)
 		// 查询该端点隧道
-		tRows, err := h.db.Query(`SELECT name, mode, status, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx FROM "Tunnel" WHERE endpointId = ?`, epID)
+		tRows, err := h.db.Query(`SELECT name, mode, status, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, extraParams, labels FROM "Tunnel" WHERE endpointId = ?`, epID)
 		if err == nil {
 			for tRows.Next() {
 				var t TunnelExport
 				var tcpRx, tcpTx, udpRx, udpTx sql.NullInt64
 				var instanceNS sql.NullString
-				var certNS, keyNS sql.NullString
-				if err := tRows.Scan(&t.Name, &t.Mode, &t.Status, &t.TunnelAddress, &t.TunnelPort, &t.TargetAddress, &t.TargetPort, &t.TLSMode, &certNS, &keyNS, &t.LogLevel, &t.CommandLine, &instanceNS, &tcpRx, &tcpTx, &udpRx, &udpTx); err == nil {
+				var certNS, keyNS, extraNS, labelsNS sql.NullString
+				if err := tRows.Scan(&t.Name, &t.Mode, &t.Status, &t.TunnelAddress, &t.TunnelPort, &t.TargetAddress, &t.TargetPort, &t.TLSMode, &certNS, &keyNS, &t.LogLevel, &t.CommandLine, &instanceNS, &tcpRx, &tcpTx, &udpRx, &udpTx, &extraNS, &labelsNS); err == nil {
 					if certNS.Valid {
 						t.CertPath = certNS.String
 					}
@@ -106,6 +116,8 @@ func (h *DataHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
 					if udpTx.Valid {
 						t.UDPTx = fmt.Sprintf("%d", udpTx.Int64)
 					}
+					t.ExtraParams = nodepassurl.DecodeExtra(extraNS.String)
+					t.Labels = labels.Decode(labelsNS.String)
 					ep.Tunnels = append(ep.Tunnels, t)
 				}
 			}
@@ -128,6 +140,31 @@ func (h *DataHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
 }
 
 // ---------- 导入 ----------
+
+// portConflicts 导入前检查各端点内隧道的端口冲突以及全局端口范围限制（已存在的端点会被跳过，不检查）
+func (h *DataHandler) portConflicts(endpoints []EndpointExport) []string {
+	var conflicts []string
+	for _, ep := range endpoints {
+		var exists bool
+		if err := h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Endpoint" WHERE url = ? AND apiPath = ?)`, ep.URL, ep.APIPath).Scan(&exists); err != nil || exists {
+			continue
+		}
+		pool := h.tunnels.GlobalPortPool()
+		for _, t := range ep.Tunnels {
+			port, err := strconv.Atoi(strings.TrimSpace(t.TunnelPort))
+			if err != nil || port <= 0 || !tunnel.ListensLocally(tunnel.TunnelMode(t.Mode), t.TunnelAddress) {
+				continue
+			}
+			if perr := pool.Claim(port, t.Name); perr != nil {
+				conflicts = append(conflicts, fmt.Sprintf("%s / %s: %v", ep.Name, t.Name, perr))
+			}
+		}
+	}
+	return conflicts
+}
+
+// HandleImport POST /api/data/import?strict=true
+// 导入前预检端口冲突：strict 为 true 时存在冲突则拒绝导入，否则照常导入并在 portConflicts 中返回
 func (h *DataHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -146,6 +183,18 @@ func (h *DataHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	conflicts := h.portConflicts(importData.Data.Endpoints)
+	if strict, _ := strconv.ParseBool(r.URL.Query().Get("strict")); strict && len(conflicts) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":       false,
+			"error":         "导入数据存在端口冲突",
+			"portConflicts": conflicts,
+		})
+		return
+	}
+
 	var skippedEndpoints int
 	var importedTunnels int
 
@@ -163,14 +212,14 @@ func (h *DataHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
 			skippedEndpoints++
 			continue
 		}
-		res, err := tx.Exec(`INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, tunnelCount, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`, ep.Name, ep.URL, ep.APIPath, ep.APIKey, ep.Status, ep.Color)
+		res, err := tx.Exec(`INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, labels, tunnelCount, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`, ep.Name, ep.URL, ep.APIPath, ep.APIKey, ep.Status, ep.Color, labels.Encode(ep.Labels))
 		if err != nil {
 			continue
 		}
 		epID, _ := res.LastInsertId()
 		for _, t := range ep.Tunnels {
-			_, _ = tx.Exec(`INSERT INTO "Tunnel" (name, mode, status, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, endpointId, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
-				t.Name, t.Mode, t.Status, t.TunnelAddress, t.TunnelPort, t.TargetAddress, t.TargetPort, t.TLSMode, t.CertPath, t.KeyPath, t.LogLevel, t.CommandLine, t.InstanceID, t.TCPRx, t.TCPTx, t.UDPRx, t.UDPTx, epID)
+			_, _ = tx.Exec(`INSERT INTO "Tunnel" (name, mode, status, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, extraParams, labels, endpointId, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+				t.Name, t.Mode, t.Status, t.TunnelAddress, t.TunnelPort, t.TargetAddress, t.TargetPort, t.TLSMode, t.CertPath, t.KeyPath, t.LogLevel, t.CommandLine, t.InstanceID, t.TCPRx, t.TCPTx, t.UDPRx, t.UDPTx, nodepassurl.EncodeExtra(t.ExtraParams), labels.Encode(t.Labels), epID)
 			importedTunnels++
 		}
 	}
@@ -187,5 +236,6 @@ func (h *DataHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
 		"message":          "数据导入成功",
 		"skippedEndpoints": skippedEndpoints,
 		"tunnels":          importedTunnels,
+		"portConflicts":    conflicts,
 	})
 }
@@ -1,7 +1,6 @@
 package api
 
 import (
-	log "NodePassDash/internal/log"
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
@@ -13,8 +12,13 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"NodePassDash/internal/config"
 	"NodePassDash/internal/endpoint"
-	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/eventbus"
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/pagination"
+	"NodePassDash/internal/reconcile"
+	"NodePassDash/internal/retention"
 	"NodePassDash/internal/sse"
 	"strings"
 )
@@ -23,13 +27,17 @@ import (
 type EndpointHandler struct {
 	endpointService *endpoint.Service
 	sseManager      *sse.Manager
+	bus             *eventbus.Bus
+	reconciler      *reconcile.Reconciler
 }
 
-// NewEndpointHandler 创建端点处理器实例
-func NewEndpointHandler(endpointService *endpoint.Service, mgr *sse.Manager) *EndpointHandler {
+// NewEndpointHandler 创建端点处理器实例，reconciler 用于手动刷新隧道
+func NewEndpointHandler(endpointService *endpoint.Service, mgr *sse.Manager, bus *eventbus.Bus, reconciler *reconcile.Reconciler) *EndpointHandler {
 	return &EndpointHandler{
 		endpointService: endpointService,
 		sseManager:      mgr,
+		bus:             bus,
+		reconciler:      reconciler,
 	}
 }
 
@@ -40,9 +48,33 @@ func (h *EndpointHandler) HandleGetEndpoints(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	endpoints, err := h.endpointService.GetEndpoints()
+	q := r.URL.Query()
+	query := endpoint.ListQuery{
+		Status: q.Get("status"),
+		Search: strings.TrimSpace(q.Get("search")),
+	}
+	var err error
+	query.Params, err = pagination.ParseParams(q)
+	if err == nil {
+		// 标签选择器，如 ?selector=region=hk
+		query.Labels, err = labels.Parse(q.Get("selector"))
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(endpoint.EndpointResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	res, err := h.endpointService.ListEndpoints(query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if pagination.IsInvalid(err) {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(endpoint.EndpointResponse{
 			Success: false,
 			Error:   "获取端点列表失败: " + err.Error(),
@@ -50,10 +82,23 @@ func (h *EndpointHandler) HandleGetEndpoints(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if endpoints == nil {
-		endpoints = []endpoint.EndpointWithStats{}
+	if res.Endpoints == nil {
+		res.Endpoints = []endpoint.EndpointWithStats{}
 	}
-	json.NewEncoder(w).Encode(endpoints)
+	// 未分页时保持原有的数组格式
+	if !query.Paged() {
+		json.NewEncoder(w).Encode(res.Endpoints)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"endpoints":  res.Endpoints,
+		"total":      res.Total,
+		"page":       res.Page,
+		"size":       res.Size,
+		"totalPages": res.TotalPages,
+		"nextCursor": res.NextCursor,
+	})
 }
 
 // HandleCreateEndpoint 创建新端点
@@ -96,9 +141,9 @@ func (h *EndpointHandler) HandleCreateEndpoint(w http.ResponseWriter, r *http.Re
 	// 创建成功后，异步启动 SSE 监听
 	if h.sseManager != nil && newEndpoint != nil {
 		go func(ep *endpoint.Endpoint) {
-			log.Infof("[Master-%v] 创建成功，准备启动 SSE 监听", ep.ID)
+			log.Ctx(r.Context()).Infof("[Master-%v] 创建成功，准备启动 SSE 监听", ep.ID)
 			if err := h.sseManager.ConnectEndpoint(ep.ID, ep.URL, ep.APIPath, ep.APIKey); err != nil {
-				log.Errorf("[Master-%v] 启动 SSE 监听失败: %v", ep.ID, err)
+				log.Ctx(r.Context()).Errorf("[Master-%v] 启动 SSE 监听失败: %v", ep.ID, err)
 			}
 		}(newEndpoint)
 	}
@@ -130,10 +175,11 @@ func (h *EndpointHandler) HandleUpdateEndpoint(w http.ResponseWriter, r *http.Re
 	}
 
 	var body struct {
-		Name    string `json:"name"`
-		URL     string `json:"url"`
-		APIPath string `json:"apiPath"`
-		APIKey  string `json:"apiKey"`
+		Name    string     `json:"name"`
+		URL     string     `json:"url"`
+		APIPath string     `json:"apiPath"`
+		APIKey  string     `json:"apiKey"`
+		Labels  labels.Set `json:"labels"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -151,6 +197,7 @@ func (h *EndpointHandler) HandleUpdateEndpoint(w http.ResponseWriter, r *http.Re
 		URL:     body.URL,
 		APIPath: body.APIPath,
 		APIKey:  body.APIKey,
+		Labels:  body.Labels,
 	}
 
 	updatedEndpoint, err := h.endpointService.UpdateEndpoint(req)
@@ -191,9 +238,9 @@ func (h *EndpointHandler) HandleDeleteEndpoint(w http.ResponseWriter, r *http.Re
 
 	// 如果存在 SSE 监听，先断开
 	if h.sseManager != nil {
-		log.Infof("[Master-%v] 删除端点前，先断开 SSE 监听", id)
+		log.Ctx(r.Context()).Infof("[Master-%v] 删除端点前，先断开 SSE 监听", id)
 		h.sseManager.DisconnectEndpoint(id)
-		log.Infof("[Master-%v] 已断开 SSE 监听", id)
+		log.Ctx(r.Context()).Infof("[Master-%v] 已断开 SSE 监听", id)
 	}
 
 	if err := h.endpointService.DeleteEndpoint(id); err != nil {
@@ -205,7 +252,7 @@ func (h *EndpointHandler) HandleDeleteEndpoint(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	log.Infof("[Master-%v] 端点及其隧道已删除", id)
+	log.Ctx(r.Context()).Infof("[Master-%v] 端点及其隧道已删除", id)
 
 	json.NewEncoder(w).Encode(endpoint.EndpointResponse{
 		Success: true,
@@ -287,9 +334,9 @@ func (h *EndpointHandler) HandlePatchEndpoint(w http.ResponseWriter, r *http.Req
 			go func(eid int64) {
 				ep, err := h.endpointService.GetEndpointByID(eid)
 				if err == nil {
-					log.Infof("[Master-%v] 手动重连端点，启动 SSE", eid)
+					log.Ctx(r.Context()).Infof("[Master-%v] 手动重连端点，启动 SSE", eid)
 					if err := h.sseManager.ConnectEndpoint(eid, ep.URL, ep.APIPath, ep.APIKey); err != nil {
-						log.Errorf("[Master-%v] 手动重连端点失败: %v", eid, err)
+						log.Ctx(r.Context()).Errorf("[Master-%v] 手动重连端点失败: %v", eid, err)
 					}
 				}
 			}(id)
@@ -298,7 +345,7 @@ func (h *EndpointHandler) HandlePatchEndpoint(w http.ResponseWriter, r *http.Req
 	case "disconnect":
 		if h.sseManager != nil {
 			go func(eid int64) {
-				log.Infof("[Master-%v] 手动断开端点 SSE", eid)
+				log.Ctx(r.Context()).Infof("[Master-%v] 手动断开端点 SSE", eid)
 				h.sseManager.DisconnectEndpoint(eid)
 
 				// 更新端点状态为 OFFLINE
@@ -405,6 +452,7 @@ func (h *EndpointHandler) HandleTestEndpoint(w http.ResponseWriter, r *http.Requ
 }
 
 // HandleEndpointStatus GET /api/endpoints/status (SSE)
+// 连接建立时先推送一次完整端点列表，之后仅推送事件总线中的端点状态变更
 func (h *EndpointHandler) HandleEndpointStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -416,33 +464,48 @@ func (h *EndpointHandler) HandleEndpointStatus(w http.ResponseWriter, r *http.Re
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
+	if h.bus == nil {
+		http.Error(w, "Event bus unavailable", http.StatusServiceUnavailable)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	send := func() {
-		endpoints, err := h.endpointService.GetEndpoints()
-		if err != nil {
-			return
-		}
+	// 先订阅再发送快照，避免两者之间的变更丢失
+	events, cancel := h.bus.Subscribe(eventbus.TopicEndpointState, 64)
+	defer cancel()
+
+	endpoints, err := h.endpointService.GetEndpoints()
+	if err == nil {
 		data, _ := json.Marshal(endpoints)
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
 	}
 
-	send()
-
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	// 心跳仅用于保持连接，不查询数据库
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
 
 	notify := r.Context().Done()
 	for {
 		select {
 		case <-notify:
 			return
-		case <-ticker.C:
-			send()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev.Data)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
 		}
 	}
 }
@@ -686,7 +749,7 @@ func (h *EndpointHandler) HandleRecycleList(w http.ResponseWriter, r *http.Reque
 
 	// 查询 TunnelRecycle 表所有字段
 	rows, err := db.Query(`SELECT id, name, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode,
-		certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max
+		certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max, deletedAt, deletedBy
 		FROM "TunnelRecycle" WHERE endpointId = ? ORDER BY id DESC`, endpointID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -715,15 +778,24 @@ func (h *EndpointHandler) HandleRecycleList(w http.ResponseWriter, r *http.Reque
 		UDPTx         int64          `json:"udpTx"`
 		Min           sql.NullInt64  `json:"min"`
 		Max           sql.NullInt64  `json:"max"`
+		DeletedAt     *time.Time     `json:"deletedAt"`
+		DeletedBy     string         `json:"deletedBy"`
 	}
 
 	list := make([]recycleItem, 0)
 	for rows.Next() {
 		var item recycleItem
+		var deletedAt sql.NullTime
+		var deletedBy sql.NullString
 		if err := rows.Scan(
 			&item.ID, &item.Name, &item.Mode, &item.TunnelAddress, &item.TunnelPort, &item.TargetAddress, &item.TargetPort, &item.TLSMode,
 			&item.CertPath, &item.KeyPath, &item.LogLevel, &item.CommandLine, &item.InstanceID, &item.TCPRx, &item.TCPTx, &item.UDPRx, &item.UDPTx, &item.Min, &item.Max,
+			&deletedAt, &deletedBy,
 		); err == nil {
+			if deletedAt.Valid {
+				item.DeletedAt = &deletedAt.Time
+			}
+			item.DeletedBy = deletedBy.String
 			list = append(list, item)
 		}
 	}
@@ -826,237 +898,62 @@ func (h *EndpointHandler) HandleRecycleDelete(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 }
 
-// refreshTunnels 同步指定端点的隧道信息
-func (h *EndpointHandler) refreshTunnels(endpointID int64) error {
-	log.Infof("[API] 刷新端点 %v 的隧道信息", endpointID)
-	// 获取端点信息
-	ep, err := h.endpointService.GetEndpointByID(endpointID)
-	if err != nil {
-		return err
-	}
-
-	// 创建 NodePass 客户端并获取实例列表
-	npClient := nodepass.NewClient(ep.URL, ep.APIPath, ep.APIKey, nil)
-	instances, err := npClient.GetInstances()
-	if err != nil {
-		return err
-	}
+// HandleRecyclePurge 批量清空回收站及相关 SSE
+// DELETE /api/recycle?endpointId=1&olderThan=7d 或 DELETE /api/endpoints/{id}/recycle?olderThan=7d；
+// 未指定主控与 olderThan 时需显式传入 all=true 才会清空全部回收站
+func (h *EndpointHandler) HandleRecyclePurge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
 
-	db := h.endpointService.DB()
-	tx, err := db.Begin()
-	if err != nil {
-		return err
+	var filter retention.RecycleFilter
+	idStr := mux.Vars(r)["id"]
+	if idStr == "" {
+		idStr = q.Get("endpointId")
 	}
-
-	// 记录 NodePass 实例 ID，便于后续删除不存在的隧道
-	instanceIDSet := make(map[string]struct{})
-
-	// Upsert
-	for _, inst := range instances {
-		if inst.Type == "" {
-			continue
-		}
-		instanceIDSet[inst.ID] = struct{}{}
-
-		parsed := parseInstanceURL(inst.URL, inst.Type)
-
-		convPort := func(p string) int {
-			v, _ := strconv.Atoi(p)
-			return v
-		}
-		convInt := func(s string) int {
-			v, _ := strconv.Atoi(s)
-			return v
-		}
-
-		// 检查隧道是否存在
-		var tunnelID int64
-		err := tx.QueryRow(`SELECT id FROM "Tunnel" WHERE instanceId = ?`, inst.ID).Scan(&tunnelID)
-		if err != nil && err != sql.ErrNoRows {
-			tx.Rollback()
-			return err
-		}
-
-		if err == sql.ErrNoRows {
-			// 插入新隧道
-			name := fmt.Sprintf("auto-%s", inst.ID)
-			_, err = tx.Exec(`INSERT INTO "Tunnel" (
-				instanceId, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort,
-				tlsMode, certPath, keyPath, logLevel, commandLine, status, min, max,
-				tcpRx, tcpTx, udpRx, udpTx, createdAt, updatedAt)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
-				inst.ID, name, endpointID, inst.Type,
-				parsed.TunnelAddress, convPort(parsed.TunnelPort), parsed.TargetAddress, convPort(parsed.TargetPort),
-				parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, inst.URL, inst.Status,
-				convInt(parsed.Min), convInt(parsed.Max),
-				inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-			log.Infof("[API] 端点 %d 更新：插入新隧道 %v", endpointID, inst.ID)
-		} else {
-			// 更新已有隧道（除 name 外其它字段全部更新）
-			_, err = tx.Exec(`UPDATE "Tunnel" SET 
-				mode = ?, tunnelAddress = ?, tunnelPort = ?, targetAddress = ?, targetPort = ?,
-				tlsMode = ?, certPath = ?, keyPath = ?, logLevel = ?, commandLine = ?, status = ?,
-				min = ?, max = ?, tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ?, updatedAt = CURRENT_TIMESTAMP
-				WHERE id = ?`,
-				inst.Type, parsed.TunnelAddress, convPort(parsed.TunnelPort), parsed.TargetAddress, convPort(parsed.TargetPort),
-				parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, inst.URL, inst.Status,
-				convInt(parsed.Min), convInt(parsed.Max), inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, tunnelID)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-			log.Infof("[API] 端点 %d 更新：更新隧道信息 %v", endpointID, inst.ID)
+	if idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的端点ID"})
+			return
 		}
+		filter.EndpointID = id
 	}
-
-	// 删除已不存在的隧道
-	rows, err := tx.Query(`SELECT id, instanceId FROM "Tunnel" WHERE endpointId = ?`, endpointID)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id int64
-		var iid string
-		if err := rows.Scan(&id, &iid); err == nil {
-			if _, ok := instanceIDSet[iid]; !ok {
-				if _, err := tx.Exec(`DELETE FROM "Tunnel" WHERE id = ?`, id); err != nil {
-					tx.Rollback()
-					return err
-				}
-				log.Infof("[API] 端点 %d 更新：删除隧道 %v", endpointID, id)
-			}
+	if v := q.Get("olderThan"); v != "" {
+		d, err := config.ParseDuration(v)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "olderThan 无效，示例: 7d、12h"})
+			return
 		}
+		filter.Before = time.Now().Add(-d)
 	}
-
-	// 更新端点隧道数量
-	_, _ = tx.Exec(`UPDATE "Endpoint" SET tunnelCount = (SELECT COUNT(*) FROM "Tunnel" WHERE endpointId = ?) WHERE id = ?`, endpointID, endpointID)
-	log.Infof("[API] 端点 %d 更新：更新隧道数量", endpointID)
-	return tx.Commit()
-}
-
-// parseInstanceURL 解析隧道 URL，逻辑与 tunnel 包保持一致（简化复制）
-func parseInstanceURL(raw, mode string) struct {
-	TunnelAddress string
-	TunnelPort    string
-	TargetAddress string
-	TargetPort    string
-	TLSMode       string
-	LogLevel      string
-	CertPath      string
-	KeyPath       string
-	Min           string
-	Max           string
-} {
-	type parsedURL struct {
-		TunnelAddress string
-		TunnelPort    string
-		TargetAddress string
-		TargetPort    string
-		TLSMode       string
-		LogLevel      string
-		CertPath      string
-		KeyPath       string
-		Min           string
-		Max           string
-	}
-
-	res := parsedURL{TLSMode: "inherit", LogLevel: "inherit"}
-
-	if raw == "" {
-		return res
-	}
-
-	// 去协议
-	if idx := strings.Index(raw, "://"); idx != -1 {
-		raw = raw[idx+3:]
-	}
-
-	// query 部分
-	var query string
-	if qIdx := strings.Index(raw, "?"); qIdx != -1 {
-		query = raw[qIdx+1:]
-		raw = raw[:qIdx]
-	}
-
-	// host 与 path
-	var hostPart, pathPart string
-	if pIdx := strings.Index(raw, "/"); pIdx != -1 {
-		hostPart = raw[:pIdx]
-		pathPart = raw[pIdx+1:]
-	} else {
-		hostPart = raw
-	}
-
-	if hostPart != "" {
-		if strings.Contains(hostPart, ":") {
-			parts := strings.SplitN(hostPart, ":", 2)
-			res.TunnelAddress = parts[0]
-			res.TunnelPort = parts[1]
-		} else {
-			if _, err := strconv.Atoi(hostPart); err == nil {
-				res.TunnelPort = hostPart
-			} else {
-				res.TunnelAddress = hostPart
-			}
-		}
+	all := strings.ToLower(q.Get("all"))
+	if filter.EndpointID == 0 && filter.Before.IsZero() && all != "1" && all != "true" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "请指定 endpointId、olderThan，或使用 all=true 清空全部回收站"})
+		return
 	}
 
-	if pathPart != "" {
-		if strings.Contains(pathPart, ":") {
-			parts := strings.SplitN(pathPart, ":", 2)
-			res.TargetAddress = parts[0]
-			res.TargetPort = parts[1]
-		} else {
-			if _, err := strconv.Atoi(pathPart); err == nil {
-				res.TargetPort = pathPart
-			} else {
-				res.TargetAddress = pathPart
-			}
-		}
+	n, err := retention.PurgeRecycle(r.Context(), h.endpointService.DB(), filter)
+	if err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 清空回收站失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error(), "deleted": n})
+		return
 	}
+	log.Ctx(r.Context()).Infof("[API] 清空回收站: endpointId=%d olderThan=%s, 删除 %d 条", filter.EndpointID, q.Get("olderThan"), n)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "deleted": n})
+}
 
-	if query != "" {
-		for _, kv := range strings.Split(query, "&") {
-			if kv == "" {
-				continue
-			}
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			key, val := parts[0], parts[1]
-			switch key {
-			case "tls":
-				if mode == "server" {
-					switch val {
-					case "0":
-						res.TLSMode = "mode0"
-					case "1":
-						res.TLSMode = "mode1"
-					case "2":
-						res.TLSMode = "mode2"
-					}
-				}
-			case "log":
-				res.LogLevel = strings.ToLower(val)
-			case "crt":
-				res.CertPath = val
-			case "key":
-				res.KeyPath = val
-			case "min":
-				res.Min = val
-			case "max":
-				res.Max = val
-			}
-		}
+// refreshTunnels 同步指定端点的隧道信息：按主控修正本地记录并接管未记录的实例，
+// 主控上已不存在的隧道按对账配置处理（默认标记为 missing，不再直接删除）
+func (h *EndpointHandler) refreshTunnels(endpointID int64) error {
+	log.Infof("[API] 刷新端点 %v 的隧道信息", endpointID)
+	rep, err := h.reconciler.ReconcileEndpoint(endpointID, reconcile.Options{Unknown: reconcile.UnknownAdopt})
+	if err != nil {
+		return err
 	}
-
-	return res
+	log.Infof("[API] 端点 %d 刷新完成: %v", endpointID, rep.Summary)
+	return nil
 }
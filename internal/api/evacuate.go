@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"NodePassDash/internal/evacuate"
+	"NodePassDash/internal/eventbus"
+
+	"github.com/gorilla/mux"
+)
+
+// EvacuateHandler 主控撤离处理器
+type EvacuateHandler struct {
+	service *evacuate.Service
+	bus     *eventbus.Bus
+}
+
+// NewEvacuateHandler 创建主控撤离处理器实例
+func NewEvacuateHandler(service *evacuate.Service, bus *eventbus.Bus) *EvacuateHandler {
+	return &EvacuateHandler{service: service, bus: bus}
+}
+
+// endpointID 解析路径中的端点 ID，失败时直接写入错误响应
+func (h *EvacuateHandler) endpointID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的端点ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeOptions 解析撤离选项，失败时直接写入错误响应
+func (h *EvacuateHandler) decodeOptions(w http.ResponseWriter, r *http.Request) (evacuate.Options, bool) {
+	var opts evacuate.Options
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return opts, false
+	}
+	opts.Actor = requestUser(r)
+	return opts, true
+}
+
+// HandlePlan POST /api/endpoints/{id}/evacuate/plan
+// 请求体与 HandleStart 相同，仅返回迁移计划（端口调整、证书提示、待更新的 client 隧道）
+func (h *EvacuateHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := h.decodeOptions(w, r)
+	if !ok {
+		return
+	}
+	plan, err := h.service.Plan(id, opts)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"plan":    plan,
+	})
+}
+
+// HandleStart POST /api/endpoints/{id}/evacuate
+// 请求体 {"targetId": 2, "targetAddress": "可选", "sourceAddress": "可选", "recycle": true, "verifyTimeout": 15, "keepConnected": false}
+// 任务在后台执行，进度通过 GET /api/endpoints/{id}/evacuate 或 /evacuate/events 获取
+func (h *EvacuateHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := h.decodeOptions(w, r)
+	if !ok {
+		return
+	}
+	job, err := h.service.Start(id, opts)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, evacuate.ErrJobRunning) {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 开始撤离主控 %d => %d", id, opts.TargetID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "撤离任务已开始",
+		"job":     job,
+	})
+}
+
+// HandleStatus GET /api/endpoints/{id}/evacuate
+// 返回主控最近一次撤离任务的进度
+func (h *EvacuateHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+	job := h.service.Job(id)
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "该主控没有撤离任务",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// HandleEvents GET /api/endpoints/{id}/evacuate/events (SSE)
+// 连接建立时先推送当前任务快照，之后推送该主控撤离任务的每次进度变化，任务结束后关闭
+func (h *EvacuateHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "无效的端点ID", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	if h.bus == nil {
+		http.Error(w, "Event bus unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// 先订阅再发送快照，避免两者之间的变更丢失
+	events, cancel := h.bus.Subscribe(eventbus.TopicEvacuation, 64)
+	defer cancel()
+
+	send := func(job *evacuate.Job) bool {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return true
+		}
+		fmt.Fprintf(w, "event: evacuation\ndata: %s\n\n", data)
+		flusher.Flush()
+		return job.Status == evacuate.JobRunning
+	}
+	if job := h.service.Job(id); job != nil && !send(job) {
+		return
+	}
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	notify := r.Context().Done()
+	for {
+		select {
+		case <-notify:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			job, ok := ev.Data.(*evacuate.Job)
+			if !ok || job.SourceID != id {
+				continue
+			}
+			if !send(job) {
+				return
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
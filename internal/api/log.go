@@ -0,0 +1,6 @@
+package api
+
+import applog "NodePassDash/internal/log"
+
+// log API 子系统日志，级别可单独配置
+var log = applog.For(applog.SubsystemAPI)
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/auth"
+	applog "NodePassDash/internal/log"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// requestIDHeader 请求 ID 头，客户端传入时沿用，否则自动生成
+const requestIDHeader = "X-Request-ID"
+
+// statusRecorder 记录响应状态码，同时保留 Flush 能力以支持 SSE 推流
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requestLogMiddleware 为每个请求生成请求 ID，并将请求 ID、用户与端点 ID 写入 context，
+// 处理器通过 log.Ctx(r.Context()) 输出的日志会自动带上这些字段
+func requestLogMiddleware(authService *auth.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(requestIDHeader)
+			if requestID == "" {
+				requestID = uuid.New().String()
+			}
+			w.Header().Set(requestIDHeader, requestID)
+
+			fields := []interface{}{applog.FieldRequestID, requestID}
+			if cookie, err := r.Cookie("session"); err == nil && authService != nil {
+				// GetSession 命中缓存时不检查过期，需先校验会话是否仍然有效
+				if session, ok := authService.GetSession(cookie.Value); ok && authService.ValidateSession(cookie.Value) {
+					fields = append(fields, applog.FieldUser, session.Username)
+				}
+			}
+			if endpointID := requestEndpointID(r); endpointID != "" {
+				fields = append(fields, applog.FieldEndpointID, endpointID)
+			}
+			ctx := applog.NewContext(r.Context(), fields...)
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			log.Ctx(ctx).Debug("请求完成",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"duration", time.Since(start).String(),
+			)
+		})
+	}
+}
+
+// requestUser 返回当前请求的登录用户名，未登录时为空
+func requestUser(r *http.Request) string {
+	user, _ := applog.FieldsFromContext(r.Context())[applog.FieldUser].(string)
+	return user
+}
+
+// requireUser 要求请求已登录，未登录时返回 401；需配合 requestLogMiddleware 使用
+func requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requestUser(r) == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "未登录",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestEndpointID 从路由参数或查询参数中提取端点 ID
+func requestEndpointID(r *http.Request) string {
+	vars := mux.Vars(r)
+	if id := vars["endpointId"]; id != "" {
+		return id
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil && strings.HasPrefix(tpl, "/api/endpoints/{id}") {
+			return vars["id"]
+		}
+	}
+	return r.URL.Query().Get("endpointId")
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"NodePassDash/internal/tunnel"
+
+	"github.com/gorilla/mux"
+)
+
+// writePairError 按错误类型写入隧道对操作的错误响应
+func writePairError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, tunnel.ErrPairNotFound) {
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// pairID 解析路径中的隧道对 ID，失败时直接写入错误响应
+func pairID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的隧道对ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleListPairs GET /api/tunnel-pairs
+func (h *TunnelHandler) HandleListPairs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	pairs, err := h.tunnelService.ListPairs()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "获取隧道对列表失败: " + err.Error(),
+		})
+		return
+	}
+	if pairs == nil {
+		pairs = []tunnel.Pair{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"pairs":   pairs,
+	})
+}
+
+// HandleGetPair GET /api/tunnel-pairs/{id}
+func (h *TunnelHandler) HandleGetPair(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := pairID(w, r)
+	if !ok {
+		return
+	}
+	p, err := h.tunnelService.GetPair(id)
+	if err != nil {
+		writePairError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"pair":    p,
+	})
+}
+
+// HandleCreatePair POST /api/tunnel-pairs
+// 将已有的 server 与 client 隧道关联为隧道对
+func (h *TunnelHandler) HandleCreatePair(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req tunnel.CreatePairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的请求数据",
+		})
+		return
+	}
+	p, err := h.tunnelService.CreatePair(req)
+	if err != nil {
+		writePairError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"pair":    p,
+	})
+}
+
+// HandlePatchPair PATCH /api/tunnel-pairs/{id}
+// 请求体 {"action": "start|stop|restart|rename", "name": "新名称"}，操作同时作用于两端隧道
+func (h *TunnelHandler) HandlePatchPair(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := pairID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Action string `json:"action"`
+		Name   string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的请求数据",
+		})
+		return
+	}
+
+	var err error
+	var message string
+	switch req.Action {
+	case "start", "stop", "restart":
+		err = h.tunnelService.ControlPair(id, req.Action)
+		message = "隧道对" + req.Action + "成功"
+	case "rename":
+		err = h.tunnelService.RenamePair(id, req.Name, requestUser(r))
+		message = "隧道对重命名成功"
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的操作类型，支持: start, stop, restart, rename",
+		})
+		return
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 隧道对 %d %s 失败: %v", id, req.Action, err)
+		writePairError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		Success: true,
+		Message: message,
+	})
+}
+
+// HandleDeletePair DELETE /api/tunnel-pairs/{id}?recycle=1
+// 删除隧道对及两端隧道
+func (h *TunnelHandler) HandleDeletePair(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := pairID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query().Get("recycle")
+	recycle := q == "1" || strings.ToLower(q) == "true"
+	if err := h.tunnelService.DeletePair(id, recycle, requestUser(r)); err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 删除隧道对 %d 失败: %v", id, err)
+		writePairError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		Success: true,
+		Message: "隧道对已删除",
+	})
+}
+
+// HandleUnlinkPair POST /api/tunnel-pairs/{id}/unlink
+// 解除关联，保留两端隧道
+func (h *TunnelHandler) HandleUnlinkPair(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := pairID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.tunnelService.UnlinkPair(id); err != nil {
+		writePairError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		Success: true,
+		Message: "已解除隧道对关联",
+	})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/tunnel"
+
+	"github.com/gorilla/mux"
+)
+
+// maxSuggestPorts 单次建议端口数量上限
+const maxSuggestPorts = 100
+
+// tunnelErrorStatus 端口不可用返回 409，其余错误返回 400
+func tunnelErrorStatus(err error) int {
+	var perr *tunnel.PortError
+	if errors.As(err, &perr) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// endpointPathID 解析路径中的端点 ID，失败时直接写入错误响应
+func endpointPathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的端点ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// HandlePortInventory GET /api/endpoints/{id}/ports?live=false
+// 返回端点的端口设置、生效的允许 / 保留范围以及被监听的端口；默认同时读取主控上未记录的实例
+func (h *TunnelHandler) HandlePortInventory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := endpointPathID(w, r)
+	if !ok {
+		return
+	}
+	live := true
+	if v, err := strconv.ParseBool(r.URL.Query().Get("live")); err == nil {
+		live = v
+	}
+	inv, err := h.tunnelService.PortInventory(id, live)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"inventory": inv,
+	})
+}
+
+// HandleUpdatePortSettings PUT /api/endpoints/{id}/ports
+// 请求体 {"allowed": "10000-20000", "reserved": "10022,10080"}；null 表示使用全局配置，"" 表示不限制
+func (h *TunnelHandler) HandleUpdatePortSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := endpointPathID(w, r)
+	if !ok {
+		return
+	}
+	var settings tunnel.PortSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据: " + err.Error(),
+		})
+		return
+	}
+	if err := h.tunnelService.SetPortSettings(id, settings); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	settings, policy, err := h.tunnelService.PortPolicy(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 更新端点 %d 端口范围: 允许 %q, 保留 %q", id, policy.Allowed.String(), policy.Reserved.String())
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  "端口范围已更新",
+		"settings": settings,
+		"policy":   policy,
+	})
+}
+
+// HandleSuggestPorts GET /api/endpoints/{id}/ports/suggest?from=20000&count=1
+// 建议端点上可用的隧道端口，from 为空时从允许范围的起点开始
+func (h *TunnelHandler) HandleSuggestPorts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := endpointPathID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	from, err := optionalInt(q.Get("from"))
+	if err != nil || from < 0 || from > 65535 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的起始端口",
+		})
+		return
+	}
+	count, err := optionalInt(q.Get("count"))
+	if err != nil || count < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的数量",
+		})
+		return
+	}
+	if count == 0 {
+		count = 1
+	}
+	if count > maxSuggestPorts {
+		count = maxSuggestPorts
+	}
+
+	ports, err := h.tunnelService.SuggestPorts(id, from, count)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"ports":   ports,
+	})
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/config"
+	"NodePassDash/internal/reconcile"
+
+	"github.com/gorilla/mux"
+)
+
+// ReconcileHandler 主控对账处理器
+type ReconcileHandler struct {
+	reconciler *reconcile.Reconciler
+}
+
+// NewReconcileHandler 创建对账处理器实例
+func NewReconcileHandler(reconciler *reconcile.Reconciler) *ReconcileHandler {
+	return &ReconcileHandler{reconciler: reconciler}
+}
+
+// endpointID 解析路径中的端点 ID，失败时直接写入错误响应
+func (h *ReconcileHandler) endpointID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的端点ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// errIntervalTooShort 对账间隔下限，避免频繁请求主控
+var errIntervalTooShort = errors.New("不能小于 1m")
+
+// HandleListReports GET /api/reconcile/reports
+// 返回各端点最近一次对账报告
+func (h *ReconcileHandler) HandleListReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	cfg := h.reconciler.Config()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"config": map[string]interface{}{
+			"interval": config.Duration(cfg.Interval).String(),
+			"unknown":  cfg.Unknown,
+			"missing":  cfg.Missing,
+		},
+		"reports": h.reconciler.Reports(),
+	})
+}
+
+// HandleGetDrift GET /api/endpoints/{id}/drift?refresh=true
+// 返回端点最近一次对账报告；refresh 为 true 时立即检测差异（不做修改）
+func (h *ReconcileHandler) HandleGetDrift(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+
+	refresh := strings.ToLower(r.URL.Query().Get("refresh"))
+	if refresh == "1" || refresh == "true" {
+		rep, err := h.reconciler.ReconcileEndpoint(id, reconcile.Options{DryRun: true})
+		if rep == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": err == nil,
+			"report":  rep,
+		})
+		return
+	}
+
+	rep, ok := h.reconciler.Report(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "该端点尚未对账",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  rep,
+	})
+}
+
+// HandleReconcile POST /api/endpoints/{id}/reconcile
+// 立即对账，请求体可选 {"unknown": "adopt", "missing": "recreate", "dryRun": false} 覆盖默认策略
+func (h *ReconcileHandler) HandleReconcile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+
+	var opts reconcile.Options
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err.Error() != "EOF" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "无效的请求数据",
+			})
+			return
+		}
+	}
+
+	log.Ctx(r.Context()).Infof("[API] 手动对账端点 %d, unknown=%s, missing=%s, dryRun=%v", id, opts.Unknown, opts.Missing, opts.DryRun)
+	rep, err := h.reconciler.ReconcileEndpoint(id, opts)
+	if rep == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": err == nil,
+		"report":  rep,
+	})
+}
+
+// HandleGetReconcileSettings GET /api/endpoints/{id}/reconcile
+// 返回端点的对账间隔与最近一次对账时间
+func (h *ReconcileHandler) HandleGetReconcileSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+	h.writeSettings(w, id)
+}
+
+// HandleUpdateReconcileSettings PUT /api/endpoints/{id}/reconcile
+// 请求体 {"interval": "10m"}；interval 为 null 表示使用默认间隔，"0" 表示关闭该端点的后台对账
+func (h *ReconcileHandler) HandleUpdateReconcileSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.endpointID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Interval *string `json:"interval"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return
+	}
+
+	var interval *time.Duration
+	if req.Interval != nil {
+		d, err := config.ParseDuration(*req.Interval)
+		if err == nil && d > 0 && d < time.Minute {
+			err = errIntervalTooShort
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "无效的对账间隔: " + err.Error(),
+			})
+			return
+		}
+		interval = &d
+	}
+
+	if err := h.reconciler.SetInterval(id, interval); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if interval != nil {
+		log.Ctx(r.Context()).Infof("[API] 更新端点 %d 对账间隔: %v", id, *interval)
+	} else {
+		log.Ctx(r.Context()).Infof("[API] 端点 %d 对账间隔恢复默认", id)
+	}
+	h.writeSettings(w, id)
+}
+
+func (h *ReconcileHandler) writeSettings(w http.ResponseWriter, id int64) {
+	interval, custom, err := h.reconciler.Interval(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	effective := h.reconciler.Config().Interval
+	var value interface{}
+	if custom {
+		effective = interval
+		value = config.Duration(interval).String()
+	}
+	resp := map[string]interface{}{
+		"success":           true,
+		"interval":          value,
+		"effectiveInterval": config.Duration(effective).String(),
+		"enabled":           effective > 0,
+	}
+	if last := h.reconciler.LastRun(id); !last.IsZero() {
+		resp["lastRun"] = last
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -6,10 +6,20 @@ import (
 	"strings"
 
 	"NodePassDash/internal/auth"
+	"NodePassDash/internal/backup"
+	"NodePassDash/internal/config"
 	"NodePassDash/internal/dashboard"
 	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/evacuate"
+	"NodePassDash/internal/eventbus"
 	"NodePassDash/internal/instance"
+	"NodePassDash/internal/reconcile"
+	"NodePassDash/internal/retention"
+	"NodePassDash/internal/schedule"
+	"NodePassDash/internal/spec"
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/system"
+	"NodePassDash/internal/templates"
 	"NodePassDash/internal/tunnel"
 
 	"github.com/gorilla/mux"
@@ -25,20 +35,30 @@ type Router struct {
 	sseHandler       *SSEHandler
 	dashboardHandler *DashboardHandler
 	dataHandler      *DataHandler
+	systemHandler    *SystemHandler
+	trafficHandler   *TrafficHandler
+	backupHandler    *BackupHandler
+	specHandler      *SpecHandler
+	reconcileHandler *ReconcileHandler
+	templateHandler  *TemplateHandler
+	evacuateHandler  *EvacuateHandler
+	scheduleHandler  *ScheduleHandler
 }
 
-// NewRouter 创建路由器实例
+// NewRouter 创建路由器实例，cfg 为服务配置
 // 如果外部已创建 sseService / sseManager，则传入以复用，避免出现多个实例导致推流失效
-func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Router {
+// bus 为内部事件总线，需与 sseService 使用同一实例；janitor 为事件数据清理任务，可为 nil
+// backupService 为数据库备份服务，可为 nil（备份接口将返回不支持）；reconciler 为主控对账任务；scheduler 为隧道定时任务
+func NewRouter(cfg *config.Config, db *sql.DB, sseService *sse.Service, sseManager *sse.Manager, bus *eventbus.Bus, janitor *retention.Janitor, backupService *backup.Service, reconciler *reconcile.Reconciler, scheduler *schedule.Service) *Router {
 	// 创建路由器（忽略末尾斜杠差异）
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 
 	// 创建（或复用）服务实例
-	authService := auth.NewService(db)
+	authService := auth.NewService(db, cfg.Auth.Options())
 	endpointService := endpoint.NewService(db)
 	instanceService := instance.NewService(db)
-	tunnelService := tunnel.NewService(db)
+	tunnelService := tunnel.NewService(db, cfg.Ports.Options())
 
 	if sseService == nil {
 		panic("sseService is nil")
@@ -46,16 +66,35 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 	if sseManager == nil {
 		panic("sseManager is nil")
 	}
+	if reconciler == nil {
+		panic("reconciler is nil")
+	}
+	if scheduler == nil {
+		panic("scheduler is nil")
+	}
 	dashboardService := dashboard.NewService(db)
+	systemService := system.NewService(db)
 
 	// 创建处理器实例
 	authHandler := NewAuthHandler(authService)
-	endpointHandler := NewEndpointHandler(endpointService, sseManager)
+	endpointHandler := NewEndpointHandler(endpointService, sseManager, bus, reconciler)
 	instanceHandler := NewInstanceHandler(db, instanceService)
 	tunnelHandler := NewTunnelHandler(tunnelService)
 	sseHandler := NewSSEHandler(sseService)
-	dataHandler := NewDataHandler(db, sseManager)
+	dataHandler := NewDataHandler(db, sseManager, tunnelService)
 	dashboardHandler := NewDashboardHandler(dashboardService)
+	systemHandler := NewSystemHandler(systemService, janitor)
+	trafficHandler := NewTrafficHandler(db)
+	backupHandler := NewBackupHandler(backupService)
+	specHandler := NewSpecHandler(spec.NewService(db, tunnelService, spec.DefaultConfig()))
+	reconcileHandler := NewReconcileHandler(reconciler)
+
+	templateService := templates.NewService(db, tunnelService)
+	if err := templateService.EnsureBuiltins(); err != nil {
+		log.Errorf("[Template] 写入内置模板失败: %v", err)
+	}
+	templateHandler := NewTemplateHandler(templateService)
+	evacuateHandler := NewEvacuateHandler(evacuate.NewService(db, tunnelService, sseManager, bus), bus)
 
 	r := &Router{
 		router:           router,
@@ -66,6 +105,14 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 		sseHandler:       sseHandler,
 		dashboardHandler: dashboardHandler,
 		dataHandler:      dataHandler,
+		systemHandler:    systemHandler,
+		trafficHandler:   trafficHandler,
+		backupHandler:    backupHandler,
+		specHandler:      specHandler,
+		reconcileHandler: reconcileHandler,
+		templateHandler:  templateHandler,
+		evacuateHandler:  evacuateHandler,
+		scheduleHandler:  NewScheduleHandler(scheduler),
 	}
 
 	// 注册路由
@@ -73,6 +120,8 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 
 	// 为所有路由添加 CORS 处理
 	r.router.Use(corsMiddleware)
+	// 请求 ID、用户等日志字段
+	r.router.Use(requestLogMiddleware(authService))
 
 	return r
 }
@@ -107,7 +156,28 @@ func (r *Router) registerRoutes() {
 	r.router.HandleFunc("/api/endpoints/{id}/logs/search", r.endpointHandler.HandleSearchEndpointLogs).Methods("GET")
 	r.router.HandleFunc("/api/endpoints/{id}/recycle", r.endpointHandler.HandleRecycleList).Methods("GET")
 	r.router.HandleFunc("/api/endpoints/{id}/recycle/count", r.endpointHandler.HandleRecycleCount).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/recycle", r.endpointHandler.HandleRecyclePurge).Methods("DELETE")
+	r.router.HandleFunc("/api/recycle", r.endpointHandler.HandleRecyclePurge).Methods("DELETE")
 	r.router.HandleFunc("/api/endpoints/{endpointId}/recycle/{recycleId}", r.endpointHandler.HandleRecycleDelete).Methods("DELETE")
+	r.router.HandleFunc("/api/endpoints/{endpointId}/recycle/{recycleId}/restore", r.tunnelHandler.HandleRecycleRestore).Methods("POST")
+
+	// 端口清单与范围
+	r.router.HandleFunc("/api/endpoints/{id}/ports", r.tunnelHandler.HandlePortInventory).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/ports", r.tunnelHandler.HandleUpdatePortSettings).Methods("PUT")
+	r.router.HandleFunc("/api/endpoints/{id}/ports/suggest", r.tunnelHandler.HandleSuggestPorts).Methods("GET")
+
+	// 主控对账相关路由
+	r.router.HandleFunc("/api/reconcile/reports", r.reconcileHandler.HandleListReports).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/drift", r.reconcileHandler.HandleGetDrift).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/reconcile", r.reconcileHandler.HandleReconcile).Methods("POST")
+	r.router.HandleFunc("/api/endpoints/{id}/reconcile", r.reconcileHandler.HandleGetReconcileSettings).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/reconcile", r.reconcileHandler.HandleUpdateReconcileSettings).Methods("PUT")
+
+	// 主控撤离
+	r.router.HandleFunc("/api/endpoints/{id}/evacuate/plan", r.evacuateHandler.HandlePlan).Methods("POST")
+	r.router.HandleFunc("/api/endpoints/{id}/evacuate", r.evacuateHandler.HandleStart).Methods("POST")
+	r.router.HandleFunc("/api/endpoints/{id}/evacuate", r.evacuateHandler.HandleStatus).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/evacuate/events", r.evacuateHandler.HandleEvents).Methods("GET")
 
 	// 实例相关路由
 	r.router.HandleFunc("/api/endpoints/{endpointId}/instances", r.instanceHandler.HandleGetInstances).Methods("GET")
@@ -123,7 +193,8 @@ func (r *Router) registerRoutes() {
 	r.router.HandleFunc("/api/tunnels", r.tunnelHandler.HandleGetTunnels).Methods("GET")
 	r.router.HandleFunc("/api/tunnels", r.tunnelHandler.HandleCreateTunnel).Methods("POST")
 	r.router.HandleFunc("/api/tunnels/quick", r.tunnelHandler.HandleQuickCreateTunnel).Methods("POST")
-	r.router.HandleFunc("/api/tunnels/template", r.tunnelHandler.HandleTemplateCreate).Methods("POST")
+	r.router.HandleFunc("/api/tunnels/template", r.templateHandler.HandleTemplateCreate).Methods("POST")
+	r.router.HandleFunc("/api/tunnels/bulk", r.tunnelHandler.HandleBulkTunnels).Methods("POST")
 	r.router.HandleFunc("/api/tunnels", r.tunnelHandler.HandlePatchTunnels).Methods("PATCH")
 	r.router.HandleFunc("/api/tunnels/{id}", r.tunnelHandler.HandlePatchTunnels).Methods("PATCH")
 	r.router.HandleFunc("/api/tunnels/{id}", r.tunnelHandler.HandleGetTunnels).Methods("GET")
@@ -132,6 +203,43 @@ func (r *Router) registerRoutes() {
 	r.router.HandleFunc("/api/tunnels/{id}/status", r.tunnelHandler.HandleControlTunnel).Methods("PATCH")
 	r.router.HandleFunc("/api/tunnels/{id}/details", r.tunnelHandler.HandleGetTunnelDetails).Methods("GET")
 	r.router.HandleFunc("/api/tunnels/{id}/logs", r.tunnelHandler.HandleTunnelLogs).Methods("GET")
+	r.router.HandleFunc("/api/tunnels/{id}/labels", r.tunnelHandler.HandleSetTunnelLabels).Methods("PUT")
+	r.router.HandleFunc("/api/tunnels/{id}/clone", r.tunnelHandler.HandleCloneTunnel).Methods("POST")
+	r.router.HandleFunc("/api/tunnels/{id}/move", r.tunnelHandler.HandleMoveTunnel).Methods("POST")
+	r.router.HandleFunc("/api/tunnels/{id}/versions", r.tunnelHandler.HandleListVersions).Methods("GET")
+	r.router.HandleFunc("/api/tunnels/{id}/versions/diff", r.tunnelHandler.HandleDiffVersions).Methods("GET")
+	r.router.HandleFunc("/api/tunnels/{id}/versions/{version}/rollback", r.tunnelHandler.HandleRollbackVersion).Methods("POST")
+
+	// 隧道模板
+	r.router.HandleFunc("/api/templates", r.templateHandler.HandleListTemplates).Methods("GET")
+	r.router.HandleFunc("/api/templates", r.templateHandler.HandleCreateTemplate).Methods("POST")
+	r.router.HandleFunc("/api/templates/{id}", r.templateHandler.HandleGetTemplate).Methods("GET")
+	r.router.HandleFunc("/api/templates/{id}", r.templateHandler.HandleUpdateTemplate).Methods("PUT")
+	r.router.HandleFunc("/api/templates/{id}", r.templateHandler.HandleDeleteTemplate).Methods("DELETE")
+	r.router.HandleFunc("/api/templates/{id}/instantiate", r.templateHandler.HandleInstantiateTemplate).Methods("POST")
+
+	// 隧道定时任务
+	r.router.HandleFunc("/api/schedules", r.scheduleHandler.HandleListSchedules).Methods("GET")
+	r.router.HandleFunc("/api/schedules", r.scheduleHandler.HandleCreateSchedule).Methods("POST")
+	r.router.HandleFunc("/api/schedules/{id}", r.scheduleHandler.HandleGetSchedule).Methods("GET")
+	r.router.HandleFunc("/api/schedules/{id}", r.scheduleHandler.HandleUpdateSchedule).Methods("PUT")
+	r.router.HandleFunc("/api/schedules/{id}", r.scheduleHandler.HandleDeleteSchedule).Methods("DELETE")
+	r.router.HandleFunc("/api/schedules/{id}/enable", r.scheduleHandler.HandleEnableSchedule).Methods("POST")
+	r.router.HandleFunc("/api/schedules/{id}/disable", r.scheduleHandler.HandleDisableSchedule).Methods("POST")
+	r.router.HandleFunc("/api/schedules/{id}/run", r.scheduleHandler.HandleRunSchedule).Methods("POST")
+	r.router.HandleFunc("/api/schedules/{id}/runs", r.scheduleHandler.HandleListScheduleRuns).Methods("GET")
+
+	// 隧道对
+	r.router.HandleFunc("/api/tunnel-pairs", r.tunnelHandler.HandleListPairs).Methods("GET")
+	r.router.HandleFunc("/api/tunnel-pairs", r.tunnelHandler.HandleCreatePair).Methods("POST")
+	r.router.HandleFunc("/api/tunnel-pairs/{id}", r.tunnelHandler.HandleGetPair).Methods("GET")
+	r.router.HandleFunc("/api/tunnel-pairs/{id}", r.tunnelHandler.HandlePatchPair).Methods("PATCH")
+	r.router.HandleFunc("/api/tunnel-pairs/{id}", r.tunnelHandler.HandleDeletePair).Methods("DELETE")
+	r.router.HandleFunc("/api/tunnel-pairs/{id}/unlink", r.tunnelHandler.HandleUnlinkPair).Methods("POST")
+
+	// 声明式隧道配置
+	r.router.HandleFunc("/api/spec/plan", r.specHandler.HandlePlan).Methods("POST")
+	r.router.HandleFunc("/api/spec/apply", r.specHandler.HandleApply).Methods("POST")
 
 	// 隧道日志相关路由
 	r.router.HandleFunc("/api/dashboard/logs", r.tunnelHandler.HandleGetTunnelLogs).Methods("GET")
@@ -148,9 +256,28 @@ func (r *Router) registerRoutes() {
 	// 仪表盘统计数据
 	r.router.HandleFunc("/api/dashboard/stats", r.dashboardHandler.HandleGetStats).Methods("GET")
 
+	// 流量汇总查询
+	r.router.HandleFunc("/api/traffic/trend", r.trafficHandler.HandleTrend).Methods("GET")
+	r.router.HandleFunc("/api/traffic/top", r.trafficHandler.HandleTopTunnels).Methods("GET")
+
 	// 数据导入导出
 	r.router.HandleFunc("/api/data/export", r.dataHandler.HandleExport).Methods("GET")
 	r.router.HandleFunc("/api/data/import", r.dataHandler.HandleImport).Methods("POST")
+
+	// 系统状态
+	r.router.HandleFunc("/api/system/status", r.systemHandler.HandleGetStatus).Methods("GET")
+	r.router.HandleFunc("/api/system/retention/run", r.systemHandler.HandleRunRetention).Methods("POST")
+	r.router.HandleFunc("/api/system/log-levels", r.systemHandler.HandleGetLogLevels).Methods("GET")
+	r.router.HandleFunc("/api/system/log-levels", requireUser(r.systemHandler.HandleSetLogLevels)).Methods("PUT")
+
+	// 数据库备份与恢复（备份包含会话与密码等敏感数据，需登录）
+	r.router.HandleFunc("/api/system/backups", requireUser(r.backupHandler.HandleListBackups)).Methods("GET")
+	r.router.HandleFunc("/api/system/backups", requireUser(r.backupHandler.HandleCreateBackup)).Methods("POST")
+	r.router.HandleFunc("/api/system/backups/upload", requireUser(r.backupHandler.HandleUploadBackup)).Methods("POST")
+	r.router.HandleFunc("/api/system/backups/restore", requireUser(r.backupHandler.HandleCancelRestore)).Methods("DELETE")
+	r.router.HandleFunc("/api/system/backups/{name}", requireUser(r.backupHandler.HandleDownloadBackup)).Methods("GET")
+	r.router.HandleFunc("/api/system/backups/{name}", requireUser(r.backupHandler.HandleDeleteBackup)).Methods("DELETE")
+	r.router.HandleFunc("/api/system/backups/{name}/restore", requireUser(r.backupHandler.HandleRestoreBackup)).Methods("POST")
 }
 
 // corsMiddleware 允许跨域请求（开发阶段 8080 → 3000）
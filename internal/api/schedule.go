@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/schedule"
+
+	"github.com/gorilla/mux"
+)
+
+// ScheduleHandler 隧道定时任务处理器
+type ScheduleHandler struct {
+	service *schedule.Service
+}
+
+// NewScheduleHandler 创建定时任务处理器实例
+func NewScheduleHandler(service *schedule.Service) *ScheduleHandler {
+	return &ScheduleHandler{service: service}
+}
+
+// writeScheduleError 按错误类型写入响应
+func writeScheduleError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, schedule.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, schedule.ErrRunning):
+		status = http.StatusConflict
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
+
+// scheduleID 解析路径中的定时任务 ID，失败时直接写入错误响应
+func (h *ScheduleHandler) scheduleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的定时任务ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeSchedule 解析请求体中的定时任务，失败时直接写入错误响应
+func (h *ScheduleHandler) decodeSchedule(w http.ResponseWriter, r *http.Request) (schedule.Schedule, bool) {
+	// 未提交 enabled 时默认启用
+	sc := schedule.Schedule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return sc, false
+	}
+	return sc, true
+}
+
+// HandleListSchedules GET /api/schedules
+func (h *ScheduleHandler) HandleListSchedules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	list, err := h.service.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取定时任务失败: " + err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"schedules": list,
+	})
+}
+
+// HandleGetSchedule GET /api/schedules/{id}
+func (h *ScheduleHandler) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	sc, err := h.service.Get(id)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"schedule": sc,
+	})
+}
+
+// HandleCreateSchedule POST /api/schedules
+// 请求体 {"name": "工作时间启动", "expression": "0 9 * * 1-5", "timezone": "Asia/Shanghai",
+// "action": "start", "target": {"ids": [1, 2], "selector": "env=prod"}, "missed": "skip", "enabled": true}
+func (h *ScheduleHandler) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	req, ok := h.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	sc, err := h.service.Create(req, requestUser(r))
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 创建定时任务: %s", sc.Name)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"schedule": sc,
+	})
+}
+
+// HandleUpdateSchedule PUT /api/schedules/{id}
+// 请求体与创建相同，整体替换定时任务配置
+func (h *ScheduleHandler) HandleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := h.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	sc, err := h.service.Update(id, req)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 更新定时任务: %s", sc.Name)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"schedule": sc,
+	})
+}
+
+// HandleDeleteSchedule DELETE /api/schedules/{id}
+func (h *ScheduleHandler) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.Delete(id); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 删除定时任务: %d", id)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "定时任务已删除",
+	})
+}
+
+// HandleEnableSchedule POST /api/schedules/{id}/enable
+func (h *ScheduleHandler) HandleEnableSchedule(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, true)
+}
+
+// HandleDisableSchedule POST /api/schedules/{id}/disable
+func (h *ScheduleHandler) HandleDisableSchedule(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, false)
+}
+
+func (h *ScheduleHandler) setEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	sc, err := h.service.SetEnabled(id, enabled)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 定时任务 %s enabled=%v", sc.Name, enabled)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"schedule": sc,
+	})
+}
+
+// HandleRunSchedule POST /api/schedules/{id}/run
+// 立即执行一次（不论是否启用），同步返回执行记录
+func (h *ScheduleHandler) HandleRunSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 手动执行定时任务: %d", id)
+	run, err := h.service.RunNow(id)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"run":     run,
+	})
+}
+
+// HandleListScheduleRuns GET /api/schedules/{id}/runs?limit=20
+// 返回最近的执行记录（含错过的执行），按时间倒序
+func (h *ScheduleHandler) HandleListScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	limit, err := optionalInt(r.URL.Query().Get("limit"))
+	if err != nil || limit < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的 limit",
+		})
+		return
+	}
+	runs, err := h.service.Runs(id, limit)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"runs":    runs,
+	})
+}
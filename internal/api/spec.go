@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"NodePassDash/internal/spec"
+)
+
+// maxSpecSize 声明式配置的大小上限
+const maxSpecSize = 4 << 20
+
+// SpecHandler 声明式隧道配置（plan / apply）处理器
+type SpecHandler struct {
+	specService *spec.Service
+}
+
+// NewSpecHandler 创建声明式配置处理器实例
+func NewSpecHandler(specService *spec.Service) *SpecHandler {
+	return &SpecHandler{specService: specService}
+}
+
+// readSpec 读取请求体中的 YAML / JSON 配置，失败时直接写入错误响应
+func (h *SpecHandler) readSpec(w http.ResponseWriter, r *http.Request) (*spec.Spec, bool) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxSpecSize))
+	if err == nil && len(strings.TrimSpace(string(data))) == 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "读取配置失败: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	s, err := spec.Parse(data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return s, true
+}
+
+// pruneParam 解析 prune 查询参数
+func pruneParam(r *http.Request) bool {
+	v := strings.ToLower(r.URL.Query().Get("prune"))
+	return v == "1" || v == "true"
+}
+
+// HandlePlan POST /api/spec/plan?prune=true
+// 比较配置与当前隧道的差异，不做任何修改
+func (h *SpecHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s, ok := h.readSpec(w, r)
+	if !ok {
+		return
+	}
+
+	plan, err := h.specService.Plan(s, pruneParam(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"plan":    plan,
+	})
+}
+
+// HandleApply POST /api/spec/apply?prune=true
+// 计算差异并执行，返回每个变更的执行结果
+func (h *SpecHandler) HandleApply(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s, ok := h.readSpec(w, r)
+	if !ok {
+		return
+	}
+
+	log.Ctx(r.Context()).Infof("[API] 应用声明式配置, prune=%v", pruneParam(r))
+	plan, results, err := h.specService.Apply(s, pruneParam(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	success := true
+	for _, res := range results {
+		if !res.Success {
+			success = false
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": success,
+		"plan":    plan,
+		"results": results,
+	})
+}
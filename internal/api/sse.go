@@ -1,7 +1,6 @@
 package api
 
 import (
-	log "NodePassDash/internal/log"
 	"context"
 	"crypto/tls"
 	"encoding/json"
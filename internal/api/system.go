@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	applog "NodePassDash/internal/log"
+	"NodePassDash/internal/retention"
+	"NodePassDash/internal/system"
+)
+
+// SystemHandler 系统状态相关的处理器
+type SystemHandler struct {
+	systemService *system.Service
+	janitor       *retention.Janitor
+}
+
+// NewSystemHandler 创建系统处理器实例
+func NewSystemHandler(systemService *system.Service, janitor *retention.Janitor) *SystemHandler {
+	return &SystemHandler{
+		systemService: systemService,
+		janitor:       janitor,
+	}
+}
+
+// HandleGetStatus GET /api/system/status
+// 返回数据库大小、各表行数以及事件保留策略
+func (h *SystemHandler) HandleGetStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	dbStatus, err := h.systemService.GetDatabaseStatus()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取数据库状态失败: " + err.Error(),
+		})
+		return
+	}
+
+	resp := map[string]interface{}{
+		"success":  true,
+		"database": dbStatus,
+	}
+	if h.janitor != nil {
+		resp["retention"] = map[string]interface{}{
+			"policies": h.janitor.Policies(),
+			"recycle":  h.janitor.RecycleRetention(),
+			"lastRun":  h.janitor.LastRun(),
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleRunRetention POST /api/system/retention/run
+// 立即执行一次事件数据清理
+func (h *SystemHandler) HandleRunRetention(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.janitor == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "清理任务未启用",
+		})
+		return
+	}
+
+	result := h.janitor.RunOnce(r.Context())
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// HandleGetLogLevels GET /api/system/log-levels
+// 返回默认日志级别以及各子系统的生效级别
+func (h *SystemHandler) HandleGetLogLevels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"levels":  applog.GetLevels(),
+	})
+}
+
+// HandleSetLogLevels PUT /api/system/log-levels
+// 运行时调整日志级别，无需重启：
+//
+//	{"level": "info", "subsystems": {"sse": "debug", "api": ""}}
+//
+// 子系统级别为空字符串表示恢复为默认级别；需登录
+func (h *SystemHandler) HandleSetLogLevels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Level      string            `json:"level"`
+		Subsystems map[string]string `json:"subsystems"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return
+	}
+
+	// 先整体校验，避免部分生效
+	if req.Level != "" {
+		if _, err := applog.ParseLevel(req.Level); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+	for sub, level := range req.Subsystems {
+		valid := false
+		for _, name := range applog.Subsystems {
+			valid = valid || name == sub
+		}
+		if !valid {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "未知的日志子系统: " + sub,
+			})
+			return
+		}
+		if level == "" {
+			continue
+		}
+		if _, err := applog.ParseLevel(level); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	if req.Level != "" {
+		applog.SetLevel(req.Level)
+	}
+	for sub, level := range req.Subsystems {
+		applog.SetSubsystemLevel(sub, level)
+	}
+	log.Ctx(r.Context()).Infof("[API] 日志级别已调整: %+v", applog.GetLevels().Subsystems)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"levels":  applog.GetLevels(),
+	})
+}
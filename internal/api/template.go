@@ -0,0 +1,365 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/templates"
+	"NodePassDash/internal/tunnel"
+
+	"github.com/gorilla/mux"
+)
+
+// TemplateHandler 隧道模板处理器
+type TemplateHandler struct {
+	templateService *templates.Service
+}
+
+// NewTemplateHandler 创建隧道模板处理器实例
+func NewTemplateHandler(templateService *templates.Service) *TemplateHandler {
+	return &TemplateHandler{templateService: templateService}
+}
+
+// writeTemplateError 按错误类型写入响应
+func writeTemplateError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, templates.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, templates.ErrBuiltin):
+		status = http.StatusForbidden
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
+
+// template 解析路径中的模板 ID 并加载模板，失败时直接写入错误响应
+func (h *TemplateHandler) template(w http.ResponseWriter, r *http.Request) (*templates.Template, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的模板ID",
+		})
+		return nil, false
+	}
+	t, err := h.templateService.Get(id)
+	if err != nil {
+		writeTemplateError(w, err)
+		return nil, false
+	}
+	return t, true
+}
+
+// HandleListTemplates GET /api/templates
+func (h *TemplateHandler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	list, err := h.templateService.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "获取模板列表失败: " + err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []templates.Template{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"templates": list,
+	})
+}
+
+// HandleGetTemplate GET /api/templates/{id}
+func (h *TemplateHandler) HandleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t, ok := h.template(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"template": t,
+	})
+}
+
+// HandleCreateTemplate POST /api/templates
+func (h *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var req templates.Template
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return
+	}
+
+	t, err := h.templateService.Create(req)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 创建隧道模板: %s", t.Name)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"template": t,
+	})
+}
+
+// HandleUpdateTemplate PUT /api/templates/{id}
+func (h *TemplateHandler) HandleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	current, ok := h.template(w, r)
+	if !ok {
+		return
+	}
+
+	var req templates.Template
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return
+	}
+
+	t, err := h.templateService.Update(current.ID, req)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 更新隧道模板: %s", t.Name)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"template": t,
+	})
+}
+
+// HandleDeleteTemplate DELETE /api/templates/{id}
+func (h *TemplateHandler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t, ok := h.template(w, r)
+	if !ok {
+		return
+	}
+	if err := h.templateService.Delete(t.ID); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	log.Ctx(r.Context()).Infof("[API] 删除隧道模板: %s", t.Name)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "模板已删除",
+	})
+}
+
+// HandleInstantiateTemplate POST /api/templates/{id}/instantiate
+// 请求体 {"params": {"listenPort": "10101", ...}, "pairName": "", "dryRun": false}；dryRun 时仅返回渲染结果，
+// ?validate=true 时渲染并预检每条隧道
+func (h *TemplateHandler) HandleInstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t, ok := h.template(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Params   map[string]string `json:"params"`
+		PairName string            `json:"pairName"`
+		DryRun   bool              `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
+		})
+		return
+	}
+
+	if validateOnly(r) {
+		v, err := h.templateService.Validate(t, req.Params)
+		writeValidation(w, v, err)
+		return
+	}
+
+	if req.DryRun {
+		rendered, err := h.templateService.Render(t, req.Params)
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"dryRun":  true,
+			"tunnels": rendered,
+		})
+		return
+	}
+
+	log.Ctx(r.Context()).Infof("[API] 实例化隧道模板: %s", t.Name)
+	inst, err := h.templateService.Instantiate(t, req.Params, req.PairName)
+	if err != nil {
+		resp := map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+		var cerr *tunnel.CreateError
+		if errors.As(err, &cerr) {
+			resp["failedStep"] = cerr.Step
+			resp["rolledBack"] = cerr.RolledBack
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"tunnels": inst.Tunnels,
+		"pair":    inst.Pair,
+	})
+}
+
+// HandleTemplateCreate POST /api/tunnels/template
+// 兼容旧版模板创建接口：按 mode（single / bothway / intranet）实例化对应的内置模板
+// ?validate=true 时仅预检，返回每条隧道的字段错误与警告
+func (h *TemplateHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 定义请求结构体
+	type bound struct {
+		TargetHost string `json:"target_host"`
+		TargetPort int    `json:"target_port"`
+		MasterID   int64  `json:"master_id"`
+		Type       string `json:"type"`
+	}
+	var req struct {
+		Log        string `json:"log"`
+		ListenPort int    `json:"listen_port"`
+		Mode       string `json:"mode"`
+		TLS        int    `json:"tls,omitempty"`
+		CertPath   string `json:"cert_path,omitempty"`
+		KeyPath    string `json:"key_path,omitempty"`
+		Inbounds   *bound `json:"inbounds,omitempty"`
+		Outbounds  *bound `json:"outbounds,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的请求数据",
+		})
+		return
+	}
+
+	log.Ctx(r.Context()).Infof("[API] 模板创建请求: mode=%s, listen_port=%d", req.Mode, req.ListenPort)
+
+	itoa := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	id := func(n int64) string { return strconv.FormatInt(n, 10) }
+	tls := "inherit"
+	if req.TLS > 0 {
+		tls = itoa(req.TLS)
+	}
+
+	var params map[string]string
+	var message string
+	switch req.Mode {
+	case templates.BuiltinSingle:
+		if req.Inbounds == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   "单端模式缺少inbounds配置",
+			})
+			return
+		}
+		params = map[string]string{
+			"entry":      id(req.Inbounds.MasterID),
+			"listenPort": itoa(req.ListenPort),
+			"targetHost": req.Inbounds.TargetHost,
+			"targetPort": itoa(req.Inbounds.TargetPort),
+			"logLevel":   req.Log,
+		}
+		message = "单端转发隧道创建成功"
+
+	case templates.BuiltinBothway, templates.BuiltinIntranet:
+		if req.Inbounds == nil || req.Outbounds == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   "双端或内网穿透模式缺少inbounds或outbounds配置",
+			})
+			return
+		}
+		params = map[string]string{
+			"server":           id(req.Inbounds.MasterID),
+			"client":           id(req.Outbounds.MasterID),
+			"listenPort":       itoa(req.ListenPort),
+			"serverTargetPort": itoa(req.Inbounds.TargetPort),
+			"tls":              tls,
+			"certPath":         req.CertPath,
+			"keyPath":          req.KeyPath,
+			"logLevel":         req.Log,
+		}
+		if req.Mode == templates.BuiltinBothway {
+			params["clientTargetPort"] = itoa(req.Outbounds.TargetPort)
+			message = "双端转发隧道创建成功"
+		} else {
+			params["targetHost"] = req.Outbounds.TargetHost
+			params["targetPort"] = itoa(req.Outbounds.TargetPort)
+			message = "内网穿透隧道创建成功"
+		}
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "不支持的隧道模式: " + req.Mode,
+		})
+		return
+	}
+
+	t, err := h.templateService.GetByName(req.Mode)
+	if err == nil && validateOnly(r) {
+		v, err := h.templateService.Validate(t, params)
+		writeValidation(w, v, err)
+		return
+	}
+	if err == nil {
+		_, err = h.templateService.Instantiate(t, params, "")
+	}
+	if err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 模板创建失败: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		Success: true,
+		Message: message,
+	})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"NodePassDash/internal/traffic"
+)
+
+// TrafficHandler 流量汇总查询相关的处理器
+type TrafficHandler struct {
+	db    *sql.DB
+	store *traffic.Store
+}
+
+// NewTrafficHandler 创建流量处理器实例
+func NewTrafficHandler(db *sql.DB) *TrafficHandler {
+	return &TrafficHandler{
+		db:    db,
+		store: traffic.NewStore(db),
+	}
+}
+
+// HandleTrend GET /api/traffic/trend?hours=24&resolution=hour&endpointId=1&tunnelId=2
+// 返回指定范围内的流量增量时间序列，resolution 缺省时按时间跨度自动选择
+func (h *TrafficHandler) HandleTrend(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+
+	hours := 24
+	if v, err := strconv.Atoi(q.Get("hours")); err == nil && v > 0 {
+		hours = v
+	}
+	span := time.Duration(hours) * time.Hour
+
+	res := traffic.ResolutionFor(span)
+	if v := q.Get("resolution"); v != "" {
+		parsed, ok := traffic.ParseResolution(v)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的 resolution 参数"})
+			return
+		}
+		res = parsed
+	}
+
+	var filter traffic.Filter
+	if v := q.Get("endpointId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的端点ID"})
+			return
+		}
+		filter.EndpointID = id
+	}
+	if v := q.Get("tunnelId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的隧道ID"})
+			return
+		}
+		var instanceID sql.NullString
+		if err := h.db.QueryRow(`SELECT endpointId, instanceId FROM "Tunnel" WHERE id = ?`, id).Scan(&filter.EndpointID, &instanceID); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "隧道不存在"})
+			return
+		}
+		if !instanceID.Valid || instanceID.String == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "resolution": res, "data": []traffic.Point{}})
+			return
+		}
+		filter.InstanceID = instanceID.String
+	}
+
+	now := time.Now()
+	points, err := h.store.Trend(res, now.Add(-span), now, filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	if points == nil {
+		points = make([]traffic.Point, 0)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "resolution": res, "data": points})
+}
+
+// HandleTopTunnels GET /api/traffic/top?hours=24&limit=10&by=total
+func (h *TrafficHandler) HandleTopTunnels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+
+	hours := 24
+	if v, err := strconv.Atoi(q.Get("hours")); err == nil && v > 0 {
+		hours = v
+	}
+	limit := 10
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 100 {
+		limit = v
+	}
+
+	list, err := h.store.TopTunnels(time.Now().Add(-time.Duration(hours)*time.Hour), limit, q.Get("by"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = make([]traffic.TunnelTraffic, 0)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": list})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"NodePassDash/internal/tunnel"
+)
+
+// HandleCloneTunnel POST /api/tunnels/{id}/clone
+// 请求体 {"endpointId": 2, "name": "可选", "tunnelPort": 0, "remapPort": true}
+func (h *TunnelHandler) HandleCloneTunnel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := tunnelPathID(w, r)
+	if !ok {
+		return
+	}
+	var req tunnel.CloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的请求数据",
+		})
+		return
+	}
+	req.Actor = requestUser(r)
+
+	res, err := h.tunnelService.CloneTunnel(id, req)
+	if err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 克隆隧道 %d 失败: %v", id, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "隧道克隆成功",
+		"result":  res,
+	})
+}
+
+// HandleMoveTunnel POST /api/tunnels/{id}/move
+// 请求体 {"endpointId": 2, "tunnelPort": 0, "remapPort": true, "recycle": true, "verifyTimeout": 15}
+func (h *TunnelHandler) HandleMoveTunnel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := tunnelPathID(w, r)
+	if !ok {
+		return
+	}
+	var req tunnel.MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的请求数据",
+		})
+		return
+	}
+	req.Actor = requestUser(r)
+
+	res, err := h.tunnelService.MoveTunnel(id, req)
+	if err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 迁移隧道 %d 失败: %v", id, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "隧道迁移成功",
+		"result":  res,
+	})
+}
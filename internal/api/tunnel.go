@@ -1,11 +1,13 @@
 package api
 
 import (
-	log "NodePassDash/internal/log"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -13,18 +15,24 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/pagination"
+	"NodePassDash/internal/traffic"
 	"NodePassDash/internal/tunnel"
 )
 
 // TunnelHandler 隧道相关的处理器
 type TunnelHandler struct {
 	tunnelService *tunnel.Service
+	trafficStore  *traffic.Store
 }
 
 // NewTunnelHandler 创建隧道处理器实例
 func NewTunnelHandler(tunnelService *tunnel.Service) *TunnelHandler {
 	return &TunnelHandler{
 		tunnelService: tunnelService,
+		trafficStore:  traffic.NewStore(tunnelService.DB()),
 	}
 }
 
@@ -35,9 +43,24 @@ func (h *TunnelHandler) HandleGetTunnels(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tunnels, err := h.tunnelService.GetTunnels()
+	q := r.URL.Query()
+	query, err := parseTunnelListQuery(q)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	res, err := h.tunnelService.ListTunnels(query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if pagination.IsInvalid(err) {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 			Success: false,
 			Error:   "获取隧道列表失败: " + err.Error(),
@@ -45,13 +68,69 @@ func (h *TunnelHandler) HandleGetTunnels(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if tunnels == nil {
-		tunnels = []tunnel.TunnelWithStats{}
+	if res.Tunnels == nil {
+		res.Tunnels = []tunnel.TunnelWithStats{}
+	}
+	// 未分页时保持原有的数组格式
+	if !query.Paged() {
+		json.NewEncoder(w).Encode(res.Tunnels)
+		return
 	}
-	json.NewEncoder(w).Encode(tunnels)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"tunnels":    res.Tunnels,
+		"total":      res.Total,
+		"page":       res.Page,
+		"size":       res.Size,
+		"totalPages": res.TotalPages,
+		"nextCursor": res.NextCursor,
+	})
+}
+
+// parseTunnelListQuery 解析隧道列表的筛选、排序与分页参数：
+// endpointId、mode、status、search、minTraffic、maxTraffic、selector、page、size、cursor、sort、order
+func parseTunnelListQuery(q url.Values) (tunnel.ListQuery, error) {
+	var query tunnel.ListQuery
+	var err error
+	if query.Params, err = pagination.ParseParams(q); err != nil {
+		return query, err
+	}
+	// 标签选择器，如 ?selector=env=prod,team!=infra
+	if query.Labels, err = labels.Parse(q.Get("selector")); err != nil {
+		return query, err
+	}
+	if v := q.Get("endpointId"); v != "" {
+		if query.EndpointID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return query, fmt.Errorf("无效的端点ID: %q", v)
+		}
+	}
+	query.Mode = q.Get("mode")
+	query.Status = q.Get("status")
+	query.Search = strings.TrimSpace(q.Get("search"))
+	if query.MinTraffic, err = parseOptionalInt64(q, "minTraffic"); err != nil {
+		return query, err
+	}
+	if query.MaxTraffic, err = parseOptionalInt64(q, "maxTraffic"); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseOptionalInt64 解析可选的整数参数，未提供时返回 nil
+func parseOptionalInt64(q url.Values, key string) (*int64, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的参数 %s: %q", key, v)
+	}
+	return &n, nil
 }
 
 // HandleCreateTunnel 创建新隧道
+// ?validate=true 时仅预检，返回字段错误、警告与命令行预览
 func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -60,19 +139,21 @@ func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Reques
 
 	// 兼容前端将端口作为字符串提交的情况
 	var raw struct {
-		Name          string          `json:"name"`
-		EndpointID    int64           `json:"endpointId"`
-		Mode          string          `json:"mode"`
-		TunnelAddress string          `json:"tunnelAddress"`
-		TunnelPort    json.RawMessage `json:"tunnelPort"`
-		TargetAddress string          `json:"targetAddress"`
-		TargetPort    json.RawMessage `json:"targetPort"`
-		TLSMode       string          `json:"tlsMode"`
-		CertPath      string          `json:"certPath"`
-		KeyPath       string          `json:"keyPath"`
-		LogLevel      string          `json:"logLevel"`
-		Min           json.RawMessage `json:"min"`
-		Max           json.RawMessage `json:"max"`
+		Name          string            `json:"name"`
+		EndpointID    int64             `json:"endpointId"`
+		Mode          string            `json:"mode"`
+		TunnelAddress string            `json:"tunnelAddress"`
+		TunnelPort    json.RawMessage   `json:"tunnelPort"`
+		TargetAddress string            `json:"targetAddress"`
+		TargetPort    json.RawMessage   `json:"targetPort"`
+		TLSMode       string            `json:"tlsMode"`
+		CertPath      string            `json:"certPath"`
+		KeyPath       string            `json:"keyPath"`
+		LogLevel      string            `json:"logLevel"`
+		Min           json.RawMessage   `json:"min"`
+		Max           json.RawMessage   `json:"max"`
+		ExtraParams   map[string]string `json:"extraParams"`
+		Labels        labels.Set        `json:"labels"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
@@ -136,13 +217,22 @@ func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Reques
 		LogLevel:      tunnel.LogLevel(raw.LogLevel),
 		Min:           minVal,
 		Max:           maxVal,
+		ExtraParams:   raw.ExtraParams,
+		Labels:        raw.Labels,
+		Actor:         requestUser(r),
 	}
 
-	log.Infof("[Master-%v] 创建隧道请求: %v", req.EndpointID, req.Name)
+	if validateOnly(r) {
+		v, err := h.tunnelService.ValidateCreate(req)
+		writeValidation(w, v, err)
+		return
+	}
+
+	log.Ctx(r.Context()).Infof("[Master-%v] 创建隧道请求: %v", req.EndpointID, req.Name)
 
 	newTunnel, err := h.tunnelService.CreateTunnel(req)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(tunnelErrorStatus(err))
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -206,7 +296,7 @@ func (h *TunnelHandler) HandleDeleteTunnel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := h.tunnelService.DeleteTunnelAndWait(req.InstanceID, 3*time.Second, req.Recycle); err != nil {
+	if err := h.tunnelService.DeleteTunnelAndWait(req.InstanceID, 3*time.Second, req.Recycle, requestUser(r)); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 			Success: false,
@@ -291,6 +381,7 @@ func (h *TunnelHandler) HandleControlTunnel(w http.ResponseWriter, r *http.Reque
 }
 
 // HandleUpdateTunnel 更新隧道配置
+// ?validate=true 时仅预检，返回字段错误、警告与命令行预览
 func (h *TunnelHandler) HandleUpdateTunnel(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tunnelIDStr := vars["id"]
@@ -307,19 +398,21 @@ func (h *TunnelHandler) HandleUpdateTunnel(w http.ResponseWriter, r *http.Reques
 
 	// 尝试解析为创建/替换请求体（与创建接口保持一致）
 	var rawCreate struct {
-		Name          string          `json:"name"`
-		EndpointID    int64           `json:"endpointId"`
-		Mode          string          `json:"mode"`
-		TunnelAddress string          `json:"tunnelAddress"`
-		TunnelPort    json.RawMessage `json:"tunnelPort"`
-		TargetAddress string          `json:"targetAddress"`
-		TargetPort    json.RawMessage `json:"targetPort"`
-		TLSMode       string          `json:"tlsMode"`
-		CertPath      string          `json:"certPath"`
-		KeyPath       string          `json:"keyPath"`
-		LogLevel      string          `json:"logLevel"`
-		Min           json.RawMessage `json:"min"`
-		Max           json.RawMessage `json:"max"`
+		Name          string            `json:"name"`
+		EndpointID    int64             `json:"endpointId"`
+		Mode          string            `json:"mode"`
+		TunnelAddress string            `json:"tunnelAddress"`
+		TunnelPort    json.RawMessage   `json:"tunnelPort"`
+		TargetAddress string            `json:"targetAddress"`
+		TargetPort    json.RawMessage   `json:"targetPort"`
+		TLSMode       string            `json:"tlsMode"`
+		CertPath      string            `json:"certPath"`
+		KeyPath       string            `json:"keyPath"`
+		LogLevel      string            `json:"logLevel"`
+		Min           json.RawMessage   `json:"min"`
+		Max           json.RawMessage   `json:"max"`
+		ExtraParams   map[string]string `json:"extraParams"`
+		Labels        labels.Set        `json:"labels"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&rawCreate); err != nil {
@@ -341,13 +434,12 @@ func (h *TunnelHandler) HandleUpdateTunnel(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		// 2. 删除旧实例（回收站=true）
-		if err := h.tunnelService.DeleteTunnelAndWait(instanceID, 3*time.Second, true); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "编辑实例失败，遭遇无法删除旧实例: " + err.Error()})
-			return
+		// 由声明式配置管理的隧道，编辑后仍保持受管理，下次 plan 时会显示差异
+		managed, _ := h.tunnelService.IsManaged(tunnelID)
+		// 未提交标签时沿用旧隧道的标签
+		if rawCreate.Labels == nil {
+			rawCreate.Labels, _ = h.tunnelService.GetLabels(tunnelID)
 		}
-		log.Infof("[Master-%v] 编辑实例=>删除旧实例: %v", rawCreate.EndpointID, instanceID)
 
 		// 工具函数解析 int 字段
 		parseInt := func(j json.RawMessage) (int, error) {
@@ -384,17 +476,67 @@ func (h *TunnelHandler) HandleUpdateTunnel(w http.ResponseWriter, r *http.Reques
 			LogLevel:      tunnel.LogLevel(rawCreate.LogLevel),
 			Min:           minVal,
 			Max:           maxVal,
+			ExtraParams:   rawCreate.ExtraParams,
+			Labels:        rawCreate.Labels,
+			Actor:         requestUser(r),
+		}
+
+		if validateOnly(r) {
+			v, err := h.tunnelService.ValidateReplace(tunnelID, createReq)
+			writeValidation(w, v, err)
+			return
+		}
+
+		// 删除旧实例前校验字段并预检端口，避免删除后才发现新配置无法创建
+		if err := createReq.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "编辑实例失败: " + err.Error()})
+			return
+		}
+		if err := h.tunnelService.CheckPort(rawCreate.EndpointID, tunnelID, tunnel.TunnelMode(rawCreate.Mode), rawCreate.TunnelAddress, tunnelPort); err != nil {
+			w.WriteHeader(tunnelErrorStatus(err))
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "编辑实例失败: " + err.Error()})
+			return
 		}
 
+		// 删除旧实例会解除其所在的隧道对，先记录下来以便关联到新实例
+		pair, err := h.tunnelService.PairOf(tunnelID)
+		if err != nil {
+			log.Ctx(r.Context()).Warnf("[Master-%v] 读取隧道对失败: %v", rawCreate.EndpointID, err)
+		}
+
+		// 2. 删除旧实例（回收站=true）
+		if err := h.tunnelService.DeleteTunnelAndWait(instanceID, 3*time.Second, true, requestUser(r)); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "编辑实例失败，遭遇无法删除旧实例: " + err.Error()})
+			return
+		}
+		log.Ctx(r.Context()).Infof("[Master-%v] 编辑实例=>删除旧实例: %v", rawCreate.EndpointID, instanceID)
+
 		newTunnel, err := h.tunnelService.CreateTunnel(createReq)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "编辑实例失败，无法创建新实例: " + err.Error()})
 			return
 		}
-		log.Infof("[Master-%v] 编辑实例=>创建新实例: %v", rawCreate.EndpointID, newTunnel.InstanceID)
+		log.Ctx(r.Context()).Infof("[Master-%v] 编辑实例=>创建新实例: %v", rawCreate.EndpointID, newTunnel.InstanceID)
+		// 配置历史随隧道转移到新实例
+		if err := h.tunnelService.InheritVersions(tunnelID, newTunnel.ID, requestUser(r), "重建实例"); err != nil {
+			log.Ctx(r.Context()).Warnf("[Master-%v] 转移配置历史失败: %v", rawCreate.EndpointID, err)
+		}
+		if err := h.tunnelService.InheritPair(pair, tunnelID, newTunnel.ID); err != nil {
+			log.Ctx(r.Context()).Warnf("[Master-%v] 隧道对关联新实例失败: %v", rawCreate.EndpointID, err)
+		}
 
-		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: true, Message: "编辑实例成功", Tunnel: newTunnel})
+		resp := tunnel.TunnelResponse{Success: true, Message: "编辑实例成功", Tunnel: newTunnel}
+		if managed {
+			if err := h.tunnelService.SetManaged(newTunnel.ID, true); err != nil {
+				log.Ctx(r.Context()).Warnf("[Master-%v] 保留受管理标记失败: %v", rawCreate.EndpointID, err)
+			}
+			newTunnel.Managed = true
+			resp.Warning = tunnel.ManagedDriftWarning
+		}
+		json.NewEncoder(w).Encode(resp)
 		return
 	}
 
@@ -538,7 +680,8 @@ func (h *TunnelHandler) HandlePatchTunnels(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		if err := h.tunnelService.RenameTunnel(raw.ID, raw.Name); err != nil {
+		managed, _ := h.tunnelService.IsManaged(raw.ID)
+		if err := h.tunnelService.RenameTunnel(raw.ID, raw.Name, requestUser(r)); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 				Success: false,
@@ -547,10 +690,14 @@ func (h *TunnelHandler) HandlePatchTunnels(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		resp := tunnel.TunnelResponse{
 			Success: true,
 			Message: "隧道重命名成功",
-		})
+		}
+		if managed {
+			resp.Warning = tunnel.ManagedDriftWarning
+		}
+		json.NewEncoder(w).Encode(resp)
 
 	default:
 		w.WriteHeader(http.StatusBadRequest)
@@ -606,13 +753,16 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 		UDPTx         int64
 		Min           sql.NullInt64
 		Max           sql.NullInt64
+		ExtraParams   sql.NullString
+		Labels        sql.NullString
+		Managed       bool
 	}
 
 	query := `SELECT t.id, t.instanceId, t.name, t.mode, t.status, t.endpointId,
 		   e.name, t.tunnelPort, t.targetPort, t.tlsMode, t.logLevel,
 		   t.tunnelAddress, t.targetAddress, t.commandLine,
 		   t.tcpRx, t.tcpTx, t.udpRx, t.udpTx,
-		   t.min, t.max
+		   t.min, t.max, t.extraParams, t.labels, t.managed
 		   FROM "Tunnel" t
 		   LEFT JOIN "Endpoint" e ON t.endpointId = e.id
 		   WHERE t.id = ?`
@@ -637,6 +787,9 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 		&tunnelRecord.UDPTx,
 		&tunnelRecord.Min,
 		&tunnelRecord.Max,
+		&tunnelRecord.ExtraParams,
+		&tunnelRecord.Labels,
+		&tunnelRecord.Managed,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -709,22 +862,40 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 			}
 		}
 
-		// 流量趋势
-		trendRows, err := db.Query(`SELECT eventTime, tcpRx, tcpTx, udpRx, udpTx FROM "EndpointSSE" WHERE endpointId = ? AND instanceId = ? AND pushType IN ('update','initial') AND (tcpRx IS NOT NULL OR tcpTx IS NOT NULL OR udpRx IS NOT NULL OR udpTx IS NOT NULL) ORDER BY eventTime ASC LIMIT 100`, tunnelRecord.EndpointID, instanceID)
-		if err == nil {
-			defer trendRows.Close()
-			for trendRows.Next() {
-				var eventTime time.Time
-				var tcpRx, tcpTx, udpRx, udpTx sql.NullInt64
-				if err := trendRows.Scan(&eventTime, &tcpRx, &tcpTx, &udpRx, &udpTx); err == nil {
-					trafficTrend = append(trafficTrend, map[string]interface{}{
-						"eventTime": eventTime.Format(time.RFC3339),
-						"tcpRx":     tcpRx.Int64,
-						"tcpTx":     tcpTx.Int64,
-						"udpRx":     udpRx.Int64,
-						"udpTx":     udpTx.Int64,
-					})
-				}
+		// 流量趋势：来自流量汇总表，trendHours 控制时间跨度（默认 1 小时）
+		// tcpRx 等字段为窗口内的累计值，tcpRxDelta 等字段为该时段的增量
+		trendHours := 1
+		if v, err := strconv.Atoi(r.URL.Query().Get("trendHours")); err == nil && v > 0 {
+			trendHours = v
+		}
+		span := time.Duration(trendHours) * time.Hour
+		now := time.Now()
+		points, err := h.trafficStore.Trend(traffic.ResolutionFor(span), now.Add(-span), now, traffic.Filter{
+			EndpointID: tunnelRecord.EndpointID,
+			InstanceID: instanceID,
+		})
+		if err == nil && len(points) > 0 {
+			var acc traffic.Point
+			trafficTrend = append(trafficTrend, map[string]interface{}{
+				"eventTime": points[0].Time.Format(time.RFC3339),
+				"tcpRx":     0, "tcpTx": 0, "udpRx": 0, "udpTx": 0,
+			})
+			for _, p := range points {
+				acc.TCPRx += p.TCPRx
+				acc.TCPTx += p.TCPTx
+				acc.UDPRx += p.UDPRx
+				acc.UDPTx += p.UDPTx
+				trafficTrend = append(trafficTrend, map[string]interface{}{
+					"eventTime":  p.Time.Format(time.RFC3339),
+					"tcpRx":      acc.TCPRx,
+					"tcpTx":      acc.TCPTx,
+					"udpRx":      acc.UDPRx,
+					"udpTx":      acc.UDPTx,
+					"tcpRxDelta": p.TCPRx,
+					"tcpTxDelta": p.TCPTx,
+					"udpRxDelta": p.UDPRx,
+					"udpTxDelta": p.UDPTx,
+				})
 			}
 		}
 	}
@@ -760,6 +931,7 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 					}
 					return nil
 				}(),
+				"extraParams": nodepassurl.DecodeExtra(tunnelRecord.ExtraParams.String),
 			},
 			"traffic": map[string]int64{
 				"tcpRx": tunnelRecord.TCPRx,
@@ -770,6 +942,8 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 			"tunnelAddress": tunnelRecord.TunnelAddress,
 			"targetAddress": tunnelRecord.TargetAddress,
 			"commandLine":   tunnelRecord.CommandLine,
+			"managed":       tunnelRecord.Managed,
+			"labels":        labels.Decode(tunnelRecord.Labels.String),
 		},
 		"logs":         logs,
 		"trafficTrend": trafficTrend,
@@ -909,6 +1083,7 @@ func ptrString(ns sql.NullString) string {
 }
 
 // HandleQuickCreateTunnel 根据 URL 快速创建隧道
+// ?validate=true 时仅预检，返回字段错误、警告与命令行预览
 func (h *TunnelHandler) HandleQuickCreateTunnel(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -929,6 +1104,12 @@ func (h *TunnelHandler) HandleQuickCreateTunnel(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if validateOnly(r) {
+		v, err := h.tunnelService.ValidateQuickCreate(req.EndpointID, req.URL, strings.TrimSpace(req.Name))
+		writeValidation(w, v, err)
+		return
+	}
+
 	if req.EndpointID == 0 || req.URL == "" || strings.TrimSpace(req.Name) == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
@@ -938,8 +1119,8 @@ func (h *TunnelHandler) HandleQuickCreateTunnel(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := h.tunnelService.QuickCreateTunnel(req.EndpointID, req.URL, req.Name); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if err := h.tunnelService.QuickCreateTunnel(req.EndpointID, req.URL, req.Name, requestUser(r)); err != nil {
+		w.WriteHeader(tunnelErrorStatus(err))
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -953,386 +1134,174 @@ func (h *TunnelHandler) HandleQuickCreateTunnel(w http.ResponseWriter, r *http.R
 	})
 }
 
-// HandleTemplateCreate 处理模板创建请求
-func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// HandleSetTunnelLabels PUT /api/tunnels/{id}/labels
+// 请求体 {"labels": {"env": "prod"}}，整体替换隧道标签，不影响主控上的实例
+func (h *TunnelHandler) HandleSetTunnelLabels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "无效的隧道ID"})
 		return
 	}
 
-	// 定义请求结构体
 	var req struct {
-		Log        string `json:"log"`
-		ListenPort int    `json:"listen_port"`
-		Mode       string `json:"mode"`
-		TLS        int    `json:"tls,omitempty"`
-		CertPath   string `json:"cert_path,omitempty"`
-		KeyPath    string `json:"key_path,omitempty"`
-		Inbounds   *struct {
-			TargetHost string `json:"target_host"`
-			TargetPort int    `json:"target_port"`
-			MasterID   int64  `json:"master_id"`
-			Type       string `json:"type"`
-		} `json:"inbounds,omitempty"`
-		Outbounds *struct {
-			TargetHost string `json:"target_host"`
-			TargetPort int    `json:"target_port"`
-			MasterID   int64  `json:"master_id"`
-			Type       string `json:"type"`
-		} `json:"outbounds,omitempty"`
+		Labels labels.Set `json:"labels"`
 	}
-
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-			Success: false,
-			Error:   "无效的请求数据",
-		})
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "无效的请求数据"})
 		return
 	}
 
-	log.Infof("[API] 模板创建请求: mode=%s, listen_port=%d", req.Mode, req.ListenPort)
-
-	switch req.Mode {
-	case "single":
-		if req.Inbounds == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "单端模式缺少inbounds配置",
-			})
-			return
-		}
-
-		// 获取中转主控信息
-		var endpointURL, endpointAPIPath, endpointAPIKey string
-		db := h.tunnelService.DB()
-		err := db.QueryRow(
-			"SELECT url, apiPath, apiKey FROM \"Endpoint\" WHERE id = ?",
-			req.Inbounds.MasterID,
-		).Scan(&endpointURL, &endpointAPIPath, &endpointAPIKey)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-					Success: false,
-					Error:   "指定的中转主控不存在",
-				})
-				return
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "查询中转主控失败",
-			})
-			return
-		}
-
-		// 构建单端转发的URL
-		tunnelURL := fmt.Sprintf("client://:%d/%s:%d?log=%s",
-			req.ListenPort,
-			req.Inbounds.TargetHost,
-			req.Inbounds.TargetPort,
-			req.Log,
-		)
-
-		// 生成隧道名称
-		tunnelName := fmt.Sprintf("template-single-%d-%d", req.Inbounds.MasterID, time.Now().Unix())
+	if err := h.tunnelService.SetLabels(id, req.Labels); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: true, Message: "标签已更新"})
+}
 
-		// 使用QuickCreateTunnel创建隧道
-		if err := h.tunnelService.QuickCreateTunnel(req.Inbounds.MasterID, tunnelURL, tunnelName); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "创建单端隧道失败: " + err.Error(),
-			})
-			return
-		}
+// HandleBulkTunnels POST /api/tunnels/bulk?stream=true
+// 按 ID 或筛选条件批量执行 start/stop/restart/delete/recycle/loglevel。
+// 筛选条件为空时 stop/delete/recycle 需在请求体中指定 "all": true。
+// stream 为 true 时以 NDJSON 逐行输出每个隧道的结果，最后一行为汇总
+func (h *TunnelHandler) HandleBulkTunnels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-			Success: true,
-			Message: "单端转发隧道创建成功",
+	var req tunnel.BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的请求数据",
 		})
+		return
+	}
+	req.Actor = requestUser(r)
+	if err := req.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
 
-	case "bothway":
-		if req.Inbounds == nil || req.Outbounds == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "双端模式缺少inbounds或outbounds配置",
-			})
-			return
-		}
-
-		// 获取两个主控信息
-		var serverEndpoint, clientEndpoint struct {
-			ID      int64
-			URL     string
-			APIPath string
-			APIKey  string
-		}
-
-		// 获取server端主控信息（inbounds）
-		db := h.tunnelService.DB()
-		err := db.QueryRow(
-			"SELECT id, url, apiPath, apiKey FROM \"Endpoint\" WHERE id = ?",
-			req.Inbounds.MasterID,
-		).Scan(&serverEndpoint.ID, &serverEndpoint.URL, &serverEndpoint.APIPath, &serverEndpoint.APIKey)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-					Success: false,
-					Error:   "指定的server端主控不存在",
-				})
-				return
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "查询server端主控失败",
-			})
-			return
-		}
-
-		// 获取client端主控信息（outbounds）
-		err = db.QueryRow(
-			"SELECT id, url, apiPath, apiKey FROM \"Endpoint\" WHERE id = ?",
-			req.Outbounds.MasterID,
-		).Scan(&clientEndpoint.ID, &clientEndpoint.URL, &clientEndpoint.APIPath, &clientEndpoint.APIKey)
+	if req.DryRun {
+		targets, err := h.tunnelService.ResolveBulkTargets(req)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-					Success: false,
-					Error:   "指定的client端主控不存在",
-				})
-				return
-			}
 			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "查询client端主控失败",
-			})
-			return
-		}
-
-		// 从server端URL中提取IP
-		serverIP := strings.TrimPrefix(serverEndpoint.URL, "http://")
-		serverIP = strings.TrimPrefix(serverIP, "https://")
-		if idx := strings.Index(serverIP, ":"); idx != -1 {
-			serverIP = serverIP[:idx]
-		}
-		if idx := strings.Index(serverIP, "/"); idx != -1 {
-			serverIP = serverIP[:idx]
-		}
-
-		// 构建server端URL
-		serverURL := fmt.Sprintf("server://:%d/:%d",
-			req.ListenPort,
-			req.Inbounds.TargetPort,
-		)
-		if req.TLS > 0 {
-			serverURL += fmt.Sprintf("?tls=%d&log=%s", req.TLS, req.Log)
-			// 如果是TLS 2且提供了证书路径，添加证书参数
-			if req.TLS == 2 && req.CertPath != "" && req.KeyPath != "" {
-				serverURL += fmt.Sprintf("&cert=%s&key=%s", req.CertPath, req.KeyPath)
-			}
-		} else {
-			serverURL += fmt.Sprintf("?log=%s", req.Log)
-		}
-
-		// 构建client端URL
-		clientURL := fmt.Sprintf("client://%s:%d/:%d?log=%s",
-			serverIP,
-			req.ListenPort,
-			req.Outbounds.TargetPort,
-			req.Log,
-		)
-
-		// 生成隧道名称
-		timestamp := time.Now().Unix()
-		serverTunnelName := fmt.Sprintf("template-server-%d-%d", req.Inbounds.MasterID, timestamp)
-		clientTunnelName := fmt.Sprintf("template-client-%d-%d", req.Outbounds.MasterID, timestamp)
-
-		log.Infof("[API] 开始创建双端隧道 - 先创建server端，再创建client端")
-
-		// 第一步：创建server端隧道
-		log.Infof("[API] 步骤1: 创建server端隧道 %s", serverTunnelName)
-		if err := h.tunnelService.QuickCreateTunnel(req.Inbounds.MasterID, serverURL, serverTunnelName); err != nil {
-			log.Errorf("[API] 创建server端隧道失败: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "创建server端隧道失败: " + err.Error(),
-			})
-			return
-		}
-		log.Infof("[API] 步骤1完成: server端隧道创建成功")
-
-		// 第二步：创建client端隧道
-		log.Infof("[API] 步骤2: 创建client端隧道 %s", clientTunnelName)
-		if err := h.tunnelService.QuickCreateTunnel(req.Outbounds.MasterID, clientURL, clientTunnelName); err != nil {
-			log.Errorf("[API] 创建client端隧道失败: %v", err)
-			// 如果client端创建失败，可以考虑回滚server端，但这里先简单处理
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "创建client端隧道失败: " + err.Error(),
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
 			})
 			return
 		}
-		log.Infof("[API] 步骤2完成: client端隧道创建成功")
-		log.Infof("[API] 双端隧道创建完成")
-
-		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-			Success: true,
-			Message: "双端转发隧道创建成功",
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"total":   len(targets),
+			"tunnels": targets,
 		})
+		return
+	}
 
-	case "intranet":
-		if req.Inbounds == nil || req.Outbounds == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "内网穿透模式缺少inbounds或outbounds配置",
-			})
-			return
-		}
-
-		// 获取两个主控信息
-		var serverEndpoint, clientEndpoint struct {
-			ID      int64
-			URL     string
-			APIPath string
-			APIKey  string
-		}
+	log.Ctx(r.Context()).Infof("[API] 批量操作隧道: action=%s, ids=%v", req.Action, req.IDs)
 
-		// 获取server端主控信息（inbounds - 中转机器）
-		db := h.tunnelService.DB()
-		err := db.QueryRow(
-			"SELECT id, url, apiPath, apiKey FROM \"Endpoint\" WHERE id = ?",
-			req.Inbounds.MasterID,
-		).Scan(&serverEndpoint.ID, &serverEndpoint.URL, &serverEndpoint.APIPath, &serverEndpoint.APIKey)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-					Success: false,
-					Error:   "指定的中转主控不存在",
-				})
-				return
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "查询中转主控失败",
-			})
-			return
-		}
-
-		// 获取client端主控信息（outbounds - 内网服务）
-		err = db.QueryRow(
-			"SELECT id, url, apiPath, apiKey FROM \"Endpoint\" WHERE id = ?",
-			req.Outbounds.MasterID,
-		).Scan(&clientEndpoint.ID, &clientEndpoint.URL, &clientEndpoint.APIPath, &clientEndpoint.APIKey)
+	stream := strings.ToLower(r.URL.Query().Get("stream"))
+	flusher, canFlush := w.(http.Flusher)
+	if (stream == "1" || stream == "true") && canFlush {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Cache-Control", "no-cache")
+		enc := json.NewEncoder(w)
+		results, err := h.tunnelService.BulkOperate(req, func(res tunnel.BulkResult) {
+			enc.Encode(res)
+			flusher.Flush()
+		})
 		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-					Success: false,
-					Error:   "指定的内网服务端主控不存在",
-				})
-				return
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "查询内网服务端主控失败",
-			})
+			enc.Encode(map[string]interface{}{"success": false, "error": err.Error()})
 			return
 		}
+		enc.Encode(bulkSummary(results, false))
+		return
+	}
 
-		// 从server端URL中提取IP
-		serverIP := strings.TrimPrefix(serverEndpoint.URL, "http://")
-		serverIP = strings.TrimPrefix(serverIP, "https://")
-		if idx := strings.Index(serverIP, ":"); idx != -1 {
-			serverIP = serverIP[:idx]
-		}
-		if idx := strings.Index(serverIP, "/"); idx != -1 {
-			serverIP = serverIP[:idx]
-		}
-
-		// 构建server端URL - 中转机器提供外部访问入口
-		serverURL := fmt.Sprintf("server://:%d/:%d",
-			req.ListenPort,
-			req.Inbounds.TargetPort,
-		)
-		if req.TLS > 0 {
-			serverURL += fmt.Sprintf("?tls=%d&log=%s", req.TLS, req.Log)
-			// 如果是TLS 2且提供了证书路径，添加证书参数
-			if req.TLS == 2 && req.CertPath != "" && req.KeyPath != "" {
-				serverURL += fmt.Sprintf("&cert=%s&key=%s", req.CertPath, req.KeyPath)
-			}
-		} else {
-			serverURL += fmt.Sprintf("?log=%s", req.Log)
-		}
-
-		// 构建client端URL - 内网服务连接到中转机器，并指定目标服务IP和端口
-		clientURL := fmt.Sprintf("client://%s:%d/%s:%d?log=%s",
-			serverIP,
-			req.ListenPort,
-			req.Outbounds.TargetHost, // 这里是用户填写的服务IP
-			req.Outbounds.TargetPort, // 这里是用户填写的服务端口
-			req.Log,
-		)
-
-		// 生成隧道名称
-		timestamp := time.Now().Unix()
-		serverTunnelName := fmt.Sprintf("template-intranet-server-%d-%d", req.Inbounds.MasterID, timestamp)
-		clientTunnelName := fmt.Sprintf("template-intranet-client-%d-%d", req.Outbounds.MasterID, timestamp)
-
-		log.Infof("[API] 开始创建内网穿透隧道 - 先创建server端，再创建client端")
-
-		// 第一步：创建server端隧道（中转机器）
-		log.Infof("[API] 步骤1: 创建server端隧道 %s", serverTunnelName)
-		if err := h.tunnelService.QuickCreateTunnel(req.Inbounds.MasterID, serverURL, serverTunnelName); err != nil {
-			log.Errorf("[API] 创建server端隧道失败: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "创建server端隧道失败: " + err.Error(),
-			})
-			return
-		}
-		log.Infof("[API] 步骤1完成: server端隧道创建成功")
+	results, err := h.tunnelService.BulkOperate(req, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(bulkSummary(results, true))
+}
 
-		// 第二步：创建client端隧道（内网服务）
-		log.Infof("[API] 步骤2: 创建client端隧道 %s", clientTunnelName)
-		if err := h.tunnelService.QuickCreateTunnel(req.Outbounds.MasterID, clientURL, clientTunnelName); err != nil {
-			log.Errorf("[API] 创建client端隧道失败: %v", err)
-			// 如果client端创建失败，可以考虑回滚server端，但这里先简单处理
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-				Success: false,
-				Error:   "创建client端隧道失败: " + err.Error(),
-			})
-			return
+// bulkSummary 汇总批量操作结果，withResults 为 false 时不包含明细（流式输出已逐条返回）
+func bulkSummary(results []tunnel.BulkResult, withResults bool) map[string]interface{} {
+	failed := 0
+	for _, res := range results {
+		if !res.Success {
+			failed++
 		}
-		log.Infof("[API] 步骤2完成: client端隧道创建成功")
-		log.Infof("[API] 内网穿透隧道创建完成")
+	}
+	summary := map[string]interface{}{
+		"success":   failed == 0,
+		"total":     len(results),
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	}
+	if withResults {
+		summary["results"] = results
+	}
+	return summary
+}
 
+// HandleRecycleRestore 从回收站恢复隧道 (POST /api/endpoints/{endpointId}/recycle/{recycleId}/restore)
+// 请求体可选 {"endpointId": 2, "name": "新名称"}，默认恢复到原主控并沿用原名称
+func (h *TunnelHandler) HandleRecycleRestore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	endpointID, err1 := strconv.ParseInt(vars["endpointId"], 10, 64)
+	recycleID, err2 := strconv.ParseInt(vars["recycleId"], 10, 64)
+	if err1 != nil || err2 != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
-			Success: true,
-			Message: "内网穿透隧道创建成功",
+			Success: false,
+			Error:   "无效的ID",
 		})
+		return
+	}
 
-	default:
+	var req tunnel.RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 			Success: false,
-			Error:   "不支持的隧道模式: " + req.Mode,
+			Error:   "无效的请求数据",
 		})
 		return
 	}
+
+	res, err := h.tunnelService.RestoreRecycled(endpointID, recycleID, req)
+	if err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 恢复回收站隧道 %d 失败: %v", recycleID, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, tunnel.ErrRecycleNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"result":  res,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "隧道已恢复",
+		"result":  res,
+	})
 }
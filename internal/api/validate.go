@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// validateOnly 请求是否为预检模式（?validate=true）：执行全部检查但不访问主控写接口、不写数据库
+func validateOnly(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("validate"))
+	return v
+}
+
+// writeValidation 写入预检结果，result 中的 valid 表示请求能否通过
+func writeValidation(w http.ResponseWriter, result interface{}, err error) {
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"validation": result,
+	})
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/tunnel"
+
+	"github.com/gorilla/mux"
+)
+
+// writeVersionError 按错误类型写入配置历史操作的错误响应
+func writeVersionError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, tunnel.ErrVersionNotFound) {
+		status = http.StatusNotFound
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// tunnelPathID 解析路径中的隧道 ID，失败时直接写入错误响应
+func tunnelPathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的隧道ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleListVersions GET /api/tunnels/{id}/versions
+func (h *TunnelHandler) HandleListVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := tunnelPathID(w, r)
+	if !ok {
+		return
+	}
+	versions, err := h.tunnelService.ListVersions(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "获取配置历史失败: " + err.Error(),
+		})
+		return
+	}
+	if versions == nil {
+		versions = []tunnel.ConfigVersion{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"versions": versions,
+	})
+}
+
+// HandleDiffVersions GET /api/tunnels/{id}/versions/diff?from=1&to=3
+// to 省略时与最新版本比较，from 省略时与 to 的上一版本比较
+func (h *TunnelHandler) HandleDiffVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := tunnelPathID(w, r)
+	if !ok {
+		return
+	}
+	from, errFrom := optionalInt(r.URL.Query().Get("from"))
+	to, errTo := optionalInt(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "from/to 应为版本号",
+		})
+		return
+	}
+	if to == 0 {
+		versions, err := h.tunnelService.ListVersions(id)
+		if err != nil {
+			writeVersionError(w, err)
+			return
+		}
+		if len(versions) == 0 {
+			writeVersionError(w, tunnel.ErrVersionNotFound)
+			return
+		}
+		to = versions[0].Version
+	}
+	if from == 0 {
+		from = to - 1
+	}
+
+	diff, err := h.tunnelService.DiffVersions(id, from, to)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"diff":    diff,
+	})
+}
+
+// HandleRollbackVersion POST /api/tunnels/{id}/versions/{version}/rollback
+// 以指定版本的命令行更新主控上的实例
+func (h *TunnelHandler) HandleRollbackVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := tunnelPathID(w, r)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil || version <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的版本号",
+		})
+		return
+	}
+
+	managed, _ := h.tunnelService.IsManaged(id)
+	if err := h.tunnelService.RollbackToVersion(id, version, requestUser(r)); err != nil {
+		log.Ctx(r.Context()).Errorf("[API] 隧道 %d 回滚到版本 %d 失败: %v", id, version, err)
+		writeVersionError(w, err)
+		return
+	}
+	resp := tunnel.TunnelResponse{
+		Success: true,
+		Message: "已回滚到版本 " + strconv.Itoa(version),
+	}
+	if managed {
+		resp.Warning = tunnel.ManagedDriftWarning
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// optionalInt 解析可选的整数查询参数，空字符串返回 0
+func optionalInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
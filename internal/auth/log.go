@@ -0,0 +1,6 @@
+package auth
+
+import applog "NodePassDash/internal/log"
+
+// log 认证子系统日志，级别可单独配置
+var log = applog.For(applog.SubsystemAuth)
@@ -1,7 +1,6 @@
 package auth
 
 import (
-	log "NodePassDash/internal/log"
 	"crypto/rand"
 	"database/sql"
 	"errors"
@@ -22,14 +21,29 @@ var (
 	configCache = sync.Map{}
 )
 
+// Config 认证配置
+type Config struct {
+	// SessionTTL 登录会话有效期
+	SessionTTL time.Duration
+}
+
+// DefaultConfig 默认配置：会话有效期 24 小时
+func DefaultConfig() Config {
+	return Config{SessionTTL: 24 * time.Hour}
+}
+
 // Service 认证服务
 type Service struct {
-	db *sql.DB
+	db  *sql.DB
+	cfg Config
 }
 
 // NewService 创建认证服务实例，需要传入数据库连接
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(db *sql.DB, cfg Config) *Service {
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultConfig().SessionTTL
+	}
+	return &Service{db: db, cfg: cfg}
 }
 
 // HashPassword 密码加密
@@ -56,7 +70,7 @@ func (s *Service) GetSystemConfig(key string) (string, error) {
 
 	// 查询数据库
 	var value string
-	err := s.db.QueryRow(`SELECT value FROM "SystemConfig" WHERE key = ?`, key).Scan(&value)
+	err := s.db.QueryRow(`SELECT value FROM "SystemConfig" WHERE "key" = ?`, key).Scan(&value)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", errors.New("配置不存在")
@@ -71,14 +85,22 @@ func (s *Service) GetSystemConfig(key string) (string, error) {
 
 // SetSystemConfig 设置系统配置（写库并更新缓存）
 func (s *Service) SetSystemConfig(key, value, description string) error {
-	_, err := s.db.Exec(`
-		INSERT INTO "SystemConfig" (key, value, description, createdAt, updatedAt)
-		VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		ON CONFLICT(key) DO UPDATE SET value = excluded.value, description = excluded.description, updatedAt = CURRENT_TIMESTAMP;
-	`, key, value, description)
+	// 先更新，不存在时再插入（兼容 SQLite / PostgreSQL / MySQL）
+	res, err := s.db.Exec(`
+		UPDATE "SystemConfig" SET value = ?, description = ?, updatedAt = CURRENT_TIMESTAMP WHERE "key" = ?
+	`, value, description, key)
 	if err != nil {
 		return err
 	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		_, err = s.db.Exec(`
+			INSERT INTO "SystemConfig" ("key", value, description, createdAt, updatedAt)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`, key, value, description)
+		if err != nil {
+			return err
+		}
+	}
 
 	// 更新缓存
 	configCache.Store(key, value)
@@ -110,12 +132,12 @@ func (s *Service) AuthenticateUser(username, password string) bool {
 // CreateUserSession 创建用户会话
 func (s *Service) CreateUserSession(username string) (string, error) {
 	sessionID := uuid.New().String()
-	expiresAt := time.Now().Add(24 * time.Hour)
+	expiresAt := time.Now().Add(s.cfg.SessionTTL)
 
 	// 写入数据库
 	_, err := s.db.Exec(`
 		INSERT INTO "UserSession" (sessionId, username, createdAt, expiresAt, isActive)
-		VALUES (?, ?, CURRENT_TIMESTAMP, ?, 1);
+		VALUES (?, ?, CURRENT_TIMESTAMP, ?, TRUE);
 	`, sessionID, username, expiresAt)
 	if err != nil {
 		return "", err
@@ -155,7 +177,7 @@ func (s *Service) ValidateSession(sessionID string) bool {
 
 	if !isActive || time.Now().After(expiresAt) {
 		// 标记为失效
-		s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE sessionId = ?`, sessionID)
+		s.db.Exec(`UPDATE "UserSession" SET isActive = FALSE WHERE sessionId = ?`, sessionID)
 		return false
 	}
 
@@ -173,7 +195,7 @@ func (s *Service) ValidateSession(sessionID string) bool {
 // DestroySession 销毁会话
 func (s *Service) DestroySession(sessionID string) {
 	// 更新数据库
-	s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE sessionId = ?`, sessionID)
+	s.db.Exec(`UPDATE "UserSession" SET isActive = FALSE WHERE sessionId = ?`, sessionID)
 	// 删除缓存
 	sessionCache.Delete(sessionID)
 }
@@ -181,7 +203,7 @@ func (s *Service) DestroySession(sessionID string) {
 // CleanupExpiredSessions 清理过期会话
 func (s *Service) CleanupExpiredSessions() {
 	// 更新数据库
-	s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE expiresAt < CURRENT_TIMESTAMP AND isActive = 1`)
+	s.db.Exec(`UPDATE "UserSession" SET isActive = FALSE WHERE expiresAt < ? AND isActive = TRUE`, time.Now())
 
 	// 清理缓存
 	sessionCache.Range(func(key, value interface{}) bool {
@@ -319,7 +341,7 @@ func (s *Service) ChangeUsername(currentUsername, newUsername string) (bool, str
 	}
 
 	// 更新数据库中的会话记录
-	_, _ = s.db.Exec(`UPDATE "UserSession" SET username = ? WHERE username = ? AND isActive = 1`, newUsername, currentUsername)
+	_, _ = s.db.Exec(`UPDATE "UserSession" SET username = ? WHERE username = ? AND isActive = TRUE`, newUsername, currentUsername)
 
 	// 更新缓存中的会话
 	sessionCache.Range(func(key, value interface{}) bool {
@@ -381,7 +403,7 @@ func (s *Service) ResetAdminPassword() (string, string, error) {
 // invalidateAllSessions 使所有会话失效（数据库 + 缓存）
 func (s *Service) invalidateAllSessions() {
 	// 更新数据库会话状态
-	_, _ = s.db.Exec(`UPDATE "UserSession" SET isActive = 0`)
+	_, _ = s.db.Exec(`UPDATE "UserSession" SET isActive = FALSE`)
 	// 清空缓存
 	sessionCache.Range(func(key, value interface{}) bool {
 		sessionCache.Delete(key)
@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	log "NodePassDash/internal/log"
+)
+
+// Start 启动定时备份：每个自然日生成一个每日备份，每个 ISO 周生成一个每周备份，并按数量轮换
+func (s *Service) Start() {
+	if !s.Supported() || s.cfg.Interval <= 0 {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			s.runScheduled(time.Now())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Infof("[Backup]定时备份已启动，目录 %s，保留每日 %d 个 / 每周 %d 个", s.cfg.Dir, s.cfg.DailyKeep, s.cfg.WeeklyKeep)
+}
+
+// Stop 停止定时备份
+func (s *Service) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
+
+// runScheduled 检查并补齐当天 / 当周的备份，然后执行轮换
+func (s *Service) runScheduled(now time.Time) {
+	list, err := s.List()
+	if err != nil {
+		log.Warnf("[Backup]读取备份列表失败: %v", err)
+		return
+	}
+
+	var hasDaily, hasWeekly bool
+	year, week := now.ISOWeek()
+	for _, info := range list {
+		switch {
+		case isKind(info, KindDaily) && sameDay(info.CreatedAt, now):
+			hasDaily = true
+		case isKind(info, KindWeekly):
+			if y, w := info.CreatedAt.ISOWeek(); y == year && w == week {
+				hasWeekly = true
+			}
+		}
+	}
+
+	s.mu.Lock()
+	if !hasDaily {
+		if _, err := s.create(KindDaily, now); err != nil {
+			log.Warnf("[Backup]每日备份失败: %v", err)
+		}
+	}
+	if !hasWeekly {
+		if _, err := s.create(KindWeekly, now); err != nil {
+			log.Warnf("[Backup]每周备份失败: %v", err)
+		}
+	}
+	s.mu.Unlock()
+
+	s.rotate()
+}
+
+// rotate 按类型保留最新的 N 个备份，删除其余备份
+func (s *Service) rotate() {
+	list, err := s.List()
+	if err != nil {
+		return
+	}
+	keep := map[string]int{KindDaily: s.cfg.DailyKeep, KindWeekly: s.cfg.WeeklyKeep}
+	seen := make(map[string]int)
+	for _, info := range list { // 已按时间倒序
+		limit, ok := keep[info.Kind]
+		if !ok {
+			continue // 手动与上传的备份不自动删除
+		}
+		seen[info.Kind]++
+		if seen[info.Kind] > limit {
+			if err := os.Remove(filepath.Join(s.cfg.Dir, info.Name)); err == nil {
+				log.Infof("[Backup]轮换删除备份 %s", info.Name)
+			}
+		}
+	}
+}
+
+// sameDay 判断两个时间是否为同一自然日（本地时区）
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Local().Date()
+	by, bm, bd := b.Local().Date()
+	return ay == by && am == bm && ad == bd
+}
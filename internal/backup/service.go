@@ -0,0 +1,414 @@
+// Package backup 提供 SQLite 数据库的在线备份、定时快照与恢复。
+//
+// 备份通过 VACUUM INTO 生成一致性快照，无需停止服务；
+// 恢复时先校验备份文件，再暂存为待恢复文件，于下次启动、打开数据库之前替换。
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/migrate"
+	"NodePassDash/internal/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 备份类型
+const (
+	KindManual   = "manual"
+	KindDaily    = "daily"
+	KindWeekly   = "weekly"
+	KindUploaded = "uploaded"
+)
+
+// pendingSuffix 待恢复文件后缀，位于数据库文件旁
+const pendingSuffix = ".restore"
+
+// 备份文件名：nodepass-<kind>-<20060102-150405>.db
+var fileNamePattern = regexp.MustCompile(`^nodepass-(manual|daily|weekly|uploaded)-(\d{8}-\d{6})\.db$`)
+
+// ErrUnsupported 非 SQLite 数据库不支持内置备份
+var ErrUnsupported = errors.New("内置备份仅支持 SQLite，请使用数据库自带的备份工具")
+
+// Config 备份配置
+type Config struct {
+	Dir        string        // 备份目录
+	DailyKeep  int           // 保留的每日备份数量
+	WeeklyKeep int           // 保留的每周备份数量
+	Interval   time.Duration // 定时检查间隔，为 0 表示不启用定时备份
+}
+
+// DefaultConfig 默认配置：保留 7 个每日备份与 4 个每周备份
+func DefaultConfig() Config {
+	return Config{
+		Dir:        "public/backups",
+		DailyKeep:  7,
+		WeeklyKeep: 4,
+		Interval:   time.Hour,
+	}
+}
+
+// Info 备份文件信息
+type Info struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Service 备份服务
+type Service struct {
+	db     *sql.DB
+	dbPath string // 当前数据库文件路径，为空表示不支持备份
+	cfg    Config
+
+	mu   sync.Mutex // 串行化备份与恢复操作
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewService 创建备份服务，dbPath 为当前 SQLite 数据库文件路径（非 SQLite 时传空字符串）
+func NewService(db *sql.DB, dbPath string, cfg Config) *Service {
+	def := DefaultConfig()
+	if cfg.Dir == "" {
+		cfg.Dir = def.Dir
+	}
+	if cfg.DailyKeep <= 0 {
+		cfg.DailyKeep = def.DailyKeep
+	}
+	if cfg.WeeklyKeep <= 0 {
+		cfg.WeeklyKeep = def.WeeklyKeep
+	}
+	return &Service{db: db, dbPath: dbPath, cfg: cfg}
+}
+
+// Supported 当前数据库是否支持内置备份
+func (s *Service) Supported() bool {
+	return s.dbPath != "" && storage.DialectOf(s.db) == storage.SQLite
+}
+
+// Create 立即创建一个备份
+func (s *Service) Create(kind string) (*Info, error) {
+	if !s.Supported() {
+		return nil, ErrUnsupported
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(kind, time.Now())
+}
+
+// create 通过 VACUUM INTO 生成快照并校验
+func (s *Service) create(kind string, now time.Time) (*Info, error) {
+	if err := os.MkdirAll(s.cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("nodepass-%s-%s.db", kind, now.Format("20060102-150405"))
+	target := filepath.Join(s.cfg.Dir, name)
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("备份文件已存在: %s", name)
+	}
+
+	// 先写入临时文件，校验通过后再重命名，避免留下不完整的备份
+	tmp := target + ".tmp"
+	_ = os.Remove(tmp)
+	if _, err := s.db.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("创建备份失败: %w", err)
+	}
+	if err := Validate(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("备份校验失败: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+
+	info, err := s.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[Backup]已创建备份 %s (%d bytes)", name, info.Size)
+	return info, nil
+}
+
+// List 列出所有备份，按创建时间倒序
+func (s *Service) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Info{}, nil
+		}
+		return nil, err
+	}
+
+	list := make([]Info, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !fileNamePattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := s.stat(e.Name())
+		if err != nil {
+			continue
+		}
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Path 返回备份文件的完整路径，并校验文件名合法，防止路径穿越
+func (s *Service) Path(name string) (string, error) {
+	if !fileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("无效的备份文件名: %s", name)
+	}
+	p := filepath.Join(s.cfg.Dir, name)
+	if _, err := os.Stat(p); err != nil {
+		return "", fmt.Errorf("备份不存在: %s", name)
+	}
+	return p, nil
+}
+
+// Delete 删除备份
+func (s *Service) Delete(name string) error {
+	p, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// Import 保存上传的备份文件，校验通过后返回备份信息
+func (s *Service) Import(r io.Reader) (*Info, error) {
+	if !s.Supported() {
+		return nil, ErrUnsupported
+	}
+	if err := os.MkdirAll(s.cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := fmt.Sprintf("nodepass-%s-%s.db", KindUploaded, time.Now().Format("20060102-150405"))
+	target := filepath.Join(s.cfg.Dir, name)
+	tmp := target + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := Validate(tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return s.stat(name)
+}
+
+// StageRestore 校验备份并暂存为待恢复文件，下次启动时生效
+func (s *Service) StageRestore(name string) error {
+	if !s.Supported() {
+		return ErrUnsupported
+	}
+	p, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StageRestoreFile(p, s.dbPath)
+}
+
+// PendingRestore 返回是否存在待恢复文件
+func (s *Service) PendingRestore() bool {
+	if s.dbPath == "" {
+		return false
+	}
+	_, err := os.Stat(s.dbPath + pendingSuffix)
+	return err == nil
+}
+
+// CancelRestore 取消尚未生效的恢复
+func (s *Service) CancelRestore() error {
+	if s.dbPath == "" {
+		return ErrUnsupported
+	}
+	err := os.Remove(s.dbPath + pendingSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// stat 读取备份文件信息
+func (s *Service) stat(name string) (*Info, error) {
+	m := fileNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return nil, fmt.Errorf("无效的备份文件名: %s", name)
+	}
+	fi, err := os.Stat(filepath.Join(s.cfg.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := time.ParseInLocation("20060102-150405", m[2], time.Local)
+	if err != nil {
+		createdAt = fi.ModTime()
+	}
+	return &Info{Name: name, Kind: m[1], Size: fi.Size(), CreatedAt: createdAt}, nil
+}
+
+// Validate 校验备份文件：完整性检查通过、包含核心表，且迁移版本不高于当前程序
+func Validate(path string) error {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("不是有效的 SQLite 数据库: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("完整性检查失败: %s", result)
+	}
+
+	for _, table := range []string{"Endpoint", "Tunnel", "SystemConfig", "schema_migrations"} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("缺少数据表: %s", table)
+		}
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	latest := 0
+	for _, m := range migrate.ForDialect(storage.SQLite) {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	if version.Valid && int(version.Int64) > latest {
+		return fmt.Errorf("备份来自更新版本的程序 (schema %d > %d)", version.Int64, latest)
+	}
+	return nil
+}
+
+// StageRestoreFile 校验备份文件并复制为 dbPath 旁的待恢复文件
+func StageRestoreFile(backupPath, dbPath string) error {
+	if err := CopyDatabase(backupPath, dbPath+pendingSuffix); err != nil {
+		return err
+	}
+	log.Infof("[Backup]已暂存恢复文件 %s，重启服务后生效", filepath.Base(backupPath))
+	return nil
+}
+
+// ApplyPendingRestore 在打开数据库之前调用：存在待恢复文件时，
+// 将当前数据库（含 -wal / -shm）移至 <db>.pre-restore-<时间>，再替换为待恢复文件
+func ApplyPendingRestore(dbPath string) (bool, error) {
+	pending := dbPath + pendingSuffix
+	if _, err := os.Stat(pending); err != nil {
+		return false, nil
+	}
+	if err := Validate(pending); err != nil {
+		// 校验失败则保留当前数据库，并移除无效的待恢复文件
+		os.Rename(pending, pending+".invalid")
+		return false, fmt.Errorf("待恢复文件校验失败，已跳过: %w", err)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := os.Rename(dbPath, dbPath+".pre-restore-"+stamp); err != nil {
+			return false, err
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + suffix); err == nil {
+			if err := os.Rename(dbPath+suffix, dbPath+".pre-restore-"+stamp+suffix); err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := os.Rename(pending, dbPath); err != nil {
+		return false, err
+	}
+	log.Infof("[Backup]已从备份恢复数据库，原数据库保存为 %s", filepath.Base(dbPath+".pre-restore-"+stamp))
+	return true, nil
+}
+
+// CopyDatabase 校验 src 为完整的 SQLite 数据库后复制到 dst，
+// 先写入临时文件再重命名，避免留下不完整的文件
+func CopyDatabase(src, dst string) error {
+	if err := Validate(src); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// copyFile 复制文件并同步到磁盘
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isKind 判断备份是否属于指定类型
+func isKind(info Info, kind string) bool {
+	return strings.EqualFold(info.Kind, kind)
+}
@@ -0,0 +1,411 @@
+// Package config 统一管理服务配置。
+//
+// 配置按 默认值 < 配置文件（YAML / TOML） < 环境变量 < 命令行参数 的优先级合并，
+// 加载后经 Validate 校验，再拆分为各模块自己的 Config 传入构造函数。
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/backup"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/reconcile"
+	"NodePassDash/internal/retention"
+	"NodePassDash/internal/schedule"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/storage"
+	"NodePassDash/internal/traffic"
+	"NodePassDash/internal/tunnel"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 服务配置
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	SSE       SSEConfig       `yaml:"sse" toml:"sse"`
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	Traffic   TrafficConfig   `yaml:"traffic" toml:"traffic"`
+	Backup    BackupConfig    `yaml:"backup" toml:"backup"`
+	Reconcile ReconcileConfig `yaml:"reconcile" toml:"reconcile"`
+	Ports     PortsConfig     `yaml:"ports" toml:"ports"`
+	Schedule  ScheduleConfig  `yaml:"schedule" toml:"schedule"`
+}
+
+// ServerConfig HTTP 服务配置
+type ServerConfig struct {
+	Port            string   `yaml:"port" toml:"port" env:"PORT"`
+	StaticDir       string   `yaml:"staticDir" toml:"staticDir" env:"STATIC_DIR"`
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// DatabaseConfig 数据库配置
+type DatabaseConfig struct {
+	DSN string `yaml:"dsn" toml:"dsn" env:"DB_DSN"`
+}
+
+// LogConfig 日志配置
+// 子系统级别可通过 LOG_LEVEL_<SUBSYSTEM> 环境变量覆盖，如 LOG_LEVEL_SSE=debug
+type LogConfig struct {
+	Level          string            `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format         string            `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+	Subsystems     map[string]string `yaml:"subsystems" toml:"subsystems"`
+	File           string            `yaml:"file" toml:"file" env:"LOG_FILE"`
+	MaxSizeMB      int               `yaml:"maxSizeMB" toml:"maxSizeMB" env:"LOG_MAX_SIZE_MB"`
+	MaxBackups     int               `yaml:"maxBackups" toml:"maxBackups" env:"LOG_MAX_BACKUPS"`
+	MaxAge         Duration          `yaml:"maxAge" toml:"maxAge" env:"LOG_MAX_AGE"`
+	Compress       bool              `yaml:"compress" toml:"compress" env:"LOG_COMPRESS"`
+	RotateInterval Duration          `yaml:"rotateInterval" toml:"rotateInterval" env:"LOG_ROTATE_INTERVAL"`
+}
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	SessionTTL Duration `yaml:"sessionTTL" toml:"sessionTTL" env:"SESSION_TTL"`
+}
+
+// SSEConfig SSE 服务配置
+type SSEConfig struct {
+	Workers             int      `yaml:"workers" toml:"workers" env:"SSE_WORKERS"`
+	StoreWorkers        int      `yaml:"storeWorkers" toml:"storeWorkers" env:"SSE_STORE_WORKERS"`
+	JobQueueSize        int      `yaml:"jobQueueSize" toml:"jobQueueSize" env:"SSE_JOB_QUEUE_SIZE"`
+	StoreQueueSize      int      `yaml:"storeQueueSize" toml:"storeQueueSize" env:"SSE_STORE_QUEUE_SIZE"`
+	BatchQueueSize      int      `yaml:"batchQueueSize" toml:"batchQueueSize" env:"SSE_BATCH_QUEUE_SIZE"`
+	BatchInterval       Duration `yaml:"batchInterval" toml:"batchInterval" env:"SSE_BATCH_INTERVAL"`
+	EventCacheSize      int      `yaml:"eventCacheSize" toml:"eventCacheSize" env:"SSE_EVENT_CACHE_SIZE"`
+	HealthCheckInterval Duration `yaml:"healthCheckInterval" toml:"healthCheckInterval" env:"SSE_HEALTH_CHECK_INTERVAL"`
+	DialTimeout         Duration `yaml:"dialTimeout" toml:"dialTimeout" env:"SSE_DIAL_TIMEOUT"`
+}
+
+// RetentionConfig EndpointSSE 事件与回收站保留配置
+// 各事件类型的保留时长可通过 SSE_RETENTION_<EVENTTYPE> 环境变量覆盖
+type RetentionConfig struct {
+	Policies       map[string]Duration `yaml:"policies" toml:"policies"`
+	Interval       Duration            `yaml:"interval" toml:"interval" env:"SSE_RETENTION_INTERVAL"`
+	ChunkSize      int                 `yaml:"chunkSize" toml:"chunkSize" env:"SSE_RETENTION_CHUNK_SIZE"`
+	ChunkPause     Duration            `yaml:"chunkPause" toml:"chunkPause" env:"SSE_RETENTION_CHUNK_PAUSE"`
+	VacuumInterval Duration            `yaml:"vacuumInterval" toml:"vacuumInterval" env:"SSE_RETENTION_VACUUM_INTERVAL"`
+	Recycle        Duration            `yaml:"recycle" toml:"recycle" env:"RECYCLE_RETENTION"`
+}
+
+// TrafficConfig 流量汇总配置
+type TrafficConfig struct {
+	FlushInterval   Duration `yaml:"flushInterval" toml:"flushInterval" env:"TRAFFIC_FLUSH_INTERVAL"`
+	MinuteRetention Duration `yaml:"minuteRetention" toml:"minuteRetention" env:"TRAFFIC_MINUTE_RETENTION"`
+	HourRetention   Duration `yaml:"hourRetention" toml:"hourRetention" env:"TRAFFIC_HOUR_RETENTION"`
+	DayRetention    Duration `yaml:"dayRetention" toml:"dayRetention" env:"TRAFFIC_DAY_RETENTION"`
+}
+
+// BackupConfig 数据库备份配置
+type BackupConfig struct {
+	Dir        string   `yaml:"dir" toml:"dir" env:"BACKUP_DIR"`
+	DailyKeep  int      `yaml:"dailyKeep" toml:"dailyKeep" env:"BACKUP_KEEP_DAILY"`
+	WeeklyKeep int      `yaml:"weeklyKeep" toml:"weeklyKeep" env:"BACKUP_KEEP_WEEKLY"`
+	Interval   Duration `yaml:"interval" toml:"interval" env:"BACKUP_INTERVAL"`
+}
+
+// ReconcileConfig 主控与数据库对账配置
+// 端点可单独设置对账间隔，未设置时使用 interval
+type ReconcileConfig struct {
+	Interval Duration `yaml:"interval" toml:"interval" env:"RECONCILE_INTERVAL"`
+	Unknown  string   `yaml:"unknown" toml:"unknown" env:"RECONCILE_UNKNOWN"`
+	Missing  string   `yaml:"missing" toml:"missing" env:"RECONCILE_MISSING"`
+}
+
+// PortsConfig 隧道端口范围，格式如 "10000-20000,30000"
+// 端点可单独设置允许范围（覆盖 allowed）与保留范围（与 reserved 合并）
+type PortsConfig struct {
+	Allowed  string `yaml:"allowed" toml:"allowed" env:"PORTS_ALLOWED"`
+	Reserved string `yaml:"reserved" toml:"reserved" env:"PORTS_RESERVED"`
+}
+
+// ScheduleConfig 隧道定时任务配置
+// 停机期间错过的执行仅在最近一次错过的时间距启动不超过 catchUpWindow 时补执行（且任务设置为 run）
+type ScheduleConfig struct {
+	CatchUpWindow Duration `yaml:"catchUpWindow" toml:"catchUpWindow" env:"SCHEDULE_CATCHUP_WINDOW"`
+	HistoryKeep   int      `yaml:"historyKeep" toml:"historyKeep" env:"SCHEDULE_HISTORY_KEEP"`
+}
+
+// Default 返回默认配置，各模块的默认值取自其 DefaultConfig
+func Default() *Config {
+	sseCfg := sse.DefaultConfig()
+	retCfg := retention.DefaultConfig()
+	trafficCfg := traffic.DefaultConfig()
+	backupCfg := backup.DefaultConfig()
+	reconcileCfg := reconcile.DefaultConfig()
+	tunnelCfg := tunnel.DefaultConfig()
+	scheduleCfg := schedule.DefaultConfig()
+
+	policies := make(map[string]Duration, len(retCfg.Policies))
+	for k, v := range retCfg.Policies {
+		policies[k] = Duration(v)
+	}
+
+	return &Config{
+		Server: ServerConfig{
+			Port:            "3000",
+			StaticDir:       "dist",
+			ShutdownTimeout: Duration(5 * time.Second),
+		},
+		Database: DatabaseConfig{DSN: storage.DefaultDSN},
+		Log: LogConfig{
+			Level:      "info",
+			Format:     "text",
+			Subsystems: map[string]string{},
+			MaxSizeMB:  100,
+			MaxBackups: 7,
+			MaxAge:     Duration(30 * 24 * time.Hour),
+		},
+		Auth: AuthConfig{SessionTTL: Duration(auth.DefaultConfig().SessionTTL)},
+		SSE: SSEConfig{
+			Workers:             sseCfg.Workers,
+			StoreWorkers:        sseCfg.StoreWorkers,
+			JobQueueSize:        sseCfg.JobQueueSize,
+			StoreQueueSize:      sseCfg.StoreQueueSize,
+			BatchQueueSize:      sseCfg.BatchQueueSize,
+			BatchInterval:       Duration(sseCfg.BatchInterval),
+			EventCacheSize:      sseCfg.EventCacheSize,
+			HealthCheckInterval: Duration(sseCfg.HealthCheckInterval),
+			DialTimeout:         Duration(sseCfg.DialTimeout),
+		},
+		Retention: RetentionConfig{
+			Policies:       policies,
+			Interval:       Duration(retCfg.Interval),
+			ChunkSize:      retCfg.ChunkSize,
+			ChunkPause:     Duration(retCfg.ChunkPause),
+			VacuumInterval: Duration(retCfg.VacuumInterval),
+			Recycle:        Duration(retCfg.Recycle),
+		},
+		Traffic: TrafficConfig{
+			FlushInterval:   Duration(trafficCfg.FlushInterval),
+			MinuteRetention: Duration(trafficCfg.MinuteRetention),
+			HourRetention:   Duration(trafficCfg.HourRetention),
+			DayRetention:    Duration(trafficCfg.DayRetention),
+		},
+		Backup: BackupConfig{
+			Dir:        backupCfg.Dir,
+			DailyKeep:  backupCfg.DailyKeep,
+			WeeklyKeep: backupCfg.WeeklyKeep,
+			Interval:   Duration(backupCfg.Interval),
+		},
+		Reconcile: ReconcileConfig{
+			Interval: Duration(reconcileCfg.Interval),
+			Unknown:  reconcileCfg.Unknown,
+			Missing:  reconcileCfg.Missing,
+		},
+		Ports: PortsConfig{
+			Allowed:  tunnelCfg.AllowedPorts.String(),
+			Reserved: tunnelCfg.ReservedPorts.String(),
+		},
+		Schedule: ScheduleConfig{
+			CatchUpWindow: Duration(scheduleCfg.CatchUpWindow),
+			HistoryKeep:   scheduleCfg.HistoryKeep,
+		},
+	}
+}
+
+// Load 加载配置：默认值 -> 配置文件（path 为空时跳过） -> 环境变量
+// 命令行参数由调用方在 Load 之后覆盖，最后调用 Validate
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile 按扩展名解析 YAML / TOML 配置文件，未知字段视为错误
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err.Error() != "EOF" {
+			return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("配置文件 %s 包含未知字段: %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s（仅支持 .yaml / .yml / .toml）", path)
+	}
+	return nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	var errs []string
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		add("server.port 无效: %q", c.Server.Port)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		add("server.shutdownTimeout 必须大于 0")
+	}
+	if _, _, _, err := storage.Parse(c.Database.DSN); err != nil {
+		add("database.dsn 无效: %v", err)
+	}
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		add("log.level %v", err)
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "text", "json":
+	default:
+		add("log.format 无效: %q（可选 text / json）", c.Log.Format)
+	}
+	for sub, level := range c.Log.Subsystems {
+		if !isLogSubsystem(sub) {
+			add("log.subsystems 包含未知子系统 %q（可选 %s）", sub, strings.Join(log.Subsystems, " / "))
+		} else if _, err := log.ParseLevel(level); err != nil {
+			add("log.subsystems.%s %v", sub, err)
+		}
+	}
+	if c.Log.File != "" && c.Log.MaxSizeMB <= 0 {
+		add("log.maxSizeMB 必须大于 0")
+	}
+	if c.Log.MaxBackups < 0 || c.Log.MaxAge < 0 || c.Log.RotateInterval < 0 {
+		add("log.maxBackups / maxAge / rotateInterval 不能为负数")
+	}
+	if c.Auth.SessionTTL <= 0 {
+		add("auth.sessionTTL 必须大于 0")
+	}
+
+	if c.SSE.Workers < 0 {
+		add("sse.workers 不能为负数（0 表示自动）")
+	}
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"sse.storeWorkers", c.SSE.StoreWorkers},
+		{"sse.jobQueueSize", c.SSE.JobQueueSize},
+		{"sse.storeQueueSize", c.SSE.StoreQueueSize},
+		{"sse.batchQueueSize", c.SSE.BatchQueueSize},
+		{"sse.eventCacheSize", c.SSE.EventCacheSize},
+		{"retention.chunkSize", c.Retention.ChunkSize},
+		{"backup.dailyKeep", c.Backup.DailyKeep},
+		{"backup.weeklyKeep", c.Backup.WeeklyKeep},
+		{"schedule.historyKeep", c.Schedule.HistoryKeep},
+	} {
+		if f.value <= 0 {
+			add("%s 必须大于 0", f.name)
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value Duration
+	}{
+		{"sse.batchInterval", c.SSE.BatchInterval},
+		{"sse.healthCheckInterval", c.SSE.HealthCheckInterval},
+		{"sse.dialTimeout", c.SSE.DialTimeout},
+		{"retention.interval", c.Retention.Interval},
+		{"traffic.flushInterval", c.Traffic.FlushInterval},
+	} {
+		if f.value <= 0 {
+			add("%s 必须大于 0", f.name)
+		}
+	}
+	for eventType, v := range c.Retention.Policies {
+		if v < 0 {
+			add("retention.policies.%s 不能为负数", eventType)
+		}
+	}
+	if c.Retention.Recycle < 0 {
+		add("retention.recycle 不能为负数（0 表示永久保留）")
+	}
+	if c.Traffic.MinuteRetention > c.Traffic.HourRetention || c.Traffic.HourRetention > c.Traffic.DayRetention {
+		add("traffic 保留时长需满足 minuteRetention <= hourRetention <= dayRetention")
+	}
+	if c.Backup.Interval < 0 {
+		add("backup.interval 不能为负数（0 表示关闭定时备份）")
+	}
+	if c.Reconcile.Interval < 0 {
+		add("reconcile.interval 不能为负数（0 表示默认关闭）")
+	}
+	if !reconcile.ValidUnknown(c.Reconcile.Unknown) {
+		add("reconcile.unknown 无效: %q（可选 report / adopt）", c.Reconcile.Unknown)
+	}
+	if !reconcile.ValidMissing(c.Reconcile.Missing) {
+		add("reconcile.missing 无效: %q（可选 mark / recreate / delete）", c.Reconcile.Missing)
+	}
+	if _, err := tunnel.ParsePortRanges(c.Ports.Allowed); err != nil {
+		add("ports.allowed %v", err)
+	}
+	if _, err := tunnel.ParsePortRanges(c.Ports.Reserved); err != nil {
+		add("ports.reserved %v", err)
+	}
+	if c.Schedule.CatchUpWindow < 0 {
+		add("schedule.catchUpWindow 不能为负数（0 表示从不补执行）")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("配置无效:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+// Dump 以 YAML（默认）或 TOML 格式输出配置，数据库密码会被隐藏
+func (c *Config) Dump(format string) ([]byte, error) {
+	out := *c
+	out.Database.DSN = redactDSN(c.Database.DSN)
+
+	if strings.EqualFold(format, "toml") {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(out); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return yaml.Marshal(out)
+}
+
+// isLogSubsystem 判断是否为支持单独设置级别的日志子系统
+func isLogSubsystem(name string) bool {
+	for _, sub := range log.Subsystems {
+		if sub == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactDSN 隐藏 DSN 中的密码
+func redactDSN(dsn string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	return u.Redacted()
+}
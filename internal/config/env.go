@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	log "NodePassDash/internal/log"
+)
+
+// retentionEnvPrefix 单个事件类型保留时长的环境变量前缀
+const retentionEnvPrefix = "SSE_RETENTION_"
+
+// logLevelEnvPrefix 子系统日志级别的环境变量前缀
+const logLevelEnvPrefix = "LOG_LEVEL_"
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// applyEnv 按字段的 env 标签读取环境变量覆盖配置
+func (c *Config) applyEnv() error {
+	if err := applyEnvStruct(reflect.ValueOf(c).Elem()); err != nil {
+		return err
+	}
+
+	// SSE_RETENTION_<EVENTTYPE>=7d / 24h / 0（永久保留）
+	for eventType := range c.Retention.Policies {
+		key := retentionEnvPrefix + strings.ToUpper(eventType)
+		if v := os.Getenv(key); v != "" {
+			d, err := ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s: %w", key, err)
+			}
+			c.Retention.Policies[eventType] = Duration(d)
+		}
+	}
+
+	// LOG_LEVEL_<SUBSYSTEM>=debug
+	for _, sub := range log.Subsystems {
+		if v := os.Getenv(logLevelEnvPrefix + strings.ToUpper(sub)); v != "" {
+			if c.Log.Subsystems == nil {
+				c.Log.Subsystems = map[string]string{}
+			}
+			c.Log.Subsystems[sub] = v
+		}
+	}
+	return nil
+}
+
+// applyEnvStruct 递归处理结构体字段
+func applyEnvStruct(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvStruct(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := t.Field(i).Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(key)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			return fmt.Errorf("环境变量 %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setField 将字符串写入字段
+func setField(field reflect.Value, raw string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("无效的整数: %s", raw)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("无效的布尔值: %s", raw)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("不支持的字段类型 %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"time"
+
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/backup"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/reconcile"
+	"NodePassDash/internal/retention"
+	"NodePassDash/internal/schedule"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/traffic"
+	"NodePassDash/internal/tunnel"
+)
+
+// Options 转换为认证服务配置
+func (c AuthConfig) Options() auth.Config {
+	return auth.Config{SessionTTL: c.SessionTTL.D()}
+}
+
+// Options 转换为 SSE 服务配置
+func (c SSEConfig) Options() sse.Config {
+	return sse.Config{
+		Workers:             c.Workers,
+		StoreWorkers:        c.StoreWorkers,
+		JobQueueSize:        c.JobQueueSize,
+		StoreQueueSize:      c.StoreQueueSize,
+		BatchQueueSize:      c.BatchQueueSize,
+		BatchInterval:       c.BatchInterval.D(),
+		EventCacheSize:      c.EventCacheSize,
+		HealthCheckInterval: c.HealthCheckInterval.D(),
+		DialTimeout:         c.DialTimeout.D(),
+	}
+}
+
+// Options 转换为事件保留任务配置
+func (c RetentionConfig) Options() retention.Config {
+	policies := make(map[string]time.Duration, len(c.Policies))
+	for k, v := range c.Policies {
+		policies[k] = v.D()
+	}
+	return retention.Config{
+		Policies:       policies,
+		Interval:       c.Interval.D(),
+		ChunkSize:      c.ChunkSize,
+		ChunkPause:     c.ChunkPause.D(),
+		VacuumInterval: c.VacuumInterval.D(),
+		Recycle:        c.Recycle.D(),
+	}
+}
+
+// Options 转换为流量汇总配置
+func (c TrafficConfig) Options() traffic.Config {
+	return traffic.Config{
+		FlushInterval:   c.FlushInterval.D(),
+		MinuteRetention: c.MinuteRetention.D(),
+		HourRetention:   c.HourRetention.D(),
+		DayRetention:    c.DayRetention.D(),
+	}
+}
+
+// Options 转换为备份服务配置
+func (c BackupConfig) Options() backup.Config {
+	return backup.Config{
+		Dir:        c.Dir,
+		DailyKeep:  c.DailyKeep,
+		WeeklyKeep: c.WeeklyKeep,
+		Interval:   c.Interval.D(),
+	}
+}
+
+// Options 转换为日志配置
+func (c LogConfig) Options() log.Config {
+	return log.Config{
+		Level:          c.Level,
+		Format:         c.Format,
+		Subsystems:     c.Subsystems,
+		File:           c.File,
+		MaxSizeMB:      c.MaxSizeMB,
+		MaxBackups:     c.MaxBackups,
+		MaxAge:         c.MaxAge.D(),
+		Compress:       c.Compress,
+		RotateInterval: c.RotateInterval.D(),
+	}
+}
+
+// Options 转换为对账任务配置
+func (c ReconcileConfig) Options() reconcile.Config {
+	return reconcile.Config{
+		Interval: c.Interval.D(),
+		Unknown:  c.Unknown,
+		Missing:  c.Missing,
+	}
+}
+
+// Options 转换为隧道服务配置，端口范围已在 Validate 中校验
+func (c PortsConfig) Options() tunnel.Config {
+	allowed, _ := tunnel.ParsePortRanges(c.Allowed)
+	reserved, _ := tunnel.ParsePortRanges(c.Reserved)
+	return tunnel.Config{AllowedPorts: allowed, ReservedPorts: reserved}
+}
+
+// Options 转换为定时任务配置
+func (c ScheduleConfig) Options() schedule.Config {
+	return schedule.Config{
+		CatchUpWindow: c.CatchUpWindow.D(),
+		HistoryKeep:   c.HistoryKeep,
+	}
+}
@@ -66,13 +66,16 @@ type DashboardStats struct {
 	} `json:"recentLogs"`
 
 	// 最活跃的隧道（按流量排序）
-	TopTunnels []struct {
-		ID        int64  `json:"id"`
-		Name      string `json:"name"`
-		Type      string `json:"type"`
-		Traffic   int64  `json:"traffic"`
-		Formatted string `json:"formatted"`
-	} `json:"topTunnels"`
+	TopTunnels []TopTunnel `json:"topTunnels"`
+}
+
+// TopTunnel 最活跃隧道条目
+type TopTunnel struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Traffic   int64  `json:"traffic"`
+	Formatted string `json:"formatted"`
 }
 
 // TimeRange 时间范围
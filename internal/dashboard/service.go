@@ -3,24 +3,100 @@ package dashboard
 import (
 	"database/sql"
 	"fmt"
-	"sort"
+	"strings"
 	"time"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/traffic"
 )
 
 // Service 仪表盘服务
 type Service struct {
-	db *sql.DB
+	db      *sql.DB
+	traffic *traffic.Store
 }
 
 // NewService 创建仪表盘服务实例
 func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, traffic: traffic.NewStore(db)}
+}
+
+// scope 按标签选择器限定统计范围，nil 表示不限
+type scope struct {
+	tunnelIDs   []int64
+	endpointIDs []int64
+	allTunnels  int // 隧道总数（未筛选）
+}
+
+// loadScope 查询匹配选择器的隧道及其所属端点
+func (s *Service) loadScope(sel labels.Selector) (*scope, error) {
+	rows, err := s.db.Query(`SELECT id, endpointId, labels FROM "Tunnel" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sc := &scope{}
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var id, endpointID int64
+		var labelsVal sql.NullString
+		if err := rows.Scan(&id, &endpointID, &labelsVal); err != nil {
+			return nil, err
+		}
+		sc.allTunnels++
+		if !sel.Matches(labels.Decode(labelsVal.String)) {
+			continue
+		}
+		sc.tunnelIDs = append(sc.tunnelIDs, id)
+		if !seen[endpointID] {
+			seen[endpointID] = true
+			sc.endpointIDs = append(sc.endpointIDs, endpointID)
+		}
+	}
+	return sc, rows.Err()
+}
+
+// inClause 生成 " AND column IN (...)" 条件，ids 为空时不匹配任何记录
+func inClause(column string, ids []int64) (string, []interface{}) {
+	if len(ids) == 0 {
+		return " AND 1 = 0", nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return " AND " + column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")", args
+}
+
+// tunnels 限定隧道 ID 的条件，sc 为 nil 时返回空条件
+func (sc *scope) tunnels(column string) (string, []interface{}) {
+	if sc == nil {
+		return "", nil
+	}
+	return inClause(column, sc.tunnelIDs)
+}
+
+// endpoints 限定端点 ID 的条件，sc 为 nil 时返回空条件
+func (sc *scope) endpoints(column string) (string, []interface{}) {
+	if sc == nil {
+		return "", nil
+	}
+	return inClause(column, sc.endpointIDs)
 }
 
-// GetStats 获取仪表盘统计数据
-func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
+// GetStats 获取仪表盘统计数据；sel 非空时仅统计标签匹配的隧道及其所属端点
+func (s *Service) GetStats(timeRange TimeRange, sel labels.Selector) (*DashboardStats, error) {
 	stats := &DashboardStats{}
 
+	var sc *scope
+	if !sel.Empty() {
+		var err error
+		if sc, err = s.loadScope(sel); err != nil {
+			return nil, fmt.Errorf("筛选隧道失败: %v", err)
+		}
+	}
+
 	// 获取时间范围
 	startTime := time.Now()
 	switch timeRange {
@@ -37,6 +113,7 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 	}
 
 	// 获取总览数据
+	cond, condArgs := sc.tunnels("t.id")
 	err := s.db.QueryRow(`
 		SELECT 
 			COUNT(DISTINCT e.id) as total_endpoints,
@@ -47,8 +124,7 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			COALESCE(SUM(t.tcpRx + t.tcpTx + t.udpRx + t.udpTx), 0) as total_traffic
 		FROM "Endpoint" e
 		LEFT JOIN "Tunnel" t ON e.id = t.endpointId
-		WHERE (? = '' OR t.createdAt >= ?)
-	`, startTime, startTime).Scan(
+		WHERE (? = '' OR t.createdAt >= ?)`+cond, append([]interface{}{startTime, startTime}, condArgs...)...).Scan(
 		&stats.Overview.TotalEndpoints,
 		&stats.Overview.TotalTunnels,
 		&stats.Overview.RunningTunnels,
@@ -62,6 +138,7 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 
 	// 获取流量统计
 	var tcpRx, tcpTx, udpRx, udpTx int64
+	cond, condArgs = sc.tunnels("id")
 	err = s.db.QueryRow(`
 		SELECT 
 			COALESCE(SUM(tcpRx), 0) as tcp_rx,
@@ -69,8 +146,7 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			COALESCE(SUM(udpRx), 0) as udp_rx,
 			COALESCE(SUM(udpTx), 0) as udp_tx
 		FROM "Tunnel"
-		WHERE (? = '' OR createdAt >= ?)
-	`, startTime, startTime).Scan(&tcpRx, &tcpTx, &udpRx, &udpTx)
+		WHERE (? = '' OR createdAt >= ?)`+cond, append([]interface{}{startTime, startTime}, condArgs...)...).Scan(&tcpRx, &tcpTx, &udpRx, &udpTx)
 	if err != nil {
 		return nil, fmt.Errorf("获取流量统计失败: %v", err)
 	}
@@ -89,15 +165,16 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 	stats.Traffic.Total.Value = totalTraffic
 	stats.Traffic.Total.Formatted = formatTrafficBytes(totalTraffic)
 
-	// 获取端点状态分布
+	// 获取端点状态分布（5 分钟内有检查记录视为在线）
+	onlineSince := time.Now().Add(-5 * time.Minute).UTC()
+	cond, condArgs = sc.endpoints("id")
 	err = s.db.QueryRow(`
 		SELECT 
-			COUNT(CASE WHEN lastCheck >= datetime('now', '-5 minutes') THEN 1 END) as online,
-			COUNT(CASE WHEN lastCheck < datetime('now', '-5 minutes') THEN 1 END) as offline,
+			COUNT(CASE WHEN lastCheck >= ? THEN 1 END) as online,
+			COUNT(CASE WHEN lastCheck < ? THEN 1 END) as offline,
 			COUNT(*) as total
 		FROM "Endpoint"
-		WHERE (? = '' OR createdAt >= ?)
-	`, startTime, startTime).Scan(
+		WHERE (? = '' OR createdAt >= ?)`+cond, append([]interface{}{onlineSince, onlineSince, startTime, startTime}, condArgs...)...).Scan(
 		&stats.EndpointStatus.Online,
 		&stats.EndpointStatus.Offline,
 		&stats.EndpointStatus.Total,
@@ -107,14 +184,14 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 	}
 
 	// 获取隧道类型分布
+	cond, condArgs = sc.tunnels("id")
 	err = s.db.QueryRow(`
 		SELECT 
 			COUNT(CASE WHEN mode = 'server' THEN 1 END) as server,
 			COUNT(CASE WHEN mode = 'client' THEN 1 END) as client,
 			COUNT(*) as total
 		FROM "Tunnel"
-		WHERE (? = '' OR createdAt >= ?)
-	`, startTime, startTime).Scan(
+		WHERE (? = '' OR createdAt >= ?)`+cond, append([]interface{}{startTime, startTime}, condArgs...)...).Scan(
 		&stats.TunnelTypes.Server,
 		&stats.TunnelTypes.Client,
 		&stats.TunnelTypes.Total,
@@ -124,14 +201,15 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 	}
 
 	// 获取最近的操作日志
+	cond, condArgs = sc.tunnels("tunnelId")
 	rows, err := s.db.Query(`
 		SELECT 
 			id, tunnelId, tunnelName, action, status, message, createdAt
 		FROM "TunnelOperationLog"
-		WHERE (? = '' OR createdAt >= ?)
+		WHERE (? = '' OR createdAt >= ?)`+cond+`
 		ORDER BY createdAt DESC
 		LIMIT 10
-	`, startTime, startTime)
+	`, append([]interface{}{startTime, startTime}, condArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("获取操作日志失败: %v", err)
 	}
@@ -162,18 +240,54 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 		stats.RecentLogs = append(stats.RecentLogs, log)
 	}
 
-	// 获取最活跃的隧道
-	rows, err = s.db.Query(`
+	// 获取最活跃的隧道：限定时间范围时按汇总表中该范围内的流量增量排序
+	if timeRange == TimeRangeAllTime {
+		if err := s.fillTopTunnelsAllTime(stats, startTime, sc); err != nil {
+			return nil, err
+		}
+	} else {
+		// 筛选时取出全部隧道的排名后再过滤
+		limit := 5
+		var matched map[int64]bool
+		if sc != nil {
+			limit = sc.allTunnels
+			matched = make(map[int64]bool, len(sc.tunnelIDs))
+			for _, id := range sc.tunnelIDs {
+				matched[id] = true
+			}
+		}
+		top, err := s.traffic.TopTunnels(startTime, limit, "total")
+		if err != nil {
+			return nil, fmt.Errorf("获取最活跃隧道失败: %v", err)
+		}
+		for _, t := range top {
+			if matched != nil && !matched[t.TunnelID] {
+				continue
+			}
+			if len(stats.TopTunnels) == 5 {
+				break
+			}
+			stats.TopTunnels = append(stats.TopTunnels, topTunnelItem(t.TunnelID, t.Name, t.Mode, t.Total))
+		}
+	}
+
+	return stats, nil
+}
+
+// fillTopTunnelsAllTime 按隧道累计流量排序
+func (s *Service) fillTopTunnelsAllTime(stats *DashboardStats, startTime time.Time, sc *scope) error {
+	cond, condArgs := sc.tunnels("id")
+	rows, err := s.db.Query(`
 		SELECT 
 			id, name, mode,
 			(tcpRx + tcpTx + udpRx + udpTx) as total_traffic
 		FROM "Tunnel"
-		WHERE (? = '' OR createdAt >= ?)
+		WHERE (? = '' OR createdAt >= ?)`+cond+`
 		ORDER BY total_traffic DESC
 		LIMIT 5
-	`, startTime, startTime)
+	`, append([]interface{}{startTime, startTime}, condArgs...)...)
 	if err != nil {
-		return nil, fmt.Errorf("获取最活跃隧道失败: %v", err)
+		return fmt.Errorf("获取最活跃隧道失败: %v", err)
 	}
 	defer rows.Close()
 
@@ -184,32 +298,27 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			Mode    string
 			Traffic int64
 		}
-		err := rows.Scan(&t.ID, &t.Name, &t.Mode, &t.Traffic)
-		if err != nil {
-			return nil, fmt.Errorf("读取隧道数据失败: %v", err)
+		if err := rows.Scan(&t.ID, &t.Name, &t.Mode, &t.Traffic); err != nil {
+			return fmt.Errorf("读取隧道数据失败: %v", err)
 		}
-
-		tunnelType := "客户端"
-		if t.Mode == "server" {
-			tunnelType = "服务端"
-		}
-
-		stats.TopTunnels = append(stats.TopTunnels, struct {
-			ID        int64  `json:"id"`
-			Name      string `json:"name"`
-			Type      string `json:"type"`
-			Traffic   int64  `json:"traffic"`
-			Formatted string `json:"formatted"`
-		}{
-			ID:        t.ID,
-			Name:      t.Name,
-			Type:      tunnelType,
-			Traffic:   t.Traffic,
-			Formatted: formatTrafficBytes(t.Traffic),
-		})
+		stats.TopTunnels = append(stats.TopTunnels, topTunnelItem(t.ID, t.Name, t.Mode, t.Traffic))
 	}
+	return nil
+}
 
-	return stats, nil
+// topTunnelItem 构造最活跃隧道条目
+func topTunnelItem(id int64, name, mode string, traffic int64) TopTunnel {
+	tunnelType := "客户端"
+	if mode == "server" {
+		tunnelType = "服务端"
+	}
+	return TopTunnel{
+		ID:        id,
+		Name:      name,
+		Type:      tunnelType,
+		Traffic:   traffic,
+		Formatted: formatTrafficBytes(traffic),
+	}
 }
 
 // formatTrafficBytes 格式化流量数据
@@ -257,74 +366,31 @@ type TrafficTrendItem struct {
 	RecordCount int    `json:"recordCount"`
 }
 
-// GetTrafficTrend 获取最近 hours 小时内的流量趋势，默认24小时
+// GetTrafficTrend 获取最近 hours 小时内每小时的流量增量，默认24小时
+// 数据来自流量汇总表，缺失的小时补零
 func (s *Service) GetTrafficTrend(hours int) ([]TrafficTrendItem, error) {
 	if hours <= 0 {
 		hours = 24
 	}
 
-	// 查询最近 hours 小时的 EndpointSSE 记录 (initial、update)
-	rows, err := s.db.Query(`
-		SELECT eventTime, tcpRx, tcpTx, udpRx, udpTx
-		FROM "EndpointSSE"
-		WHERE pushType IN ('initial','update')
-		  AND eventTime >= datetime('now', ?||' hours')
-		  AND (tcpRx IS NOT NULL OR tcpTx IS NOT NULL OR udpRx IS NOT NULL OR udpTx IS NOT NULL)
-		ORDER BY eventTime DESC
-		LIMIT 500`, -hours)
+	now := time.Now()
+	from := now.Add(-time.Duration(hours-1) * time.Hour)
+	points, err := s.traffic.Trend(traffic.ResolutionHour, from, now, traffic.Filter{})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	type rec struct {
-		t                          time.Time
-		tcpRx, tcpTx, udpRx, udpTx sql.NullInt64
-	}
-
-	hourly := make(map[string]*TrafficTrendItem)
-
-	for rows.Next() {
-		var r rec
-		if err := rows.Scan(&r.t, &r.tcpRx, &r.tcpTx, &r.udpRx, &r.udpTx); err != nil {
-			return nil, err
-		}
 
-		hourKey := r.t.Format("2006-01-02 15:00:00")
-		if _, ok := hourly[hourKey]; !ok {
-			hourly[hourKey] = &TrafficTrendItem{
-				HourTime:    hourKey,
-				HourDisplay: r.t.Format("15:00"),
-			}
-		}
-		item := hourly[hourKey]
-		if r.tcpRx.Valid {
-			item.TCPRx += r.tcpRx.Int64
-		}
-		if r.tcpTx.Valid {
-			item.TCPTx += r.tcpTx.Int64
-		}
-		if r.udpRx.Valid {
-			item.UDPRx += r.udpRx.Int64
-		}
-		if r.udpTx.Valid {
-			item.UDPTx += r.udpTx.Int64
-		}
-		item.RecordCount++
-	}
-
-	// 转为 slice 并排序
-	var list []TrafficTrendItem
-	for _, v := range hourly {
-		list = append(list, *v)
-	}
-	// sort by HourTime asc
-	sort.Slice(list, func(i, j int) bool { return list[i].HourTime < list[j].HourTime })
-
-	// 只取最近 hours 条 (可能不足)
-	if len(list) > hours {
-		list = list[len(list)-hours:]
+	list := make([]TrafficTrendItem, 0, len(points))
+	for _, p := range points {
+		list = append(list, TrafficTrendItem{
+			HourTime:    p.Time.Format("2006-01-02 15:00:00"),
+			HourDisplay: p.Time.Format("15:00"),
+			TCPRx:       p.TCPRx,
+			TCPTx:       p.TCPTx,
+			UDPRx:       p.UDPRx,
+			UDPTx:       p.UDPTx,
+			RecordCount: int(p.Samples),
+		})
 	}
-
 	return list, nil
 }
@@ -0,0 +1,245 @@
+package endpoint
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/pagination"
+	"NodePassDash/internal/storage"
+)
+
+// ListQuery 端点列表查询条件，空值表示不限
+type ListQuery struct {
+	Status string
+	// Search 名称或地址包含的关键字（不区分大小写）
+	Search string
+	// Labels 标签选择器，非空时在内存中筛选后再分页
+	Labels labels.Selector
+	pagination.Params
+}
+
+// ListResult 端点列表查询结果
+type ListResult struct {
+	Endpoints  []EndpointWithStats `json:"endpoints"`
+	Total      int                 `json:"total"`
+	Page       int                 `json:"page,omitempty"`
+	Size       int                 `json:"size,omitempty"`
+	TotalPages int                 `json:"totalPages,omitempty"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+// 默认排序：创建时间倒序
+const defaultEndpointSort = "createdAt"
+
+// endpointSortFields 可排序字段（基于带统计的派生表 x）
+var endpointSortFields = map[string]pagination.Field{
+	"id":            {Expr: "x.id", Kind: pagination.KindInt},
+	"name":          {Expr: "x.name", Kind: pagination.KindString},
+	"status":        {Expr: "x.status", Kind: pagination.KindString},
+	"lastCheck":     {Expr: "x.lastCheck", Kind: pagination.KindTime},
+	"createdAt":     {Expr: "x.createdAt", Kind: pagination.KindTime},
+	"tunnelCount":   {Expr: "x.tunnelCount", Kind: pagination.KindInt},
+	"activeTunnels": {Expr: "x.activeTunnels", Kind: pagination.KindInt},
+}
+
+// endpointsWithStats 端点及其隧道统计的派生表
+const endpointsWithStats = `(
+		SELECT
+			e.id, e.name, e.url, e.apiPath, e.apiKey, e.status, e.color, e.labels,
+			e.lastCheck, e.createdAt, e.updatedAt,
+			COUNT(t.id) as tunnelCount,
+			COUNT(CASE WHEN t.status = 'running' THEN 1 END) as activeTunnels
+		FROM "Endpoint" e
+		LEFT JOIN "Tunnel" t ON e.id = t.endpointId
+		GROUP BY e.id
+	) x`
+
+// sortValue 返回端点在排序字段上的值，用于生成游标
+func (e *EndpointWithStats) sortValue(field string) interface{} {
+	switch field {
+	case "id":
+		return e.ID
+	case "name":
+		return e.Name
+	case "status":
+		return string(e.Status)
+	case "lastCheck":
+		return e.LastCheck
+	case "tunnelCount":
+		return e.TunnelCount
+	case "activeTunnels":
+		return e.ActiveTunnels
+	}
+	return e.CreatedAt
+}
+
+// conditions 生成筛选条件（不含标签选择器）
+func (q ListQuery) conditions() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if q.Status != "" {
+		conds = append(conds, "x.status = ?")
+		args = append(args, q.Status)
+	}
+	if q.Search != "" {
+		keyword := "%" + strings.ToLower(q.Search) + "%"
+		conds = append(conds, "(LOWER(x.name) LIKE ? OR LOWER(x.url) LIKE ?)")
+		args = append(args, keyword, keyword)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// ListEndpoints 按条件查询端点列表，支持偏移分页与游标分页
+func (s *Service) ListEndpoints(q ListQuery) (*ListResult, error) {
+	sortName, desc := q.Sort, q.Desc
+	if sortName == "" {
+		sortName, desc = defaultEndpointSort, true
+	}
+	field, ok := endpointSortFields[sortName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", pagination.ErrInvalidSort, sortName)
+	}
+	if field.Kind == pagination.KindTime {
+		field.Expr = storage.DialectOf(s.db).UnixTime(field.Expr)
+	}
+
+	where, args := q.conditions()
+	res := &ListResult{}
+
+	// 总数（不受游标影响）
+	if q.Paged() {
+		total, err := s.countEndpoints(where, args, q.Labels)
+		if err != nil {
+			return nil, err
+		}
+		res.Total = total
+		res.Size = q.Size
+		res.TotalPages = pagination.TotalPages(total, q.Size)
+		if q.Cursor == "" {
+			res.Page = q.Page
+		}
+	}
+
+	dataWhere, dataArgs := where, args
+	if q.Cursor != "" {
+		c, err := pagination.DecodeCursor(q.Cursor)
+		if err != nil || c.Sort != sortName || c.Desc != desc {
+			return nil, pagination.ErrInvalidCursor
+		}
+		cond, condArgs, err := field.Keyset(c, "x.id")
+		if err != nil {
+			return nil, err
+		}
+		if dataWhere != "" {
+			dataWhere += " AND "
+		}
+		dataWhere += cond
+		dataArgs = append(append([]interface{}{}, args...), condArgs...)
+	}
+
+	query := `
+		SELECT
+			x.id, x.name, x.url, x.apiPath, x.apiKey, x.status, x.color, x.labels,
+			x.lastCheck, x.createdAt, x.updatedAt, x.tunnelCount, x.activeTunnels
+		FROM ` + endpointsWithStats
+	if dataWhere != "" {
+		query += " WHERE " + dataWhere
+	}
+	query += " ORDER BY " + field.OrderBy("x.id", desc)
+
+	// 多取一条判断是否还有下一页；有标签选择器时无法在 SQL 中分页
+	if q.Paged() && q.Labels.Empty() {
+		query += " LIMIT ? OFFSET ?"
+		dataArgs = append(dataArgs, q.Size+1, q.Offset())
+	}
+
+	rows, err := s.db.Query(query, dataArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []EndpointWithStats
+	for rows.Next() {
+		var e EndpointWithStats
+		var statusStr string
+		var labelsVal sql.NullString
+		err := rows.Scan(
+			&e.ID, &e.Name, &e.URL, &e.APIPath, &e.APIKey, &statusStr, &e.Color, &labelsVal,
+			&e.LastCheck, &e.CreatedAt, &e.UpdatedAt,
+			&e.TunnelCount, &e.ActiveTunnels,
+		)
+		if err != nil {
+			return nil, err
+		}
+		e.Status = EndpointStatus(statusStr)
+		e.Labels = labels.Decode(labelsVal.String)
+		if !q.Labels.Matches(e.Labels) {
+			continue
+		}
+		endpoints = append(endpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.Paged() && !q.Labels.Empty() {
+		offset := q.Offset()
+		if offset > len(endpoints) {
+			offset = len(endpoints)
+		}
+		endpoints = endpoints[offset:]
+	}
+	if q.Paged() && len(endpoints) > q.Size {
+		endpoints = endpoints[:q.Size]
+		last := endpoints[len(endpoints)-1]
+		res.NextCursor = pagination.Cursor{
+			Sort:  sortName,
+			Desc:  desc,
+			Value: field.Format(last.sortValue(sortName)),
+			ID:    last.ID,
+		}.Encode()
+	}
+	if !q.Paged() {
+		res.Total = len(endpoints)
+	}
+	res.Endpoints = endpoints
+	return res, nil
+}
+
+// countEndpoints 统计符合条件的端点数
+func (s *Service) countEndpoints(where string, args []interface{}, sel labels.Selector) (int, error) {
+	if sel.Empty() {
+		query := `SELECT COUNT(*) FROM "Endpoint" x`
+		if where != "" {
+			query += " WHERE " + where
+		}
+		var total int
+		err := s.db.QueryRow(query, args...).Scan(&total)
+		return total, err
+	}
+
+	query := `SELECT x.labels FROM "Endpoint" x`
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var labelsVal sql.NullString
+		if err := rows.Scan(&labelsVal); err != nil {
+			return 0, err
+		}
+		if sel.Matches(labels.Decode(labelsVal.String)) {
+			total++
+		}
+	}
+	return total, rows.Err()
+}
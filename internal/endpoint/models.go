@@ -1,6 +1,10 @@
 package endpoint
 
-import "time"
+import (
+	"time"
+
+	"NodePassDash/internal/labels"
+)
 
 // EndpointStatus 端点状态枚举
 type EndpointStatus string
@@ -20,6 +24,7 @@ type Endpoint struct {
 	APIKey    string         `json:"apiKey"`
 	Status    EndpointStatus `json:"status"`
 	Color     string         `json:"color,omitempty"`
+	Labels    labels.Set     `json:"labels,omitempty"`
 	LastCheck time.Time      `json:"lastCheck"`
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
@@ -34,11 +39,12 @@ type EndpointWithStats struct {
 
 // CreateEndpointRequest 创建端点请求
 type CreateEndpointRequest struct {
-	Name    string `json:"name" validate:"required,max=50"`
-	URL     string `json:"url" validate:"required,url"`
-	APIPath string `json:"apiPath" validate:"required"`
-	APIKey  string `json:"apiKey" validate:"required,max=200"`
-	Color   string `json:"color,omitempty"`
+	Name    string     `json:"name" validate:"required,max=50"`
+	URL     string     `json:"url" validate:"required,url"`
+	APIPath string     `json:"apiPath" validate:"required"`
+	APIKey  string     `json:"apiKey" validate:"required,max=200"`
+	Color   string     `json:"color,omitempty"`
+	Labels  labels.Set `json:"labels,omitempty"`
 }
 
 // UpdateEndpointRequest 更新端点请求
@@ -49,6 +55,8 @@ type UpdateEndpointRequest struct {
 	URL     string `json:"url,omitempty" validate:"omitempty,url"`
 	APIPath string `json:"apiPath,omitempty"`
 	APIKey  string `json:"apiKey,omitempty" validate:"omitempty,max=200"`
+	// Labels 为 nil 时保持不变，非 nil 时整体替换
+	Labels labels.Set `json:"labels,omitempty"`
 }
 
 // EndpointResponse API 响应
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"NodePassDash/internal/labels"
 )
 
 // Service 端点管理服务
@@ -23,45 +25,19 @@ func (s *Service) DB() *sql.DB {
 
 // GetEndpoints 获取所有端点列表
 func (s *Service) GetEndpoints() ([]EndpointWithStats, error) {
-	query := `
-		SELECT 
-			e.id, e.name, e.url, e.apiPath, e.apiKey, e.status, e.color,
-			e.lastCheck, e.createdAt, e.updatedAt,
-			COUNT(t.id) as tunnel_count,
-			COUNT(CASE WHEN t.status = 'running' THEN 1 END) as active_tunnels
-		FROM "Endpoint" e
-		LEFT JOIN "Tunnel" t ON e.id = t.endpointId
-		GROUP BY e.id
-		ORDER BY e.createdAt DESC
-	`
-
-	rows, err := s.db.Query(query)
+	res, err := s.ListEndpoints(ListQuery{})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var endpoints []EndpointWithStats
-	for rows.Next() {
-		var e EndpointWithStats
-		var statusStr string
-		err := rows.Scan(
-			&e.ID, &e.Name, &e.URL, &e.APIPath, &e.APIKey, &statusStr, &e.Color,
-			&e.LastCheck, &e.CreatedAt, &e.UpdatedAt,
-			&e.TunnelCount, &e.ActiveTunnels,
-		)
-		if err != nil {
-			return nil, err
-		}
-		e.Status = EndpointStatus(statusStr)
-		endpoints = append(endpoints, e)
-	}
-
-	return endpoints, nil
+	return res.Endpoints, nil
 }
 
 // CreateEndpoint 创建新端点
 func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
+	if err := req.Labels.Validate(); err != nil {
+		return nil, err
+	}
+
 	// 检查名称是否重复
 	var exists bool
 	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM Endpoint WHERE name = ?)", req.Name).Scan(&exists)
@@ -83,8 +59,8 @@ func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
 
 	// 创建新端点
 	query := `
-		INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, lastCheck, createdAt, updatedAt)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, labels, lastCheck, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
@@ -95,6 +71,7 @@ func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
 		req.APIKey,
 		StatusOffline,
 		req.Color,
+		labels.Encode(req.Labels),
 		now,
 		now,
 		now,
@@ -116,6 +93,7 @@ func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
 		APIKey:    req.APIKey,
 		Status:    StatusOffline,
 		Color:     req.Color,
+		Labels:    req.Labels,
 		LastCheck: now,
 		CreatedAt: now,
 		UpdatedAt: now,
@@ -127,12 +105,13 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 	// 检查端点是否存在
 	var endpoint Endpoint
 	var statusStr string
+	var labelsVal sql.NullString
 	err := s.db.QueryRow(
-		"SELECT id, name, url, apiPath, apiKey, status, color, lastCheck, createdAt, updatedAt FROM \"Endpoint\" WHERE id = ?",
+		"SELECT id, name, url, apiPath, apiKey, status, color, labels, lastCheck, createdAt, updatedAt FROM \"Endpoint\" WHERE id = ?",
 		req.ID,
 	).Scan(
 		&endpoint.ID, &endpoint.Name, &endpoint.URL, &endpoint.APIPath, &endpoint.APIKey,
-		&statusStr, &endpoint.Color, &endpoint.LastCheck, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+		&statusStr, &endpoint.Color, &labelsVal, &endpoint.LastCheck, &endpoint.CreatedAt, &endpoint.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -141,6 +120,7 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 		return nil, err
 	}
 	endpoint.Status = EndpointStatus(statusStr)
+	endpoint.Labels = labels.Decode(labelsVal.String)
 
 	switch req.Action {
 	case "rename":
@@ -198,10 +178,18 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 			newAPIKey = req.APIKey
 		}
 
+		newLabels := endpoint.Labels
+		if req.Labels != nil {
+			if err := req.Labels.Validate(); err != nil {
+				return nil, err
+			}
+			newLabels = req.Labels
+		}
+
 		// 更新端点信息
 		query := `
 			UPDATE "Endpoint" 
-			SET name = ?, url = ?, apiPath = ?, apiKey = ?, updatedAt = ?
+			SET name = ?, url = ?, apiPath = ?, apiKey = ?, labels = ?, updatedAt = ?
 			WHERE id = ?
 		`
 		_, err = s.db.Exec(query,
@@ -209,6 +197,7 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 			newURL,
 			newAPIPath,
 			newAPIKey,
+			labels.Encode(newLabels),
 			time.Now(),
 			req.ID,
 		)
@@ -220,6 +209,7 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 		endpoint.URL = newURL
 		endpoint.APIPath = newAPIPath
 		endpoint.APIKey = newAPIKey
+		endpoint.Labels = newLabels
 	}
 
 	endpoint.UpdatedAt = time.Now()
@@ -246,15 +236,14 @@ func (s *Service) DeleteEndpoint(id int64) error {
 		return err
 	}
 
-	// 3) 删除端点
-	res, err := tx.Exec(`DELETE FROM "Endpoint" WHERE id = ?`, id)
-	if err != nil {
+	// 3) 删除回收站（需在删除端点之前，开启外键约束时端点删除会级联删除回收站记录）
+	if _, err := tx.Exec(`DELETE FROM "TunnelRecycle" WHERE endpointId = ?`, id); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// 3) 删除回收站
-	res, err = tx.Exec(`DELETE FROM "TunnelRecycle" WHERE endpointId = ?`, id)
+	// 4) 删除端点
+	res, err := tx.Exec(`DELETE FROM "Endpoint" WHERE id = ?`, id)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -0,0 +1,276 @@
+package evacuate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"NodePassDash/internal/tunnel"
+)
+
+// Options 迁移选项
+type Options struct {
+	// TargetID 接收隧道的新主控
+	TargetID int64 `json:"targetId"`
+	// SourceAddress client 隧道中原主控的地址，为空时取原主控 URL 的主机名
+	SourceAddress string `json:"sourceAddress,omitempty"`
+	// TargetAddress 新主控供 client 连接的地址，为空时取新主控 URL 的主机名
+	TargetAddress string `json:"targetAddress,omitempty"`
+	// Recycle 原隧道移入回收站而非直接删除
+	Recycle bool `json:"recycle,omitempty"`
+	// VerifyTimeout 每条隧道等待目标实例运行的秒数，为 0 时使用默认值
+	VerifyTimeout int `json:"verifyTimeout,omitempty"`
+	// KeepConnected 全部迁移成功后仍保持原主控的 SSE 连接
+	KeepConnected bool   `json:"keepConnected,omitempty"`
+	Actor         string `json:"-"`
+}
+
+// PlannedMove 计划迁移的隧道
+type PlannedMove struct {
+	TunnelID   int64  `json:"tunnelId"`
+	Name       string `json:"name"`
+	Mode       string `json:"mode"`
+	InstanceID string `json:"instanceId,omitempty"`
+	TunnelPort int    `json:"tunnelPort"`
+	// NewPort 在新主控上使用的隧道端口，与 TunnelPort 不同表示因端口冲突而调整
+	NewPort int `json:"newPort"`
+	// Skip 无法迁移（如没有关联的实例）
+	Skip     bool     `json:"skip,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CounterpartUpdate 连接原主控的 client 隧道，迁移后将其隧道地址与端口改为新主控
+type CounterpartUpdate struct {
+	TunnelID       int64  `json:"tunnelId"`
+	Name           string `json:"name"`
+	EndpointID     int64  `json:"endpointId"`
+	ServerTunnelID int64  `json:"serverTunnelId"`
+	FromAddress    string `json:"fromAddress"`
+	ToAddress      string `json:"toAddress"`
+	FromPort       int    `json:"fromPort"`
+	ToPort         int    `json:"toPort"`
+	// Moving client 本身也位于原主控，会先随迁移移动到新主控
+	Moving bool `json:"moving,omitempty"`
+}
+
+// Plan 迁移计划
+type Plan struct {
+	SourceID      int64               `json:"sourceId"`
+	TargetID      int64               `json:"targetId"`
+	SourceAddress string              `json:"sourceAddress"`
+	TargetAddress string              `json:"targetAddress"`
+	Moves         []PlannedMove       `json:"moves"`
+	Counterparts  []CounterpartUpdate `json:"counterparts"`
+	Warnings      []string            `json:"warnings,omitempty"`
+}
+
+// sourceTunnel 原主控上的隧道
+type sourceTunnel struct {
+	id                int64
+	name, mode        string
+	instanceID        string
+	tunnelAddress     string
+	tunnelPort        int
+	tlsMode           string
+	certPath, keyPath string
+}
+
+// Plan 计算将 sourceID 上全部隧道迁移到 opts.TargetID 的计划：
+// 端口在新主控上不可用时顺延到下一个可用端口，使用自定义证书的隧道给出提示，
+// 并找出连接原主控地址的 client 隧道
+func (s *Service) Plan(sourceID int64, opts Options) (*Plan, error) {
+	if opts.TargetID == 0 {
+		return nil, errors.New("缺少目标主控")
+	}
+	if opts.TargetID == sourceID {
+		return nil, errors.New("目标主控与原主控相同")
+	}
+	sourceURL, err := s.endpointURL(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("原主控: %w", err)
+	}
+	targetURL, err := s.endpointURL(opts.TargetID)
+	if err != nil {
+		return nil, fmt.Errorf("目标主控: %w", err)
+	}
+
+	plan := &Plan{
+		SourceID:      sourceID,
+		TargetID:      opts.TargetID,
+		SourceAddress: normalizeHost(opts.SourceAddress),
+		TargetAddress: normalizeHost(opts.TargetAddress),
+		Moves:         []PlannedMove{},
+		Counterparts:  []CounterpartUpdate{},
+	}
+	if plan.SourceAddress == "" {
+		plan.SourceAddress = hostOf(sourceURL)
+	}
+	if plan.TargetAddress == "" {
+		plan.TargetAddress = hostOf(targetURL)
+	}
+	if plan.TargetAddress == "" {
+		return nil, errors.New("无法从新主控 URL 确定连接地址，请指定 targetAddress")
+	}
+
+	tunnels, err := s.sourceTunnels(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := s.tunnels.PortPool(opts.TargetID, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make(map[int64]int, len(tunnels))
+	for _, t := range tunnels {
+		m := PlannedMove{TunnelID: t.id, Name: t.name, Mode: t.mode, InstanceID: t.instanceID, TunnelPort: t.tunnelPort, NewPort: t.tunnelPort}
+		if t.instanceID == "" {
+			m.Skip = true
+			m.Warnings = append(m.Warnings, "隧道没有关联的实例，跳过迁移")
+			plan.Moves = append(plan.Moves, m)
+			continue
+		}
+		if tunnel.ListensLocally(tunnel.TunnelMode(t.mode), t.tunnelAddress) {
+			if perr := pool.Check(t.tunnelPort); perr != nil {
+				free, err := pool.Next(t.tunnelPort + 1)
+				if err != nil {
+					return nil, err
+				}
+				m.NewPort = free
+				m.Warnings = append(m.Warnings, fmt.Sprintf("新主控%v，调整为 %d", perr, free))
+			}
+			pool.Take(m.NewPort, t.name)
+		}
+		if tunnel.TLSMode(t.tlsMode) == tunnel.TLSMode2 || t.certPath != "" || t.keyPath != "" {
+			m.Warnings = append(m.Warnings, fmt.Sprintf("使用自定义证书（%s / %s），请确认新主控上存在相同路径", t.certPath, t.keyPath))
+		}
+		ports[t.id] = m.NewPort
+		plan.Moves = append(plan.Moves, m)
+	}
+
+	for _, t := range tunnels {
+		if t.instanceID == "" || tunnel.TunnelMode(t.mode) != tunnel.ModeServer {
+			continue
+		}
+		if err := s.planCounterparts(plan, sourceID, t, ports[t.id]); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// planCounterparts 找出连接 server 隧道的 client：隧道对中的 client 端，以及地址与端口均指向原主控的 client
+func (s *Service) planCounterparts(plan *Plan, sourceID int64, server sourceTunnel, newPort int) error {
+	seen := make(map[int64]bool)
+	for _, c := range plan.Counterparts {
+		seen[c.TunnelID] = true
+	}
+	add := func(id int64, name string, endpointID int64, address string, port int) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		plan.Counterparts = append(plan.Counterparts, CounterpartUpdate{
+			TunnelID:       id,
+			Name:           name,
+			EndpointID:     endpointID,
+			ServerTunnelID: server.id,
+			FromAddress:    address,
+			ToAddress:      plan.TargetAddress,
+			FromPort:       port,
+			ToPort:         newPort,
+			Moving:         endpointID == sourceID,
+		})
+	}
+
+	// 隧道对中的 client 端
+	var pairName string
+	var clientID, endpointID int64
+	var clientName string
+	var address sql.NullString
+	var port int
+	err := s.db.QueryRow(`
+		SELECT p.name, t.id, t.name, t.endpointId, t.tunnelAddress, t.tunnelPort
+		FROM "TunnelPair" p
+		JOIN "Tunnel" t ON t.id = p.clientTunnelId
+		WHERE p.serverTunnelId = ?`, server.id).Scan(&pairName, &clientID, &clientName, &endpointID, &address, &port)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case normalizeHost(address.String) == plan.SourceAddress:
+		add(clientID, clientName, endpointID, address.String, port)
+	default:
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("隧道对 %s 的 client 端 %s 连接地址 %s 不是原主控地址 %s，不会自动更新",
+			pairName, clientName, address.String, plan.SourceAddress))
+	}
+
+	// 未关联为隧道对，但地址与端口指向原主控的 client
+	rows, err := s.db.Query(`SELECT id, name, endpointId, tunnelAddress FROM "Tunnel" WHERE mode = ? AND tunnelPort = ?`,
+		string(tunnel.ModeClient), server.tunnelPort)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, endpointID int64
+		var name string
+		var address sql.NullString
+		if err := rows.Scan(&id, &name, &endpointID, &address); err != nil {
+			return err
+		}
+		if normalizeHost(address.String) == plan.SourceAddress {
+			add(id, name, endpointID, address.String, server.tunnelPort)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Service) sourceTunnels(endpointID int64) ([]sourceTunnel, error) {
+	rows, err := s.db.Query(`SELECT id, name, mode, instanceId, tunnelAddress, tunnelPort, tlsMode, certPath, keyPath
+		FROM "Tunnel" WHERE endpointId = ? ORDER BY id`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []sourceTunnel
+	for rows.Next() {
+		var t sourceTunnel
+		var instanceID, address, tlsMode, certPath, keyPath sql.NullString
+		if err := rows.Scan(&t.id, &t.name, &t.mode, &instanceID, &address, &t.tunnelPort, &tlsMode, &certPath, &keyPath); err != nil {
+			return nil, err
+		}
+		t.instanceID = instanceID.String
+		t.tunnelAddress = address.String
+		t.tlsMode = tlsMode.String
+		t.certPath = certPath.String
+		t.keyPath = keyPath.String
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *Service) endpointURL(id int64) (string, error) {
+	var u string
+	err := s.db.QueryRow(`SELECT url FROM "Endpoint" WHERE id = ?`, id).Scan(&u)
+	if err == sql.ErrNoRows {
+		return "", errors.New("指定的端点不存在")
+	}
+	return u, err
+}
+
+// hostOf 返回主控 URL 中的主机名
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(u.Hostname())
+}
+
+// normalizeHost 去除 IPv6 方括号并转为小写，便于比较
+func normalizeHost(h string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(h), "[]"))
+}
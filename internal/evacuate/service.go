@@ -0,0 +1,261 @@
+// Package evacuate 主控撤离：将一个主控上的全部隧道迁移到另一个主控，
+// 更新连接原主控的 client 隧道，完成后断开原主控。
+package evacuate
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/eventbus"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/tunnel"
+)
+
+// 任务状态
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed" // 全部步骤成功
+	JobFailed    = "failed"    // 存在失败的步骤，原主控保持连接
+)
+
+// 步骤类型
+const (
+	StepMove        = "move"        // 迁移隧道
+	StepCounterpart = "counterpart" // 更新 client 隧道地址
+	StepDisconnect  = "disconnect"  // 断开原主控
+)
+
+// ErrJobRunning 同一主控已有进行中的撤离任务
+var ErrJobRunning = errors.New("该主控正在撤离")
+
+// Step 单个步骤的执行结果
+type Step struct {
+	Kind     string `json:"kind"`
+	TunnelID int64  `json:"tunnelId,omitempty"`
+	Name     string `json:"name,omitempty"`
+	// NewTunnelID 迁移后在新主控上的隧道 ID
+	NewTunnelID int64  `json:"newTunnelId,omitempty"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+	Warning     string `json:"warning,omitempty"`
+}
+
+// Job 撤离任务，Done / Total 为已执行步骤与计划步骤数
+type Job struct {
+	SourceID     int64      `json:"sourceId"`
+	TargetID     int64      `json:"targetId"`
+	Status       string     `json:"status"`
+	Total        int        `json:"total"`
+	Done         int        `json:"done"`
+	Failed       int        `json:"failed"`
+	Current      string     `json:"current,omitempty"`
+	Steps        []Step     `json:"steps"`
+	Plan         *Plan      `json:"plan"`
+	Disconnected bool       `json:"disconnected"`
+	StartedAt    time.Time  `json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Service 主控撤离服务
+type Service struct {
+	db      *sql.DB
+	tunnels *tunnel.Service
+	manager *sse.Manager
+	bus     *eventbus.Bus
+
+	mu   sync.Mutex
+	jobs map[int64]*Job // 原主控 ID -> 最近一次任务
+}
+
+// NewService 创建主控撤离服务，manager 用于完成后断开原主控，bus 用于推送进度，均可为 nil
+func NewService(db *sql.DB, tunnels *tunnel.Service, manager *sse.Manager, bus *eventbus.Bus) *Service {
+	return &Service{db: db, tunnels: tunnels, manager: manager, bus: bus, jobs: make(map[int64]*Job)}
+}
+
+// Start 计算计划并在后台执行，返回任务快照
+func (s *Service) Start(sourceID int64, opts Options) (*Job, error) {
+	plan, err := s.Plan(sourceID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if j, ok := s.jobs[sourceID]; ok && j.Status == JobRunning {
+		s.mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	job := &Job{
+		SourceID:  sourceID,
+		TargetID:  opts.TargetID,
+		Status:    JobRunning,
+		Total:     len(plan.Counterparts),
+		Steps:     []Step{},
+		Plan:      plan,
+		StartedAt: time.Now(),
+	}
+	for _, m := range plan.Moves {
+		if !m.Skip {
+			job.Total++
+		}
+	}
+	if !opts.KeepConnected {
+		job.Total++
+	}
+	s.jobs[sourceID] = job
+	snapshot := job.snapshot()
+	s.mu.Unlock()
+
+	log.Infof("[Evacuate] 开始撤离主控 %d => %d：%d 条隧道，%d 条 client 待更新", sourceID, opts.TargetID, len(plan.Moves), len(plan.Counterparts))
+	go s.run(job, opts)
+	return snapshot, nil
+}
+
+// Job 返回主控最近一次撤离任务的快照，不存在时返回 nil
+func (s *Service) Job(sourceID int64) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[sourceID]; ok {
+		return j.snapshot()
+	}
+	return nil
+}
+
+// run 依次迁移隧道、更新 client 隧道，全部成功后断开原主控。单步失败不影响其余步骤
+func (s *Service) run(job *Job, opts Options) {
+	plan := job.Plan
+	moved := make(map[int64]int64) // 原隧道 ID -> 新隧道 ID
+	failed := make(map[int64]bool)
+
+	for _, m := range plan.Moves {
+		if m.Skip {
+			continue
+		}
+		s.begin(job, "迁移 "+m.Name)
+		req := tunnel.MoveRequest{
+			EndpointID:    plan.TargetID,
+			Recycle:       opts.Recycle,
+			VerifyTimeout: opts.VerifyTimeout,
+			Actor:         opts.Actor,
+		}
+		if m.NewPort != m.TunnelPort {
+			req.TunnelPort = m.NewPort
+		}
+		step := Step{Kind: StepMove, TunnelID: m.TunnelID, Name: m.Name}
+		res, err := s.tunnels.MoveTunnel(m.TunnelID, req)
+		if err != nil {
+			failed[m.TunnelID] = true
+			step.Error = err.Error()
+		} else {
+			moved[m.TunnelID] = res.Tunnel.ID
+			step.NewTunnelID = res.Tunnel.ID
+			step.Success = true
+			step.Warning = res.Warning
+		}
+		s.finish(job, step)
+	}
+
+	for _, c := range plan.Counterparts {
+		s.begin(job, "更新 "+c.Name)
+		step := Step{Kind: StepCounterpart, TunnelID: c.TunnelID, Name: c.Name}
+		id := c.TunnelID
+		if c.Moving {
+			id = moved[c.TunnelID]
+		}
+		switch {
+		case failed[c.ServerTunnelID]:
+			step.Error = "server 隧道迁移失败，保持原地址"
+		case c.Moving && id == 0:
+			step.Error = "client 隧道迁移失败，未更新地址"
+		default:
+			step.NewTunnelID = id
+			err := s.tunnels.UpdateTunnel(tunnel.UpdateTunnelRequest{
+				ID:            id,
+				TunnelAddress: c.ToAddress,
+				TunnelPort:    c.ToPort,
+				Actor:         opts.Actor,
+			})
+			if err != nil {
+				step.Error = err.Error()
+			} else {
+				step.Success = true
+			}
+		}
+		s.finish(job, step)
+	}
+
+	if !opts.KeepConnected {
+		s.begin(job, "断开原主控")
+		step := Step{Kind: StepDisconnect}
+		s.mu.Lock()
+		ok := job.Failed == 0
+		s.mu.Unlock()
+		if !ok {
+			step.Error = "存在失败的步骤，保持原主控连接"
+		} else {
+			if s.manager != nil {
+				s.manager.DisconnectEndpoint(plan.SourceID)
+			}
+			step.Success = true
+		}
+		s.finish(job, step)
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Current = ""
+	job.Status = JobCompleted
+	if job.Failed > 0 {
+		job.Status = JobFailed
+	}
+	job.Disconnected = !opts.KeepConnected && job.Failed == 0
+	snapshot := job.snapshot()
+	s.mu.Unlock()
+	s.publish(snapshot)
+	log.Infof("[Evacuate] 主控 %d 撤离结束：%s，失败 %d 步", plan.SourceID, snapshot.Status, snapshot.Failed)
+}
+
+// begin 记录当前步骤并推送进度
+func (s *Service) begin(job *Job, current string) {
+	s.mu.Lock()
+	job.Current = current
+	snapshot := job.snapshot()
+	s.mu.Unlock()
+	s.publish(snapshot)
+}
+
+// finish 记录步骤结果并推送进度
+func (s *Service) finish(job *Job, step Step) {
+	what := strings.TrimSpace(step.Kind + " " + step.Name)
+	if step.Success {
+		log.Infof("[Evacuate] 主控 %d %s 完成", job.SourceID, what)
+	} else {
+		log.Warnf("[Evacuate] 主控 %d %s 失败: %s", job.SourceID, what, step.Error)
+	}
+	s.mu.Lock()
+	job.Steps = append(job.Steps, step)
+	job.Done++
+	if !step.Success {
+		job.Failed++
+	}
+	snapshot := job.snapshot()
+	s.mu.Unlock()
+	s.publish(snapshot)
+}
+
+func (s *Service) publish(job *Job) {
+	if s.bus != nil {
+		s.bus.Publish(eventbus.TopicEvacuation, job)
+	}
+}
+
+// snapshot 复制任务状态，调用方需持有锁
+func (j *Job) snapshot() *Job {
+	c := *j
+	c.Steps = append([]Step{}, j.Steps...)
+	return &c
+}
@@ -0,0 +1,110 @@
+// Package eventbus 进程内的轻量级发布/订阅总线。
+//
+// 用于在后台模块（如 SSE 管理器）与前端推流接口之间传递状态变更，
+// 避免前端接口定时轮询数据库。
+package eventbus
+
+import (
+	"sync"
+)
+
+// 内置主题
+const (
+	// TopicEndpointState 端点状态 / 隧道数量变更
+	TopicEndpointState = "endpoint.state"
+	// TopicTunnelTraffic 实例流量采样（累计计数）
+	TopicTunnelTraffic = "tunnel.traffic"
+	// TopicEvacuation 主控撤离任务进度
+	TopicEvacuation = "endpoint.evacuation"
+)
+
+// Event 总线中传递的事件
+type Event struct {
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data"`
+}
+
+// subscriber 单个订阅者
+type subscriber struct {
+	ch chan Event
+}
+
+// Bus 发布/订阅总线，并发安全
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[string]map[int64]*subscriber // topic -> subID -> subscriber
+	nextID int64
+}
+
+// New 创建总线实例
+func New() *Bus {
+	return &Bus{
+		subs: make(map[string]map[int64]*subscriber),
+	}
+}
+
+// Subscribe 订阅指定主题，返回只读事件通道以及取消订阅函数
+// buffer 为通道缓冲大小，订阅者处理过慢时新事件会被丢弃，不会阻塞发布方
+func (b *Bus) Subscribe(topic string, buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = 16
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	sub := &subscriber{ch: make(chan Event, buffer)}
+	if _, ok := b.subs[topic]; !ok {
+		b.subs[topic] = make(map[int64]*subscriber)
+	}
+	b.subs[topic][id] = sub
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			if subs, ok := b.subs[topic]; ok {
+				delete(subs, id)
+				if len(subs) == 0 {
+					delete(b.subs, topic)
+				}
+			}
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+	return sub.ch, cancel
+}
+
+// Publish 向主题的所有订阅者投递事件（非阻塞），返回成功投递的订阅者数量
+func (b *Bus) Publish(topic string, data interface{}) int {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ev := Event{Topic: topic, Data: data}
+	delivered := 0
+	for _, sub := range b.subs[topic] {
+		select {
+		case sub.ch <- ev:
+			delivered++
+		default:
+			// 订阅者缓冲已满，丢弃该事件，避免拖慢发布方
+		}
+	}
+	return delivered
+}
+
+// SubscriberCount 返回主题当前订阅者数量
+func (b *Bus) SubscriberCount(topic string) int {
+	if b == nil {
+		return 0
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs[topic])
+}
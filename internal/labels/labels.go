@@ -0,0 +1,102 @@
+// Package labels 提供隧道与端点的键值标签，以及 Kubernetes 风格的标签选择器。
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Set 标签集合
+type Set map[string]string
+
+// 标签键为可选的 DNS 前缀加名称（如 example.com/team），名称与值最长 63 个字符
+var (
+	namePattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?$`)
+	prefixPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]{0,251}[a-z0-9])?$`)
+)
+
+// ValidKey 判断标签键是否合法
+func ValidKey(key string) bool {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		if !prefixPattern.MatchString(key[:i]) {
+			return false
+		}
+		name = key[i+1:]
+	}
+	return namePattern.MatchString(name)
+}
+
+// ValidValue 判断标签值是否合法（允许为空）
+func ValidValue(value string) bool {
+	return value == "" || namePattern.MatchString(value)
+}
+
+// Validate 校验标签集合
+func (s Set) Validate() error {
+	for _, k := range s.Keys() {
+		if !ValidKey(k) {
+			return fmt.Errorf("无效的标签键: %q", k)
+		}
+		if !ValidValue(s[k]) {
+			return fmt.Errorf("标签 %s 的值无效: %q", k, s[k])
+		}
+	}
+	return nil
+}
+
+// Keys 返回排序后的标签键
+func (s Set) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String 以 k1=v1,k2=v2 形式输出（按键排序）
+func (s Set) String() string {
+	parts := make([]string, 0, len(s))
+	for _, k := range s.Keys() {
+		parts = append(parts, k+"="+s[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Equal 判断两个标签集合是否相同（nil 与空集合视为相同）
+func (s Set) Equal(other Set) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for k, v := range s {
+		if ov, ok := other[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode 编码为数据库存储的 JSON 字符串，空集合返回 nil
+func Encode(s Set) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Decode 解析数据库中的 JSON 字符串，格式错误时返回 nil
+func Decode(data string) Set {
+	if data == "" {
+		return nil
+	}
+	var s Set
+	if err := json.Unmarshal([]byte(data), &s); err != nil || len(s) == 0 {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"env", true},
+		{"app.kubernetes.io_name", true},
+		{"example.com/team", true},
+		{"a", true},
+		{"", false},
+		{"-env", false},
+		{"env-", false},
+		{"Example.com/team", false},
+		{"example.com/", false},
+		{"has space", false},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+	}
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSetValidate(t *testing.T) {
+	if err := (Set{"env": "prod", "team": ""}).Validate(); err != nil {
+		t.Errorf("valid set: %v", err)
+	}
+	if err := (Set{"env": "prod value"}).Validate(); err == nil {
+		t.Error("invalid value accepted")
+	}
+	if err := (Set{"bad key": "x"}).Validate(); err == nil {
+		t.Error("invalid key accepted")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	s := Set{"env": "prod", "team": "infra"}
+	encoded, ok := Encode(s).(string)
+	if !ok {
+		t.Fatalf("Encode(%v) returned %T", s, Encode(s))
+	}
+	if got := Decode(encoded); !got.Equal(s) {
+		t.Errorf("Decode(Encode(%v)) = %v", s, got)
+	}
+	if Encode(nil) != nil || Encode(Set{}) != nil {
+		t.Error("empty set should encode to nil")
+	}
+	if Decode("") != nil || Decode("not json") != nil || Decode("{}") != nil {
+		t.Error("empty or invalid data should decode to nil")
+	}
+	if got := s.String(); got != "env=prod,team=infra" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	set := Set{"env": "prod", "team": "infra", "tier": ""}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env==prod", true},
+		{"env=dev", false},
+		{"env!=dev", true},
+		{"region!=us", true},
+		{"env in (prod,staging)", true},
+		{"env in (dev)", false},
+		{"env notin (dev, staging)", true},
+		{"region notin (us)", true},
+		{"team", true},
+		{"region", false},
+		{"!region", true},
+		{"!team", false},
+		{"tier=", true},
+		{"env=prod,team=infra", true},
+		{"env=prod,team=web", false},
+		{"env in (prod,staging),!region", true},
+	}
+	for _, tt := range tests {
+		sel, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := sel.Matches(set); got != tt.want {
+			t.Errorf("%q.Matches(%v) = %v, want %v", tt.expr, set, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorString(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"env==prod", "env=prod"},
+		{" env != dev , team ", "env!=dev,team"},
+		{"env IN (staging, prod)", "env in (prod,staging)"},
+		{"!region", "!region"},
+	}
+	for _, tt := range tests {
+		sel, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := sel.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.expr, got, tt.want)
+		}
+		again, err := Parse(sel.String())
+		if err != nil || again.String() != tt.want {
+			t.Errorf("re-parse of %q = %q, %v", tt.want, again.String(), err)
+		}
+	}
+}
+
+func TestSelectorErrors(t *testing.T) {
+	for _, expr := range []string{
+		"=prod",
+		"env=prod value",
+		"env in (prod",
+		"env within (prod)",
+		"!",
+		"bad key",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
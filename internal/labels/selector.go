@@ -0,0 +1,193 @@
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 选择器运算符
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opIn        = "in"
+	opNotIn     = "notin"
+	opExists    = "exists"
+	opNotExists = "!"
+)
+
+// requirement 单个匹配条件
+type requirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+// Selector 标签选择器，所有条件同时满足才算匹配；空选择器匹配全部
+type Selector []requirement
+
+// Parse 解析 Kubernetes 风格的选择器，支持：
+//
+//	env=prod  env==prod  env!=prod  env in (prod,staging)  env notin (dev)  env  !env
+//
+// 多个条件以逗号分隔
+func Parse(expr string) (Selector, error) {
+	var sel Selector
+	for _, part := range splitTerms(expr) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// splitTerms 以顶层逗号分隔（忽略括号内的逗号）
+func splitTerms(expr string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseRequirement(term string) (requirement, error) {
+	if strings.HasPrefix(term, "!") {
+		key := strings.TrimSpace(term[1:])
+		if !ValidKey(key) {
+			return requirement{}, fmt.Errorf("无效的选择器: %q", term)
+		}
+		return requirement{key: key, op: opNotExists}, nil
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(term, op); i >= 0 {
+			key := strings.TrimSpace(term[:i])
+			value := strings.TrimSpace(term[i+len(op):])
+			if !ValidKey(key) || !ValidValue(value) {
+				return requirement{}, fmt.Errorf("无效的选择器: %q", term)
+			}
+			if op == "!=" {
+				return requirement{key: key, op: opNotEquals, values: []string{value}}, nil
+			}
+			return requirement{key: key, op: opEquals, values: []string{value}}, nil
+		}
+	}
+
+	if open := strings.Index(term, "("); open >= 0 {
+		if !strings.HasSuffix(term, ")") {
+			return requirement{}, fmt.Errorf("无效的选择器: %q", term)
+		}
+		fields := strings.Fields(term[:open])
+		if len(fields) != 2 || !ValidKey(fields[0]) {
+			return requirement{}, fmt.Errorf("无效的选择器: %q", term)
+		}
+		var op string
+		switch strings.ToLower(fields[1]) {
+		case opIn:
+			op = opIn
+		case opNotIn:
+			op = opNotIn
+		default:
+			return requirement{}, fmt.Errorf("不支持的运算符 %q: %q", fields[1], term)
+		}
+		var values []string
+		for _, v := range strings.Split(term[open+1:len(term)-1], ",") {
+			v = strings.TrimSpace(v)
+			if !ValidValue(v) {
+				return requirement{}, fmt.Errorf("无效的选择器: %q", term)
+			}
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		return requirement{key: fields[0], op: op, values: values}, nil
+	}
+
+	if !ValidKey(term) {
+		return requirement{}, fmt.Errorf("无效的选择器: %q", term)
+	}
+	return requirement{key: term, op: opExists}, nil
+}
+
+// Empty 是否为空选择器
+func (sel Selector) Empty() bool {
+	return len(sel) == 0
+}
+
+// Matches 判断标签集合是否满足选择器
+func (sel Selector) Matches(s Set) bool {
+	for _, r := range sel {
+		v, ok := s[r.key]
+		switch r.op {
+		case opEquals:
+			if !ok || v != r.values[0] {
+				return false
+			}
+		case opNotEquals:
+			// 与 Kubernetes 一致：不存在该标签也视为满足 !=
+			if ok && v == r.values[0] {
+				return false
+			}
+		case opIn:
+			if !ok || !contains(r.values, v) {
+				return false
+			}
+		case opNotIn:
+			if ok && contains(r.values, v) {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String 输出规范化的选择器表达式
+func (sel Selector) String() string {
+	parts := make([]string, 0, len(sel))
+	for _, r := range sel {
+		switch r.op {
+		case opEquals, opNotEquals:
+			parts = append(parts, r.key+r.op+r.values[0])
+		case opIn, opNotIn:
+			parts = append(parts, fmt.Sprintf("%s %s (%s)", r.key, r.op, strings.Join(r.values, ",")))
+		case opExists:
+			parts = append(parts, r.key)
+		case opNotExists:
+			parts = append(parts, "!"+r.key)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
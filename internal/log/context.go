@@ -0,0 +1,44 @@
+package log
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 请求相关的常用字段名
+const (
+	FieldRequestID  = "requestId"
+	FieldUser       = "user"
+	FieldEndpointID = "endpointId"
+)
+
+type ctxKey struct{}
+
+// NewContext 返回附加了日志字段的 context，与已有字段合并
+func NewContext(ctx context.Context, args ...interface{}) context.Context {
+	fields := parseFields(args)
+	if len(fields) == 0 {
+		return ctx
+	}
+	if prev, ok := ctx.Value(ctxKey{}).(log.Fields); ok {
+		merged := make(log.Fields, len(prev)+len(fields))
+		for k, v := range prev {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		fields = merged
+	}
+	return context.WithValue(ctx, ctxKey{}, fields)
+}
+
+// FieldsFromContext 取出 context 中的日志字段
+func FieldsFromContext(ctx context.Context) log.Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(ctxKey{}).(log.Fields)
+	return fields
+}
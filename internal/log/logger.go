@@ -1,6 +1,12 @@
 package log
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -11,6 +17,128 @@ import (
 // 例：
 //     log.Info("启动服务", "port", 8080)
 //     log.Error("数据库查询失败", "err", err)
+//
+// 各子系统通过 For("sse") 获取独立的 Logger，可单独设置日志级别；
+// 请求相关字段（请求 ID、用户、端点 ID）通过 NewContext 写入 context，
+// 再由 Ctx(ctx) 取出附加到日志中。
+
+// 子系统名称
+const (
+	SubsystemSSE    = "sse"
+	SubsystemAPI    = "api"
+	SubsystemTunnel = "tunnel"
+	SubsystemAuth   = "auth"
+)
+
+// Subsystems 支持单独设置级别的子系统
+var Subsystems = []string{SubsystemSSE, SubsystemAPI, SubsystemTunnel, SubsystemAuth}
+
+var (
+	levelMu   sync.RWMutex
+	baseLevel = log.InfoLevel
+	subLevels = map[string]log.Level{} // 子系统 -> 级别，未设置时沿用 baseLevel
+)
+
+// Logger 绑定了子系统与附加字段的日志记录器
+type Logger struct {
+	subsystem string
+	fields    log.Fields
+}
+
+// root 未指定子系统的默认记录器
+var root = &Logger{}
+
+// For 返回指定子系统的记录器
+func For(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// With 返回附加了键值对字段的新记录器
+func (l *Logger) With(args ...interface{}) *Logger {
+	return l.withFields(parseFields(args))
+}
+
+// Ctx 返回附加了 context 中请求字段的新记录器
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	return l.withFields(FieldsFromContext(ctx))
+}
+
+// withFields 合并字段
+func (l *Logger) withFields(fields log.Fields) *Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	merged := make(log.Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{subsystem: l.subsystem, fields: merged}
+}
+
+// enabled 判断该级别在当前子系统下是否输出
+func (l *Logger) enabled(level log.Level) bool {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	threshold, ok := subLevels[l.subsystem]
+	if !ok {
+		threshold = baseLevel
+	}
+	return level <= threshold
+}
+
+// entry 构造带字段的 logrus 条目
+func (l *Logger) entry(extra log.Fields) *log.Entry {
+	fields := make(log.Fields, len(l.fields)+len(extra)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	if l.subsystem != "" {
+		fields["subsystem"] = l.subsystem
+	}
+	return log.WithFields(fields)
+}
+
+func (l *Logger) log(level log.Level, msg string, args []interface{}) {
+	if l.enabled(level) {
+		l.entry(parseFields(args)).Log(level, msg)
+	}
+}
+
+func (l *Logger) logf(level log.Level, format string, args []interface{}) {
+	if l.enabled(level) {
+		l.entry(nil).Log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// Debug 调试级别日志
+func (l *Logger) Debug(msg string, args ...interface{}) { l.log(log.DebugLevel, msg, args) }
+
+// Info 信息级别日志
+func (l *Logger) Info(msg string, args ...interface{}) { l.log(log.InfoLevel, msg, args) }
+
+// Warn 警告级别日志
+func (l *Logger) Warn(msg string, args ...interface{}) { l.log(log.WarnLevel, msg, args) }
+
+// Error 错误级别日志
+func (l *Logger) Error(msg string, args ...interface{}) { l.log(log.ErrorLevel, msg, args) }
+
+// Debugf 使用 fmt 占位符格式化
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(log.DebugLevel, format, args) }
+
+// Infof 使用 fmt 占位符格式化
+func (l *Logger) Infof(format string, args ...interface{}) { l.logf(log.InfoLevel, format, args) }
+
+// Warnf 使用 fmt 占位符格式化
+func (l *Logger) Warnf(format string, args ...interface{}) { l.logf(log.WarnLevel, format, args) }
+
+// Errorf 使用 fmt 占位符格式化
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(log.ErrorLevel, format, args) }
 
 // parseFields 将可变参数转换为 logrus.Fields。
 func parseFields(args []interface{}) log.Fields {
@@ -25,42 +153,130 @@ func parseFields(args []interface{}) log.Fields {
 
 // Info 信息级别日志
 func Info(msg string, args ...interface{}) {
-	log.WithFields(parseFields(args)).Info(msg)
+	root.Info(msg, args...)
 }
 
 // Debug 调试级别日志
 func Debug(msg string, args ...interface{}) {
-	log.WithFields(parseFields(args)).Debug(msg)
+	root.Debug(msg, args...)
 }
 
 // Warn 警告级别日志
 func Warn(msg string, args ...interface{}) {
-	log.WithFields(parseFields(args)).Warn(msg)
+	root.Warn(msg, args...)
 }
 
 // Error 错误级别日志
 func Error(msg string, args ...interface{}) {
-	log.WithFields(parseFields(args)).Error(msg)
+	root.Error(msg, args...)
 }
 
 // Infof 使用 fmt 占位符格式化后输出，无额外字段
 func Infof(format string, args ...interface{}) {
-	log.Infof(format, args...)
+	root.Infof(format, args...)
 }
 
 // Debugf 使用 fmt 占位符格式化
 func Debugf(format string, args ...interface{}) {
-	log.Debugf(format, args...)
+	root.Debugf(format, args...)
 }
 
 // Warnf 使用 fmt 占位符格式化
 func Warnf(format string, args ...interface{}) {
-	log.Warnf(format, args...)
+	root.Warnf(format, args...)
 }
 
 // Errorf 使用 fmt 占位符格式化
 func Errorf(format string, args ...interface{}) {
-	log.Errorf(format, args...)
+	root.Errorf(format, args...)
+}
+
+// Ctx 返回附加了 context 中请求字段的默认记录器
+func Ctx(ctx context.Context) *Logger {
+	return root.Ctx(ctx)
+}
+
+// ParseLevel 校验并规范化日志级别：debug / info / warn / error
+func ParseLevel(level string) (string, error) {
+	lvl, err := log.ParseLevel(strings.TrimSpace(level))
+	if err != nil || lvl < log.ErrorLevel || lvl > log.DebugLevel {
+		return "", fmt.Errorf("无效的日志级别: %q（可选 debug / info / warn / error）", level)
+	}
+	return lvl.String(), nil
+}
+
+// SetLevel 设置默认日志级别：debug / info / warn / error
+func SetLevel(level string) error {
+	name, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	lvl, _ := log.ParseLevel(name)
+
+	levelMu.Lock()
+	baseLevel = lvl
+	levelMu.Unlock()
+	return nil
+}
+
+// SetSubsystemLevel 设置子系统日志级别，level 为空表示沿用默认级别
+func SetSubsystemLevel(subsystem, level string) error {
+	if !isSubsystem(subsystem) {
+		return fmt.Errorf("未知的日志子系统: %s", subsystem)
+	}
+
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if level == "" {
+		delete(subLevels, subsystem)
+		return nil
+	}
+	name, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	lvl, _ := log.ParseLevel(name)
+	subLevels[subsystem] = lvl
+	return nil
+}
+
+// Levels 当前日志级别
+type Levels struct {
+	Level      string            `json:"level"`
+	Subsystems map[string]string `json:"subsystems"` // 子系统 -> 生效级别
+	Overrides  []string          `json:"overrides"`  // 单独设置过级别的子系统
+}
+
+// GetLevels 返回当前默认级别以及各子系统的生效级别
+func GetLevels() Levels {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+
+	res := Levels{
+		Level:      baseLevel.String(),
+		Subsystems: make(map[string]string, len(Subsystems)),
+		Overrides:  []string{},
+	}
+	for _, sub := range Subsystems {
+		if lvl, ok := subLevels[sub]; ok {
+			res.Subsystems[sub] = lvl.String()
+			res.Overrides = append(res.Overrides, sub)
+		} else {
+			res.Subsystems[sub] = baseLevel.String()
+		}
+	}
+	sort.Strings(res.Overrides)
+	return res
+}
+
+// isSubsystem 判断是否为已知子系统
+func isSubsystem(name string) bool {
+	for _, sub := range Subsystems {
+		if sub == name {
+			return true
+		}
+	}
+	return false
 }
 
 func init() {
@@ -70,5 +286,6 @@ func init() {
 		TimestampFormat: "2006-01-02 15:04:05",
 		ForceColors:     true,
 	})
+	// 级别过滤由本包按子系统处理，logrus 本身输出全部级别
 	log.SetLevel(log.DebugLevel)
 }
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Config 日志输出配置
+type Config struct {
+	Level      string            // 默认级别
+	Format     string            // text / json
+	Subsystems map[string]string // 子系统 -> 级别
+
+	// 文件输出，File 为空表示仅输出到标准输出
+	File       string
+	MaxSizeMB  int           // 单个文件达到该大小后轮转
+	MaxBackups int           // 保留的历史文件数量
+	MaxAge     time.Duration // 历史文件保留时长
+	Compress   bool          // 是否 gzip 压缩历史文件
+	// RotateInterval 按时间轮转的间隔（如 24h），为 0 表示仅按大小轮转
+	RotateInterval time.Duration
+}
+
+var (
+	outputMu   sync.Mutex
+	fileOutput *lumberjack.Logger
+	rotateStop chan struct{}
+)
+
+// Setup 按配置设置日志级别、格式与输出目标，可重复调用
+func Setup(cfg Config) error {
+	if cfg.Level != "" {
+		if err := SetLevel(cfg.Level); err != nil {
+			return err
+		}
+	}
+	for sub, level := range cfg.Subsystems {
+		if err := SetSubsystemLevel(sub, level); err != nil {
+			return err
+		}
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	closeFileLocked()
+
+	var out io.Writer = os.Stdout
+	if cfg.File != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0755); err != nil {
+			return fmt.Errorf("创建日志目录失败: %w", err)
+		}
+		fileOutput = &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     int(cfg.MaxAge / (24 * time.Hour)),
+			Compress:   cfg.Compress,
+			LocalTime:  true,
+		}
+		out = io.MultiWriter(os.Stdout, fileOutput)
+
+		if cfg.RotateInterval > 0 {
+			rotateStop = make(chan struct{})
+			go rotateLoop(fileOutput, cfg.RotateInterval, rotateStop)
+		}
+	}
+	log.SetOutput(out)
+
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339})
+	case "", "text":
+		log.SetFormatter(&log.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+			// 写入文件时不输出颜色控制符
+			ForceColors:   cfg.File == "",
+			DisableColors: cfg.File != "",
+		})
+	default:
+		return fmt.Errorf("无效的日志格式: %q（可选 text / json）", cfg.Format)
+	}
+	return nil
+}
+
+// Close 关闭日志文件
+func Close() {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	log.SetOutput(os.Stdout)
+	closeFileLocked()
+}
+
+// closeFileLocked 停止定时轮转并关闭当前日志文件，调用方需持有 outputMu
+func closeFileLocked() {
+	if rotateStop != nil {
+		close(rotateStop)
+		rotateStop = nil
+	}
+	if fileOutput != nil {
+		fileOutput.Close()
+		fileOutput = nil
+	}
+}
+
+// rotateLoop 按固定间隔轮转日志文件
+func rotateLoop(l *lumberjack.Logger, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := l.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "日志轮转失败: %v\n", err)
+			}
+		}
+	}
+}
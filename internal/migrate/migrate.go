@@ -0,0 +1,298 @@
+// Package migrate 提供带版本号的数据库迁移。
+//
+// 每个迁移在独立事务中执行，执行记录写入 schema_migrations 表，
+// 服务启动时自动执行尚未应用的迁移，也可通过命令行查看状态或回滚。
+// SQLite / PostgreSQL / MySQL 各自维护一份迁移列表，版本号保持一致。
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/storage"
+)
+
+// Migration 单个迁移
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error // 为 nil 表示不可回滚
+}
+
+// Status 迁移状态
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// Migrator 迁移执行器
+type Migrator struct {
+	db         *sql.DB
+	dialect    storage.Dialect
+	migrations []Migration
+}
+
+// New 创建迁移执行器，按连接的数据库方言选择内置迁移列表
+func New(db *sql.DB) *Migrator {
+	dialect := storage.DialectOf(db)
+	return NewWithMigrations(db, dialect, ForDialect(dialect))
+}
+
+// NewWithMigrations 使用指定迁移列表创建执行器（按版本号排序）
+func NewWithMigrations(db *sql.DB, dialect storage.Dialect, list []Migration) *Migrator {
+	sorted := make([]Migration, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, dialect: dialect, migrations: sorted}
+}
+
+// ForDialect 返回指定方言的内置迁移列表
+func ForDialect(dialect storage.Dialect) []Migration {
+	switch dialect {
+	case storage.Postgres:
+		return postgresMigrations
+	case storage.MySQL:
+		return mysqlMigrations
+	default:
+		return sqliteMigrations
+	}
+}
+
+// ensureTable 创建迁移记录表
+func (m *Migrator) ensureTable() error {
+	var ddl string
+	switch m.dialect {
+	case storage.Postgres:
+		// PostgreSQL 下所有表都需要 id 列，见 storage 包说明
+		ddl = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			id BIGSERIAL PRIMARY KEY,
+			version INTEGER NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			appliedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`
+	case storage.MySQL:
+		ddl = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			appliedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`
+	default:
+		ddl = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			appliedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`
+	}
+	_, err := m.db.Exec(ddl)
+	return err
+}
+
+// applied 查询已应用的迁移版本
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	rows, err := m.db.Query(`SELECT version, appliedAt FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+// validate 检查迁移版本号是否重复
+func (m *Migrator) validate() error {
+	seen := make(map[int]bool, len(m.migrations))
+	for _, mg := range m.migrations {
+		if mg.Version <= 0 {
+			return fmt.Errorf("迁移 %s 版本号无效: %d", mg.Name, mg.Version)
+		}
+		if seen[mg.Version] {
+			return fmt.Errorf("迁移版本号重复: %d", mg.Version)
+		}
+		if mg.Up == nil {
+			return fmt.Errorf("迁移 %d_%s 缺少 Up", mg.Version, mg.Name)
+		}
+		seen[mg.Version] = true
+	}
+	return nil
+}
+
+// Up 执行所有尚未应用的迁移，返回本次应用的数量
+func (m *Migrator) Up() (int, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+	if err := m.ensureTable(); err != nil {
+		return 0, err
+	}
+	done, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mg := range m.migrations {
+		if _, ok := done[mg.Version]; ok {
+			continue
+		}
+		if err := m.run(mg, true); err != nil {
+			return count, fmt.Errorf("执行迁移 %d_%s 失败: %w", mg.Version, mg.Name, err)
+		}
+		log.Infof("[Migrate]已应用迁移 %d_%s", mg.Version, mg.Name)
+		count++
+	}
+	return count, nil
+}
+
+// Down 按版本号从高到低回滚最近 steps 个已应用的迁移，返回回滚数量
+func (m *Migrator) Down(steps int) (int, error) {
+	if steps <= 0 {
+		return 0, nil
+	}
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+	if err := m.ensureTable(); err != nil {
+		return 0, err
+	}
+	done, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		mg := m.migrations[i]
+		if _, ok := done[mg.Version]; !ok {
+			continue
+		}
+		if mg.Down == nil {
+			return count, fmt.Errorf("迁移 %d_%s 不支持回滚", mg.Version, mg.Name)
+		}
+		if err := m.run(mg, false); err != nil {
+			return count, fmt.Errorf("回滚迁移 %d_%s 失败: %w", mg.Version, mg.Name, err)
+		}
+		log.Infof("[Migrate]已回滚迁移 %d_%s", mg.Version, mg.Name)
+		count++
+	}
+	return count, nil
+}
+
+// Status 返回所有已知迁移的应用状态
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	done, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		st := Status{Version: mg.Version, Name: mg.Name}
+		if t, ok := done[mg.Version]; ok {
+			at := t
+			st.Applied = true
+			st.AppliedAt = &at
+		}
+		list = append(list, st)
+	}
+	return list, nil
+}
+
+// run 在单个事务中执行迁移并更新迁移记录
+// 注意：MySQL 的 DDL 会隐式提交事务，迁移失败时可能只应用了部分语句
+func (m *Migrator) run(mg Migration, up bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if err := mg.Up(tx); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, mg.Version, mg.Name); err != nil {
+			return err
+		}
+	} else {
+		if err := mg.Down(tx); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, mg.Version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// execAll 依次执行多条 SQL
+func execAll(tx *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureColumn 若列不存在则 ALTER TABLE 添加，幂等安全（仅用于 SQLite）
+func ensureColumn(tx *sql.Tx, table, column, typ string) error {
+	rows, err := tx.Query(`PRAGMA table_info("` + table + `")`)
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notnull int
+		var dfltValue interface{}
+		var pk int
+		_ = rows.Scan(&cid, &name, &ctype, &notnull, &dfltValue, &pk)
+		if name == column {
+			exists = true
+			break
+		}
+	}
+	rows.Close()
+
+	if !exists {
+		_, err := tx.Exec(`ALTER TABLE "` + table + `" ADD COLUMN ` + column + ` ` + typ)
+		return err
+	}
+	return nil
+}
+
+// indexName 将表名转换为索引名使用的下划线形式，如 TrafficMinute -> traffic_minute
+func indexName(table string) string {
+	var b []byte
+	for i := 0; i < len(table); i++ {
+		c := table[i]
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				b = append(b, '_')
+			}
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
@@ -0,0 +1,443 @@
+package migrate
+
+import "database/sql"
+
+// mysqlMigrations MySQL 迁移列表，版本号与 SQLite 保持一致
+//
+// 约定：
+//   - 连接开启 ANSI_QUOTES，双引号用于标识符
+//   - 需要唯一约束或索引的文本列使用 VARCHAR
+//   - MySQL 不支持 CREATE INDEX IF NOT EXISTS，且 DDL 会隐式提交事务
+var mysqlMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "Endpoint" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(255) NOT NULL UNIQUE,
+					url VARCHAR(512) NOT NULL UNIQUE,
+					apiPath VARCHAR(255) NOT NULL,
+					apiKey VARCHAR(255) NOT NULL,
+					status VARCHAR(16) NOT NULL DEFAULT 'OFFLINE',
+					color VARCHAR(32) DEFAULT 'default',
+					lastCheck DATETIME DEFAULT CURRENT_TIMESTAMP,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					tunnelCount INT DEFAULT 0
+				)`,
+				`CREATE TABLE IF NOT EXISTS "Tunnel" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(255) NOT NULL UNIQUE,
+					endpointId BIGINT NOT NULL,
+					mode VARCHAR(16) NOT NULL,
+					status VARCHAR(16) NOT NULL DEFAULT 'stopped',
+					tunnelAddress VARCHAR(255) NOT NULL,
+					tunnelPort VARCHAR(16) NOT NULL,
+					targetAddress VARCHAR(255) NOT NULL,
+					targetPort VARCHAR(16) NOT NULL,
+					tlsMode VARCHAR(16) NOT NULL,
+					certPath TEXT,
+					keyPath TEXT,
+					logLevel VARCHAR(16) NOT NULL DEFAULT 'info',
+					commandLine TEXT NOT NULL,
+					instanceId VARCHAR(128),
+					tcpRx BIGINT DEFAULT 0,
+					tcpTx BIGINT DEFAULT 0,
+					udpRx BIGINT DEFAULT 0,
+					udpTx BIGINT DEFAULT 0,
+					min INT,
+					max INT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					lastEventTime DATETIME,
+					FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelRecycle" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(255) NOT NULL,
+					endpointId BIGINT NOT NULL,
+					mode VARCHAR(16) NOT NULL,
+					tunnelAddress VARCHAR(255) NOT NULL,
+					tunnelPort VARCHAR(16) NOT NULL,
+					targetAddress VARCHAR(255) NOT NULL,
+					targetPort VARCHAR(16) NOT NULL,
+					tlsMode VARCHAR(16) NOT NULL,
+					certPath TEXT,
+					keyPath TEXT,
+					logLevel VARCHAR(16) NOT NULL DEFAULT 'info',
+					commandLine TEXT NOT NULL,
+					instanceId VARCHAR(128),
+					tcpRx BIGINT DEFAULT 0,
+					tcpTx BIGINT DEFAULT 0,
+					udpRx BIGINT DEFAULT 0,
+					udpTx BIGINT DEFAULT 0,
+					min INT,
+					max INT,
+					FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
+				)`,
+				`CREATE TABLE IF NOT EXISTS "EndpointSSE" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					eventType VARCHAR(16) NOT NULL,
+					pushType VARCHAR(16) NOT NULL,
+					eventTime DATETIME(3) NOT NULL,
+					endpointId BIGINT NOT NULL,
+					instanceId VARCHAR(128) NOT NULL,
+					instanceType VARCHAR(16),
+					status VARCHAR(16),
+					url TEXT,
+					tcpRx BIGINT DEFAULT 0,
+					tcpTx BIGINT DEFAULT 0,
+					udpRx BIGINT DEFAULT 0,
+					udpTx BIGINT DEFAULT 0,
+					logs MEDIUMTEXT,
+					createdAt DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+					FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelOperationLog" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					tunnelId BIGINT,
+					tunnelName VARCHAR(255) NOT NULL,
+					action VARCHAR(32) NOT NULL,
+					status VARCHAR(16) NOT NULL,
+					message TEXT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "SystemConfig" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					"key" VARCHAR(255) NOT NULL UNIQUE,
+					value TEXT NOT NULL,
+					description TEXT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "UserSession" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					sessionId VARCHAR(128) NOT NULL UNIQUE,
+					username VARCHAR(255) NOT NULL,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					expiresAt DATETIME NOT NULL,
+					isActive BOOLEAN NOT NULL DEFAULT TRUE
+				)`,
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX idx_endpoint_sse_lookup ON "EndpointSSE" (endpointId, instanceId, eventType, createdAt)`,
+				`CREATE INDEX idx_endpoint_sse_created ON "EndpointSSE" (createdAt)`,
+				`CREATE INDEX idx_tunnel_instance ON "Tunnel" (instanceId)`,
+				`CREATE INDEX idx_tunnel_endpoint ON "Tunnel" (endpointId, instanceId)`,
+				`CREATE INDEX idx_tunnel_recycle_endpoint ON "TunnelRecycle" (endpointId)`,
+				`CREATE INDEX idx_tunnel_operation_log_created ON "TunnelOperationLog" (createdAt)`,
+				`CREATE INDEX idx_user_session_expires ON "UserSession" (isActive, expiresAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX idx_endpoint_sse_lookup ON "EndpointSSE"`,
+				`DROP INDEX idx_endpoint_sse_created ON "EndpointSSE"`,
+				`DROP INDEX idx_tunnel_instance ON "Tunnel"`,
+				`DROP INDEX idx_tunnel_endpoint ON "Tunnel"`,
+				`DROP INDEX idx_tunnel_recycle_endpoint ON "TunnelRecycle"`,
+				`DROP INDEX idx_tunnel_operation_log_created ON "TunnelOperationLog"`,
+				`DROP INDEX idx_user_session_expires ON "UserSession"`,
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "endpoint_sse_retention_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX idx_endpoint_sse_type_created ON "EndpointSSE" (eventType, createdAt)`,
+				`CREATE INDEX idx_endpoint_sse_endpoint_type ON "EndpointSSE" (endpointId, eventType, createdAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX idx_endpoint_sse_type_created ON "EndpointSSE"`,
+				`DROP INDEX idx_endpoint_sse_endpoint_type ON "EndpointSSE"`,
+			)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "traffic_rollups",
+		Up: func(tx *sql.Tx) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS "TrafficCounter" (
+					endpointId BIGINT NOT NULL,
+					instanceId VARCHAR(128) NOT NULL,
+					eventTime DATETIME(3) NOT NULL,
+					tcpRx BIGINT NOT NULL DEFAULT 0,
+					tcpTx BIGINT NOT NULL DEFAULT 0,
+					udpRx BIGINT NOT NULL DEFAULT 0,
+					udpTx BIGINT NOT NULL DEFAULT 0,
+					PRIMARY KEY (endpointId, instanceId)
+				)`,
+			}
+			for _, table := range []string{"TrafficMinute", "TrafficHour", "TrafficDay"} {
+				stmts = append(stmts,
+					`CREATE TABLE IF NOT EXISTS "`+table+`" (
+						endpointId BIGINT NOT NULL,
+						instanceId VARCHAR(128) NOT NULL,
+						bucket DATETIME NOT NULL,
+						tcpRx BIGINT NOT NULL DEFAULT 0,
+						tcpTx BIGINT NOT NULL DEFAULT 0,
+						udpRx BIGINT NOT NULL DEFAULT 0,
+						udpTx BIGINT NOT NULL DEFAULT 0,
+						samples BIGINT NOT NULL DEFAULT 0,
+						PRIMARY KEY (endpointId, instanceId, bucket),
+						INDEX idx_`+indexName(table)+`_bucket (bucket)
+					)`,
+				)
+			}
+			return execAll(tx, stmts...)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TrafficCounter"`,
+				`DROP TABLE IF EXISTS "TrafficMinute"`,
+				`DROP TABLE IF EXISTS "TrafficHour"`,
+				`DROP TABLE IF EXISTS "TrafficDay"`,
+			)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "tunnel_extra_params",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" ADD COLUMN extraParams TEXT`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN extraParams TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" DROP COLUMN extraParams`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN extraParams`,
+			)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "tunnel_managed",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" ADD COLUMN managed BOOLEAN NOT NULL DEFAULT FALSE`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" DROP COLUMN managed`,
+			)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "endpoint_reconcile_interval",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" ADD COLUMN reconcileInterval INTEGER`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN reconcileInterval`,
+			)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "labels",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" ADD COLUMN labels TEXT`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN labels TEXT`,
+				`ALTER TABLE "Endpoint" ADD COLUMN labels TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN labels`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN labels`,
+				`ALTER TABLE "Tunnel" DROP COLUMN labels`,
+			)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "list_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX idx_tunnel_created ON "Tunnel" (createdAt, id)`,
+				`CREATE INDEX idx_tunnel_status ON "Tunnel" (status, createdAt)`,
+				`CREATE INDEX idx_tunnel_mode ON "Tunnel" (mode, createdAt)`,
+				`CREATE INDEX idx_endpoint_created ON "Endpoint" (createdAt, id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX idx_endpoint_created ON "Endpoint"`,
+				`DROP INDEX idx_tunnel_mode ON "Tunnel"`,
+				`DROP INDEX idx_tunnel_status ON "Tunnel"`,
+				`DROP INDEX idx_tunnel_created ON "Tunnel"`,
+			)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "tunnel_templates",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelTemplate" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(255) NOT NULL UNIQUE,
+					description TEXT,
+					builtin BOOLEAN NOT NULL DEFAULT FALSE,
+					definition TEXT NOT NULL,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelTemplate"`,
+			)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "tunnel_pairs",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelPair" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(255) NOT NULL UNIQUE,
+					serverTunnelId BIGINT NOT NULL UNIQUE,
+					clientTunnelId BIGINT NOT NULL UNIQUE,
+					template VARCHAR(255),
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelPair"`,
+			)
+		},
+	},
+	{
+		Version: 12,
+		Name:    "recycle_deleted_at",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN deletedAt DATETIME`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN deletedBy VARCHAR(255)`,
+				`UPDATE "TunnelRecycle" SET deletedAt = CURRENT_TIMESTAMP WHERE deletedAt IS NULL`,
+				`CREATE INDEX idx_tunnel_recycle_deleted ON "TunnelRecycle" (deletedAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX idx_tunnel_recycle_deleted ON "TunnelRecycle"`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN deletedBy`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN deletedAt`,
+			)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "tunnel_config_versions",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelConfigVersion" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					tunnelId BIGINT NOT NULL,
+					version INTEGER NOT NULL,
+					name VARCHAR(255) NOT NULL,
+					commandLine TEXT NOT NULL,
+					action VARCHAR(255) NOT NULL,
+					actor VARCHAR(255),
+					message TEXT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE (tunnelId, version)
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelConfigVersion"`,
+			)
+		},
+	},
+	{
+		Version: 14,
+		Name:    "endpoint_port_ranges",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" ADD COLUMN allowedPorts TEXT`,
+				`ALTER TABLE "Endpoint" ADD COLUMN reservedPorts TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN reservedPorts`,
+				`ALTER TABLE "Endpoint" DROP COLUMN allowedPorts`,
+			)
+		},
+	},
+	{
+		Version: 15,
+		Name:    "tunnel_schedules",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelSchedule" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(255) NOT NULL UNIQUE,
+					expression VARCHAR(255) NOT NULL,
+					timezone VARCHAR(255) NOT NULL,
+					action VARCHAR(255) NOT NULL,
+					tunnelIds TEXT,
+					selector TEXT,
+					missed VARCHAR(255) NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					lastRunAt DATETIME,
+					lastStatus VARCHAR(255),
+					lastMessage TEXT,
+					createdBy VARCHAR(255),
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelScheduleRun" (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					scheduleId BIGINT NOT NULL,
+					scheduledAt DATETIME NOT NULL,
+					startedAt DATETIME NOT NULL,
+					finishedAt DATETIME,
+					source VARCHAR(255) NOT NULL,
+					status VARCHAR(255) NOT NULL,
+					total INTEGER NOT NULL DEFAULT 0,
+					succeeded INTEGER NOT NULL DEFAULT 0,
+					failed INTEGER NOT NULL DEFAULT 0,
+					message TEXT,
+					results TEXT
+				)`,
+				`CREATE INDEX idx_tunnel_schedule_run ON "TunnelScheduleRun" (scheduleId, id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelScheduleRun"`,
+				`DROP TABLE IF EXISTS "TunnelSchedule"`,
+			)
+		},
+	},
+}
@@ -0,0 +1,441 @@
+package migrate
+
+import "database/sql"
+
+// postgresMigrations PostgreSQL 迁移列表，版本号与 SQLite 保持一致
+//
+// 约定：
+//   - 所有表都必须包含 id 列（storage 包通过 RETURNING id 实现 LastInsertId）
+//   - 列名不加引号，建表与查询时统一折叠为小写
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "Endpoint" (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					url TEXT NOT NULL UNIQUE,
+					apiPath TEXT NOT NULL,
+					apiKey TEXT NOT NULL,
+					status TEXT NOT NULL DEFAULT 'OFFLINE',
+					color TEXT DEFAULT 'default',
+					lastCheck TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					tunnelCount INTEGER DEFAULT 0
+				)`,
+				`CREATE TABLE IF NOT EXISTS "Tunnel" (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					endpointId BIGINT NOT NULL REFERENCES "Endpoint"(id) ON DELETE CASCADE,
+					mode TEXT NOT NULL,
+					status TEXT NOT NULL DEFAULT 'stopped',
+					tunnelAddress TEXT NOT NULL,
+					tunnelPort TEXT NOT NULL,
+					targetAddress TEXT NOT NULL,
+					targetPort TEXT NOT NULL,
+					tlsMode TEXT NOT NULL,
+					certPath TEXT,
+					keyPath TEXT,
+					logLevel TEXT NOT NULL DEFAULT 'info',
+					commandLine TEXT NOT NULL,
+					instanceId TEXT,
+					tcpRx BIGINT DEFAULT 0,
+					tcpTx BIGINT DEFAULT 0,
+					udpRx BIGINT DEFAULT 0,
+					udpTx BIGINT DEFAULT 0,
+					min INTEGER,
+					max INTEGER,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					lastEventTime TIMESTAMPTZ
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelRecycle" (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL,
+					endpointId BIGINT NOT NULL REFERENCES "Endpoint"(id) ON DELETE CASCADE,
+					mode TEXT NOT NULL,
+					tunnelAddress TEXT NOT NULL,
+					tunnelPort TEXT NOT NULL,
+					targetAddress TEXT NOT NULL,
+					targetPort TEXT NOT NULL,
+					tlsMode TEXT NOT NULL,
+					certPath TEXT,
+					keyPath TEXT,
+					logLevel TEXT NOT NULL DEFAULT 'info',
+					commandLine TEXT NOT NULL,
+					instanceId TEXT,
+					tcpRx BIGINT DEFAULT 0,
+					tcpTx BIGINT DEFAULT 0,
+					udpRx BIGINT DEFAULT 0,
+					udpTx BIGINT DEFAULT 0,
+					min INTEGER,
+					max INTEGER
+				)`,
+				`CREATE TABLE IF NOT EXISTS "EndpointSSE" (
+					id BIGSERIAL PRIMARY KEY,
+					eventType TEXT NOT NULL,
+					pushType TEXT NOT NULL,
+					eventTime TIMESTAMPTZ NOT NULL,
+					endpointId BIGINT NOT NULL REFERENCES "Endpoint"(id) ON DELETE CASCADE,
+					instanceId TEXT NOT NULL,
+					instanceType TEXT,
+					status TEXT,
+					url TEXT,
+					tcpRx BIGINT DEFAULT 0,
+					tcpTx BIGINT DEFAULT 0,
+					udpRx BIGINT DEFAULT 0,
+					udpTx BIGINT DEFAULT 0,
+					logs TEXT,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelOperationLog" (
+					id BIGSERIAL PRIMARY KEY,
+					tunnelId BIGINT,
+					tunnelName TEXT NOT NULL,
+					action TEXT NOT NULL,
+					status TEXT NOT NULL,
+					message TEXT,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "SystemConfig" (
+					id BIGSERIAL PRIMARY KEY,
+					key TEXT NOT NULL UNIQUE,
+					value TEXT NOT NULL,
+					description TEXT,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "UserSession" (
+					id BIGSERIAL PRIMARY KEY,
+					sessionId TEXT NOT NULL UNIQUE,
+					username TEXT NOT NULL,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					expiresAt TIMESTAMPTZ NOT NULL,
+					isActive BOOLEAN NOT NULL DEFAULT TRUE
+				)`,
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_lookup ON "EndpointSSE" (endpointId, instanceId, eventType, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_created ON "EndpointSSE" (createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_instance ON "Tunnel" (instanceId)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_endpoint ON "Tunnel" (endpointId, instanceId)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_recycle_endpoint ON "TunnelRecycle" (endpointId)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_operation_log_created ON "TunnelOperationLog" (createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_user_session_expires ON "UserSession" (isActive, expiresAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_lookup`,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_created`,
+				`DROP INDEX IF EXISTS idx_tunnel_instance`,
+				`DROP INDEX IF EXISTS idx_tunnel_endpoint`,
+				`DROP INDEX IF EXISTS idx_tunnel_recycle_endpoint`,
+				`DROP INDEX IF EXISTS idx_tunnel_operation_log_created`,
+				`DROP INDEX IF EXISTS idx_user_session_expires`,
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "endpoint_sse_retention_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_type_created ON "EndpointSSE" (eventType, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_endpoint_type ON "EndpointSSE" (endpointId, eventType, createdAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_type_created`,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_endpoint_type`,
+			)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "traffic_rollups",
+		Up: func(tx *sql.Tx) error {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS "TrafficCounter" (
+					id BIGSERIAL PRIMARY KEY,
+					endpointId BIGINT NOT NULL,
+					instanceId TEXT NOT NULL,
+					eventTime TIMESTAMPTZ NOT NULL,
+					tcpRx BIGINT NOT NULL DEFAULT 0,
+					tcpTx BIGINT NOT NULL DEFAULT 0,
+					udpRx BIGINT NOT NULL DEFAULT 0,
+					udpTx BIGINT NOT NULL DEFAULT 0,
+					UNIQUE (endpointId, instanceId)
+				)`,
+			}
+			for _, table := range []string{"TrafficMinute", "TrafficHour", "TrafficDay"} {
+				stmts = append(stmts,
+					`CREATE TABLE IF NOT EXISTS "`+table+`" (
+						id BIGSERIAL PRIMARY KEY,
+						endpointId BIGINT NOT NULL,
+						instanceId TEXT NOT NULL,
+						bucket TIMESTAMPTZ NOT NULL,
+						tcpRx BIGINT NOT NULL DEFAULT 0,
+						tcpTx BIGINT NOT NULL DEFAULT 0,
+						udpRx BIGINT NOT NULL DEFAULT 0,
+						udpTx BIGINT NOT NULL DEFAULT 0,
+						samples BIGINT NOT NULL DEFAULT 0,
+						UNIQUE (endpointId, instanceId, bucket)
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_`+indexName(table)+`_bucket ON "`+table+`" (bucket)`,
+				)
+			}
+			return execAll(tx, stmts...)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TrafficCounter"`,
+				`DROP TABLE IF EXISTS "TrafficMinute"`,
+				`DROP TABLE IF EXISTS "TrafficHour"`,
+				`DROP TABLE IF EXISTS "TrafficDay"`,
+			)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "tunnel_extra_params",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" ADD COLUMN extraParams TEXT`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN extraParams TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" DROP COLUMN extraParams`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN extraParams`,
+			)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "tunnel_managed",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" ADD COLUMN managed BOOLEAN NOT NULL DEFAULT FALSE`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" DROP COLUMN managed`,
+			)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "endpoint_reconcile_interval",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" ADD COLUMN reconcileInterval INTEGER`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN reconcileInterval`,
+			)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "labels",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" ADD COLUMN labels TEXT`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN labels TEXT`,
+				`ALTER TABLE "Endpoint" ADD COLUMN labels TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN labels`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN labels`,
+				`ALTER TABLE "Tunnel" DROP COLUMN labels`,
+			)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "list_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_created ON "Tunnel" (createdAt, id)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_status ON "Tunnel" (status, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_mode ON "Tunnel" (mode, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_created ON "Endpoint" (createdAt, id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_endpoint_created`,
+				`DROP INDEX IF EXISTS idx_tunnel_mode`,
+				`DROP INDEX IF EXISTS idx_tunnel_status`,
+				`DROP INDEX IF EXISTS idx_tunnel_created`,
+			)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "tunnel_templates",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelTemplate" (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					description TEXT,
+					builtin BOOLEAN NOT NULL DEFAULT FALSE,
+					definition TEXT NOT NULL,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelTemplate"`,
+			)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "tunnel_pairs",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelPair" (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					serverTunnelId BIGINT NOT NULL UNIQUE,
+					clientTunnelId BIGINT NOT NULL UNIQUE,
+					template TEXT,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelPair"`,
+			)
+		},
+	},
+	{
+		Version: 12,
+		Name:    "recycle_deleted_at",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN deletedAt TIMESTAMPTZ`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN deletedBy TEXT`,
+				`UPDATE "TunnelRecycle" SET deletedAt = CURRENT_TIMESTAMP WHERE deletedAt IS NULL`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_recycle_deleted ON "TunnelRecycle" (deletedAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_tunnel_recycle_deleted`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN deletedBy`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN deletedAt`,
+			)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "tunnel_config_versions",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelConfigVersion" (
+					id BIGSERIAL PRIMARY KEY,
+					tunnelId BIGINT NOT NULL,
+					version INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					commandLine TEXT NOT NULL,
+					action TEXT NOT NULL,
+					actor TEXT,
+					message TEXT,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE (tunnelId, version)
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelConfigVersion"`,
+			)
+		},
+	},
+	{
+		Version: 14,
+		Name:    "endpoint_port_ranges",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" ADD COLUMN allowedPorts TEXT`,
+				`ALTER TABLE "Endpoint" ADD COLUMN reservedPorts TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN reservedPorts`,
+				`ALTER TABLE "Endpoint" DROP COLUMN allowedPorts`,
+			)
+		},
+	},
+	{
+		Version: 15,
+		Name:    "tunnel_schedules",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE TABLE IF NOT EXISTS "TunnelSchedule" (
+					id BIGSERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					expression TEXT NOT NULL,
+					timezone TEXT NOT NULL,
+					action TEXT NOT NULL,
+					tunnelIds TEXT,
+					selector TEXT,
+					missed TEXT NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					lastRunAt TIMESTAMPTZ,
+					lastStatus TEXT,
+					lastMessage TEXT,
+					createdBy TEXT,
+					createdAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelScheduleRun" (
+					id BIGSERIAL PRIMARY KEY,
+					scheduleId BIGINT NOT NULL,
+					scheduledAt TIMESTAMPTZ NOT NULL,
+					startedAt TIMESTAMPTZ NOT NULL,
+					finishedAt TIMESTAMPTZ,
+					source TEXT NOT NULL,
+					status TEXT NOT NULL,
+					total INTEGER NOT NULL DEFAULT 0,
+					succeeded INTEGER NOT NULL DEFAULT 0,
+					failed INTEGER NOT NULL DEFAULT 0,
+					message TEXT,
+					results TEXT
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_schedule_run ON "TunnelScheduleRun" (scheduleId, id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelScheduleRun"`,
+				`DROP TABLE IF EXISTS "TunnelSchedule"`,
+			)
+		},
+	},
+}
@@ -0,0 +1,504 @@
+package migrate
+
+import "database/sql"
+
+// sqliteMigrations SQLite 迁移列表，新增迁移请追加在末尾并递增版本号，
+// 同时在 PostgreSQL / MySQL 列表中添加相同版本号的迁移
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      sqliteBaselineUp,
+	},
+	{
+		Version: 2,
+		Name:    "add_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_lookup ON "EndpointSSE" (endpointId, instanceId, eventType, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_created ON "EndpointSSE" (createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_instance ON "Tunnel" (instanceId)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_endpoint ON "Tunnel" (endpointId, instanceId)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_recycle_endpoint ON "TunnelRecycle" (endpointId)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_operation_log_created ON "TunnelOperationLog" (createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_user_session_expires ON "UserSession" (isActive, expiresAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_lookup`,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_created`,
+				`DROP INDEX IF EXISTS idx_tunnel_instance`,
+				`DROP INDEX IF EXISTS idx_tunnel_endpoint`,
+				`DROP INDEX IF EXISTS idx_tunnel_recycle_endpoint`,
+				`DROP INDEX IF EXISTS idx_tunnel_operation_log_created`,
+				`DROP INDEX IF EXISTS idx_user_session_expires`,
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "endpoint_sse_retention_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 按事件类型分批清理过期数据
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_type_created ON "EndpointSSE" (eventType, createdAt)`,
+				// 端点日志查询 / 搜索
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_sse_endpoint_type ON "EndpointSSE" (endpointId, eventType, createdAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_type_created`,
+				`DROP INDEX IF EXISTS idx_endpoint_sse_endpoint_type`,
+			)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "traffic_rollups",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 各实例最近一次的累计计数，用于计算增量
+				`CREATE TABLE IF NOT EXISTS "TrafficCounter" (
+					endpointId INTEGER NOT NULL,
+					instanceId TEXT NOT NULL,
+					eventTime DATETIME NOT NULL,
+					tcpRx INTEGER NOT NULL DEFAULT 0,
+					tcpTx INTEGER NOT NULL DEFAULT 0,
+					udpRx INTEGER NOT NULL DEFAULT 0,
+					udpTx INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (endpointId, instanceId)
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TrafficMinute" (
+					endpointId INTEGER NOT NULL,
+					instanceId TEXT NOT NULL,
+					bucket DATETIME NOT NULL,
+					tcpRx INTEGER NOT NULL DEFAULT 0,
+					tcpTx INTEGER NOT NULL DEFAULT 0,
+					udpRx INTEGER NOT NULL DEFAULT 0,
+					udpTx INTEGER NOT NULL DEFAULT 0,
+					samples INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (endpointId, instanceId, bucket)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_traffic_minute_bucket ON "TrafficMinute" (bucket)`,
+				`CREATE TABLE IF NOT EXISTS "TrafficHour" (
+					endpointId INTEGER NOT NULL,
+					instanceId TEXT NOT NULL,
+					bucket DATETIME NOT NULL,
+					tcpRx INTEGER NOT NULL DEFAULT 0,
+					tcpTx INTEGER NOT NULL DEFAULT 0,
+					udpRx INTEGER NOT NULL DEFAULT 0,
+					udpTx INTEGER NOT NULL DEFAULT 0,
+					samples INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (endpointId, instanceId, bucket)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_traffic_hour_bucket ON "TrafficHour" (bucket)`,
+				`CREATE TABLE IF NOT EXISTS "TrafficDay" (
+					endpointId INTEGER NOT NULL,
+					instanceId TEXT NOT NULL,
+					bucket DATETIME NOT NULL,
+					tcpRx INTEGER NOT NULL DEFAULT 0,
+					tcpTx INTEGER NOT NULL DEFAULT 0,
+					udpRx INTEGER NOT NULL DEFAULT 0,
+					udpTx INTEGER NOT NULL DEFAULT 0,
+					samples INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (endpointId, instanceId, bucket)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_traffic_day_bucket ON "TrafficDay" (bucket)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TrafficCounter"`,
+				`DROP TABLE IF EXISTS "TrafficMinute"`,
+				`DROP TABLE IF EXISTS "TrafficHour"`,
+				`DROP TABLE IF EXISTS "TrafficDay"`,
+			)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "tunnel_extra_params",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 扩展实例参数（JSON 对象）
+				`ALTER TABLE "Tunnel" ADD COLUMN extraParams TEXT`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN extraParams TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" DROP COLUMN extraParams`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN extraParams`,
+			)
+		},
+	},
+	{
+		Version: 6,
+		Name:    "tunnel_managed",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 由声明式配置（plan / apply）管理的隧道
+				`ALTER TABLE "Tunnel" ADD COLUMN managed BOOLEAN NOT NULL DEFAULT 0`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Tunnel" DROP COLUMN managed`,
+			)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "endpoint_reconcile_interval",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 端点对账间隔（秒），NULL 表示使用默认间隔，0 表示关闭
+				`ALTER TABLE "Endpoint" ADD COLUMN reconcileInterval INTEGER`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN reconcileInterval`,
+			)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "labels",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 键值标签（JSON），回收站保留标签以便恢复
+				`ALTER TABLE "Tunnel" ADD COLUMN labels TEXT`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN labels TEXT`,
+				`ALTER TABLE "Endpoint" ADD COLUMN labels TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN labels`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN labels`,
+				`ALTER TABLE "Tunnel" DROP COLUMN labels`,
+			)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "list_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 列表分页、排序与筛选使用的索引
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_created ON "Tunnel" (createdAt, id)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_status ON "Tunnel" (status, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_mode ON "Tunnel" (mode, createdAt)`,
+				`CREATE INDEX IF NOT EXISTS idx_endpoint_created ON "Endpoint" (createdAt, id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_endpoint_created`,
+				`DROP INDEX IF EXISTS idx_tunnel_mode`,
+				`DROP INDEX IF EXISTS idx_tunnel_status`,
+				`DROP INDEX IF EXISTS idx_tunnel_created`,
+			)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "tunnel_templates",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 隧道模板：参数与隧道定义以 JSON 保存在 definition 中
+				`CREATE TABLE IF NOT EXISTS "TunnelTemplate" (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE,
+					description TEXT,
+					builtin BOOLEAN NOT NULL DEFAULT 0,
+					definition TEXT NOT NULL,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelTemplate"`,
+			)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "tunnel_pairs",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 隧道对：双端 / 内网穿透模板创建的 server 与 client 隧道
+				`CREATE TABLE IF NOT EXISTS "TunnelPair" (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE,
+					serverTunnelId BIGINT NOT NULL UNIQUE,
+					clientTunnelId BIGINT NOT NULL UNIQUE,
+					template TEXT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelPair"`,
+			)
+		},
+	},
+	{
+		Version: 12,
+		Name:    "recycle_deleted_at",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 回收站记录删除时间与操作者；已有记录以迁移时间作为删除时间
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN deletedAt DATETIME`,
+				`ALTER TABLE "TunnelRecycle" ADD COLUMN deletedBy TEXT`,
+				`UPDATE "TunnelRecycle" SET deletedAt = CURRENT_TIMESTAMP WHERE deletedAt IS NULL`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_recycle_deleted ON "TunnelRecycle" (deletedAt)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP INDEX IF EXISTS idx_tunnel_recycle_deleted`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN deletedBy`,
+				`ALTER TABLE "TunnelRecycle" DROP COLUMN deletedAt`,
+			)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "tunnel_config_versions",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 隧道配置历史：每次创建、编辑、重命名、回滚及主控侧变更记录一个版本
+				`CREATE TABLE IF NOT EXISTS "TunnelConfigVersion" (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					tunnelId BIGINT NOT NULL,
+					version INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					commandLine TEXT NOT NULL,
+					action TEXT NOT NULL,
+					actor TEXT,
+					message TEXT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE (tunnelId, version)
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelConfigVersion"`,
+			)
+		},
+	},
+	{
+		Version: 14,
+		Name:    "endpoint_port_ranges",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 端点允许 / 保留的隧道端口范围，NULL 表示使用全局配置
+				`ALTER TABLE "Endpoint" ADD COLUMN allowedPorts TEXT`,
+				`ALTER TABLE "Endpoint" ADD COLUMN reservedPorts TEXT`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`ALTER TABLE "Endpoint" DROP COLUMN reservedPorts`,
+				`ALTER TABLE "Endpoint" DROP COLUMN allowedPorts`,
+			)
+		},
+	},
+	{
+		Version: 15,
+		Name:    "tunnel_schedules",
+		Up: func(tx *sql.Tx) error {
+			return execAll(tx,
+				// 定时操作：计划（cron 表达式、时区、目标与动作）及执行记录
+				`CREATE TABLE IF NOT EXISTS "TunnelSchedule" (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE,
+					expression TEXT NOT NULL,
+					timezone TEXT NOT NULL,
+					action TEXT NOT NULL,
+					tunnelIds TEXT,
+					selector TEXT,
+					missed TEXT NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					lastRunAt DATETIME,
+					lastStatus TEXT,
+					lastMessage TEXT,
+					createdBy TEXT,
+					createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS "TunnelScheduleRun" (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					scheduleId BIGINT NOT NULL,
+					scheduledAt DATETIME NOT NULL,
+					startedAt DATETIME NOT NULL,
+					finishedAt DATETIME,
+					source TEXT NOT NULL,
+					status TEXT NOT NULL,
+					total INTEGER NOT NULL DEFAULT 0,
+					succeeded INTEGER NOT NULL DEFAULT 0,
+					failed INTEGER NOT NULL DEFAULT 0,
+					message TEXT,
+					results TEXT
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_tunnel_schedule_run ON "TunnelScheduleRun" (scheduleId, id)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execAll(tx,
+				`DROP TABLE IF EXISTS "TunnelScheduleRun"`,
+				`DROP TABLE IF EXISTS "TunnelSchedule"`,
+			)
+		},
+	},
+}
+
+// sqliteBaselineUp 初始表结构（兼容迁移框架引入前已存在的数据库，因此使用 IF NOT EXISTS）
+func sqliteBaselineUp(tx *sql.Tx) error {
+	createEndpointsTable := `
+	CREATE TABLE IF NOT EXISTS "Endpoint" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		url TEXT NOT NULL UNIQUE,
+		apiPath TEXT NOT NULL,
+		apiKey TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'OFFLINE',
+		color TEXT DEFAULT 'default',
+		lastCheck DATETIME DEFAULT CURRENT_TIMESTAMP,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		tunnelCount INTEGER DEFAULT 0
+	);`
+
+	createTunnelTable := `
+	CREATE TABLE IF NOT EXISTS "Tunnel" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		endpointId INTEGER NOT NULL,
+		mode TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'stopped',
+		tunnelAddress TEXT NOT NULL,
+		tunnelPort TEXT NOT NULL,
+		targetAddress TEXT NOT NULL,
+		targetPort TEXT NOT NULL,
+		tlsMode TEXT NOT NULL,
+		certPath TEXT,
+		keyPath TEXT,
+		logLevel TEXT NOT NULL DEFAULT 'info',
+		commandLine TEXT NOT NULL,
+		instanceId TEXT,
+		tcpRx INTEGER DEFAULT 0,
+		tcpTx INTEGER DEFAULT 0,
+		udpRx INTEGER DEFAULT 0,
+		udpTx INTEGER DEFAULT 0,
+		min INTEGER,
+		max INTEGER,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		lastEventTime DATETIME,
+		FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
+	);`
+
+	createTunnelRecycleTable := `
+	CREATE TABLE IF NOT EXISTS "TunnelRecycle" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		endpointId INTEGER NOT NULL,
+		mode TEXT NOT NULL,
+		tunnelAddress TEXT NOT NULL,
+		tunnelPort TEXT NOT NULL,
+		targetAddress TEXT NOT NULL,
+		targetPort TEXT NOT NULL,
+		tlsMode TEXT NOT NULL,
+		certPath TEXT,
+		keyPath TEXT,
+		logLevel TEXT NOT NULL DEFAULT 'info',
+		commandLine TEXT NOT NULL,
+		instanceId TEXT,
+		tcpRx INTEGER DEFAULT 0,
+		tcpTx INTEGER DEFAULT 0,
+		udpRx INTEGER DEFAULT 0,
+		udpTx INTEGER DEFAULT 0,
+		min INTEGER,
+		max INTEGER,
+		FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
+	);`
+
+	createEndpointSSE := `
+	CREATE TABLE IF NOT EXISTS "EndpointSSE" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		eventType TEXT NOT NULL,
+		pushType TEXT NOT NULL,
+		eventTime DATETIME NOT NULL,
+		endpointId INTEGER NOT NULL,
+		instanceId TEXT NOT NULL,
+		instanceType TEXT,
+		status TEXT,
+		url TEXT,
+		tcpRx INTEGER DEFAULT 0,
+		tcpTx INTEGER DEFAULT 0,
+		udpRx INTEGER DEFAULT 0,
+		udpTx INTEGER DEFAULT 0,
+		logs TEXT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (endpointId) REFERENCES "Endpoint"(id) ON DELETE CASCADE
+	);`
+
+	createTunnelLog := `
+	CREATE TABLE IF NOT EXISTS "TunnelOperationLog" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tunnelId INTEGER,
+		tunnelName TEXT NOT NULL,
+		action TEXT NOT NULL,
+		status TEXT NOT NULL,
+		message TEXT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createSystemConfig := `
+	CREATE TABLE IF NOT EXISTS "SystemConfig" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		KEY TEXT NOT NULL UNIQUE,
+		value TEXT NOT NULL,
+		description TEXT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createUserSession := `
+	CREATE TABLE IF NOT EXISTS "UserSession" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sessionId TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expiresAt DATETIME NOT NULL,
+		isActive BOOLEAN NOT NULL DEFAULT 1
+	);`
+
+	if err := execAll(tx,
+		createEndpointsTable,
+		createTunnelTable,
+		createTunnelRecycleTable,
+		createEndpointSSE,
+		createTunnelLog,
+		createSystemConfig,
+		createUserSession,
+	); err != nil {
+		return err
+	}
+
+	// ---- 旧库兼容：为 Tunnel 表添加 min / max 列 ----
+	if err := ensureColumn(tx, "Tunnel", "min", "INTEGER"); err != nil {
+		return err
+	}
+	return ensureColumn(tx, "Tunnel", "max", "INTEGER")
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+
+	"NodePassDash/internal/nodepassurl"
 )
 
 // Client 封装与 NodePass HTTP API 的交互
@@ -173,3 +175,22 @@ func (c *Client) GetInstances() ([]Instance, error) {
 	}
 	return resp, nil
 }
+
+// Info 主控信息（GET /info），Params 为主控声明支持的扩展实例参数，旧版本主控不返回
+type Info struct {
+	Name    string             `json:"name"`
+	Version string             `json:"ver"`
+	OS      string             `json:"os"`
+	Arch    string             `json:"arch"`
+	Params  nodepassurl.Schema `json:"params,omitempty"`
+}
+
+// GetInfo 获取主控信息，旧版本主控不支持时返回错误
+func (c *Client) GetInfo() (*Info, error) {
+	url := fmt.Sprintf("%s%s/info", c.baseURL, c.apiPath)
+	var resp Info
+	if err := c.doRequest(http.MethodGet, url, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
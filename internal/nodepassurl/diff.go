@@ -0,0 +1,63 @@
+package nodepassurl
+
+import "strconv"
+
+// FieldDiff 两个实例 URL 之间的单个字段差异，空字符串表示未设置
+type FieldDiff struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Diff 比较两个实例 URL 的语义差异（忽略参数顺序与转义方式），from 为 nil 时视为空配置
+func Diff(from, to *URL) []FieldDiff {
+	if from == nil {
+		from = &URL{}
+	}
+	if to == nil {
+		to = &URL{}
+	}
+
+	var diffs []FieldDiff
+	add := func(field, a, b string) {
+		if a != b {
+			diffs = append(diffs, FieldDiff{Field: field, From: a, To: b})
+		}
+	}
+	num := func(p int) string {
+		if p <= 0 {
+			return ""
+		}
+		return strconv.Itoa(p)
+	}
+
+	add("mode", from.Mode, to.Mode)
+	add("tunnelAddress", from.TunnelAddress, to.TunnelAddress)
+	add("tunnelPort", num(from.TunnelPort), num(to.TunnelPort))
+	add("targetAddress", from.TargetAddress, to.TargetAddress)
+	add("targetPort", num(from.TargetPort), num(to.TargetPort))
+	add(ParamLog, from.Log, to.Log)
+	add(ParamTLS, from.TLS, to.TLS)
+	add(ParamCrt, from.Crt, to.Crt)
+	add(ParamKey, from.Key, to.Key)
+	add(ParamMin, num(from.Min), num(to.Min))
+	add(ParamMax, num(from.Max), num(to.Max))
+
+	fromExtra, toExtra := from.ExtraMap(), to.ExtraMap()
+	keys := make(map[string]string, len(fromExtra)+len(toExtra))
+	for k := range fromExtra {
+		keys[k] = ""
+	}
+	for k := range toExtra {
+		keys[k] = ""
+	}
+	for _, k := range sortedKeys(keys) {
+		add("extraParams."+k, fromExtra[k], toExtra[k])
+	}
+	return diffs
+}
+
+// Equal 判断两个实例 URL 在语义上是否一致
+func Equal(a, b *URL) bool {
+	return len(Diff(a, b)) == 0
+}
@@ -0,0 +1,72 @@
+package nodepassurl
+
+import (
+	"net/url"
+	"strings"
+)
+
+// 数据库中 Tunnel.tlsMode / logLevel 的取值
+const (
+	Inherit  = "inherit"
+	TLSMode0 = "mode0"
+	TLSMode1 = "mode1"
+	TLSMode2 = "mode2"
+)
+
+// TLSMode 返回数据库使用的 TLS 模式（inherit / mode0 / mode1 / mode2），仅 server 模式有效
+func (u *URL) TLSMode() string {
+	if u.Mode != ModeServer {
+		return Inherit
+	}
+	switch u.TLS {
+	case "0":
+		return TLSMode0
+	case "1":
+		return TLSMode1
+	case "2":
+		return TLSMode2
+	}
+	return Inherit
+}
+
+// SetTLSMode 按数据库取值设置 TLS 参数，inherit 或空表示移除
+func (u *URL) SetTLSMode(mode string) {
+	switch mode {
+	case TLSMode0:
+		u.TLS = "0"
+	case TLSMode1:
+		u.TLS = "1"
+	case TLSMode2:
+		u.TLS = "2"
+	default:
+		u.TLS = ""
+	}
+}
+
+// LogLevel 返回数据库使用的日志级别，未设置时为 inherit
+func (u *URL) LogLevel() string {
+	if u.Log == "" {
+		return Inherit
+	}
+	return u.Log
+}
+
+// SetLogLevel 按数据库取值设置日志级别，inherit 或空表示移除
+func (u *URL) SetLogLevel(level string) {
+	if level == Inherit {
+		level = ""
+	}
+	u.Log = strings.ToLower(level)
+}
+
+// EndpointHost 提取主控 API 地址（http(s)://host:port/api）中的主机名，支持 IPv6
+func EndpointHost(endpointURL string) string {
+	raw := endpointURL
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	if u, err := url.Parse(raw); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
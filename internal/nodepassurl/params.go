@@ -0,0 +1,160 @@
+package nodepassurl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 参数取值类型
+const (
+	ParamTypeString = "string"
+	ParamTypeInt    = "int"
+	ParamTypeBool   = "bool"
+	ParamTypeEnum   = "enum"
+)
+
+// ParamSpec 主控声明的实例参数
+type ParamSpec struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type,omitempty"`   // string / int / bool / enum，空视为 string
+	Values      []string `json:"values,omitempty"` // enum 可选值
+	Modes       []string `json:"modes,omitempty"`  // 适用的模式，空表示 server / client 均可
+	Description string   `json:"description,omitempty"`
+}
+
+// Schema 主控支持的扩展参数集合，为空表示未知（不做校验）
+type Schema []ParamSpec
+
+// ExtraMap 以 map 形式返回未识别参数，无参数时返回 nil
+func (u *URL) ExtraMap() map[string]string {
+	if len(u.Extra) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(u.Extra))
+	for _, p := range u.Extra {
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+// SetExtraMap 用 m 替换全部未识别参数：已有参数保持原顺序，新增参数按名称排序追加
+func (u *URL) SetExtraMap(m map[string]string) {
+	kept := u.Extra[:0:0]
+	for _, p := range u.Extra {
+		if v, ok := m[p.Key]; ok {
+			kept = append(kept, Param{Key: p.Key, Value: v})
+		}
+	}
+	u.Extra = kept
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if _, ok := u.Param(k); !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		u.Extra = append(u.Extra, Param{Key: k, Value: m[k]})
+	}
+}
+
+// ValidateExtra 校验扩展参数名：不能为空、不能包含分隔符，且不能与已识别参数重复
+func ValidateExtra(m map[string]string) error {
+	var errs []string
+	for _, k := range sortedKeys(m) {
+		switch {
+		case k == "" || strings.ContainsAny(k, "&=?# "):
+			errs = append(errs, fmt.Sprintf("参数名无效: %q", k))
+		case IsKnownParam(k):
+			errs = append(errs, fmt.Sprintf("参数 %s 请使用对应字段设置", k))
+		}
+	}
+	if len(errs) > 0 {
+		return invalid("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate 按主控声明校验扩展参数；schema 为空时仅校验参数名
+func (s Schema) Validate(mode string, m map[string]string) error {
+	if err := ValidateExtra(m); err != nil {
+		return err
+	}
+	if len(s) == 0 {
+		return nil
+	}
+
+	specs := make(map[string]ParamSpec, len(s))
+	for _, spec := range s {
+		specs[spec.Name] = spec
+	}
+
+	var errs []string
+	for _, k := range sortedKeys(m) {
+		v := m[k]
+		spec, ok := specs[k]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("主控不支持参数 %s", k))
+			continue
+		}
+		if len(spec.Modes) > 0 && !contains(spec.Modes, mode) {
+			errs = append(errs, fmt.Sprintf("参数 %s 不适用于 %s 模式", k, mode))
+			continue
+		}
+		switch spec.Type {
+		case ParamTypeInt:
+			if _, err := strconv.Atoi(v); err != nil {
+				errs = append(errs, fmt.Sprintf("参数 %s=%q 不是整数", k, v))
+			}
+		case ParamTypeBool:
+			if _, err := strconv.ParseBool(v); err != nil {
+				errs = append(errs, fmt.Sprintf("参数 %s=%q 不是布尔值", k, v))
+			}
+		case ParamTypeEnum:
+			if !contains(spec.Values, v) {
+				errs = append(errs, fmt.Sprintf("参数 %s=%q 取值应为 %s", k, v, strings.Join(spec.Values, " / ")))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return invalid("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// EncodeExtra 将扩展参数编码为数据库存储的 JSON，无参数时返回 nil（写入 NULL）
+func EncodeExtra(m map[string]string) interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// DecodeExtra 解析数据库中的扩展参数 JSON，空值或格式错误时返回 nil
+func DecodeExtra(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil || len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
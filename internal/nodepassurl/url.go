@@ -0,0 +1,472 @@
+// Package nodepassurl 解析与构建 NodePass 实例 URL（命令行）。
+//
+//	server://[tunnelAddr]:tunnelPort/[targetAddr]:targetPort?log=info&tls=2&crt=...&key=...
+//	client://[tunnelAddr]:tunnelPort/[targetAddr]:targetPort?log=info&min=8&max=64
+//
+// 地址支持 IPv6（格式化时使用方括号）。解析后再格式化可得到与原始字符串一致的结果：
+// 未修改的地址与参数（含大小写、转义方式、重复参数与未识别参数）均按原样输出。
+package nodepassurl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 实例模式
+const (
+	ModeServer = "server"
+	ModeClient = "client"
+)
+
+// 已识别的查询参数，格式化时按此顺序输出新增参数
+const (
+	ParamLog = "log"
+	ParamTLS = "tls"
+	ParamCrt = "crt"
+	ParamKey = "key"
+	ParamMin = "min"
+	ParamMax = "max"
+)
+
+var knownParams = []string{ParamLog, ParamTLS, ParamCrt, ParamKey, ParamMin, ParamMax}
+
+// 日志级别与 TLS 取值
+var (
+	LogLevels = []string{"none", "debug", "info", "warn", "error", "event"}
+	TLSValues = []string{"0", "1", "2"}
+)
+
+// Param 未识别的查询参数
+type Param struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// URL NodePass 实例 URL
+type URL struct {
+	Mode          string // server / client
+	TunnelAddress string // 隧道地址，IPv6 不含方括号
+	TunnelPort    int    // 隧道端口，0 表示未设置
+	TargetAddress string // 目标地址，IPv6 不含方括号
+	TargetPort    int    // 目标端口，0 表示未设置
+
+	Log string // 日志级别，空表示继承主控
+	TLS string // TLS 模式 0/1/2，空表示继承主控（仅 server）
+	Crt string // 证书路径（tls=2）
+	Key string // 私钥路径（tls=2）
+	Min int    // 连接池最小容量，0 表示未设置（仅 client）
+	Max int    // 连接池最大容量，0 表示未设置（仅 client）
+
+	// Extra 未识别的查询参数，保持原始顺序
+	Extra []Param
+
+	// src 解析时的原始内容，用于无损还原；自行构造的 URL 为 nil
+	src *source
+}
+
+// source 解析时的原始内容：未修改的部分按原样输出
+type source struct {
+	addr     string     // ? 之前的地址部分（不含协议）
+	params   []rawParam // 查询参数片段，含重复参数与空片段，按出现顺序
+	hasQuery bool       // 原始字符串是否带 ?
+	parsed   URL        // 解析结果快照，用于判断字段是否被修改
+}
+
+// rawParam 原始查询参数片段
+type rawParam struct {
+	key  string
+	text string // 未解码的原始片段，如 log=INFO
+}
+
+// ErrInvalid 所有解析 / 校验错误均包装该错误
+var ErrInvalid = errors.New("无效的隧道URL")
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Parse 解析实例 URL，仅做语法校验；语义校验见 Validate
+func Parse(raw string) (*URL, error) {
+	raw = strings.TrimSpace(raw)
+	idx := strings.Index(raw, "://")
+	if idx <= 0 {
+		return nil, invalid("缺少协议部分 (server:// 或 client://)")
+	}
+
+	u := &URL{Mode: raw[:idx]}
+	rest := raw[idx+3:]
+	src := &source{}
+
+	var query string
+	if q := strings.Index(rest, "?"); q != -1 {
+		query = rest[q+1:]
+		rest = rest[:q]
+		src.hasQuery = true
+	}
+	src.addr = rest
+
+	hostPart, pathPart := rest, ""
+	if p := strings.Index(rest, "/"); p != -1 {
+		hostPart, pathPart = rest[:p], rest[p+1:]
+	}
+
+	var err error
+	if u.TunnelAddress, u.TunnelPort, err = splitHostPort(hostPart); err != nil {
+		return nil, invalid("隧道地址 %q: %v", hostPart, err)
+	}
+	if u.TargetAddress, u.TargetPort, err = splitHostPort(pathPart); err != nil {
+		return nil, invalid("目标地址 %q: %v", pathPart, err)
+	}
+
+	if query != "" {
+		for _, kv := range strings.Split(query, "&") {
+			key, val := kv, ""
+			if eq := strings.Index(kv, "="); eq != -1 {
+				key, val = kv[:eq], kv[eq+1:]
+			}
+			src.params = append(src.params, rawParam{key: key, text: kv})
+			if key == "" {
+				continue
+			}
+			if v, err := url.QueryUnescape(val); err == nil {
+				val = v
+			}
+			// 重复参数以最后一次出现为准
+			if err := u.set(key, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	src.parsed = *u
+	src.parsed.Extra = append([]Param(nil), u.Extra...)
+	u.src = src
+	return u, nil
+}
+
+// set 写入解析到的查询参数
+func (u *URL) set(key, val string) error {
+	switch key {
+	case ParamLog:
+		u.Log = strings.ToLower(val)
+	case ParamTLS:
+		u.TLS = val
+	case ParamCrt:
+		u.Crt = val
+	case ParamKey:
+		u.Key = val
+	case ParamMin, ParamMax:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return invalid("参数 %s=%q 不是整数", key, val)
+		}
+		if key == ParamMin {
+			u.Min = n
+		} else {
+			u.Max = n
+		}
+	default:
+		u.SetParam(key, val)
+	}
+	return nil
+}
+
+// splitHostPort 解析 host:port / [ipv6]:port / :port / port / host
+func splitHostPort(s string) (string, int, error) {
+	if s == "" {
+		return "", 0, nil
+	}
+
+	// [ipv6]:port 或 [ipv6]
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end == -1 {
+			return "", 0, errors.New("IPv6 地址缺少 ]")
+		}
+		host := s[1:end]
+		rest := s[end+1:]
+		if rest == "" {
+			return host, 0, nil
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return "", 0, errors.New("IPv6 地址后应为 :端口")
+		}
+		port, err := parsePort(rest[1:])
+		return host, port, err
+	}
+
+	colon := strings.LastIndex(s, ":")
+	if colon == -1 {
+		// 只有端口或只有地址
+		if port, err := strconv.Atoi(s); err == nil {
+			if port < 0 || port > 65535 {
+				return "", 0, fmt.Errorf("端口超出范围: %d", port)
+			}
+			return "", port, nil
+		}
+		return s, 0, nil
+	}
+	if strings.Count(s, ":") > 1 {
+		// 未加方括号的 IPv6：仅当最后一段为端口时才拆分
+		if port, err := parsePort(s[colon+1:]); err == nil && net.ParseIP(s[:colon]) != nil {
+			return s[:colon], port, nil
+		}
+		if net.ParseIP(s) != nil {
+			return s, 0, nil
+		}
+		return "", 0, errors.New("IPv6 地址需使用 [地址]:端口 格式")
+	}
+	port, err := parsePort(s[colon+1:])
+	return s[:colon], port, err
+}
+
+// parsePort 解析端口，空字符串视为未设置
+func parsePort(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("端口 %q 不是数字", s)
+	}
+	if port < 0 || port > 65535 {
+		return 0, fmt.Errorf("端口超出范围: %d", port)
+	}
+	return port, nil
+}
+
+// joinHostPort 格式化地址，IPv6 使用方括号
+func joinHostPort(host string, port int) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port > 0 {
+		return host + ":" + strconv.Itoa(port)
+	}
+	return host
+}
+
+// String 格式化为实例 URL。解析得到的 URL 中未修改的地址与参数按原样输出
+// （保留大小写、转义方式、重复参数与未识别参数），修改过的参数在原位置输出新值，
+// 新设置的参数追加在末尾
+func (u *URL) String() string {
+	var b strings.Builder
+	b.WriteString(u.Mode)
+	b.WriteString("://")
+	if u.src != nil && u.sameAddress(&u.src.parsed) {
+		b.WriteString(u.src.addr)
+	} else {
+		b.WriteString(joinHostPort(u.TunnelAddress, u.TunnelPort))
+		b.WriteString("/")
+		b.WriteString(joinHostPort(u.TargetAddress, u.TargetPort))
+	}
+
+	values := u.params()
+	written := make(map[string]bool, len(values))
+	var parts []string
+	if u.src != nil {
+		last := make(map[string]int, len(u.src.params))
+		for i, p := range u.src.params {
+			last[p.key] = i
+		}
+		for i, p := range u.src.params {
+			if p.key == "" || u.unchanged(p.key) {
+				parts = append(parts, p.text)
+				written[p.key] = true
+				continue
+			}
+			// 已修改：在最后一次出现的位置输出新值，丢弃重复项
+			if val, ok := values[p.key]; ok && i == last[p.key] {
+				parts = append(parts, p.key+"="+escape(val))
+			}
+			written[p.key] = true
+		}
+	}
+	emit := func(key string) {
+		if written[key] {
+			return
+		}
+		if val, ok := values[key]; ok {
+			parts = append(parts, key+"="+escape(val))
+			written[key] = true
+		}
+	}
+	for _, key := range knownParams {
+		emit(key)
+	}
+	for _, p := range u.Extra {
+		emit(p.Key)
+	}
+
+	if len(parts) > 0 || (u.src != nil && u.src.hasQuery && len(u.src.params) == 0) {
+		b.WriteString("?")
+		b.WriteString(strings.Join(parts, "&"))
+	}
+	return b.String()
+}
+
+// sameAddress 判断隧道地址与目标地址是否与 o 一致
+func (u *URL) sameAddress(o *URL) bool {
+	return u.TunnelAddress == o.TunnelAddress && u.TunnelPort == o.TunnelPort &&
+		u.TargetAddress == o.TargetAddress && u.TargetPort == o.TargetPort
+}
+
+// unchanged 判断参数相对解析结果是否未被修改
+func (u *URL) unchanged(key string) bool {
+	cur, curOK := u.value(key)
+	old, oldOK := u.src.parsed.value(key)
+	return cur == old && curOK == oldOK
+}
+
+// value 返回参数的当前取值；已识别参数始终视为存在
+func (u *URL) value(key string) (string, bool) {
+	switch key {
+	case ParamLog:
+		return u.Log, true
+	case ParamTLS:
+		return u.TLS, true
+	case ParamCrt:
+		return u.Crt, true
+	case ParamKey:
+		return u.Key, true
+	case ParamMin:
+		return strconv.Itoa(u.Min), true
+	case ParamMax:
+		return strconv.Itoa(u.Max), true
+	}
+	return u.Param(key)
+}
+
+// params 返回当前所有非空参数
+func (u *URL) params() map[string]string {
+	values := make(map[string]string, len(knownParams)+len(u.Extra))
+	if u.Log != "" {
+		values[ParamLog] = u.Log
+	}
+	if u.TLS != "" {
+		values[ParamTLS] = u.TLS
+	}
+	if u.Crt != "" {
+		values[ParamCrt] = u.Crt
+	}
+	if u.Key != "" {
+		values[ParamKey] = u.Key
+	}
+	if u.Min > 0 {
+		values[ParamMin] = strconv.Itoa(u.Min)
+	}
+	if u.Max > 0 {
+		values[ParamMax] = strconv.Itoa(u.Max)
+	}
+	for _, p := range u.Extra {
+		values[p.Key] = p.Value
+	}
+	return values
+}
+
+// escape 仅转义会破坏查询串结构的字符，保持路径等值的可读性
+func escape(s string) string {
+	if !strings.ContainsAny(s, "&=#%? ") {
+		return s
+	}
+	return strings.NewReplacer("%", "%25", "&", "%26", "=", "%3D", "#", "%23", "?", "%3F", " ", "%20").Replace(s)
+}
+
+// Param 返回未识别参数的值
+func (u *URL) Param(key string) (string, bool) {
+	for _, p := range u.Extra {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetParam 设置未识别参数，已存在时覆盖；已识别参数请直接设置对应字段
+func (u *URL) SetParam(key, value string) {
+	for i, p := range u.Extra {
+		if p.Key == key {
+			u.Extra[i].Value = value
+			return
+		}
+	}
+	u.Extra = append(u.Extra, Param{Key: key, Value: value})
+}
+
+// DelParam 删除未识别参数
+func (u *URL) DelParam(key string) {
+	for i, p := range u.Extra {
+		if p.Key == key {
+			u.Extra = append(u.Extra[:i], u.Extra[i+1:]...)
+			return
+		}
+	}
+}
+
+// IsKnownParam 判断是否为已识别（有独立字段）的参数
+func IsKnownParam(key string) bool {
+	for _, k := range knownParams {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 语义校验：模式、端口范围、日志级别、TLS 及证书、连接池容量
+func (u *URL) Validate() error {
+	var errs []string
+	if u.Mode != ModeServer && u.Mode != ModeClient {
+		errs = append(errs, fmt.Sprintf("模式必须为 server 或 client: %q", u.Mode))
+	}
+	if u.TunnelPort <= 0 || u.TunnelPort > 65535 {
+		errs = append(errs, fmt.Sprintf("隧道端口无效: %d", u.TunnelPort))
+	}
+	if u.TargetPort <= 0 || u.TargetPort > 65535 {
+		errs = append(errs, fmt.Sprintf("目标端口无效: %d", u.TargetPort))
+	}
+	if u.Log != "" && !contains(LogLevels, u.Log) {
+		errs = append(errs, fmt.Sprintf("日志级别无效: %q", u.Log))
+	}
+	if u.TLS != "" {
+		if u.Mode != ModeServer {
+			errs = append(errs, "仅 server 模式支持 tls 参数")
+		} else if !contains(TLSValues, u.TLS) {
+			errs = append(errs, fmt.Sprintf("TLS 模式无效: %q", u.TLS))
+		}
+	}
+	if u.TLS == "2" && (u.Crt == "" || u.Key == "") {
+		errs = append(errs, "tls=2 需要同时指定 crt 与 key")
+	}
+	if (u.Crt != "" || u.Key != "") && u.TLS != "2" {
+		errs = append(errs, "crt / key 仅在 tls=2 时有效")
+	}
+	if u.Min < 0 || u.Max < 0 {
+		errs = append(errs, "min / max 不能为负数")
+	}
+	if u.Min > 0 && u.Max > 0 && u.Min > u.Max {
+		errs = append(errs, fmt.Sprintf("min (%d) 不能大于 max (%d)", u.Min, u.Max))
+	}
+	for _, p := range u.Extra {
+		if p.Key == "" || strings.ContainsAny(p.Key, "&=?# ") {
+			errs = append(errs, fmt.Sprintf("参数名无效: %q", p.Key))
+		}
+	}
+	if len(errs) > 0 {
+		return invalid("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package nodepassurl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"server", "server://:10101/127.0.0.1:8080?log=info&tls=1"},
+		{"client", "client://1.2.3.4:10101/127.0.0.1:8080?log=warn&min=8&max=64"},
+		{"ipv6 bracketed", "server://[::]:10101/[2001:db8::1]:8080?log=debug"},
+		{"ipv6 bracketed without port", "client://[2001:db8::2]/[::1]:22"},
+		{"ipv6 unbracketed", "client://2001:db8::2:10101/127.0.0.1:22"},
+		{"uppercase log", "server://:10101/127.0.0.1:8080?log=INFO"},
+		{"zero min", "client://1.2.3.4:10101/:8080?min=0&max=64"},
+		{"empty known params", "server://:1/:2?log=&crt=&key="},
+		{"duplicate known params", "server://:1/:2?log=info&log=debug"},
+		{"duplicate unknown params", "client://a:1/b:2?foo=1&bar=x&foo=2"},
+		{"param order", "server://:1/:2?key=/k.pem&tls=2&crt=/c.pem&log=info"},
+		{"escaping", "server://:1/:2?tls=2&crt=/certs/a%20b.crt&key=%2Fk.pem&note=a+b"},
+		{"flag without value", "server://a:1/b:2?flag&log=info"},
+		{"empty segments", "server://:1/:2?&log=info&&"},
+		{"empty query", "server://:1/:2?"},
+		{"no target", "server://:10101"},
+		{"leading zero port", "client://host:080/x:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.raw, err)
+			}
+			if got := u.String(); got != tt.raw {
+				t.Errorf("String(Parse(%q)) = %q", tt.raw, got)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want URL
+	}{
+		{
+			raw: "server://[::]:10101/[2001:db8::1]:8080?log=INFO&tls=2&crt=/a%20b.crt&key=/k",
+			want: URL{Mode: ModeServer, TunnelAddress: "::", TunnelPort: 10101, TargetAddress: "2001:db8::1", TargetPort: 8080,
+				Log: "info", TLS: "2", Crt: "/a b.crt", Key: "/k"},
+		},
+		{
+			raw:  "client://example.com:10101/127.0.0.1:22?min=0&max=64&foo=1&foo=2",
+			want: URL{Mode: ModeClient, TunnelAddress: "example.com", TunnelPort: 10101, TargetAddress: "127.0.0.1", TargetPort: 22, Max: 64},
+		},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.raw, err)
+		}
+		if u.Mode != tt.want.Mode || u.TunnelAddress != tt.want.TunnelAddress || u.TunnelPort != tt.want.TunnelPort ||
+			u.TargetAddress != tt.want.TargetAddress || u.TargetPort != tt.want.TargetPort ||
+			u.Log != tt.want.Log || u.TLS != tt.want.TLS || u.Crt != tt.want.Crt || u.Key != tt.want.Key ||
+			u.Min != tt.want.Min || u.Max != tt.want.Max {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.raw, *u, tt.want)
+		}
+	}
+
+	u, _ := Parse("client://a:1/b:2?foo=1&foo=2")
+	if v, _ := u.Param("foo"); v != "2" {
+		t.Errorf("duplicate param: got %q, want last value %q", v, "2")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		":10101/127.0.0.1:8080",
+		"server://[::1:10101/127.0.0.1:8080",
+		"server://[::1]10101/127.0.0.1:8080",
+		"server://:70000/127.0.0.1:8080",
+		"server://:abc/127.0.0.1:8080",
+		"client://a:1/b:2?min=x",
+	} {
+		if _, err := Parse(raw); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalid", raw, err)
+		}
+	}
+}
+
+func TestStringAfterChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		change func(u *URL)
+		want   string
+	}{
+		{
+			name:   "change known param keeps others verbatim",
+			raw:    "server://:1/:2?log=INFO&note=a%2Fb&tls=1",
+			change: func(u *URL) { u.TLS = "0" },
+			want:   "server://:1/:2?log=INFO&note=a%2Fb&tls=0",
+		},
+		{
+			name:   "change duplicated param collapses duplicates",
+			raw:    "server://:1/:2?log=info&tls=1&log=warn",
+			change: func(u *URL) { u.SetLogLevel("debug") },
+			want:   "server://:1/:2?tls=1&log=debug",
+		},
+		{
+			name:   "same value keeps raw text",
+			raw:    "server://:1/:2?log=INFO",
+			change: func(u *URL) { u.SetLogLevel("info") },
+			want:   "server://:1/:2?log=INFO",
+		},
+		{
+			name:   "remove params",
+			raw:    "client://a:1/b:2?log=info&foo=1&min=4",
+			change: func(u *URL) { u.SetLogLevel(Inherit); u.DelParam("foo") },
+			want:   "client://a:1/b:2?min=4",
+		},
+		{
+			name:   "new params appended",
+			raw:    "client://a:1/b:2?foo=1",
+			change: func(u *URL) { u.Max = 16; u.SetParam("bar", "x y") },
+			want:   "client://a:1/b:2?foo=1&max=16&bar=x%20y",
+		},
+		{
+			name:   "address change keeps params",
+			raw:    "server://[::]:10101/[::1]:22?log=info&foo=1&foo=2",
+			change: func(u *URL) { u.TunnelPort = 10102 },
+			want:   "server://[::]:10102/[::1]:22?log=info&foo=1&foo=2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.raw, err)
+			}
+			tt.change(u)
+			if got := u.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringBuilt(t *testing.T) {
+	u := &URL{Mode: ModeServer, TunnelAddress: "::1", TunnelPort: 10101, TargetAddress: "127.0.0.1", TargetPort: 8080, Log: "info", TLS: "2", Crt: "/c", Key: "/k"}
+	u.SetParam("x", "1")
+	want := "server://[::1]:10101/127.0.0.1:8080?log=info&tls=2&crt=/c&key=/k&x=1"
+	if got := u.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	back, err := Parse(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(u, back) {
+		t.Errorf("Parse(String()) diff: %+v", Diff(u, back))
+	}
+}
+
+func TestDiffIgnoresFormatting(t *testing.T) {
+	a, _ := Parse("server://:1/:2?log=INFO&foo=a%2Fb&tls=1")
+	b, _ := Parse("server://:1/:2?tls=1&foo=a/b&log=info")
+	if diffs := Diff(a, b); len(diffs) != 0 {
+		t.Errorf("unexpected diff: %+v", diffs)
+	}
+	c, _ := Parse("server://:1/:3?tls=0")
+	if diffs := Diff(a, c); len(diffs) != 4 {
+		t.Errorf("want 4 diffs (targetPort, log, tls, extraParams.foo), got %+v", diffs)
+	}
+}
@@ -0,0 +1,196 @@
+// Package pagination 列表接口的分页、排序与游标。
+//
+// 支持两种翻页方式：page/size 偏移分页，以及基于 (排序值, id) 的游标分页。
+// 游标分页在翻页期间有数据增删时也不会重复或遗漏记录。
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 每页条数
+const (
+	DefaultSize = 20
+	MaxSize     = 200
+)
+
+// Kind 排序字段的值类型，用于解析游标中的排序值
+type Kind int
+
+const (
+	KindInt Kind = iota
+	KindString
+	// KindTime 时间字段，游标中保存 Unix 秒数，Expr 需为对应的整数秒表达式
+	// （见 storage.Dialect.UnixTime），同一秒内按 ID 排序
+	KindTime
+)
+
+// Field 可排序字段
+type Field struct {
+	Expr string // SQL 表达式
+	Kind Kind
+}
+
+// Params 分页与排序参数
+type Params struct {
+	Page   int    // 从 1 开始，Cursor 非空时忽略
+	Size   int    // 0 表示不分页
+	Cursor string // 上一页返回的 nextCursor
+	Sort   string // 排序字段，空表示使用默认排序
+	Desc   bool
+}
+
+// Paged 是否分页
+func (p Params) Paged() bool {
+	return p.Size > 0
+}
+
+// Offset 偏移分页的起始位置
+func (p Params) Offset() int {
+	if p.Cursor != "" || p.Page <= 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Size
+}
+
+// ParseParams 解析 page、size、cursor、sort、order 查询参数。
+// 未指定 page/size/cursor 时不分页
+func ParseParams(q url.Values) (Params, error) {
+	var p Params
+	p.Cursor = q.Get("cursor")
+	p.Sort = q.Get("sort")
+
+	switch strings.ToLower(q.Get("order")) {
+	case "", "asc":
+	case "desc":
+		p.Desc = true
+	default:
+		return p, fmt.Errorf("无效的排序方向: %q", q.Get("order"))
+	}
+
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("无效的页码: %q", v)
+		}
+		p.Page = n
+	}
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("无效的每页条数: %q", v)
+		}
+		p.Size = n
+	}
+	if p.Size == 0 && (p.Page > 0 || p.Cursor != "") {
+		p.Size = DefaultSize
+	}
+	if p.Size > MaxSize {
+		p.Size = MaxSize
+	}
+	if p.Page == 0 && p.Size > 0 {
+		p.Page = 1
+	}
+	return p, nil
+}
+
+// TotalPages 计算总页数
+func TotalPages(total, size int) int {
+	if size <= 0 {
+		return 0
+	}
+	return (total + size - 1) / size
+}
+
+// Cursor 游标，记录上一页最后一行的排序值与 ID
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+// 参数错误
+var (
+	// ErrInvalidCursor 游标格式错误或与当前排序不一致
+	ErrInvalidCursor = errors.New("无效的游标")
+	// ErrInvalidSort 不支持的排序字段
+	ErrInvalidSort = errors.New("不支持的排序字段")
+)
+
+// IsInvalid 是否为分页参数错误
+func IsInvalid(err error) bool {
+	return errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidSort)
+}
+
+// Encode 编码为 URL 安全的字符串
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor 解析游标
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// OrderBy 生成排序子句，以 idExpr 作为第二排序键保证顺序稳定
+func (f Field) OrderBy(idExpr string, desc bool) string {
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s %s", f.Expr, dir, idExpr, dir)
+}
+
+// Keyset 生成游标之后的记录条件
+func (f Field) Keyset(c Cursor, idExpr string) (string, []interface{}, error) {
+	v, err := f.parse(c.Value)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	op := ">"
+	if c.Desc {
+		op = "<"
+	}
+	cond := fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", f.Expr, op, f.Expr, idExpr, op)
+	return cond, []interface{}{v, v, c.ID}, nil
+}
+
+// Format 将排序值格式化为游标中保存的字符串
+func (f Field) Format(v interface{}) string {
+	switch x := v.(type) {
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case int:
+		return strconv.Itoa(x)
+	case time.Time:
+		return strconv.FormatInt(x.Unix(), 10)
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
+
+func (f Field) parse(s string) (interface{}, error) {
+	switch f.Kind {
+	case KindInt, KindTime:
+		return strconv.ParseInt(s, 10, 64)
+	}
+	return s, nil
+}
@@ -0,0 +1,244 @@
+package pagination
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"NodePassDash/internal/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Params
+	}{
+		{"", Params{}},
+		{"page=2", Params{Page: 2, Size: DefaultSize}},
+		{"size=10", Params{Page: 1, Size: 10}},
+		{"page=3&size=5", Params{Page: 3, Size: 5}},
+		{"size=1000", Params{Page: 1, Size: MaxSize}},
+		{"cursor=abc", Params{Page: 1, Size: DefaultSize, Cursor: "abc"}},
+		{"sort=name&order=DESC", Params{Sort: "name", Desc: true}},
+		{"sort=name&order=asc", Params{Sort: "name"}},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := ParseParams(q)
+		if err != nil {
+			t.Errorf("ParseParams(%q): %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseParams(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseParamsErrors(t *testing.T) {
+	for _, query := range []string{"page=0", "page=x", "size=0", "size=-1", "order=up"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := ParseParams(q); err == nil {
+			t.Errorf("ParseParams(%q) succeeded, want error", query)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		p    Params
+		want int
+	}{
+		{Params{Page: 1, Size: 20}, 0},
+		{Params{Page: 3, Size: 20}, 40},
+		{Params{Page: 3, Size: 20, Cursor: "abc"}, 0},
+		{Params{}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Offset(); got != tt.want {
+			t.Errorf("%+v.Offset() = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestTotalPages(t *testing.T) {
+	tests := []struct {
+		total, size, want int
+	}{
+		{0, 20, 0},
+		{1, 20, 1},
+		{20, 20, 1},
+		{21, 20, 2},
+		{5, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := TotalPages(tt.total, tt.size); got != tt.want {
+			t.Errorf("TotalPages(%d, %d) = %d, want %d", tt.total, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCursorEncodeDecode(t *testing.T) {
+	c := Cursor{Sort: "createdAt", Desc: true, Value: "1760000000", ID: 42}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != c {
+		t.Errorf("DecodeCursor(Encode(%+v)) = %+v", c, got)
+	}
+	for _, s := range []string{"!!!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 600, time.FixedZone("", 8*3600))
+	tests := []struct {
+		field Field
+		v     interface{}
+		want  string
+	}{
+		{Field{Kind: KindInt}, int64(7), "7"},
+		{Field{Kind: KindInt}, 7, "7"},
+		{Field{Kind: KindString}, "abc", "abc"},
+		{Field{Kind: KindTime}, ts, "1735758245"},
+	}
+	for _, tt := range tests {
+		if got := tt.field.Format(tt.v); got != tt.want {
+			t.Errorf("Format(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	tests := []struct {
+		field    Field
+		cursor   Cursor
+		wantCond string
+		wantArgs []interface{}
+	}{
+		{
+			field:    Field{Expr: "t.name", Kind: KindString},
+			cursor:   Cursor{Value: "web", ID: 3},
+			wantCond: "(t.name > ? OR (t.name = ? AND t.id > ?))",
+			wantArgs: []interface{}{"web", "web", int64(3)},
+		},
+		{
+			field:    Field{Expr: "t.port", Kind: KindInt},
+			cursor:   Cursor{Desc: true, Value: "8080", ID: 9},
+			wantCond: "(t.port < ? OR (t.port = ? AND t.id < ?))",
+			wantArgs: []interface{}{int64(8080), int64(8080), int64(9)},
+		},
+		{
+			field:    Field{Expr: "ts", Kind: KindTime},
+			cursor:   Cursor{Desc: true, Value: "1735758245", ID: 1},
+			wantCond: "(ts < ? OR (ts = ? AND t.id < ?))",
+			wantArgs: []interface{}{int64(1735758245), int64(1735758245), int64(1)},
+		},
+	}
+	for _, tt := range tests {
+		cond, args, err := tt.field.Keyset(tt.cursor, "t.id")
+		if err != nil {
+			t.Errorf("Keyset(%+v): %v", tt.cursor, err)
+			continue
+		}
+		if cond != tt.wantCond {
+			t.Errorf("Keyset cond = %q, want %q", cond, tt.wantCond)
+		}
+		if len(args) != len(tt.wantArgs) {
+			t.Errorf("Keyset args = %v, want %v", args, tt.wantArgs)
+			continue
+		}
+		for i := range args {
+			if args[i] != tt.wantArgs[i] {
+				t.Errorf("Keyset args = %v, want %v", args, tt.wantArgs)
+				break
+			}
+		}
+	}
+
+	// 旧版本游标（RFC3339 时间）视为无效
+	field := Field{Expr: "ts", Kind: KindTime}
+	if _, _, err := field.Keyset(Cursor{Value: "2025-01-02T03:04:05Z"}, "id"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Keyset with RFC3339 value error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+// TestKeysetSQLite 时间以不同文本格式保存、且多行时间相同时，逐页翻完不重复不遗漏
+func TestKeysetSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE item (id INTEGER PRIMARY KEY, createdAt DATETIME)`); err != nil {
+		t.Fatal(err)
+	}
+	// 前 4 行与导入数据一样共享同一个 CURRENT_TIMESTAMP 格式的时间，
+	// 其余为驱动写入的带时区格式
+	for i := 0; i < 4; i++ {
+		if _, err := db.Exec(`INSERT INTO item (createdAt) VALUES ('2025-01-02 03:04:05')`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, d := range []time.Duration{-time.Hour, 500 * time.Millisecond, time.Second, time.Hour} {
+		if _, err := db.Exec(`INSERT INTO item (createdAt) VALUES (?)`, base.Add(d).In(time.FixedZone("", 8*3600))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	field := Field{Expr: storage.SQLite.UnixTime("createdAt"), Kind: KindTime}
+	for _, desc := range []bool{true, false} {
+		seen := make(map[int64]bool)
+		var cursor *Cursor
+		for page := 0; page < 10; page++ {
+			query := `SELECT id, createdAt FROM item`
+			var args []interface{}
+			if cursor != nil {
+				cond, condArgs, err := field.Keyset(*cursor, "id")
+				if err != nil {
+					t.Fatal(err)
+				}
+				query += " WHERE " + cond
+				args = condArgs
+			}
+			query += " ORDER BY " + field.OrderBy("id", desc) + " LIMIT 3"
+
+			rows, err := db.Query(query, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			var lastID int64
+			var lastAt time.Time
+			for rows.Next() {
+				if err := rows.Scan(&lastID, &lastAt); err != nil {
+					t.Fatal(err)
+				}
+				if seen[lastID] {
+					t.Errorf("desc=%v: row %d returned twice", desc, lastID)
+				}
+				seen[lastID] = true
+				n++
+			}
+			rows.Close()
+			if n == 0 {
+				break
+			}
+			cursor = &Cursor{Desc: desc, Value: field.Format(lastAt), ID: lastID}
+		}
+		if len(seen) != 8 {
+			t.Errorf("desc=%v: got %d rows, want 8", desc, len(seen))
+		}
+	}
+}
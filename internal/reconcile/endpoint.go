@@ -0,0 +1,446 @@
+package reconcile
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/tunnel"
+)
+
+// 偏差类型
+const (
+	KindStatus  = "status"  // 运行状态不一致
+	KindConfig  = "config"  // 实例 URL 不一致
+	KindUnknown = "unknown" // 主控上存在、本地未记录
+	KindMissing = "missing" // 本地记录、主控上不存在
+)
+
+// 处理结果
+const (
+	ActionDetected  = "detected"  // 仅检测（dry-run）
+	ActionFixed     = "fixed"     // 已按主控状态修正本地记录
+	ActionReported  = "reported"  // 仅报告
+	ActionAdopted   = "adopted"   // 已写入 Tunnel 表
+	ActionMarked    = "marked"    // 已标记为 missing
+	ActionRecreated = "recreated" // 已在主控上重建
+	ActionDeleted   = "deleted"   // 已移入回收站
+	ActionFailed    = "failed"    // 处理失败
+)
+
+// statusMissing 对应 tunnel.StatusMissing
+const statusMissing = "missing"
+
+// Drift 单条偏差
+type Drift struct {
+	Kind       string                  `json:"kind"`
+	TunnelID   int64                   `json:"tunnelId,omitempty"`
+	TunnelName string                  `json:"tunnelName,omitempty"`
+	InstanceID string                  `json:"instanceId,omitempty"`
+	From       string                  `json:"from,omitempty"`
+	To         string                  `json:"to,omitempty"`
+	Diff       []nodepassurl.FieldDiff `json:"diff,omitempty"`
+	Action     string                  `json:"action"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// Report 单个端点的对账报告
+type Report struct {
+	EndpointID   int64          `json:"endpointId"`
+	EndpointName string         `json:"endpointName"`
+	Time         time.Time      `json:"time"`
+	Duration     string         `json:"duration"`
+	DryRun       bool           `json:"dryRun,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Items        []Drift        `json:"items"`
+	Summary      map[string]int `json:"summary"`
+}
+
+func (rep *Report) add(d Drift) {
+	rep.Items = append(rep.Items, d)
+	rep.Summary[d.Kind]++
+}
+
+type tunnelRow struct {
+	id          int64
+	instanceID  string
+	name        string
+	commandLine string
+	status      string
+	tcpRx       int64
+	tcpTx       int64
+	udpRx       int64
+	udpTx       int64
+}
+
+// ReconcileEndpoint 立即对指定端点执行一次对账并返回报告。
+// 非 dry-run 的报告会作为该端点的最新报告保存
+func (r *Reconciler) ReconcileEndpoint(endpointID int64, opts Options) (*Report, error) {
+	if opts.Unknown == "" {
+		opts.Unknown = r.cfg.Unknown
+	}
+	if opts.Missing == "" {
+		opts.Missing = r.cfg.Missing
+	}
+	if !ValidUnknown(opts.Unknown) {
+		return nil, fmt.Errorf("不支持的未知实例策略: %s", opts.Unknown)
+	}
+	if !ValidMissing(opts.Missing) {
+		return nil, fmt.Errorf("不支持的缺失实例策略: %s", opts.Missing)
+	}
+
+	var name, url, apiPath, apiKey string
+	err := r.db.QueryRow(`SELECT name, url, apiPath, apiKey FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&name, &url, &apiPath, &apiKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("端点不存在")
+		}
+		return nil, err
+	}
+
+	// 同一端点同一时间只运行一次对账
+	r.mu.Lock()
+	if r.running[endpointID] {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("端点 %s 正在对账", name)
+	}
+	r.running[endpointID] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, endpointID)
+		r.mu.Unlock()
+	}()
+
+	start := time.Now()
+	rep := &Report{
+		EndpointID:   endpointID,
+		EndpointName: name,
+		Time:         start,
+		DryRun:       opts.DryRun,
+		Items:        []Drift{},
+		Summary:      make(map[string]int),
+	}
+
+	client := nodepass.NewClient(url, apiPath, apiKey, nil)
+	err = r.reconcile(endpointID, client, opts, rep)
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	rep.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	if !opts.DryRun {
+		r.mu.Lock()
+		r.reports[endpointID] = rep
+		r.lastRun[endpointID] = start
+		r.mu.Unlock()
+
+		if changed(rep) {
+			log.Infof("[Reconcile]端点 %s 对账完成: %v", name, rep.Summary)
+			if r.notify != nil {
+				r.notify(endpointID)
+			}
+		}
+	}
+	return rep, err
+}
+
+// changed 报告中是否有修改本地记录的处理
+func changed(rep *Report) bool {
+	for _, d := range rep.Items {
+		switch d.Action {
+		case ActionFixed, ActionAdopted, ActionMarked, ActionRecreated, ActionDeleted:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reconciler) reconcile(endpointID int64, client *nodepass.Client, opts Options, rep *Report) error {
+	instances, err := client.GetInstances()
+	if err != nil {
+		return fmt.Errorf("获取实例列表失败: %v", err)
+	}
+	rows, err := r.loadTunnels(endpointID)
+	if err != nil {
+		return err
+	}
+
+	byInstance := make(map[string]*tunnelRow, len(rows))
+	for i := range rows {
+		if rows[i].instanceID != "" {
+			byInstance[rows[i].instanceID] = &rows[i]
+		}
+	}
+
+	seen := make(map[string]bool, len(instances))
+	for _, inst := range instances {
+		if inst.Type == "" {
+			continue
+		}
+		seen[inst.ID] = true
+
+		parsed, err := nodepassurl.Parse(inst.URL)
+		if err != nil {
+			log.Warnf("[Reconcile]端点 %d 实例 %s URL 解析失败: %v", endpointID, inst.ID, err)
+			parsed = &nodepassurl.URL{Mode: inst.Type}
+		}
+
+		row := byInstance[inst.ID]
+		if row == nil {
+			r.handleUnknown(endpointID, inst, parsed, opts, rep)
+			continue
+		}
+		r.handleKnown(row, inst, parsed, opts, rep)
+	}
+
+	for i := range rows {
+		if seen[rows[i].instanceID] {
+			continue
+		}
+		r.handleMissing(endpointID, client, &rows[i], opts, rep)
+	}
+
+	if !opts.DryRun && changed(rep) {
+		_, _ = r.db.Exec(`UPDATE "Endpoint" SET tunnelCount = (SELECT COUNT(*) FROM "Tunnel" WHERE endpointId = ?) WHERE id = ?`, endpointID, endpointID)
+	}
+	return nil
+}
+
+// handleKnown 以主控为准修正状态与配置。运行中隧道的流量统计总在变化，不视为偏差，
+// 仅静默刷新；修正配置时同时记录 external 配置版本
+func (r *Reconciler) handleKnown(row *tunnelRow, inst nodepass.Instance, parsed *nodepassurl.URL, opts Options, rep *Report) {
+	var items []Drift
+	base := Drift{TunnelID: row.id, TunnelName: row.name, InstanceID: inst.ID}
+
+	if row.status != inst.Status {
+		d := base
+		d.Kind, d.From, d.To = KindStatus, row.status, inst.Status
+		items = append(items, d)
+	}
+	configDrift := false
+	if row.commandLine != inst.URL {
+		have, err := nodepassurl.Parse(row.commandLine)
+		if err != nil {
+			have = nil
+		}
+		d := base
+		d.Kind = KindConfig
+		d.Diff = nodepassurl.Diff(have, parsed)
+		if len(d.Diff) > 0 {
+			items = append(items, d)
+			configDrift = true
+		}
+	}
+	trafficChanged := row.tcpRx != inst.TCPRx || row.tcpTx != inst.TCPTx || row.udpRx != inst.UDPRx || row.udpTx != inst.UDPTx
+	if opts.DryRun {
+		for _, d := range items {
+			d.Action = ActionDetected
+			rep.add(d)
+		}
+		return
+	}
+	if len(items) == 0 {
+		if trafficChanged {
+			if _, err := r.db.Exec(`UPDATE "Tunnel" SET tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ? WHERE id = ?`,
+				inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, row.id); err != nil {
+				log.Warnf("[Reconcile]刷新隧道 %s 流量统计失败: %v", row.name, err)
+			}
+		}
+		return
+	}
+
+	action, errMsg := ActionFixed, ""
+	if err := r.fixKnown(row, inst, parsed, configDrift); err != nil {
+		action, errMsg = ActionFailed, err.Error()
+	}
+	for _, d := range items {
+		d.Action, d.Error = action, errMsg
+		rep.add(d)
+	}
+}
+
+// fixKnown 按主控状态覆盖隧道记录；configDrift 为 true 时在同一事务中记录 external 配置版本
+func (r *Reconciler) fixKnown(row *tunnelRow, inst nodepass.Instance, parsed *nodepassurl.URL, configDrift bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE "Tunnel" SET
+		mode = ?, tunnelAddress = ?, tunnelPort = ?, targetAddress = ?, targetPort = ?,
+		tlsMode = ?, certPath = ?, keyPath = ?, logLevel = ?, commandLine = ?, status = ?,
+		min = ?, max = ?, extraParams = ?, tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ?, updatedAt = ?
+		WHERE id = ?`,
+		inst.Type, parsed.TunnelAddress, parsed.TunnelPort, parsed.TargetAddress, parsed.TargetPort,
+		parsed.TLSMode(), parsed.Crt, parsed.Key, parsed.LogLevel(), inst.URL, inst.Status,
+		parsed.Min, parsed.Max, nodepassurl.EncodeExtra(parsed.ExtraMap()),
+		inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, time.Now(), row.id)
+	if err != nil {
+		return err
+	}
+	if configDrift {
+		if _, err := tunnel.RecordVersion(tx, row.id, row.name, inst.URL, tunnel.VersionExternal, "reconcile", "对账同步主控配置"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// handleUnknown 按策略处理本地未记录的实例
+func (r *Reconciler) handleUnknown(endpointID int64, inst nodepass.Instance, parsed *nodepassurl.URL, opts Options, rep *Report) {
+	d := Drift{Kind: KindUnknown, InstanceID: inst.ID, To: inst.URL, Action: ActionDetected}
+	switch {
+	case opts.DryRun:
+	case opts.Unknown == UnknownReport:
+		d.Action = ActionReported
+	default:
+		name, err := r.adoptName(inst, parsed)
+		if err == nil {
+			d.TunnelName = name
+			now := time.Now()
+			var res sql.Result
+			res, err = r.db.Exec(`INSERT INTO "Tunnel" (
+				instanceId, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort,
+				tlsMode, certPath, keyPath, logLevel, commandLine, status, min, max, extraParams,
+				tcpRx, tcpTx, udpRx, udpTx, createdAt, updatedAt)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				inst.ID, name, endpointID, inst.Type,
+				parsed.TunnelAddress, parsed.TunnelPort, parsed.TargetAddress, parsed.TargetPort,
+				parsed.TLSMode(), parsed.Crt, parsed.Key, parsed.LogLevel(), inst.URL, inst.Status,
+				parsed.Min, parsed.Max, nodepassurl.EncodeExtra(parsed.ExtraMap()),
+				inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, now, now)
+			if err == nil {
+				d.TunnelID, _ = res.LastInsertId()
+			}
+		}
+		if err != nil {
+			d.Action, d.Error = ActionFailed, err.Error()
+		} else {
+			d.Action = ActionAdopted
+		}
+	}
+	rep.add(d)
+}
+
+// adoptName 为接管的实例生成名称：<模式>-<端口>，重名时追加实例 ID
+func (r *Reconciler) adoptName(inst nodepass.Instance, parsed *nodepassurl.URL) (string, error) {
+	candidates := []string{}
+	if parsed.TunnelPort > 0 {
+		base := fmt.Sprintf("%s-%d", inst.Type, parsed.TunnelPort)
+		candidates = append(candidates, base, base+"-"+inst.ID)
+	}
+	candidates = append(candidates, fmt.Sprintf("%s-%s", inst.Type, inst.ID))
+	for _, name := range candidates {
+		var count int
+		if err := r.db.QueryRow(`SELECT COUNT(*) FROM "Tunnel" WHERE name = ?`, name).Scan(&count); err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("无法为实例 %s 生成唯一名称", inst.ID)
+}
+
+// handleMissing 按策略处理主控上已不存在的隧道
+func (r *Reconciler) handleMissing(endpointID int64, client *nodepass.Client, row *tunnelRow, opts Options, rep *Report) {
+	d := Drift{
+		Kind:       KindMissing,
+		TunnelID:   row.id,
+		TunnelName: row.name,
+		InstanceID: row.instanceID,
+		From:       row.commandLine,
+		Action:     ActionDetected,
+	}
+	if opts.DryRun {
+		rep.add(d)
+		return
+	}
+
+	var err error
+	switch opts.Missing {
+	case MissingMark:
+		// 已标记过的只报告，避免每轮对账都视为有修改
+		d.Action = ActionReported
+		if row.status != statusMissing {
+			d.Action = ActionMarked
+			_, err = r.db.Exec(`UPDATE "Tunnel" SET status = ?, updatedAt = ? WHERE id = ?`, statusMissing, time.Now(), row.id)
+		}
+	case MissingRecreate:
+		d.Action = ActionRecreated
+		err = r.recreate(client, row, &d)
+	case MissingDelete:
+		d.Action = ActionDeleted
+		err = r.recycle(row)
+	}
+	if err != nil {
+		d.Action, d.Error = ActionFailed, err.Error()
+		log.Warnf("[Reconcile]端点 %d 隧道 %s 处理失败: %v", endpointID, row.name, err)
+	}
+	rep.add(d)
+}
+
+// recreate 按本地命令行在主控上重建实例，并将本地记录指向新实例
+func (r *Reconciler) recreate(client *nodepass.Client, row *tunnelRow, d *Drift) error {
+	instanceID, status, err := client.CreateInstance(row.commandLine)
+	if err != nil {
+		return err
+	}
+	d.To = instanceID
+	// SSE 可能已按新实例插入了一条记录，去重后保留原记录
+	if _, err := r.db.Exec(`DELETE FROM "Tunnel" WHERE instanceId = ? AND id <> ?`, instanceID, row.id); err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`UPDATE "Tunnel" SET instanceId = ?, status = ?, updatedAt = ? WHERE id = ?`, instanceID, status, time.Now(), row.id)
+	return err
+}
+
+// recycle 将隧道复制到回收站后删除
+func (r *Reconciler) recycle(row *tunnelRow) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO "TunnelRecycle" (
+		name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode,
+		certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max, extraParams, labels,
+		deletedAt, deletedBy
+	) SELECT name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode,
+		certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max, extraParams, labels,
+		?, ?
+	FROM "Tunnel" WHERE id = ?`, time.Now(), "reconcile", row.id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM "Tunnel" WHERE id = ?`, row.id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Reconciler) loadTunnels(endpointID int64) ([]tunnelRow, error) {
+	rows, err := r.db.Query(`SELECT id, instanceId, name, commandLine, status, tcpRx, tcpTx, udpRx, udpTx
+		FROM "Tunnel" WHERE endpointId = ? ORDER BY id`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []tunnelRow
+	for rows.Next() {
+		var t tunnelRow
+		var instanceID sql.NullString
+		if err := rows.Scan(&t.id, &instanceID, &t.name, &t.commandLine, &t.status,
+			&t.tcpRx, &t.tcpTx, &t.udpRx, &t.udpTx); err != nil {
+			return nil, err
+		}
+		t.instanceID = instanceID.String
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
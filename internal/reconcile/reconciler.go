@@ -0,0 +1,254 @@
+// Package reconcile 周期性比较各主控上的实例与 Tunnel 表，修正状态、流量与配置偏差。
+//
+// 主控上存在而本地未记录的实例（unknown）按策略仅报告或自动接管；
+// 本地记录而主控上已不存在的隧道（missing）按策略标记、重建或移入回收站。
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+)
+
+// 未知实例处理策略
+const (
+	UnknownReport = "report" // 仅报告
+	UnknownAdopt  = "adopt"  // 写入 Tunnel 表
+)
+
+// 缺失实例处理策略
+const (
+	MissingMark     = "mark"     // 将隧道状态标记为 missing
+	MissingRecreate = "recreate" // 按本地命令行在主控上重建
+	MissingDelete   = "delete"   // 移入回收站
+)
+
+// tick 后台循环检查各端点是否到期的间隔
+const tick = 30 * time.Second
+
+// Config 对账配置
+type Config struct {
+	// Interval 默认对账间隔，端点未单独设置时使用，为 0 表示默认关闭
+	Interval time.Duration
+	// Unknown 未知实例处理策略
+	Unknown string
+	// Missing 缺失实例处理策略
+	Missing string
+}
+
+// DefaultConfig 默认每 5 分钟对账一次，未知实例仅报告，缺失实例标记为 missing
+func DefaultConfig() Config {
+	return Config{
+		Interval: 5 * time.Minute,
+		Unknown:  UnknownReport,
+		Missing:  MissingMark,
+	}
+}
+
+// ValidUnknown 判断是否为支持的未知实例策略
+func ValidUnknown(p string) bool {
+	return p == UnknownReport || p == UnknownAdopt
+}
+
+// ValidMissing 判断是否为支持的缺失实例策略
+func ValidMissing(p string) bool {
+	return p == MissingMark || p == MissingRecreate || p == MissingDelete
+}
+
+// Options 单次对账选项，为空的策略使用配置值
+type Options struct {
+	Unknown string `json:"unknown,omitempty"`
+	Missing string `json:"missing,omitempty"`
+	// DryRun 仅检测差异，不做任何修改
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Reconciler 后台对账任务
+type Reconciler struct {
+	db     *sql.DB
+	cfg    Config
+	notify func(endpointID int64)
+
+	mu      sync.Mutex
+	reports map[int64]*Report
+	lastRun map[int64]time.Time
+	running map[int64]bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReconciler 创建对账任务；notify 在端点隧道发生变化后调用，可为 nil
+func NewReconciler(db *sql.DB, cfg Config, notify func(endpointID int64)) *Reconciler {
+	def := DefaultConfig()
+	if !ValidUnknown(cfg.Unknown) {
+		cfg.Unknown = def.Unknown
+	}
+	if !ValidMissing(cfg.Missing) {
+		cfg.Missing = def.Missing
+	}
+	return &Reconciler{
+		db:      db,
+		cfg:     cfg,
+		notify:  notify,
+		reports: make(map[int64]*Report),
+		lastRun: make(map[int64]time.Time),
+		running: make(map[int64]bool),
+	}
+}
+
+// Config 返回对账配置
+func (r *Reconciler) Config() Config {
+	return r.cfg
+}
+
+// Start 启动后台对账循环
+func (r *Reconciler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		// 启动后稍作延迟，等待 SSE 完成初始同步
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			r.runDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Infof("[Reconcile]对账任务已启动，默认间隔 %v，未知实例策略 %s，缺失实例策略 %s", r.cfg.Interval, r.cfg.Unknown, r.cfg.Missing)
+}
+
+// Stop 停止后台对账循环
+func (r *Reconciler) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// runDue 对到期的在线端点执行对账
+func (r *Reconciler) runDue(ctx context.Context) {
+	rows, err := r.db.Query(`SELECT id, status, reconcileInterval FROM "Endpoint" ORDER BY id`)
+	if err != nil {
+		log.Warnf("[Reconcile]查询端点失败: %v", err)
+		return
+	}
+	type due struct {
+		id       int64
+		status   string
+		interval time.Duration
+	}
+	var list []due
+	for rows.Next() {
+		var d due
+		var seconds sql.NullInt64
+		if err := rows.Scan(&d.id, &d.status, &seconds); err != nil {
+			continue
+		}
+		d.interval = r.cfg.Interval
+		if seconds.Valid {
+			d.interval = time.Duration(seconds.Int64) * time.Second
+		}
+		list = append(list, d)
+	}
+	rows.Close()
+
+	for _, d := range list {
+		if ctx.Err() != nil {
+			return
+		}
+		if d.interval <= 0 || d.status != "ONLINE" {
+			continue
+		}
+		r.mu.Lock()
+		last := r.lastRun[d.id]
+		r.mu.Unlock()
+		if time.Since(last) < d.interval {
+			continue
+		}
+		if _, err := r.ReconcileEndpoint(d.id, Options{}); err != nil {
+			log.Warnf("[Reconcile]端点 %d 对账失败: %v", d.id, err)
+		}
+	}
+}
+
+// Report 返回端点最近一次对账报告
+func (r *Reconciler) Report(endpointID int64) (*Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep, ok := r.reports[endpointID]
+	return rep, ok
+}
+
+// Reports 返回所有端点最近一次对账报告，按端点 ID 排序
+func (r *Reconciler) Reports() []*Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]*Report, 0, len(r.reports))
+	for _, rep := range r.reports {
+		list = append(list, rep)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].EndpointID < list[j].EndpointID })
+	return list
+}
+
+// Interval 返回端点单独设置的对账间隔，未设置时 ok 为 false
+func (r *Reconciler) Interval(endpointID int64) (time.Duration, bool, error) {
+	var seconds sql.NullInt64
+	if err := r.db.QueryRow(`SELECT reconcileInterval FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&seconds); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, fmt.Errorf("端点不存在")
+		}
+		return 0, false, err
+	}
+	if !seconds.Valid {
+		return 0, false, nil
+	}
+	return time.Duration(seconds.Int64) * time.Second, true, nil
+}
+
+// SetInterval 设置端点的对账间隔；interval 为 nil 表示使用默认间隔，为 0 表示关闭
+func (r *Reconciler) SetInterval(endpointID int64, interval *time.Duration) error {
+	var value interface{}
+	if interval != nil {
+		if *interval < 0 {
+			return fmt.Errorf("对账间隔不能为负数")
+		}
+		value = int64(interval.Seconds())
+	}
+	res, err := r.db.Exec(`UPDATE "Endpoint" SET reconcileInterval = ? WHERE id = ?`, value, endpointID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("端点不存在")
+	}
+	return nil
+}
+
+// LastRun 返回端点最近一次对账时间
+func (r *Reconciler) LastRun(endpointID int64) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastRun[endpointID]
+}
@@ -0,0 +1,340 @@
+// Package retention 负责 EndpointSSE 事件表与隧道回收站的数据保留与空间回收。
+//
+// 后台清理任务按事件类型的保留时长分批删除过期数据，避免长时间持有写锁，
+// 清理超过保留时长的回收站记录及其日志，并周期性执行 incremental_vacuum / VACUUM 回收磁盘空间。
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/storage"
+)
+
+// Config 保留策略配置
+type Config struct {
+	// Policies 事件类型 -> 保留时长，未配置或为 0 表示永久保留
+	Policies map[string]time.Duration
+	// Interval 清理任务执行间隔
+	Interval time.Duration
+	// ChunkSize 单次删除的最大行数
+	ChunkSize int
+	// ChunkPause 两次分批删除之间的停顿，给 SSE 写入让出数据库锁
+	ChunkPause time.Duration
+	// VacuumInterval 完整 VACUUM 的执行间隔，为 0 表示仅执行 incremental_vacuum
+	VacuumInterval time.Duration
+	// Recycle 回收站记录（含其 EndpointSSE 日志）及已删除隧道配置历史的保留时长，为 0 表示永久保留
+	Recycle time.Duration
+}
+
+// DefaultConfig 默认保留策略：日志 7 天，流量更新 24 小时，其余事件与回收站 30 天
+func DefaultConfig() Config {
+	return Config{
+		Policies: map[string]time.Duration{
+			"log":      7 * 24 * time.Hour,
+			"update":   24 * time.Hour,
+			"initial":  30 * 24 * time.Hour,
+			"create":   30 * 24 * time.Hour,
+			"delete":   30 * 24 * time.Hour,
+			"shutdown": 30 * 24 * time.Hour,
+		},
+		Interval:       10 * time.Minute,
+		ChunkSize:      5000,
+		ChunkPause:     50 * time.Millisecond,
+		VacuumInterval: 7 * 24 * time.Hour,
+		Recycle:        30 * 24 * time.Hour,
+	}
+}
+
+// RunResult 单次清理结果
+type RunResult struct {
+	StartedAt time.Time        `json:"startedAt"`
+	Duration  string           `json:"duration"`
+	Deleted   map[string]int64 `json:"deleted"`  // 事件类型 -> 删除行数
+	Recycle   int64            `json:"recycle"`  // 清理的回收站记录数
+	Versions  int64            `json:"versions"` // 清理的已删除隧道配置版本数
+	Vacuum    string           `json:"vacuum,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// PolicyInfo 保留策略展示信息
+type PolicyInfo struct {
+	EventType string `json:"eventType"`
+	Retention string `json:"retention"` // 为空表示永久保留
+}
+
+// Janitor 后台清理任务
+type Janitor struct {
+	db      *sql.DB
+	dialect storage.Dialect
+	cfg     Config
+
+	mu         sync.Mutex
+	running    bool
+	lastRun    *RunResult
+	lastVacuum time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewJanitor 创建清理任务
+func NewJanitor(db *sql.DB, cfg Config) *Janitor {
+	def := DefaultConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = def.Interval
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = def.ChunkSize
+	}
+	if cfg.Policies == nil {
+		cfg.Policies = def.Policies
+	}
+	return &Janitor{db: db, dialect: storage.DialectOf(db), cfg: cfg}
+}
+
+// Start 启动后台清理循环
+func (j *Janitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.done = make(chan struct{})
+
+	go func() {
+		defer close(j.done)
+
+		// 启动后稍作延迟，避开服务初始化阶段的大量写入
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+
+		ticker := time.NewTicker(j.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			j.RunOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Infof("[Retention]清理任务已启动，间隔 %v", j.cfg.Interval)
+}
+
+// Stop 停止后台清理循环
+func (j *Janitor) Stop() {
+	if j.cancel == nil {
+		return
+	}
+	j.cancel()
+	<-j.done
+}
+
+// RunOnce 立即执行一次清理，若已有清理在执行则直接返回上次结果
+func (j *Janitor) RunOnce(ctx context.Context) *RunResult {
+	j.mu.Lock()
+	if j.running {
+		last := j.lastRun
+		j.mu.Unlock()
+		return last
+	}
+	j.running = true
+	j.mu.Unlock()
+
+	res := &RunResult{StartedAt: time.Now(), Deleted: make(map[string]int64)}
+	var total int64
+	for _, eventType := range j.eventTypes() {
+		maxAge := j.cfg.Policies[eventType]
+		if maxAge <= 0 {
+			continue
+		}
+		n, err := j.purge(ctx, eventType, time.Now().Add(-maxAge))
+		res.Deleted[eventType] = n
+		total += n
+		if err != nil {
+			res.Error = err.Error()
+			log.Warnf("[Retention]清理 %s 事件失败: %v", eventType, err)
+			break
+		}
+	}
+
+	if j.cfg.Recycle > 0 && res.Error == "" {
+		n, err := PurgeRecycle(ctx, j.db, RecycleFilter{Before: time.Now().Add(-j.cfg.Recycle)})
+		res.Recycle = n
+		total += n
+		if err != nil {
+			res.Error = err.Error()
+			log.Warnf("[Retention]清理回收站失败: %v", err)
+		} else if n > 0 {
+			log.Infof("[Retention]已清理过期回收站记录 %d 条", n)
+		}
+	}
+	if j.cfg.Recycle > 0 && res.Error == "" {
+		n, err := PurgeOrphanVersions(ctx, j.db, time.Now().Add(-j.cfg.Recycle))
+		res.Versions = n
+		if err != nil {
+			res.Error = err.Error()
+			log.Warnf("[Retention]清理配置历史失败: %v", err)
+		} else if n > 0 {
+			log.Infof("[Retention]已清理已删除隧道的配置版本 %d 条", n)
+		}
+	}
+
+	if ctx.Err() == nil {
+		res.Vacuum = j.vacuum(total)
+	}
+	res.Duration = time.Since(res.StartedAt).Round(time.Millisecond).String()
+	if total > 0 {
+		log.Infof("[Retention]已清理 EndpointSSE 过期数据 %d 行，耗时 %s", total, res.Duration)
+	}
+
+	j.mu.Lock()
+	j.running = false
+	j.lastRun = res
+	j.mu.Unlock()
+	return res
+}
+
+// purge 分批删除指定事件类型中早于 cutoff 的数据
+func (j *Janitor) purge(ctx context.Context, eventType string, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		if ctx.Err() != nil {
+			return total, nil
+		}
+		var query string
+		if j.dialect == storage.MySQL {
+			// MySQL 不支持 IN 子查询中使用 LIMIT，但支持 DELETE ... LIMIT
+			query = `DELETE FROM "EndpointSSE" WHERE eventType = ? AND createdAt < ? LIMIT ?`
+		} else {
+			query = `DELETE FROM "EndpointSSE" WHERE id IN (
+				SELECT id FROM "EndpointSSE" WHERE eventType = ? AND createdAt < ? LIMIT ?
+			)`
+		}
+		res, err := j.db.Exec(query, eventType, cutoff, j.cfg.ChunkSize)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < int64(j.cfg.ChunkSize) {
+			return total, nil
+		}
+		if j.cfg.ChunkPause > 0 {
+			time.Sleep(j.cfg.ChunkPause)
+		}
+	}
+}
+
+// vacuum 回收空间：到达间隔时执行完整 VACUUM（同时切换为 INCREMENTAL 模式），
+// 否则在有删除时执行 incremental_vacuum
+func (j *Janitor) vacuum(deleted int64) string {
+	if j.dialect != storage.SQLite {
+		return j.vacuumServer()
+	}
+
+	var mode int
+	if err := j.db.QueryRow(`PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		return ""
+	}
+
+	needFull := mode != 2 || (j.cfg.VacuumInterval > 0 && time.Since(j.lastVacuum) >= j.cfg.VacuumInterval)
+	if needFull && j.lastVacuum.IsZero() && mode == 2 {
+		// 已是增量模式的库重启后不立即执行完整 VACUUM
+		j.lastVacuum = time.Now()
+		needFull = false
+	}
+
+	if needFull {
+		if mode != 2 {
+			if _, err := j.db.Exec(`PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+				log.Warnf("[Retention]设置 auto_vacuum 失败: %v", err)
+				return ""
+			}
+		}
+		if _, err := j.db.Exec(`VACUUM`); err != nil {
+			log.Warnf("[Retention]VACUUM 失败: %v", err)
+			return ""
+		}
+		j.lastVacuum = time.Now()
+		return "full"
+	}
+
+	if deleted > 0 {
+		if _, err := j.db.Exec(`PRAGMA incremental_vacuum`); err != nil {
+			log.Warnf("[Retention]incremental_vacuum 失败: %v", err)
+			return ""
+		}
+		return "incremental"
+	}
+	return ""
+}
+
+// vacuumServer PostgreSQL / MySQL 依赖数据库自身的空间回收，仅按间隔整理 EndpointSSE 表
+func (j *Janitor) vacuumServer() string {
+	if j.cfg.VacuumInterval <= 0 {
+		return ""
+	}
+	if j.lastVacuum.IsZero() {
+		j.lastVacuum = time.Now()
+		return ""
+	}
+	if time.Since(j.lastVacuum) < j.cfg.VacuumInterval {
+		return ""
+	}
+
+	query := `VACUUM (ANALYZE) "EndpointSSE"`
+	if j.dialect == storage.MySQL {
+		query = `OPTIMIZE TABLE "EndpointSSE"`
+	}
+	if _, err := j.db.Exec(query); err != nil {
+		log.Warnf("[Retention]整理 EndpointSSE 表失败: %v", err)
+		return ""
+	}
+	j.lastVacuum = time.Now()
+	return "full"
+}
+
+// eventTypes 返回排序后的事件类型，保证执行顺序稳定
+func (j *Janitor) eventTypes() []string {
+	types := make([]string, 0, len(j.cfg.Policies))
+	for t := range j.cfg.Policies {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Policies 返回当前保留策略
+func (j *Janitor) Policies() []PolicyInfo {
+	list := make([]PolicyInfo, 0, len(j.cfg.Policies))
+	for _, t := range j.eventTypes() {
+		info := PolicyInfo{EventType: t}
+		if d := j.cfg.Policies[t]; d > 0 {
+			info.Retention = d.String()
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+// RecycleRetention 返回回收站保留时长，为空表示永久保留
+func (j *Janitor) RecycleRetention() string {
+	if j.cfg.Recycle <= 0 {
+		return ""
+	}
+	return j.cfg.Recycle.String()
+}
+
+// LastRun 返回最近一次清理结果
+func (j *Janitor) LastRun() *RunResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.lastRun
+}
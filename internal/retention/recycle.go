@@ -0,0 +1,92 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// RecycleFilter 回收站清理条件，各条件取交集，空值表示不限
+type RecycleFilter struct {
+	// EndpointID 仅清理指定主控的回收站
+	EndpointID int64
+	// Before 仅清理删除时间早于该时间的记录
+	Before time.Time
+}
+
+// PurgeRecycle 删除符合条件的回收站记录及其实例的 EndpointSSE 历史，返回删除的回收站记录数
+func PurgeRecycle(ctx context.Context, db *sql.DB, f RecycleFilter) (int64, error) {
+	var conds []string
+	var args []interface{}
+	if f.EndpointID > 0 {
+		conds = append(conds, "endpointId = ?")
+		args = append(args, f.EndpointID)
+	}
+	if !f.Before.IsZero() {
+		conds = append(conds, "deletedAt < ?")
+		args = append(args, f.Before)
+	}
+	query := `SELECT id, endpointId, instanceId FROM "TunnelRecycle"`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	type entry struct {
+		id, endpointID int64
+		instanceID     sql.NullString
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.endpointID, &e.instanceID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// 逐条删除，每条记录与其日志在同一事务中，避免长时间持有写锁
+	var total int64
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return total, nil
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return total, err
+		}
+		if e.instanceID.Valid && e.instanceID.String != "" {
+			if _, err := tx.Exec(`DELETE FROM "EndpointSSE" WHERE endpointId = ? AND instanceId = ?`, e.endpointID, e.instanceID.String); err != nil {
+				tx.Rollback()
+				return total, err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM "TunnelRecycle" WHERE id = ?`, e.id); err != nil {
+			tx.Rollback()
+			return total, err
+		}
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		total++
+	}
+	return total, nil
+}
+
+// PurgeOrphanVersions 删除所属隧道已不存在且早于 before 的配置版本，返回删除行数
+func PurgeOrphanVersions(ctx context.Context, db *sql.DB, before time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM "TunnelConfigVersion" WHERE createdAt < ? AND tunnelId NOT IN (SELECT id FROM "Tunnel")`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,183 @@
+// Package schedule 隧道定时操作：按 cron 表达式与时区定时启动、停止或重启一组隧道。
+//
+// 计划与执行记录保存在数据库中；服务停止期间错过的执行在启动时记录，
+// 并按计划的设置跳过或补执行一次。
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/labels"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 定时操作
+const (
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+)
+
+// 错过执行的处理方式
+const (
+	MissedSkip = "skip" // 仅记录，不补执行
+	MissedRun  = "run"  // 启动后补执行一次（最近一次错过的时间需在补执行窗口内）
+)
+
+// 执行来源
+const (
+	SourceSchedule = "schedule" // 按计划触发
+	SourceManual   = "manual"   // 手动触发
+	SourceCatchUp  = "catchup"  // 启动后补执行
+)
+
+// 执行结果
+const (
+	RunSuccess = "success"
+	RunPartial = "partial" // 部分隧道失败
+	RunFailed  = "failed"
+	RunSkipped = "skipped" // 没有匹配的隧道
+	RunMissed  = "missed"  // 服务停止期间错过
+)
+
+// 错误
+var (
+	ErrNotFound = errors.New("定时任务不存在")
+	ErrRunning  = errors.New("该定时任务正在执行")
+)
+
+// parser 标准 5 段 cron 表达式，支持 @daily、@every 1h 等描述符
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Target 操作的隧道，IDs 与 Selector 至少指定一个（同时指定时取交集）
+type Target struct {
+	IDs []int64 `json:"ids,omitempty"`
+	// Selector 标签选择器，如 env=prod,team!=infra
+	Selector string `json:"selector,omitempty"`
+}
+
+// Schedule 定时任务
+type Schedule struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Expression cron 表达式（分 时 日 月 周），如 "0 9 * * 1-5"
+	Expression string `json:"expression"`
+	// Timezone IANA 时区，如 Asia/Shanghai，为空时保存为服务所在时区的名称
+	Timezone string `json:"timezone"`
+	Action   string `json:"action"`
+	Target   Target `json:"target"`
+	// Missed 服务停止期间错过执行的处理方式：skip / run
+	Missed      string     `json:"missed"`
+	Enabled     bool       `json:"enabled"`
+	LastRunAt   *time.Time `json:"lastRunAt,omitempty"`
+	LastStatus  string     `json:"lastStatus,omitempty"`
+	LastMessage string     `json:"lastMessage,omitempty"`
+	// NextRunAt 下次执行时间，未启用时为空
+	NextRunAt *time.Time `json:"nextRunAt,omitempty"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// RunResult 单条隧道的执行结果
+type RunResult struct {
+	TunnelID int64  `json:"tunnelId"`
+	Name     string `json:"name"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Run 一次执行记录
+type Run struct {
+	ID          int64       `json:"id"`
+	ScheduleID  int64       `json:"scheduleId"`
+	ScheduledAt time.Time   `json:"scheduledAt"`
+	StartedAt   time.Time   `json:"startedAt"`
+	FinishedAt  *time.Time  `json:"finishedAt,omitempty"`
+	Source      string      `json:"source"`
+	Status      string      `json:"status"`
+	Total       int         `json:"total"`
+	Succeeded   int         `json:"succeeded"`
+	Failed      int         `json:"failed"`
+	Message     string      `json:"message,omitempty"`
+	Results     []RunResult `json:"results"`
+}
+
+// normalize 填充默认值并校验定时任务
+func (s *Schedule) normalize() error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Expression = strings.TrimSpace(s.Expression)
+	s.Timezone = strings.TrimSpace(s.Timezone)
+	s.Target.Selector = strings.TrimSpace(s.Target.Selector)
+	if s.Timezone == "" || s.Timezone == "Local" {
+		s.Timezone = localTimezone()
+	}
+	if s.Missed == "" {
+		s.Missed = MissedSkip
+	}
+
+	if s.Name == "" {
+		return errors.New("名称不能为空")
+	}
+	switch s.Action {
+	case ActionStart, ActionStop, ActionRestart:
+	default:
+		return fmt.Errorf("不支持的操作: %q（可选 start / stop / restart）", s.Action)
+	}
+	switch s.Missed {
+	case MissedSkip, MissedRun:
+	default:
+		return fmt.Errorf("无效的错过处理方式: %q（可选 skip / run）", s.Missed)
+	}
+	if len(s.Target.IDs) == 0 && s.Target.Selector == "" {
+		return errors.New("需要指定隧道 ID 或标签选择器")
+	}
+	if _, err := labels.Parse(s.Target.Selector); err != nil {
+		return err
+	}
+	_, err := s.schedule()
+	return err
+}
+
+// localTimezone 返回服务所在时区的 IANA 名称。time.Local.String() 通常只是 "Local"，
+// 保存后在其它时区的服务上含义会改变，因此依次从 TZ 环境变量与 /etc/localtime 解析，均无法确定时使用 UTC
+func localTimezone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" && tz != "Local" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if i := strings.LastIndex(target, "zoneinfo/"); i >= 0 {
+			tz := target[i+len("zoneinfo/"):]
+			if _, err := time.LoadLocation(tz); err == nil {
+				return tz
+			}
+		}
+	}
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	return "UTC"
+}
+
+// schedule 按时区解析 cron 表达式
+func (s *Schedule) schedule() (cron.Schedule, error) {
+	if strings.HasPrefix(s.Expression, "TZ=") || strings.HasPrefix(s.Expression, "CRON_TZ=") {
+		return nil, errors.New("时区请通过 timezone 字段指定")
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return nil, fmt.Errorf("无效的时区: %q", s.Timezone)
+	}
+	sched, err := parser.Parse("CRON_TZ=" + s.Timezone + " " + s.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 cron 表达式 %q: %v", s.Expression, err)
+	}
+	return sched, nil
+}
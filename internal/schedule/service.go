@@ -0,0 +1,556 @@
+package schedule
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/tunnel"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxMissedScan 统计错过次数时最多向后推算的执行次数
+const maxMissedScan = 10000
+
+// Config 定时任务配置
+type Config struct {
+	// CatchUpWindow 补执行窗口：最近一次错过的执行距启动时间不超过该值时才补执行，为 0 表示从不补执行
+	CatchUpWindow time.Duration
+	// HistoryKeep 每个定时任务保留的执行记录条数
+	HistoryKeep int
+}
+
+// DefaultConfig 默认补执行 1 小时内错过的执行，每个任务保留 100 条执行记录
+func DefaultConfig() Config {
+	return Config{
+		CatchUpWindow: time.Hour,
+		HistoryKeep:   100,
+	}
+}
+
+// Service 定时任务服务
+type Service struct {
+	db      *sql.DB
+	tunnels *tunnel.Service
+	cfg     Config
+	cron    *cron.Cron
+
+	mu      sync.Mutex
+	entries map[int64]cron.EntryID
+	running map[int64]bool
+}
+
+// NewService 创建定时任务服务，需调用 Start 后才会按计划执行
+func NewService(db *sql.DB, tunnels *tunnel.Service, cfg Config) *Service {
+	if cfg.HistoryKeep <= 0 {
+		cfg.HistoryKeep = DefaultConfig().HistoryKeep
+	}
+	return &Service{
+		db:      db,
+		tunnels: tunnels,
+		cfg:     cfg,
+		cron:    cron.New(cron.WithParser(parser)),
+		entries: make(map[int64]cron.EntryID),
+		running: make(map[int64]bool),
+	}
+}
+
+// Start 加载已启用的定时任务，处理停止期间错过的执行后开始调度
+func (s *Service) Start() error {
+	list, err := s.list()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	enabled := 0
+	for i := range list {
+		sc := &list[i]
+		if !sc.Enabled {
+			continue
+		}
+		enabled++
+		s.handleMissed(sc, now)
+		s.register(sc)
+	}
+	s.cron.Start()
+	log.Infof("[Schedule]定时任务已启动，%d 个已启用，补执行窗口 %v", enabled, s.cfg.CatchUpWindow)
+	return nil
+}
+
+// Stop 停止调度并等待执行中的任务完成
+func (s *Service) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// List 返回全部定时任务
+func (s *Service) List() ([]Schedule, error) {
+	list, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		s.fillNext(&list[i])
+	}
+	return list, nil
+}
+
+// Get 返回定时任务
+func (s *Service) Get(id int64) (*Schedule, error) {
+	sc, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.fillNext(sc)
+	return sc, nil
+}
+
+// Create 创建定时任务，actor 记录为创建者
+func (s *Service) Create(sc Schedule, actor string) (*Schedule, error) {
+	if err := sc.normalize(); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(sc.Name, 0); err != nil {
+		return nil, err
+	}
+	ids, err := encodeIDs(sc.Target.IDs)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res, err := s.db.Exec(`INSERT INTO "TunnelSchedule" (name, expression, timezone, action, tunnelIds, selector, missed, enabled, createdBy, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sc.Name, sc.Expression, sc.Timezone, sc.Action, ids, nullable(sc.Target.Selector), sc.Missed, sc.Enabled, nullable(actor), now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.register(created)
+	s.fillNext(created)
+	log.Infof("[Schedule]创建定时任务 %s: %s (%s) %s", created.Name, created.Expression, created.Timezone, created.Action)
+	return created, nil
+}
+
+// Update 整体更新定时任务；修改后从当前时间重新开始计算错过的执行
+func (s *Service) Update(id int64, sc Schedule) (*Schedule, error) {
+	if _, err := s.get(id); err != nil {
+		return nil, err
+	}
+	if err := sc.normalize(); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(sc.Name, id); err != nil {
+		return nil, err
+	}
+	ids, err := encodeIDs(sc.Target.IDs)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.Exec(`UPDATE "TunnelSchedule" SET name = ?, expression = ?, timezone = ?, action = ?, tunnelIds = ?, selector = ?, missed = ?, enabled = ?, updatedAt = ?
+		WHERE id = ?`,
+		sc.Name, sc.Expression, sc.Timezone, sc.Action, ids, nullable(sc.Target.Selector), sc.Missed, sc.Enabled, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.register(updated)
+	s.fillNext(updated)
+	return updated, nil
+}
+
+// SetEnabled 启用或停用定时任务；重新启用时不会补执行停用期间的计划
+func (s *Service) SetEnabled(id int64, enabled bool) (*Schedule, error) {
+	res, err := s.db.Exec(`UPDATE "TunnelSchedule" SET enabled = ?, updatedAt = ? WHERE id = ?`, enabled, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	sc, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.register(sc)
+	s.fillNext(sc)
+	return sc, nil
+}
+
+// Delete 删除定时任务及其执行记录
+func (s *Service) Delete(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM "TunnelSchedule" WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	s.unregister(id)
+	_, err = s.db.Exec(`DELETE FROM "TunnelScheduleRun" WHERE scheduleId = ?`, id)
+	return err
+}
+
+// RunNow 立即执行一次定时任务（不论是否启用），返回执行记录
+func (s *Service) RunNow(id int64) (*Run, error) {
+	sc, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.execute(sc, time.Now(), SourceManual)
+}
+
+// Runs 返回定时任务最近的执行记录，按时间倒序
+func (s *Service) Runs(id int64, limit int) ([]Run, error) {
+	if _, err := s.get(id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > s.cfg.HistoryKeep {
+		limit = s.cfg.HistoryKeep
+	}
+	rows, err := s.db.Query(`SELECT id, scheduleId, scheduledAt, startedAt, finishedAt, source, status, total, succeeded, failed, message, results
+		FROM "TunnelScheduleRun" WHERE scheduleId = ? ORDER BY id DESC LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []Run{}
+	for rows.Next() {
+		var r Run
+		var finished sql.NullTime
+		var message, results sql.NullString
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.ScheduledAt, &r.StartedAt, &finished, &r.Source, &r.Status,
+			&r.Total, &r.Succeeded, &r.Failed, &message, &results); err != nil {
+			return nil, err
+		}
+		if finished.Valid {
+			r.FinishedAt = &finished.Time
+		}
+		r.Message = message.String
+		r.Results = []RunResult{}
+		if results.String != "" {
+			_ = json.Unmarshal([]byte(results.String), &r.Results)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// register 按当前配置重新登记调度项，未启用或表达式无效时仅移除
+func (s *Service) register(sc *Schedule) {
+	s.unregister(sc.ID)
+	if !sc.Enabled {
+		return
+	}
+	sched, err := sc.schedule()
+	if err != nil {
+		log.Warnf("[Schedule]定时任务 %s 无法调度: %v", sc.Name, err)
+		return
+	}
+	id := sc.ID
+	entry := s.cron.Schedule(sched, cron.FuncJob(func() { s.fire(id) }))
+	s.mu.Lock()
+	s.entries[id] = entry
+	s.mu.Unlock()
+}
+
+func (s *Service) unregister(id int64) {
+	s.mu.Lock()
+	entry, ok := s.entries[id]
+	delete(s.entries, id)
+	s.mu.Unlock()
+	if ok {
+		s.cron.Remove(entry)
+	}
+}
+
+// fillNext 填充下次执行时间
+func (s *Service) fillNext(sc *Schedule) {
+	s.mu.Lock()
+	entry, ok := s.entries[sc.ID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	next := s.cron.Entry(entry).Next
+	if next.IsZero() {
+		// 调度尚未启动时按表达式推算
+		sched, err := sc.schedule()
+		if err != nil {
+			return
+		}
+		next = sched.Next(time.Now())
+	}
+	sc.NextRunAt = &next
+}
+
+// fire 调度触发：重新读取任务，确认仍启用后执行
+func (s *Service) fire(id int64) {
+	sc, err := s.get(id)
+	if err != nil {
+		log.Warnf("[Schedule]读取定时任务 %d 失败: %v", id, err)
+		return
+	}
+	if !sc.Enabled {
+		return
+	}
+	if _, err := s.execute(sc, time.Now().Truncate(time.Second), SourceSchedule); err != nil {
+		log.Warnf("[Schedule]定时任务 %s 未执行: %v", sc.Name, err)
+	}
+}
+
+// handleMissed 统计上次执行（或最近一次修改）之后、启动之前错过的执行，记录并按设置补执行一次
+func (s *Service) handleMissed(sc *Schedule, now time.Time) {
+	sched, err := sc.schedule()
+	if err != nil {
+		return
+	}
+	from := sc.UpdatedAt
+	if sc.LastRunAt != nil && sc.LastRunAt.After(from) {
+		from = *sc.LastRunAt
+	}
+	var count int
+	var latest time.Time
+	for t := sched.Next(from); !t.IsZero() && !t.After(now) && count < maxMissedScan; t = sched.Next(t) {
+		count++
+		latest = t
+	}
+	if count == 0 {
+		return
+	}
+
+	catchUp := sc.Missed == MissedRun && s.cfg.CatchUpWindow > 0 && now.Sub(latest) <= s.cfg.CatchUpWindow
+	msg := fmt.Sprintf("服务停止期间错过 %d 次执行，最近一次为 %s", count, latest.Format(time.RFC3339))
+	switch {
+	case catchUp:
+		msg += "，已补执行"
+	case sc.Missed == MissedRun:
+		msg += "，超出补执行窗口，已跳过"
+	default:
+		msg += "，已跳过"
+	}
+	log.Warnf("[Schedule]定时任务 %s %s", sc.Name, msg)
+	s.record(sc, &Run{
+		ScheduleID:  sc.ID,
+		ScheduledAt: latest,
+		StartedAt:   now,
+		FinishedAt:  &now,
+		Source:      SourceSchedule,
+		Status:      RunMissed,
+		Message:     msg,
+		Results:     []RunResult{},
+	})
+	if catchUp {
+		go func() {
+			if _, err := s.execute(sc, latest, SourceCatchUp); err != nil {
+				log.Warnf("[Schedule]定时任务 %s 补执行失败: %v", sc.Name, err)
+			}
+		}()
+	}
+}
+
+// execute 解析目标隧道并逐条执行操作，同一任务不会并发执行
+func (s *Service) execute(sc *Schedule, scheduledAt time.Time, source string) (*Run, error) {
+	s.mu.Lock()
+	if s.running[sc.ID] {
+		s.mu.Unlock()
+		return nil, ErrRunning
+	}
+	s.running[sc.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, sc.ID)
+		s.mu.Unlock()
+	}()
+
+	run := &Run{
+		ScheduleID:  sc.ID,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		Source:      source,
+		Results:     []RunResult{},
+	}
+	req := tunnel.BulkRequest{IDs: sc.Target.IDs}
+	if sc.Target.Selector != "" {
+		req.Selector = &tunnel.BulkSelector{Labels: sc.Target.Selector}
+	}
+	targets, err := s.tunnels.ResolveBulkTargets(req)
+	if err != nil {
+		run.Status = RunFailed
+		run.Message = "解析目标隧道失败: " + err.Error()
+	} else {
+		for _, t := range targets {
+			r := RunResult{TunnelID: t.ID, Name: t.Name}
+			if t.InstanceID == "" {
+				r.Error = "隧道没有关联的实例"
+			} else if err := s.tunnels.ControlTunnel(tunnel.TunnelActionRequest{InstanceID: t.InstanceID, Action: sc.Action}); err != nil {
+				r.Error = err.Error()
+			} else {
+				r.Success = true
+			}
+			run.Results = append(run.Results, r)
+			run.Total++
+			if r.Success {
+				run.Succeeded++
+			} else {
+				run.Failed++
+			}
+		}
+		switch {
+		case run.Total == 0:
+			run.Status = RunSkipped
+			run.Message = "没有匹配的隧道"
+		case run.Failed == 0:
+			run.Status = RunSuccess
+		case run.Succeeded == 0:
+			run.Status = RunFailed
+		default:
+			run.Status = RunPartial
+		}
+		if run.Total > 0 {
+			run.Message = fmt.Sprintf("%s %d 条隧道，成功 %d，失败 %d", sc.Action, run.Total, run.Succeeded, run.Failed)
+		}
+	}
+	finished := time.Now()
+	run.FinishedAt = &finished
+
+	if run.Status == RunSuccess || run.Status == RunSkipped {
+		log.Infof("[Schedule]定时任务 %s (%s) %s", sc.Name, source, run.Message)
+	} else {
+		log.Warnf("[Schedule]定时任务 %s (%s) %s", sc.Name, source, run.Message)
+	}
+	s.record(sc, run)
+	return run, nil
+}
+
+// record 保存执行记录、更新任务的最近执行状态，并清理超出保留条数的旧记录
+func (s *Service) record(sc *Schedule, run *Run) {
+	results, _ := json.Marshal(run.Results)
+	res, err := s.db.Exec(`INSERT INTO "TunnelScheduleRun" (scheduleId, scheduledAt, startedAt, finishedAt, source, status, total, succeeded, failed, message, results)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ScheduleID, run.ScheduledAt, run.StartedAt, run.FinishedAt, run.Source, run.Status,
+		run.Total, run.Succeeded, run.Failed, nullable(run.Message), string(results))
+	if err != nil {
+		log.Warnf("[Schedule]保存定时任务 %s 执行记录失败: %v", sc.Name, err)
+		return
+	}
+	run.ID, _ = res.LastInsertId()
+
+	if _, err := s.db.Exec(`UPDATE "TunnelSchedule" SET lastRunAt = ?, lastStatus = ?, lastMessage = ? WHERE id = ?`,
+		run.ScheduledAt, run.Status, nullable(run.Message), sc.ID); err != nil {
+		log.Warnf("[Schedule]更新定时任务 %s 状态失败: %v", sc.Name, err)
+	}
+
+	// MySQL 不支持在 DELETE 的子查询中引用同一张表，先查出边界 ID
+	var boundary int64
+	err = s.db.QueryRow(`SELECT id FROM "TunnelScheduleRun" WHERE scheduleId = ? ORDER BY id DESC LIMIT 1 OFFSET ?`,
+		sc.ID, s.cfg.HistoryKeep).Scan(&boundary)
+	if err == nil {
+		_, err = s.db.Exec(`DELETE FROM "TunnelScheduleRun" WHERE scheduleId = ? AND id <= ?`, sc.ID, boundary)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Warnf("[Schedule]清理定时任务 %s 执行记录失败: %v", sc.Name, err)
+	}
+}
+
+func (s *Service) checkName(name string, exceptID int64) error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "TunnelSchedule" WHERE name = ? AND id != ?`, name, exceptID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("定时任务名称已存在: %s", name)
+	}
+	return nil
+}
+
+const scheduleColumns = `id, name, expression, timezone, action, tunnelIds, selector, missed, enabled,
+	lastRunAt, lastStatus, lastMessage, createdBy, createdAt, updatedAt`
+
+func (s *Service) list() ([]Schedule, error) {
+	rows, err := s.db.Query(`SELECT ` + scheduleColumns + ` FROM "TunnelSchedule" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Schedule{}
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sc)
+	}
+	return list, rows.Err()
+}
+
+func (s *Service) get(id int64) (*Schedule, error) {
+	sc, err := scanSchedule(s.db.QueryRow(`SELECT `+scheduleColumns+` FROM "TunnelSchedule" WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return sc, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSchedule(row rowScanner) (*Schedule, error) {
+	var sc Schedule
+	var ids, selector, lastStatus, lastMessage, createdBy sql.NullString
+	var lastRun sql.NullTime
+	if err := row.Scan(&sc.ID, &sc.Name, &sc.Expression, &sc.Timezone, &sc.Action, &ids, &selector, &sc.Missed, &sc.Enabled,
+		&lastRun, &lastStatus, &lastMessage, &createdBy, &sc.CreatedAt, &sc.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if ids.String != "" {
+		_ = json.Unmarshal([]byte(ids.String), &sc.Target.IDs)
+	}
+	sc.Target.Selector = selector.String
+	if lastRun.Valid {
+		sc.LastRunAt = &lastRun.Time
+	}
+	sc.LastStatus = lastStatus.String
+	sc.LastMessage = lastMessage.String
+	sc.CreatedBy = createdBy.String
+	return &sc, nil
+}
+
+// encodeIDs 隧道 ID 列表以 JSON 数组保存，空列表写入 NULL
+func encodeIDs(ids []int64) (interface{}, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, fmt.Errorf("无效的隧道 ID: %d", id)
+		}
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func nullable(v string) interface{} {
+	if v = strings.TrimSpace(v); v != "" {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/tunnel"
+)
+
+// Result 单个变更的执行结果
+type Result struct {
+	Change
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Apply 计算差异并按顺序执行，单个变更失败不影响其余变更
+func (s *Service) Apply(spec *Spec, prune bool) (*Plan, []Result, error) {
+	plan, err := s.Plan(spec, prune)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var results []Result
+	for _, c := range plan.Changes {
+		if c.Action == ActionNoop {
+			continue
+		}
+		res := Result{Change: c, Success: true}
+		if err := s.execute(c); err != nil {
+			res.Success = false
+			res.Error = err.Error()
+			log.Warnf("[Spec] %s %s/%s 失败: %v", c.Action, c.Endpoint, c.Tunnel, err)
+		} else {
+			log.Infof("[Spec] %s %s/%s 完成", c.Action, c.Endpoint, c.Tunnel)
+		}
+		results = append(results, res)
+	}
+	return plan, results, nil
+}
+
+// execute 执行单个变更
+func (s *Service) execute(c Change) error {
+	switch c.Action {
+	case ActionDelete:
+		return s.deleteTunnel(c)
+	case ActionReplace:
+		return s.replaceTunnel(c)
+	case ActionRecreate:
+		// 实例已不存在，只需移除本地记录；所在隧道对关联到新隧道
+		pair, err := s.tunnels.PairOf(c.TunnelID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = ?`, c.TunnelID); err != nil {
+			return err
+		}
+		created, err := s.createTunnel(c)
+		if err != nil {
+			return err
+		}
+		return s.tunnels.InheritPair(pair, c.TunnelID, created.ID)
+	case ActionUpdate:
+		req := *c.desired
+		req.Actor = "spec"
+		if err := s.tunnels.ReplaceTunnel(c.TunnelID, req); err != nil {
+			return err
+		}
+		return s.tunnels.SetManaged(c.TunnelID, true)
+	case ActionAdopt:
+		return s.tunnels.SetManaged(c.TunnelID, true)
+	case ActionCreate:
+		_, err := s.createTunnel(c)
+		return err
+	}
+	return fmt.Errorf("未知的变更类型: %s", c.Action)
+}
+
+func (s *Service) createTunnel(c Change) (*tunnel.Tunnel, error) {
+	req := *c.desired
+	req.Actor = "spec"
+	t, err := s.tunnels.CreateTunnel(req)
+	if err != nil {
+		return nil, err
+	}
+	return t, s.tunnels.SetManaged(t.ID, true)
+}
+
+// replaceTunnel 删除旧隧道（移入回收站）后按新配置创建，所在隧道对随之关联到新隧道；
+// 创建失败时从回收站恢复旧隧道，避免隧道丢失
+func (s *Service) replaceTunnel(c Change) error {
+	managed, err := s.tunnels.IsManaged(c.TunnelID)
+	if err != nil {
+		return err
+	}
+	pair, err := s.tunnels.PairOf(c.TunnelID)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteTunnel(c); err != nil {
+		return err
+	}
+	created, createErr := s.createTunnel(c)
+	if created != nil {
+		if err := s.tunnels.InheritPair(pair, c.TunnelID, created.ID); err != nil {
+			log.Warnf("[Spec] %s/%s 的隧道对关联新隧道失败: %v", c.Endpoint, c.Tunnel, err)
+		}
+	}
+	if createErr == nil || c.InstanceID == "" {
+		// 旧隧道没有关联实例时只删除了本地记录，无需恢复
+		return createErr
+	}
+
+	var recycleID int64
+	err = s.db.QueryRow(`SELECT id FROM "TunnelRecycle" WHERE endpointId = ? AND instanceId = ? ORDER BY id DESC LIMIT 1`,
+		c.EndpointID, c.InstanceID).Scan(&recycleID)
+	if err != nil {
+		return fmt.Errorf("创建新隧道失败: %v；旧隧道已移入回收站，查找回收站记录失败: %v", createErr, err)
+	}
+	res, err := s.tunnels.RestoreRecycled(c.EndpointID, recycleID, tunnel.RestoreRequest{IgnorePortPolicy: true})
+	if err != nil {
+		return fmt.Errorf("创建新隧道失败: %v；从回收站恢复旧隧道失败，请手动恢复: %v", createErr, err)
+	}
+	if managed {
+		_ = s.tunnels.SetManaged(res.Tunnel.ID, true)
+	}
+	if err := s.tunnels.InheritPair(pair, c.TunnelID, res.Tunnel.ID); err != nil {
+		log.Warnf("[Spec] %s/%s 的隧道对关联恢复的隧道失败: %v", c.Endpoint, c.Tunnel, err)
+	}
+	log.Warnf("[Spec] 重建 %s/%s 失败，已从回收站恢复旧隧道", c.Endpoint, c.Tunnel)
+	return fmt.Errorf("创建新隧道失败，已恢复旧隧道: %w", createErr)
+}
+
+func (s *Service) deleteTunnel(c Change) error {
+	if c.InstanceID == "" || c.localOnly {
+		_, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = ?`, c.TunnelID)
+		return err
+	}
+	return s.tunnels.DeleteTunnelAndWait(c.InstanceID, s.cfg.DeleteTimeout, true, "spec")
+}
+
+// Text 以文本形式输出差异，供命令行使用
+func (p *Plan) Text() string {
+	var b strings.Builder
+	symbols := map[string]string{
+		ActionDelete:   "-",
+		ActionReplace:  "-/+",
+		ActionRecreate: "+",
+		ActionUpdate:   "~",
+		ActionAdopt:    "=",
+		ActionCreate:   "+",
+		ActionNoop:     " ",
+	}
+	for _, w := range p.Warnings {
+		fmt.Fprintf(&b, "警告: %s\n", w)
+	}
+	for _, c := range p.Changes {
+		if c.Action == ActionNoop {
+			continue
+		}
+		fmt.Fprintf(&b, "%-3s %-8s %s/%s", symbols[c.Action], c.Action, c.Endpoint, c.Tunnel)
+		if c.Reason != "" {
+			fmt.Fprintf(&b, "  (%s)", c.Reason)
+		}
+		b.WriteString("\n")
+		if c.Action == ActionDelete {
+			continue
+		}
+		for _, d := range c.Diff {
+			fmt.Fprintf(&b, "      %s: %q -> %q\n", d.Field, d.From, d.To)
+		}
+	}
+	fmt.Fprintf(&b, "计划: %d 创建, %d 更新, %d 重建, %d 删除, %d 接管, %d 无变化\n",
+		p.Summary[ActionCreate], p.Summary[ActionUpdate],
+		p.Summary[ActionReplace]+p.Summary[ActionRecreate], p.Summary[ActionDelete],
+		p.Summary[ActionAdopt], p.Summary[ActionNoop])
+	return b.String()
+}
@@ -0,0 +1,341 @@
+package spec
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/labels"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/tunnel"
+)
+
+// 变更类型，apply 按此顺序执行（先删除释放名称与端口，再创建）
+const (
+	ActionDelete   = "delete"   // 删除隧道（移入回收站）
+	ActionReplace  = "replace"  // 模式变化，删除后重建（重建失败时从回收站恢复原隧道）
+	ActionRecreate = "recreate" // 主控上实例已不存在，重建
+	ActionUpdate   = "update"   // 覆盖隧道配置
+	ActionAdopt    = "adopt"    // 配置一致，仅标记为受管理
+	ActionCreate   = "create"   // 新建隧道
+	ActionNoop     = "noop"     // 无变化
+)
+
+var actionOrder = map[string]int{
+	ActionDelete:   0,
+	ActionReplace:  1,
+	ActionRecreate: 2,
+	ActionUpdate:   3,
+	ActionAdopt:    4,
+	ActionCreate:   5,
+	ActionNoop:     6,
+}
+
+// Change 单个隧道的变更
+type Change struct {
+	Action     string                  `json:"action"`
+	Endpoint   string                  `json:"endpoint"`
+	EndpointID int64                   `json:"endpointId"`
+	Tunnel     string                  `json:"tunnel"`
+	TunnelID   int64                   `json:"tunnelId,omitempty"`
+	InstanceID string                  `json:"instanceId,omitempty"`
+	Reason     string                  `json:"reason,omitempty"`
+	Diff       []nodepassurl.FieldDiff `json:"diff,omitempty"`
+
+	desired   *tunnel.CreateTunnelRequest
+	localOnly bool // 主控上已无该实例，仅需删除本地记录
+}
+
+// Plan 配置与当前状态的差异
+type Plan struct {
+	Prune    bool           `json:"prune"`
+	Changes  []Change       `json:"changes"`
+	Summary  map[string]int `json:"summary"`
+	Warnings []string       `json:"warnings,omitempty"`
+}
+
+// HasChanges 是否存在需要执行的变更
+func (p *Plan) HasChanges() bool {
+	for _, c := range p.Changes {
+		if c.Action != ActionNoop {
+			return true
+		}
+	}
+	return false
+}
+
+// Config 声明式配置服务配置
+type Config struct {
+	// DeleteTimeout 删除实例后等待 SSE 同步移除本地记录的最长时间；
+	// 为 0 时不等待，直接删除本地记录（命令行模式下没有 SSE 监听）
+	DeleteTimeout time.Duration
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{DeleteTimeout: 3 * time.Second}
+}
+
+// Service 声明式配置服务
+type Service struct {
+	db      *sql.DB
+	tunnels *tunnel.Service
+	cfg     Config
+}
+
+// NewService 创建声明式配置服务
+func NewService(db *sql.DB, tunnels *tunnel.Service, cfg Config) *Service {
+	return &Service{db: db, tunnels: tunnels, cfg: cfg}
+}
+
+type endpointRow struct {
+	id                   int64
+	name                 string
+	url, apiPath, apiKey string
+}
+
+type tunnelRow struct {
+	id          int64
+	instanceID  string
+	name        string
+	endpointID  int64
+	commandLine string
+	managed     bool
+	labels      labels.Set
+}
+
+// Plan 比较配置与数据库、主控实例的差异。
+// 删除只作用于配置中出现的主控：prune 为 true 时删除这些主控上未声明的全部隧道（包括未受管理的），
+// 否则只删除其中此前由配置管理、现已从配置中移除的隧道。配置中未出现的主控上的隧道保持不变，
+// 仅当受管理的隧道改为声明在其它主控上（同名迁移）时才会被删除后重建
+func (s *Service) Plan(spec *Spec, prune bool) (*Plan, error) {
+	endpoints, err := s.loadEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.loadTunnels()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Prune: prune, Summary: make(map[string]int)}
+
+	// 解析主控名称
+	var missing []string
+	specEndpoints := make(map[int64]bool)
+	for _, ep := range spec.Endpoints {
+		row, ok := endpoints[ep.Name]
+		if !ok {
+			missing = append(missing, ep.Name)
+			continue
+		}
+		specEndpoints[row.id] = true
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("主控不存在: %s", strings.Join(missing, ", "))
+	}
+
+	// 获取主控上的实例，失败时以数据库为准
+	live := make(map[int64]map[string]string)
+	for _, ep := range spec.Endpoints {
+		row := endpoints[ep.Name]
+		client := nodepass.NewClient(row.url, row.apiPath, row.apiKey, nil)
+		instances, err := client.GetInstances()
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("无法获取主控 %s 的实例列表，按数据库记录比较: %v", ep.Name, err))
+			continue
+		}
+		urls := make(map[string]string, len(instances))
+		for _, inst := range instances {
+			urls[inst.ID] = inst.URL
+		}
+		live[row.id] = urls
+	}
+
+	byName := make(map[string]*tunnelRow, len(rows))
+	for i := range rows {
+		byName[rows[i].name] = &rows[i]
+	}
+	endpointNames := make(map[int64]string, len(endpoints))
+	for _, ep := range endpoints {
+		endpointNames[ep.id] = ep.name
+	}
+
+	desired := make(map[int64]bool)
+	// moved 迁移到配置中其它主控的受管理隧道，需删除旧主控上的隧道
+	moved := make(map[int64]bool)
+	var conflicts []string
+	for _, ep := range spec.Endpoints {
+		endpointID := endpoints[ep.Name].id
+		for _, t := range ep.Tunnels {
+			req := t.request(endpointID)
+			change := Change{
+				Endpoint:   ep.Name,
+				EndpointID: endpointID,
+				Tunnel:     t.Name,
+				desired:    &req,
+			}
+			want := req.CommandURL()
+
+			row := byName[t.Name]
+			if row != nil && row.endpointID != endpointID {
+				// 同名隧道位于其它主控：受管理的将被删除后在此重建，否则冲突
+				if !row.managed && !(prune && specEndpoints[row.endpointID]) {
+					conflicts = append(conflicts, fmt.Sprintf("%s 已被主控 %s 上未受管理的隧道占用", t.Name, endpointNames[row.endpointID]))
+					continue
+				}
+				moved[row.id] = true
+				row = nil
+			}
+
+			if err := s.tunnels.ValidateExtraParams(endpointID, req.Mode, req.ExtraParams); err != nil {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s/%s: %v", ep.Name, t.Name, err))
+			}
+
+			if row == nil {
+				change.Action = ActionCreate
+				change.Diff = nodepassurl.Diff(nil, want)
+				plan.add(change)
+				continue
+			}
+
+			desired[row.id] = true
+			change.TunnelID = row.id
+			change.InstanceID = row.instanceID
+
+			current := row.commandLine
+			if urls, ok := live[endpointID]; ok {
+				liveURL, exists := urls[row.instanceID]
+				if !exists {
+					change.Action = ActionRecreate
+					change.Reason = "主控上不存在该实例"
+					change.Diff = nodepassurl.Diff(nil, want)
+					plan.add(change)
+					continue
+				}
+				current = liveURL
+			}
+
+			have, err := nodepassurl.Parse(current)
+			if err != nil {
+				log.Warnf("[Spec] 隧道 %s 的实例 URL 解析失败: %v", t.Name, err)
+				have = nil
+			}
+			change.Diff = nodepassurl.Diff(have, want)
+			if t.Labels != nil && !t.Labels.Equal(row.labels) {
+				change.Diff = append(change.Diff, nodepassurl.FieldDiff{
+					Field: "labels",
+					From:  row.labels.String(),
+					To:    t.Labels.String(),
+				})
+			}
+
+			switch {
+			case have == nil || have.Mode != want.Mode:
+				change.Action = ActionReplace
+				change.Reason = "模式变化需要重建"
+			case len(change.Diff) > 0:
+				change.Action = ActionUpdate
+				if !row.managed {
+					change.Reason = "接管未受管理的隧道"
+				}
+			case !row.managed:
+				change.Action = ActionAdopt
+				change.Reason = "接管未受管理的隧道"
+			default:
+				change.Action = ActionNoop
+			}
+			plan.add(change)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, errors.New("隧道名称冲突: " + strings.Join(conflicts, "; "))
+	}
+
+	// 删除配置中已不存在的隧道
+	for _, row := range rows {
+		if desired[row.id] {
+			continue
+		}
+		reason := ""
+		switch {
+		case moved[row.id]:
+			reason = "已迁移到其它主控"
+		case row.managed && specEndpoints[row.endpointID]:
+			reason = "已从配置中移除"
+		case prune && specEndpoints[row.endpointID]:
+			reason = "未受管理（prune）"
+		default:
+			continue
+		}
+		change := Change{
+			Action:     ActionDelete,
+			Endpoint:   endpointNames[row.endpointID],
+			EndpointID: row.endpointID,
+			Tunnel:     row.name,
+			TunnelID:   row.id,
+			InstanceID: row.instanceID,
+			Reason:     reason,
+		}
+		if urls, ok := live[row.endpointID]; ok {
+			if _, exists := urls[row.instanceID]; !exists {
+				change.localOnly = true
+			}
+		}
+		plan.add(change)
+	}
+
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		return actionOrder[plan.Changes[i].Action] < actionOrder[plan.Changes[j].Action]
+	})
+	return plan, nil
+}
+
+func (p *Plan) add(c Change) {
+	p.Changes = append(p.Changes, c)
+	p.Summary[c.Action]++
+}
+
+func (s *Service) loadEndpoints() (map[string]endpointRow, error) {
+	rows, err := s.db.Query(`SELECT id, name, url, apiPath, apiKey FROM "Endpoint"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := make(map[string]endpointRow)
+	for rows.Next() {
+		var ep endpointRow
+		if err := rows.Scan(&ep.id, &ep.name, &ep.url, &ep.apiPath, &ep.apiKey); err != nil {
+			return nil, err
+		}
+		endpoints[ep.name] = ep
+	}
+	return endpoints, rows.Err()
+}
+
+func (s *Service) loadTunnels() ([]tunnelRow, error) {
+	rows, err := s.db.Query(`SELECT id, instanceId, name, endpointId, commandLine, managed, labels FROM "Tunnel" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []tunnelRow
+	for rows.Next() {
+		var t tunnelRow
+		var instanceID, labelsVal sql.NullString
+		if err := rows.Scan(&t.id, &instanceID, &t.name, &t.endpointID, &t.commandLine, &t.managed, &labelsVal); err != nil {
+			return nil, err
+		}
+		t.instanceID = instanceID.String
+		t.labels = labels.Decode(labelsVal.String)
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,156 @@
+// Package spec 声明式隧道配置：以 YAML 描述各主控（按名称）上的隧道，
+// 通过 plan 比较配置与数据库 / 主控实例的差异，再由 apply 执行创建、更新与删除。
+//
+//	endpoints:
+//	  - name: hk-master
+//	    tunnels:
+//	      - name: web
+//	        mode: server
+//	        tunnelPort: 10101
+//	        targetAddress: 127.0.0.1
+//	        targetPort: 80
+//	        tlsMode: mode1
+//	        extraParams:
+//	          rate: "100"
+//	        labels:
+//	          env: prod
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/tunnel"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec 声明式配置
+type Spec struct {
+	Endpoints []EndpointSpec `yaml:"endpoints" json:"endpoints"`
+}
+
+// EndpointSpec 单个主控（按名称匹配）及其隧道
+type EndpointSpec struct {
+	Name    string       `yaml:"name" json:"name"`
+	Tunnels []TunnelSpec `yaml:"tunnels" json:"tunnels"`
+}
+
+// TunnelSpec 隧道配置，字段含义与创建隧道接口一致
+type TunnelSpec struct {
+	Name          string            `yaml:"name" json:"name"`
+	Mode          string            `yaml:"mode" json:"mode"`
+	TunnelAddress string            `yaml:"tunnelAddress,omitempty" json:"tunnelAddress,omitempty"`
+	TunnelPort    int               `yaml:"tunnelPort" json:"tunnelPort"`
+	TargetAddress string            `yaml:"targetAddress,omitempty" json:"targetAddress,omitempty"`
+	TargetPort    int               `yaml:"targetPort" json:"targetPort"`
+	TLSMode       string            `yaml:"tlsMode,omitempty" json:"tlsMode,omitempty"`
+	CertPath      string            `yaml:"certPath,omitempty" json:"certPath,omitempty"`
+	KeyPath       string            `yaml:"keyPath,omitempty" json:"keyPath,omitempty"`
+	LogLevel      string            `yaml:"logLevel,omitempty" json:"logLevel,omitempty"`
+	Min           int               `yaml:"min,omitempty" json:"min,omitempty"`
+	Max           int               `yaml:"max,omitempty" json:"max,omitempty"`
+	ExtraParams   map[string]string `yaml:"extraParams,omitempty" json:"extraParams,omitempty"`
+	// Labels 未声明时保留隧道现有标签
+	Labels labels.Set `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// Parse 解析 YAML（兼容 JSON）配置，未知字段视为错误
+func Parse(data []byte) (*Spec, error) {
+	var s Spec
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate 校验配置：名称唯一、字段合法
+func (s *Spec) Validate() error {
+	var errs []string
+	endpoints := make(map[string]bool)
+	tunnels := make(map[string]string)
+	for i, ep := range s.Endpoints {
+		if strings.TrimSpace(ep.Name) == "" {
+			errs = append(errs, fmt.Sprintf("endpoints[%d]: 缺少主控名称", i))
+			continue
+		}
+		if endpoints[ep.Name] {
+			errs = append(errs, fmt.Sprintf("主控 %s 重复声明", ep.Name))
+		}
+		endpoints[ep.Name] = true
+
+		for j, t := range ep.Tunnels {
+			where := fmt.Sprintf("%s/tunnels[%d]", ep.Name, j)
+			if strings.TrimSpace(t.Name) == "" {
+				errs = append(errs, where+": 缺少隧道名称")
+				continue
+			}
+			where = ep.Name + "/" + t.Name
+			if other, ok := tunnels[t.Name]; ok {
+				errs = append(errs, fmt.Sprintf("%s: 隧道名称与 %s/%s 重复", where, other, t.Name))
+			}
+			tunnels[t.Name] = ep.Name
+
+			if err := t.validate(); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", where, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (t TunnelSpec) validate() error {
+	switch tunnel.TLSMode(t.TLSMode) {
+	case "", tunnel.TLSModeInherit, tunnel.TLSMode0, tunnel.TLSMode1, tunnel.TLSMode2:
+	default:
+		return fmt.Errorf("tlsMode 无效: %q", t.TLSMode)
+	}
+	if err := nodepassurl.ValidateExtra(t.ExtraParams); err != nil {
+		return err
+	}
+	if err := t.Labels.Validate(); err != nil {
+		return err
+	}
+	return t.request(0).CommandURL().Validate()
+}
+
+// request 转换为创建隧道请求，未设置的 TLS / 日志级别视为继承主控
+func (t TunnelSpec) request(endpointID int64) tunnel.CreateTunnelRequest {
+	tlsMode := tunnel.TLSMode(t.TLSMode)
+	if tlsMode == "" {
+		tlsMode = tunnel.TLSModeInherit
+	}
+	logLevel := tunnel.LogLevel(strings.ToLower(t.LogLevel))
+	if logLevel == "" {
+		logLevel = tunnel.LogLevelInherit
+	}
+	return tunnel.CreateTunnelRequest{
+		Name:          t.Name,
+		EndpointID:    endpointID,
+		Mode:          t.Mode,
+		TunnelAddress: t.TunnelAddress,
+		TunnelPort:    t.TunnelPort,
+		TargetAddress: t.TargetAddress,
+		TargetPort:    t.TargetPort,
+		TLSMode:       tlsMode,
+		CertPath:      t.CertPath,
+		KeyPath:       t.KeyPath,
+		LogLevel:      logLevel,
+		Min:           t.Min,
+		Max:           t.Max,
+		ExtraParams:   t.ExtraParams,
+		Labels:        t.Labels,
+	}
+}
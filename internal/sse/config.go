@@ -0,0 +1,55 @@
+package sse
+
+import (
+	"runtime"
+	"time"
+)
+
+// Config SSE 服务与管理器配置
+type Config struct {
+	// Workers 解析主控 SSE 消息的 worker 数量，为 0 表示按 CPU 核数自动选择（最多 4 个）
+	Workers int
+	// StoreWorkers 事件持久化 worker 数量
+	StoreWorkers int
+	// JobQueueSize 待解析消息队列长度
+	JobQueueSize int
+	// StoreQueueSize 事件持久化队列长度
+	StoreQueueSize int
+	// BatchQueueSize 批量更新队列长度
+	BatchQueueSize int
+	// BatchInterval 批量更新的合并间隔
+	BatchInterval time.Duration
+	// EventCacheSize 每个端点在内存中缓存的最近事件数量
+	EventCacheSize int
+	// HealthCheckInterval 端点健康检查间隔
+	HealthCheckInterval time.Duration
+	// DialTimeout 连接主控的超时时间
+	DialTimeout time.Duration
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		StoreWorkers:        1,
+		JobQueueSize:        4096,
+		StoreQueueSize:      1000,
+		BatchQueueSize:      100,
+		BatchInterval:       200 * time.Millisecond,
+		EventCacheSize:      100,
+		HealthCheckInterval: 30 * time.Second,
+		DialTimeout:         30 * time.Second,
+	}
+}
+
+// WorkerCount 返回实际使用的 worker 数量
+func (c Config) WorkerCount() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	// 适当减少 worker 数量，避免过多并发写入
+	n := runtime.NumCPU()
+	if n > 4 {
+		n = 4
+	}
+	return n
+}
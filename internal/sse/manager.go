@@ -1,7 +1,6 @@
 package sse
 
 import (
-	log "NodePassDash/internal/log"
 	"NodePassDash/internal/models"
 	"context"
 	"crypto/tls"
@@ -27,6 +26,8 @@ type Manager struct {
 
 	// 事件处理 worker pool
 	jobs chan eventJob // 投递待解析/处理的原始 SSE 事件
+
+	cfg Config
 }
 
 // eventJob 表示一个待处理的 SSE 消息
@@ -36,12 +37,13 @@ type eventJob struct {
 }
 
 // NewManager 创建SSE管理器
-func NewManager(db *sql.DB, service *Service) *Manager {
+func NewManager(db *sql.DB, service *Service, cfg Config) *Manager {
 	return &Manager{
 		service:     service,
 		db:          db,
 		connections: make(map[int64]*EndpointConnection),
-		jobs:        make(chan eventJob, 4096), // 缓冲可按需调整 //    size := getEnvInt("SSE_JOB_BUFFER", 4096)
+		jobs:        make(chan eventJob, cfg.JobQueueSize),
+		cfg:         cfg,
 	}
 }
 
@@ -112,7 +114,7 @@ func (m *Manager) ConnectEndpoint(endpointID int64, url, apiPath, apiKey string)
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
+					Timeout:   m.cfg.DialTimeout,
 					KeepAlive: 30 * time.Second,
 					DualStack: true, // 兼容 IPv4/IPv6
 				}).DialContext,
@@ -218,6 +220,7 @@ func (m *Manager) markEndpointFail(endpointID int64) {
 	// 仅当确实修改了行时再打印成功日志
 	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
 		log.Infof("[Master-%d#SSE]更新状态为 FAIL", endpointID)
+		m.service.publishEndpointState(endpointID, EndpointStateReasonStatus)
 	}
 }
 
@@ -235,13 +238,19 @@ func (m *Manager) markEndpointOnline(endpointID int64) {
 	// 仅当确实修改了行时再打印成功日志
 	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
 		log.Infof("[Master-%d#SSE]更新状态为 ONLINE", endpointID)
+		m.service.publishEndpointState(endpointID, EndpointStateReasonStatus)
 	}
 }
 
+// NotifyEndpointState 在外部修改端点隧道数据后（如手动刷新隧道列表）推送端点最新状态
+func (m *Manager) NotifyEndpointState(endpointID int64) {
+	m.service.publishEndpointState(endpointID, EndpointStateReasonTunnels)
+}
+
 // StartWorkers 启动固定数量的后台 worker 处理事件
 func (m *Manager) StartWorkers(n int) {
 	if n <= 0 {
-		n = 4 // 默认 4 个
+		n = m.cfg.WorkerCount()
 	}
 	for i := 0; i < n; i++ {
 		go m.workerLoop()
@@ -46,6 +46,22 @@ type SSEEvent struct {
 	CreatedAt    time.Time `json:"createdAt"`
 }
 
+// EndpointState 端点状态变更事件，经事件总线推送给订阅的前端
+type EndpointState struct {
+	EndpointID    int64          `json:"endpointId"`
+	Status        EndpointStatus `json:"status"`
+	TunnelCount   int            `json:"tunnelCount"`
+	ActiveTunnels int            `json:"activeTunnels"`
+	Reason        string         `json:"reason"` // status: 连接状态变化; tunnels: 隧道数量/状态变化
+	Time          time.Time      `json:"time"`
+}
+
+// 端点状态事件原因
+const (
+	EndpointStateReasonStatus  = "status"
+	EndpointStateReasonTunnels = "tunnels"
+)
+
 // EndpointConnection 端点连接状态
 type EndpointConnection struct {
 	EndpointID           int64
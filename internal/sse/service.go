@@ -1,14 +1,16 @@
 package sse
 
 import (
-	log "NodePassDash/internal/log"
+	"NodePassDash/internal/eventbus"
 	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/traffic"
+	"NodePassDash/internal/tunnel"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,12 +26,16 @@ type Service struct {
 	// 数据存储
 	db *sql.DB
 
+	// 内部事件总线，用于推送端点状态变更
+	bus *eventbus.Bus
+
 	// 异步持久化队列
 	storeJobCh chan models.EndpointSSE // 事件持久化任务队列
 
 	// 批处理相关
 	batchUpdateCh  chan models.EndpointSSE       // 批量更新通道
 	batchTimer     *time.Timer                   // 批处理定时器
+	batchInterval  time.Duration                 // 批处理间隔
 	batchMu        sync.Mutex                    // 批处理锁
 	pendingUpdates map[string]models.EndpointSSE // 待处理的更新 key: instanceID
 
@@ -49,26 +55,28 @@ type Service struct {
 }
 
 // NewService 创建SSE服务实例
-func NewService(db *sql.DB) *Service {
+func NewService(db *sql.DB, bus *eventbus.Bus, cfg Config) *Service {
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &Service{
 		clients:             make(map[string]*Client),
 		tunnelSubs:          make(map[string]map[string]*Client),
 		db:                  db,
-		storeJobCh:          make(chan models.EndpointSSE, 1000), // 缓冲大小按需调整
-		batchUpdateCh:       make(chan models.EndpointSSE, 100),  // 批量更新通道
-		batchTimer:          time.NewTimer(1 * time.Second),      // 批处理定时器
+		bus:                 bus,
+		storeJobCh:          make(chan models.EndpointSSE, cfg.StoreQueueSize),
+		batchUpdateCh:       make(chan models.EndpointSSE, cfg.BatchQueueSize), // 批量更新通道
+		batchTimer:          time.NewTimer(1 * time.Second),                    // 批处理定时器
+		batchInterval:       cfg.BatchInterval,
 		pendingUpdates:      make(map[string]models.EndpointSSE), // 待处理的更新 key: instanceID
 		eventCache:          make(map[int64][]models.EndpointSSE),
-		maxCacheEvents:      100,
-		healthCheckInterval: 30 * time.Second,
+		maxCacheEvents:      cfg.EventCacheSize,
+		healthCheckInterval: cfg.HealthCheckInterval,
 		lastEventTime:       make(map[int64]time.Time),
 		ctx:                 ctx,
 		cancel:              cancel,
 	}
 
-	// 启动异步持久化 worker，默认 1 条，可在外部自行调用 StartStoreWorkers 增加并发
-	s.StartStoreWorkers(1)
+	// 启动异步持久化 worker，可在外部自行调用 StartStoreWorkers 增加并发
+	s.StartStoreWorkers(cfg.StoreWorkers)
 
 	// 启动批处理 worker
 	go s.startBatchProcessor()
@@ -140,6 +148,9 @@ func (s *Service) UnsubscribeFromTunnel(clientID, tunnelID string) {
 
 // ProcessEvent 处理SSE事件
 func (s *Service) ProcessEvent(endpointID int64, event models.EndpointSSE) error {
+	// 流量采样交给汇总任务计算增量
+	s.publishTraffic(event)
+
 	// 异步处理事件，避免阻塞SSE接收
 	select {
 	case s.storeJobCh <- event:
@@ -499,62 +510,33 @@ func (s *Service) updateTunnelData(event models.EndpointSSE) {
 			} else {
 				log.Infof("[Inst.%s]sse推送创建隧道实例,instanceType=%s", event.InstanceID, *event.InstanceType)
 				// 解析 URL 获取详细配置
-				var (
-					tunnelAddr, tunnelPort, targetAddr, targetPort, tlsMode, logLevel, commandLine string
-					cfg                                                                            parsedURL
-				)
-				if event.URL != nil {
-					cfg = parseInstanceURL(*event.URL, *event.InstanceType)
-					tunnelAddr = cfg.TunnelAddress
-					tunnelPort = cfg.TunnelPort
-					targetAddr = cfg.TargetAddress
-					targetPort = cfg.TargetPort
-					tlsMode = cfg.TLSMode
-					logLevel = cfg.LogLevel
-					commandLine = *event.URL
-				}
-
-				if tlsMode == "" {
-					tlsMode = "inherit"
-				}
-				if logLevel == "" {
-					logLevel = "inherit"
-				}
+				cfg := instanceConfig(event)
 
 				_, err = tx.Exec(`INSERT INTO "Tunnel" (
 					instanceId, endpointId, name, mode,
 					status, tunnelAddress, tunnelPort, targetAddress, targetPort,
 					tlsMode, certPath, keyPath, logLevel, commandLine,
-					min, max,
+					min, max, extraParams,
 					tcpRx, tcpTx, udpRx, udpTx,
 					createdAt, updatedAt, lastEventTime
-				) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+				) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 					event.InstanceID,
 					event.EndpointID,
 					event.InstanceID,
 					*event.InstanceType,
 					statusVal,
-					tunnelAddr,
-					tunnelPort,
-					targetAddr,
-					targetPort,
-					tlsMode,
-					cfg.CertPath,
-					cfg.KeyPath,
-					logLevel,
-					commandLine,
-					func() interface{} {
-						if cfg.Min != "" {
-							return cfg.Min
-						}
-						return nil
-					}(),
-					func() interface{} {
-						if cfg.Max != "" {
-							return cfg.Max
-						}
-						return nil
-					}(),
+					cfg.TunnelAddress,
+					cfg.TunnelPort,
+					cfg.TargetAddress,
+					cfg.TargetPort,
+					cfg.TLSMode(),
+					cfg.Crt,
+					cfg.Key,
+					cfg.LogLevel(),
+					ptrString(event.URL),
+					nullableInt(cfg.Min),
+					nullableInt(cfg.Max),
+					nodepassurl.EncodeExtra(cfg.ExtraMap()),
 					event.TCPRx,
 					event.TCPTx,
 					event.UDPRx,
@@ -633,123 +615,26 @@ func (s *Service) updateTunnelData(event models.EndpointSSE) {
 	// log.Info("updateTunnelData 完成", "instanceID", event.InstanceID, "eventType", event.EventType)
 }
 
-// parseInstanceURL 解析隧道实例 URL，返回各字段（简化版）
-type parsedURL struct {
-	TunnelAddress string
-	TunnelPort    string
-	TargetAddress string
-	TargetPort    string
-	TLSMode       string
-	LogLevel      string
-	CertPath      string
-	KeyPath       string
-	Min           string
-	Max           string
-}
-
-func parseInstanceURL(raw, mode string) parsedURL {
-	// 默认值
-	res := parsedURL{
-		TLSMode:  "inherit",
-		LogLevel: "inherit",
-		CertPath: "",
-		KeyPath:  "",
-	}
-
+// instanceConfig 解析事件中的实例 URL，解析失败时记录日志并返回仅包含模式的配置
+func instanceConfig(e models.EndpointSSE) *nodepassurl.URL {
+	raw := ptrString(e.URL)
 	if raw == "" {
-		return res
-	}
-
-	// 分离 protocol://hostPart/pathPart?query
-	var hostPart, pathPart, queryPart string
-	// strip protocol
-	if idx := strings.Index(raw, "://"); idx != -1 {
-		raw = raw[idx+3:]
+		return &nodepassurl.URL{Mode: ptrString(e.InstanceType)}
 	}
-
-	// split query
-	if qIdx := strings.Index(raw, "?"); qIdx != -1 {
-		queryPart = raw[qIdx+1:]
-		raw = raw[:qIdx]
-	}
-
-	// split path
-	if pIdx := strings.Index(raw, "/"); pIdx != -1 {
-		hostPart = raw[:pIdx]
-		pathPart = raw[pIdx+1:]
-	} else {
-		hostPart = raw
-	}
-
-	// hostPart => tunnel address:port
-	if hostPart != "" {
-		if strings.Contains(hostPart, ":") {
-			parts := strings.SplitN(hostPart, ":", 2)
-			res.TunnelAddress = parts[0]
-			res.TunnelPort = parts[1]
-		} else {
-			// 只有端口或地址
-			if _, err := strconv.Atoi(hostPart); err == nil {
-				res.TunnelPort = hostPart
-			} else {
-				res.TunnelAddress = hostPart
-			}
-		}
-	}
-
-	// pathPart => target address:port
-	if pathPart != "" {
-		if strings.Contains(pathPart, ":") {
-			parts := strings.SplitN(pathPart, ":", 2)
-			res.TargetAddress = parts[0]
-			res.TargetPort = parts[1]
-		} else {
-			if _, err := strconv.Atoi(pathPart); err == nil {
-				res.TargetPort = pathPart
-			} else {
-				res.TargetAddress = pathPart
-			}
-		}
+	u, err := nodepassurl.Parse(raw)
+	if err != nil {
+		log.Warnf("[Master-%d#SSE]Inst.%s实例URL解析失败: %v", e.EndpointID, e.InstanceID, err)
+		return &nodepassurl.URL{Mode: ptrString(e.InstanceType)}
 	}
+	return u
+}
 
-	// query params
-	if queryPart != "" {
-		for _, kv := range strings.Split(queryPart, "&") {
-			if kv == "" {
-				continue
-			}
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			key, val := parts[0], parts[1]
-			switch key {
-			case "tls":
-				if mode == "server" {
-					switch val {
-					case "0":
-						res.TLSMode = "mode0"
-					case "1":
-						res.TLSMode = "mode1"
-					case "2":
-						res.TLSMode = "mode2"
-					}
-				}
-			case "log":
-				res.LogLevel = strings.ToLower(val)
-			case "crt":
-				res.CertPath = val
-			case "key":
-				res.KeyPath = val
-			case "min":
-				res.Min = val
-			case "max":
-				res.Max = val
-			}
-		}
+// nullableInt 0 视为未设置，写入 NULL
+func nullableInt(v int) interface{} {
+	if v > 0 {
+		return v
 	}
-
-	return res
+	return nil
 }
 
 // ======================== 事件处理器 ============================
@@ -758,27 +643,34 @@ func (s *Service) handleInitialEvent(e models.EndpointSSE) {
 	if e.InstanceType == nil || *e.InstanceType == "" {
 		return
 	}
-	cfg := parseInstanceURL(ptrString(e.URL), *e.InstanceType)
-	if err := s.withTx(func(tx *sql.Tx) error { return s.tunnelCreate(tx, e, cfg) }); err != nil {
+	cfg := instanceConfig(e)
+	if err := s.withTx(func(tx *sql.Tx) error { return s.tunnelCreate(tx, e, cfg) }); err == nil {
+		s.publishEndpointState(e.EndpointID, EndpointStateReasonTunnels)
 	}
 }
 
 func (s *Service) handleCreateEvent(e models.EndpointSSE) {
-	cfg := parseInstanceURL(ptrString(e.URL), *e.InstanceType)
-	if err := s.withTx(func(tx *sql.Tx) error { return s.tunnelCreate(tx, e, cfg) }); err != nil {
+	cfg := instanceConfig(e)
+	if err := s.withTx(func(tx *sql.Tx) error { return s.tunnelCreate(tx, e, cfg) }); err == nil {
+		s.publishEndpointState(e.EndpointID, EndpointStateReasonTunnels)
 	}
 }
 
 func (s *Service) handleUpdateEvent(e models.EndpointSSE) {
+	var statusChanged bool
 	if err := s.withTx(func(tx *sql.Tx) error {
-		cfg := parseInstanceURL(ptrString(e.URL), ptrStringDefault(e.InstanceType, ""))
-		return s.tunnelUpdate(tx, e, cfg)
-	}); err != nil {
+		cfg := instanceConfig(e)
+		changed, err := s.tunnelUpdate(tx, e, cfg)
+		statusChanged = changed
+		return err
+	}); err == nil && statusChanged {
+		s.publishEndpointState(e.EndpointID, EndpointStateReasonTunnels)
 	}
 }
 
 func (s *Service) handleDeleteEvent(e models.EndpointSSE) {
-	if err := s.withTx(func(tx *sql.Tx) error { return s.tunnelDelete(tx, e.EndpointID, e.InstanceID) }); err != nil {
+	if err := s.withTx(func(tx *sql.Tx) error { return s.tunnelDelete(tx, e.EndpointID, e.InstanceID) }); err == nil {
+		s.publishEndpointState(e.EndpointID, EndpointStateReasonTunnels)
 	}
 }
 
@@ -797,7 +689,7 @@ func (s *Service) tunnelExists(tx *sql.Tx, endpointID int64, instanceID string)
 	return cnt > 0, nil
 }
 
-func (s *Service) tunnelCreate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL) error {
+func (s *Service) tunnelCreate(tx *sql.Tx, e models.EndpointSSE, cfg *nodepassurl.URL) error {
 	// 检查是否已存在相同 instanceID 的隧道
 	exists, err := s.tunnelExists(tx, e.EndpointID, e.InstanceID)
 	if err != nil {
@@ -823,38 +715,19 @@ func (s *Service) tunnelCreate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 
 	// 如果不存在，才创建新记录（使用 instanceID 作为默认名称）
 	name := e.InstanceID
-	if cfg.LogLevel == "" {
-		cfg.LogLevel = "inherit"
-	}
-	if e.InstanceType != nil && *e.InstanceType == "server" {
-		if cfg.TLSMode == "" {
-			cfg.TLSMode = "inherit"
-		}
-	}
 
 	_, err = tx.Exec(`INSERT INTO "Tunnel" (
 		instanceId, endpointId, name, mode,
 		status, tunnelAddress, tunnelPort, targetAddress, targetPort,
 		tlsMode, certPath, keyPath, logLevel, commandLine,
-		min, max,
+		min, max, extraParams,
 		tcpRx, tcpTx, udpRx, udpTx,
 		createdAt, updatedAt, lastEventTime
-	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 		e.InstanceID, e.EndpointID, name, ptrStringDefault(e.InstanceType, ""), ptrStringDefault(e.Status, "stopped"),
 		cfg.TunnelAddress, cfg.TunnelPort, cfg.TargetAddress, cfg.TargetPort,
-		cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, ptrString(e.URL),
-		func() interface{} {
-			if cfg.Min != "" {
-				return cfg.Min
-			}
-			return nil
-		}(),
-		func() interface{} {
-			if cfg.Max != "" {
-				return cfg.Max
-			}
-			return nil
-		}(),
+		cfg.TLSMode(), cfg.Crt, cfg.Key, cfg.LogLevel(), ptrString(e.URL),
+		nullableInt(cfg.Min), nullableInt(cfg.Max), nodepassurl.EncodeExtra(cfg.ExtraMap()),
 		e.TCPRx, e.TCPTx, e.UDPRx, e.UDPTx, time.Now(), time.Now(), e.EventTime,
 	)
 	if err != nil {
@@ -871,19 +744,21 @@ func (s *Service) tunnelCreate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 	return err
 }
 
-func (s *Service) tunnelUpdate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL) error {
-	var curStatus string
+// tunnelUpdate 更新隧道状态与流量，并同步主控侧的配置变更，返回隧道状态是否发生变化
+func (s *Service) tunnelUpdate(tx *sql.Tx, e models.EndpointSSE, cfg *nodepassurl.URL) (bool, error) {
+	var id int64
+	var name, curStatus, curCommandLine string
 	var curTCPRx, curTCPTx, curUDPRx, curUDPTx int64
 	var curEventTime sql.NullTime
 
-	err := tx.QueryRow(`SELECT status, tcpRx, tcpTx, udpRx, udpTx, lastEventTime FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`, e.EndpointID, e.InstanceID).
-		Scan(&curStatus, &curTCPRx, &curTCPTx, &curUDPRx, &curUDPTx, &curEventTime)
+	err := tx.QueryRow(`SELECT id, name, commandLine, status, tcpRx, tcpTx, udpRx, udpTx, lastEventTime FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`, e.EndpointID, e.InstanceID).
+		Scan(&id, &name, &curCommandLine, &curStatus, &curTCPRx, &curTCPTx, &curUDPRx, &curUDPTx, &curEventTime)
 	if err == sql.ErrNoRows {
 		log.Infof("[Master-%d#SSE]Inst.%s不存在，跳过更新", e.EndpointID, e.InstanceID)
-		return nil // 尚未创建对应记录，等待后续 create/initial
+		return false, nil // 尚未创建对应记录，等待后续 create/initial
 	}
 	if err != nil {
-		return err // 查询错误
+		return false, err // 查询错误
 	}
 
 	newStatus := ptrStringDefault(e.Status, curStatus)
@@ -891,24 +766,73 @@ func (s *Service) tunnelUpdate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 	statusChanged := newStatus != curStatus
 	trafficChanged := curTCPRx != e.TCPRx || curTCPTx != e.TCPTx || curUDPRx != e.UDPRx || curUDPTx != e.UDPTx
 
-	// 只有状态/流量变化且事件时间更新时才更新
-	if !statusChanged && !trafficChanged {
-		return nil
+	configChanged := externalConfigChanged(e, curCommandLine)
+
+	// 只有状态/流量/配置变化且事件时间更新时才更新
+	if !statusChanged && !trafficChanged && !configChanged {
+		return false, nil
 	}
 
 	if curEventTime.Valid && !e.EventTime.After(curEventTime.Time) {
 		log.Infof("[Master-%d#SSE]Inst.%s旧事件时间，跳过更新", e.EndpointID, e.InstanceID)
-		return nil
+		return false, nil
+	}
+
+	if configChanged {
+		if err := s.syncExternalConfig(tx, e, cfg, id, name); err != nil {
+			log.Errorf("[Master-%d#SSE]Inst.%s同步配置失败,err=%v", e.EndpointID, e.InstanceID, err)
+			return false, err
+		}
 	}
 
 	_, err = tx.Exec(`UPDATE "Tunnel" SET status = ?, tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ?, lastEventTime = ?, updatedAt = ? WHERE endpointId = ? AND instanceId = ?`,
 		newStatus, e.TCPRx, e.TCPTx, e.UDPRx, e.UDPTx, e.EventTime, time.Now(), e.EndpointID, e.InstanceID)
 	if err != nil {
 		log.Errorf("[Master-%d#SSE]Inst.%s更新隧道失败,err=%v", e.EndpointID, e.InstanceID, err)
-		return err
+		return false, err
 	}
 	log.Infof("[Master-%d#SSE]Inst.%s更新隧道成功", e.EndpointID, e.InstanceID)
-	return err
+	return statusChanged, nil
+}
+
+// externalConfigChanged 判断事件中的实例 URL 是否与本地命令行存在语义差异，URL 缺失或无法解析时视为未变化
+func externalConfigChanged(e models.EndpointSSE, commandLine string) bool {
+	raw := ptrString(e.URL)
+	if raw == "" {
+		return false
+	}
+	remote, err := nodepassurl.Parse(raw)
+	if err != nil {
+		return false
+	}
+	local, err := nodepassurl.Parse(commandLine)
+	return err != nil || !nodepassurl.Equal(local, remote)
+}
+
+// syncExternalConfig 将主控侧修改后的配置写入隧道记录，并记录 external 配置版本。
+// 本地刚保存过配置时跳过，此时事件携带的可能是尚未更新的旧命令行
+func (s *Service) syncExternalConfig(tx *sql.Tx, e models.EndpointSSE, cfg *nodepassurl.URL, id int64, name string) error {
+	recent, err := tunnel.RecentlyChanged(tx, id)
+	if err != nil || recent {
+		return err
+	}
+	commandLine := ptrString(e.URL)
+	if _, err := tx.Exec(`UPDATE "Tunnel" SET
+		tunnelAddress = ?, tunnelPort = ?, targetAddress = ?, targetPort = ?,
+		tlsMode = ?, certPath = ?, keyPath = ?, logLevel = ?, commandLine = ?,
+		min = ?, max = ?, extraParams = ?
+		WHERE id = ?`,
+		cfg.TunnelAddress, cfg.TunnelPort, cfg.TargetAddress, cfg.TargetPort,
+		cfg.TLSMode(), cfg.Crt, cfg.Key, cfg.LogLevel(), commandLine,
+		nullableInt(cfg.Min), nullableInt(cfg.Max), nodepassurl.EncodeExtra(cfg.ExtraMap()),
+		id); err != nil {
+		return err
+	}
+	if _, err := tunnel.RecordVersion(tx, id, name, commandLine, tunnel.VersionExternal, "master", "主控侧配置变更"); err != nil {
+		return err
+	}
+	log.Infof("[Master-%d#SSE]Inst.%s检测到主控侧配置变更，已同步", e.EndpointID, e.InstanceID)
+	return nil
 }
 
 func (s *Service) tunnelDelete(tx *sql.Tx, endpointID int64, instanceID string) error {
@@ -1011,7 +935,7 @@ func (s *Service) startBatchProcessor() {
 			s.addToBatch(event)
 		case <-s.batchTimer.C:
 			s.flushBatch()
-			s.batchTimer.Reset(200 * time.Millisecond) // 200ms 批处理间隔
+			s.batchTimer.Reset(s.batchInterval)
 		}
 	}
 }
@@ -1062,28 +986,88 @@ func (s *Service) flushBatchUnsafe() {
 
 // processBatchEvents 批量处理事件
 func (s *Service) processBatchEvents(events []models.EndpointSSE) error {
-	return s.withTx(func(tx *sql.Tx) error {
+	// 记录隧道数量/状态发生变化的端点，事务提交后统一发布
+	changedEndpoints := make(map[int64]struct{})
+	err := s.withTx(func(tx *sql.Tx) error {
 		for _, event := range events {
-			if err := s.processSingleEventInTx(tx, event); err != nil {
+			changed, err := s.processSingleEventInTx(tx, event)
+			if err != nil {
 				log.Warnf("[Master-%d#SSE]Inst.%s批量处理失败: %v", event.EndpointID, event.InstanceID, err)
 				// 继续处理其他事件，不中断整个批次
+				continue
+			}
+			if changed {
+				changedEndpoints[event.EndpointID] = struct{}{}
 			}
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	for endpointID := range changedEndpoints {
+		s.publishEndpointState(endpointID, EndpointStateReasonTunnels)
+	}
+	return nil
 }
 
-// processSingleEventInTx 在事务中处理单个事件
-func (s *Service) processSingleEventInTx(tx *sql.Tx, event models.EndpointSSE) error {
-	cfg := parseInstanceURL(ptrString(event.URL), ptrStringDefault(event.InstanceType, ""))
+// processSingleEventInTx 在事务中处理单个事件，返回端点隧道数量或状态是否可能发生变化
+func (s *Service) processSingleEventInTx(tx *sql.Tx, event models.EndpointSSE) (bool, error) {
+	cfg := instanceConfig(event)
 
 	switch event.EventType {
 	case models.SSEEventTypeInitial, models.SSEEventTypeCreate:
-		return s.tunnelCreate(tx, event, cfg)
+		return true, s.tunnelCreate(tx, event, cfg)
 	case models.SSEEventTypeUpdate:
 		return s.tunnelUpdate(tx, event, cfg)
 	case models.SSEEventTypeDelete:
-		return s.tunnelDelete(tx, event.EndpointID, event.InstanceID)
+		return true, s.tunnelDelete(tx, event.EndpointID, event.InstanceID)
 	}
-	return nil
+	return false, nil
+}
+
+// publishTraffic 将携带累计流量的事件发布到事件总线
+func (s *Service) publishTraffic(event models.EndpointSSE) {
+	switch event.EventType {
+	case models.SSEEventTypeInitial, models.SSEEventTypeCreate, models.SSEEventTypeUpdate:
+	default:
+		return
+	}
+	s.bus.Publish(eventbus.TopicTunnelTraffic, traffic.Sample{
+		EndpointID: event.EndpointID,
+		InstanceID: event.InstanceID,
+		Time:       event.EventTime,
+		TCPRx:      event.TCPRx,
+		TCPTx:      event.TCPTx,
+		UDPRx:      event.UDPRx,
+		UDPTx:      event.UDPTx,
+	})
+}
+
+// publishEndpointState 查询端点最新状态及隧道数量，并发布到事件总线
+func (s *Service) publishEndpointState(endpointID int64, reason string) {
+	if s.bus == nil || s.bus.SubscriberCount(eventbus.TopicEndpointState) == 0 {
+		return // 无订阅者时无需查询
+	}
+
+	state := EndpointState{
+		EndpointID: endpointID,
+		Reason:     reason,
+		Time:       time.Now(),
+	}
+	var status string
+	err := s.db.QueryRow(`SELECT e.status,
+		(SELECT COUNT(*) FROM "Tunnel" t WHERE t.endpointId = e.id),
+		(SELECT COUNT(*) FROM "Tunnel" t WHERE t.endpointId = e.id AND t.status = 'running')
+		FROM "Endpoint" e WHERE e.id = ?`, endpointID).Scan(&status, &state.TunnelCount, &state.ActiveTunnels)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Warnf("[Master-%d]查询端点状态失败,err=%v", endpointID, err)
+		}
+		return
+	}
+	state.Status = EndpointStatus(status)
+
+	s.bus.Publish(eventbus.TopicEndpointState, state)
 }
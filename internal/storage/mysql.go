@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlSource 将 mysql:// 形式的 URL 转换为驱动使用的 DSN
+func mysqlSource(dsn string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("解析 MySQL DSN 失败: %v", err)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = u.Host + ":3306"
+	}
+	dbName := trimSlash(u.Path)
+	if dbName == "" {
+		return "", fmt.Errorf("MySQL DSN 缺少数据库名")
+	}
+
+	// 先按驱动格式解析，保留 URL 中的其它驱动参数（charset、tls 等）
+	native := fmt.Sprintf("tcp(%s)/%s", addr, dbName)
+	if u.RawQuery != "" {
+		native += "?" + u.RawQuery
+	}
+	cfg, err := mysql.ParseDSN(native)
+	if err != nil {
+		return "", fmt.Errorf("解析 MySQL DSN 失败: %v", err)
+	}
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+	}
+
+	// 时间字段解析为 time.Time；UPDATE 返回匹配行数而非实际修改行数，
+	// 以便“先更新、无记录再插入”的写法在值未变化时也能正确判断
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.ClientFoundRows = true
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	// 双引号作为标识符引号，与 SQLite / PostgreSQL 写法保持一致
+	cfg.Params["sql_mode"] = "CONCAT(@@sql_mode, ',ANSI_QUOTES')"
+	return cfg.FormatDSN(), nil
+}
+
+// trimSlash 去除路径开头的斜杠
+func trimSlash(p string) string {
+	for len(p) > 0 && p[0] == '/' {
+		p = p[1:]
+	}
+	return p
+}
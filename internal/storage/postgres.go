@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresDriverName 包装后的 PostgreSQL 驱动名
+const postgresDriverName = "nodepass-postgres"
+
+func init() {
+	sql.Register(postgresDriverName, &pgDriver{})
+}
+
+// pgDriver 包装 lib/pq：
+//  1. 将 `?` 占位符转换为 `$n`
+//  2. 为 INSERT 语句追加 RETURNING id，以支持 Result.LastInsertId
+//     （因此 PostgreSQL 下所有表都必须包含 id 列）
+type pgDriver struct{}
+
+// Open 实现 driver.Driver
+func (d *pgDriver) Open(name string) (driver.Conn, error) {
+	conn, err := pq.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pgConn{conn: conn}, nil
+}
+
+// pgConn 包装后的连接
+type pgConn struct {
+	conn driver.Conn
+}
+
+// Prepare 实现 driver.Conn
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(Rebind(query))
+}
+
+// Close 实现 driver.Conn
+func (c *pgConn) Close() error {
+	return c.conn.Close()
+}
+
+// Begin 实现 driver.Conn
+func (c *pgConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx 实现 driver.ConnBeginTx
+func (c *pgConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+// Ping 实现 driver.Pinger
+func (c *pgConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession 实现 driver.SessionResetter
+func (c *pgConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// QueryContext 实现 driver.QueryerContext
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return q.QueryContext(ctx, Rebind(query), args)
+}
+
+// ExecContext 实现 driver.ExecerContext
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query = Rebind(query)
+
+	if isInsert(query) {
+		q, ok := c.conn.(driver.QueryerContext)
+		if !ok {
+			return nil, driver.ErrSkip
+		}
+		rows, err := q.QueryContext(ctx, query+" RETURNING id", args)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		res := &pgResult{}
+		dest := make([]driver.Value, len(rows.Columns()))
+		for {
+			if err := rows.Next(dest); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+			if res.affected == 0 && len(dest) > 0 {
+				if id, ok := dest[0].(int64); ok {
+					res.lastID = id
+				}
+			}
+			res.affected++
+		}
+		return res, nil
+	}
+
+	e, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+// pgResult INSERT ... RETURNING id 的执行结果
+type pgResult struct {
+	lastID   int64
+	affected int64
+}
+
+// LastInsertId 实现 driver.Result
+func (r *pgResult) LastInsertId() (int64, error) { return r.lastID, nil }
+
+// RowsAffected 实现 driver.Result
+func (r *pgResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// isInsert 判断是否为需要追加 RETURNING id 的 INSERT 语句
+func isInsert(query string) bool {
+	upper := strings.ToUpper(query)
+	return strings.HasPrefix(strings.TrimSpace(upper), "INSERT") && !strings.Contains(upper, "RETURNING")
+}
+
+// Rebind 将 `?` 占位符转换为 `$1, $2 ...`，忽略字符串与标识符中的问号，并去除末尾分号
+func Rebind(query string) string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+)
+
+// sqliteDefaults SQLite 连接的默认参数，键为参数名及其别名。
+// 外键约束默认关闭，不开启时迁移中声明的 ON DELETE CASCADE 不会生效
+var sqliteDefaults = []struct {
+	names []string
+	value string
+}{
+	{[]string{"_fk", "_foreign_keys"}, "1"},
+	{[]string{"_journal_mode", "_journal"}, "WAL"},
+	{[]string{"_busy_timeout", "_timeout"}, "5000"},
+}
+
+// sqliteSource 为 SQLite DSN 补充未显式指定的默认参数
+func sqliteSource(source string) string {
+	if source == "" || source == ":memory:" {
+		return source
+	}
+	path, rawQuery := source, ""
+	if i := strings.Index(source, "?"); i >= 0 {
+		path, rawQuery = source[:i], source[i+1:]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// 参数无法解析时原样交给驱动报错
+		return source
+	}
+
+	var extra []string
+	for _, d := range sqliteDefaults {
+		set := false
+		for _, name := range d.names {
+			set = set || query.Has(name)
+		}
+		if !set {
+			extra = append(extra, d.names[0]+"="+d.value)
+		}
+	}
+	if len(extra) == 0 {
+		return source
+	}
+	if rawQuery != "" {
+		extra = append([]string{rawQuery}, extra...)
+	}
+	return path + "?" + strings.Join(extra, "&")
+}
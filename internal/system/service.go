@@ -0,0 +1,135 @@
+package system
+
+import (
+	"database/sql"
+	"fmt"
+
+	"NodePassDash/internal/storage"
+)
+
+// TableStat 单表统计
+type TableStat struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// DatabaseStatus 数据库状态
+type DatabaseStatus struct {
+	Dialect   string `json:"dialect"`
+	SizeBytes int64  `json:"sizeBytes"`
+	FreeBytes int64  `json:"freeBytes"` // 可回收的空闲空间
+
+	// 以下字段仅 SQLite 有效
+	PageSize      int64  `json:"pageSize,omitempty"`
+	PageCount     int64  `json:"pageCount,omitempty"`
+	FreelistCount int64  `json:"freelistCount,omitempty"`
+	AutoVacuum    string `json:"autoVacuum,omitempty"`
+
+	Tables []TableStat `json:"tables"`
+}
+
+// Service 系统状态服务
+type Service struct {
+	db      *sql.DB
+	dialect storage.Dialect
+}
+
+// NewService 创建系统状态服务实例
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db, dialect: storage.DialectOf(db)}
+}
+
+// DB 返回底层 *sql.DB
+func (s *Service) DB() *sql.DB {
+	return s.db
+}
+
+// GetDatabaseStatus 获取数据库大小及各表行数
+func (s *Service) GetDatabaseStatus() (*DatabaseStatus, error) {
+	st := &DatabaseStatus{Dialect: string(s.dialect)}
+
+	var err error
+	switch s.dialect {
+	case storage.Postgres:
+		err = s.db.QueryRow(`SELECT pg_database_size(current_database())`).Scan(&st.SizeBytes)
+	case storage.MySQL:
+		err = s.db.QueryRow(`SELECT COALESCE(SUM(data_length + index_length), 0), COALESCE(SUM(data_free), 0)
+			FROM information_schema.tables WHERE table_schema = DATABASE()`).Scan(&st.SizeBytes, &st.FreeBytes)
+	default:
+		err = s.sqliteSize(st)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.tableNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		var rows int64
+		if err := s.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s`, s.dialect.QuoteTable(name))).Scan(&rows); err != nil {
+			return nil, err
+		}
+		st.Tables = append(st.Tables, TableStat{Name: name, Rows: rows})
+	}
+	return st, nil
+}
+
+// sqliteSize 通过 PRAGMA 计算 SQLite 数据库文件大小
+func (s *Service) sqliteSize(st *DatabaseStatus) error {
+	if err := s.db.QueryRow(`PRAGMA page_size`).Scan(&st.PageSize); err != nil {
+		return err
+	}
+	if err := s.db.QueryRow(`PRAGMA page_count`).Scan(&st.PageCount); err != nil {
+		return err
+	}
+	if err := s.db.QueryRow(`PRAGMA freelist_count`).Scan(&st.FreelistCount); err != nil {
+		return err
+	}
+	var autoVacuum int
+	if err := s.db.QueryRow(`PRAGMA auto_vacuum`).Scan(&autoVacuum); err == nil {
+		switch autoVacuum {
+		case 1:
+			st.AutoVacuum = "full"
+		case 2:
+			st.AutoVacuum = "incremental"
+		default:
+			st.AutoVacuum = "none"
+		}
+	}
+	st.SizeBytes = st.PageSize * st.PageCount
+	st.FreeBytes = st.PageSize * st.FreelistCount
+	return nil
+}
+
+// tableNames 获取所有用户表名
+func (s *Service) tableNames() ([]string, error) {
+	var query string
+	switch s.dialect {
+	case storage.Postgres:
+		query = `SELECT table_name FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`
+	case storage.MySQL:
+		query = `SELECT table_name FROM information_schema.tables
+			WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name`
+	default:
+		query = `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`
+	}
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
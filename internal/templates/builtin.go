@@ -0,0 +1,109 @@
+package templates
+
+// 内置模板名称
+const (
+	BuiltinSingle   = "single"
+	BuiltinBothway  = "bothway"
+	BuiltinIntranet = "intranet"
+)
+
+// serverSideParams 双端 / 内网穿透模板中 server 端的公共参数
+func serverSideParams(serverLabel, clientLabel string) []Param {
+	return []Param{
+		{Name: "server", Type: ParamEndpoint, Label: serverLabel, Required: true},
+		{Name: "client", Type: ParamEndpoint, Label: clientLabel, Required: true},
+		{Name: "listenPort", Type: ParamPort, Label: "隧道端口", Required: true},
+		{Name: "serverTargetPort", Type: ParamPort, Label: "入口端口", Required: true},
+		{Name: "tls", Type: ParamTLS, Label: "TLS 模式", Default: "inherit"},
+		{Name: "certPath", Type: ParamString, Label: "证书路径", Description: "仅 mode2 使用"},
+		{Name: "keyPath", Type: ParamString, Label: "私钥路径", Description: "仅 mode2 使用"},
+		{Name: "logLevel", Type: ParamLogLevel, Label: "日志级别", Default: "inherit"},
+	}
+}
+
+// serverSideTunnel server 端隧道定义
+func serverSideTunnel(name string) TunnelDef {
+	return TunnelDef{
+		Key:        "server",
+		Name:       name,
+		Endpoint:   "{{server}}",
+		Mode:       "server",
+		TunnelPort: "{{listenPort}}",
+		TargetPort: "{{serverTargetPort}}",
+		TLSMode:    "{{tls}}",
+		CertPath:   "{{certPath}}",
+		KeyPath:    "{{keyPath}}",
+		LogLevel:   "{{logLevel}}",
+	}
+}
+
+// builtinTemplates 内置模板，启动时写入数据库（同名时覆盖定义）
+func builtinTemplates() []Template {
+	return []Template{
+		{
+			Name:        BuiltinSingle,
+			Description: "单端转发：中转主控监听端口并转发到目标地址",
+			Params: []Param{
+				{Name: "entry", Type: ParamEndpoint, Label: "中转主控", Required: true},
+				{Name: "listenPort", Type: ParamPort, Label: "监听端口", Required: true},
+				{Name: "targetHost", Type: ParamHost, Label: "目标地址", Required: true},
+				{Name: "targetPort", Type: ParamPort, Label: "目标端口", Required: true},
+				{Name: "logLevel", Type: ParamLogLevel, Label: "日志级别", Default: "inherit"},
+			},
+			Tunnels: []TunnelDef{
+				{
+					Key:           "client",
+					Name:          "template-single-{{entry}}-{{ts}}",
+					Endpoint:      "{{entry}}",
+					Mode:          "client",
+					TunnelPort:    "{{listenPort}}",
+					TargetAddress: "{{targetHost}}",
+					TargetPort:    "{{targetPort}}",
+					LogLevel:      "{{logLevel}}",
+				},
+			},
+		},
+		{
+			Name:        BuiltinBothway,
+			Description: "双端转发：入口主控运行 server，出口主控运行 client 连接入口主控",
+			Params: append(serverSideParams("入口主控", "出口主控"),
+				Param{Name: "clientTargetPort", Type: ParamPort, Label: "出口目标端口", Required: true},
+			),
+			Tunnels: []TunnelDef{
+				serverSideTunnel("template-server-{{server}}-{{ts}}"),
+				{
+					Key:           "client",
+					Name:          "template-client-{{client}}-{{ts}}",
+					Endpoint:      "{{client}}",
+					Mode:          "client",
+					TunnelAddress: "{{host:server}}",
+					TunnelPort:    "{{listenPort}}",
+					TargetPort:    "{{clientTargetPort}}",
+					LogLevel:      "{{logLevel}}",
+				},
+			},
+		},
+		{
+			Name:        BuiltinIntranet,
+			Description: "内网穿透：中转主控提供外部入口，内网主控运行 client 并转发到内网服务",
+			Params: append(serverSideParams("中转主控", "内网主控"),
+				Param{Name: "targetHost", Type: ParamHost, Label: "内网服务地址", Required: true},
+				Param{Name: "targetPort", Type: ParamPort, Label: "内网服务端口", Required: true},
+			),
+			Tunnels: []TunnelDef{
+				serverSideTunnel("template-intranet-server-{{server}}-{{ts}}"),
+				{
+					Key:           "client",
+					Name:          "template-intranet-client-{{client}}-{{ts}}",
+					Endpoint:      "{{client}}",
+					Mode:          "client",
+					TunnelAddress: "{{host:server}}",
+					TunnelPort:    "{{listenPort}}",
+					TargetAddress: "{{targetHost}}",
+					TargetPort:    "{{targetPort}}",
+					LogLevel:      "{{logLevel}}",
+				},
+			},
+		},
+	}
+}
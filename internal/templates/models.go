@@ -0,0 +1,296 @@
+// Package templates 可复用的参数化隧道模板：模板声明带类型、默认值与校验规则的参数，
+// 以及一条或多条隧道定义；实例化时按参数渲染为创建隧道请求，可跨多个主控。
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/nodepassurl"
+)
+
+// 参数类型
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamPort     = "port"
+	ParamHost     = "host"
+	ParamEndpoint = "endpoint" // 主控 ID 或名称
+	ParamTLS      = "tls"      // inherit / mode0 / mode1 / mode2
+	ParamLogLevel = "loglevel" // inherit / debug / info / warn / error
+)
+
+// AutoPort port 类型参数取值为 auto 时，在以该参数作为隧道端口、且在本地监听的隧道所在主控上自动分配可用端口
+const AutoPort = "auto"
+
+// Param 模板参数
+type Param struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Label       string `json:"label,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+	// Min / Max int 与 port 类型的取值范围
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+	// Pattern string 与 host 类型的正则校验
+	Pattern string `json:"pattern,omitempty"`
+	// Enum 可选值列表
+	Enum []string `json:"enum,omitempty"`
+}
+
+// TunnelDef 模板中的一条隧道。字符串字段中可以使用：
+//
+//	{{参数名}}         参数值（endpoint 类型为主控 ID）
+//	{{host:参数名}}    endpoint 类型参数对应主控的地址
+//	{{ts}}             实例化时的 Unix 时间戳
+//	{{template}}       模板名称
+type TunnelDef struct {
+	// Key 隧道在模板内的标识，如 server / client
+	Key string `json:"key"`
+	// Name 隧道名称模板
+	Name          string            `json:"name"`
+	Endpoint      string            `json:"endpoint"`
+	Mode          string            `json:"mode"`
+	TunnelAddress string            `json:"tunnelAddress,omitempty"`
+	TunnelPort    string            `json:"tunnelPort"`
+	TargetAddress string            `json:"targetAddress,omitempty"`
+	TargetPort    string            `json:"targetPort"`
+	TLSMode       string            `json:"tlsMode,omitempty"`
+	CertPath      string            `json:"certPath,omitempty"`
+	KeyPath       string            `json:"keyPath,omitempty"`
+	LogLevel      string            `json:"logLevel,omitempty"`
+	Min           string            `json:"min,omitempty"`
+	Max           string            `json:"max,omitempty"`
+	ExtraParams   map[string]string `json:"extraParams,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// Template 隧道模板
+type Template struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Builtin     bool        `json:"builtin"`
+	Params      []Param     `json:"params"`
+	Tunnels     []TunnelDef `json:"tunnels"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+}
+
+// definition 数据库中 definition 列保存的内容
+type definition struct {
+	Params  []Param     `json:"params"`
+	Tunnels []TunnelDef `json:"tunnels"`
+}
+
+// 内置变量，不能作为参数名
+var builtinVars = map[string]bool{"ts": true, "template": true}
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// placeholderPattern 匹配 {{name}} 与 {{host:name}}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(?:(host)\s*:\s*)?([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Validate 校验模板定义：参数声明、默认值以及隧道定义中的引用
+func (t *Template) Validate() error {
+	var errs []string
+	if strings.TrimSpace(t.Name) == "" {
+		errs = append(errs, "缺少模板名称")
+	}
+
+	params := make(map[string]Param, len(t.Params))
+	for i, p := range t.Params {
+		where := fmt.Sprintf("params[%d]", i)
+		if p.Name != "" {
+			where = "参数 " + p.Name
+		}
+		switch {
+		case !paramNamePattern.MatchString(p.Name):
+			errs = append(errs, where+": 名称无效")
+			continue
+		case builtinVars[p.Name]:
+			errs = append(errs, where+": 与内置变量重名")
+			continue
+		case params[p.Name].Name != "":
+			errs = append(errs, where+": 重复声明")
+			continue
+		}
+		if err := p.validateDecl(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", where, err))
+			continue
+		}
+		params[p.Name] = p
+	}
+
+	if len(t.Tunnels) == 0 {
+		errs = append(errs, "至少需要一条隧道定义")
+	}
+	keys := make(map[string]bool, len(t.Tunnels))
+	for i, d := range t.Tunnels {
+		where := fmt.Sprintf("tunnels[%d]", i)
+		if d.Key != "" {
+			where = "隧道 " + d.Key
+		}
+		if strings.TrimSpace(d.Key) == "" {
+			errs = append(errs, where+": 缺少 key")
+		} else if keys[d.Key] {
+			errs = append(errs, where+": key 重复")
+		}
+		keys[d.Key] = true
+		if strings.TrimSpace(d.Name) == "" || strings.TrimSpace(d.Endpoint) == "" || strings.TrimSpace(d.Mode) == "" {
+			errs = append(errs, where+": name、endpoint、mode 不能为空")
+		}
+		for _, ref := range d.references() {
+			p, ok := params[ref.name]
+			switch {
+			case builtinVars[ref.name] && !ref.host:
+			case !ok:
+				errs = append(errs, fmt.Sprintf("%s: 引用了未声明的参数 %s", where, ref.name))
+			case ref.host && p.Type != ParamEndpoint:
+				errs = append(errs, fmt.Sprintf("%s: host:%s 只能引用 endpoint 类型的参数", where, ref.name))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateDecl 校验参数声明本身
+func (p Param) validateDecl() error {
+	switch p.Type {
+	case ParamString, ParamInt, ParamPort, ParamHost, ParamEndpoint, ParamTLS, ParamLogLevel:
+	default:
+		return fmt.Errorf("不支持的参数类型 %q", p.Type)
+	}
+	if p.Pattern != "" {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("正则无效: %v", err)
+		}
+	}
+	if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+		return errors.New("min 不能大于 max")
+	}
+	if p.Default != "" && p.Type != ParamEndpoint && !p.isAuto(p.Default) {
+		if _, err := p.normalize(p.Default); err != nil {
+			return fmt.Errorf("默认值无效: %v", err)
+		}
+	}
+	return nil
+}
+
+// isAuto 判断参数值是否要求自动分配端口
+func (p Param) isAuto(v string) bool {
+	return p.Type == ParamPort && strings.EqualFold(strings.TrimSpace(v), AutoPort)
+}
+
+type reference struct {
+	name string
+	host bool
+}
+
+// references 返回隧道定义中引用的参数
+func (d TunnelDef) references() []reference {
+	fields := []string{
+		d.Name, d.Endpoint, d.Mode, d.TunnelAddress, d.TunnelPort, d.TargetAddress, d.TargetPort,
+		d.TLSMode, d.CertPath, d.KeyPath, d.LogLevel, d.Min, d.Max,
+	}
+	for _, v := range d.ExtraParams {
+		fields = append(fields, v)
+	}
+	for _, v := range d.Labels {
+		fields = append(fields, v)
+	}
+
+	var refs []reference
+	for _, f := range fields {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(f, -1) {
+			refs = append(refs, reference{name: m[2], host: m[1] != ""})
+		}
+	}
+	return refs
+}
+
+// hostPattern 主机名或 IP（IPv6 可带方括号）
+var hostPattern = regexp.MustCompile(`^(\[[0-9A-Fa-f:.]+\]|[0-9A-Fa-f:.]+|[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?)$`)
+
+// normalize 校验并规范化参数值（不含 endpoint 类型的存在性检查）
+func (p Param) normalize(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if len(p.Enum) > 0 && !contains(p.Enum, v) {
+		return "", fmt.Errorf("取值必须是 %s 之一", strings.Join(p.Enum, ", "))
+	}
+
+	switch p.Type {
+	case ParamInt, ParamPort:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "", errors.New("必须是整数")
+		}
+		if p.Type == ParamPort && (n < 1 || n > 65535) {
+			return "", errors.New("端口范围为 1-65535")
+		}
+		if p.Min != nil && n < *p.Min {
+			return "", fmt.Errorf("不能小于 %d", *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return "", fmt.Errorf("不能大于 %d", *p.Max)
+		}
+	case ParamHost:
+		if !hostPattern.MatchString(v) {
+			return "", errors.New("主机地址无效")
+		}
+	case ParamTLS:
+		switch v {
+		case "", "inherit":
+			v = "inherit"
+		case "0", "1", "2":
+			v = "mode" + v
+		case "mode0", "mode1", "mode2":
+		default:
+			return "", errors.New("TLS 模式必须是 inherit、mode0、mode1 或 mode2")
+		}
+	case ParamLogLevel:
+		v = strings.ToLower(v)
+		switch v {
+		case "":
+			v = "inherit"
+		case "inherit", "debug", "info", "warn", "error":
+		default:
+			return "", errors.New("日志级别必须是 inherit、debug、info、warn 或 error")
+		}
+	}
+
+	if p.Pattern != "" && (p.Type == ParamString || p.Type == ParamHost) {
+		if !regexp.MustCompile(p.Pattern).MatchString(v) {
+			return "", fmt.Errorf("不符合格式 %s", p.Pattern)
+		}
+	}
+	return v, nil
+}
+
+// validateRendered 校验渲染后的标签与实例参数
+func validateRendered(extra map[string]string, set labels.Set) error {
+	if err := nodepassurl.ValidateExtra(extra); err != nil {
+		return err
+	}
+	return set.Validate()
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
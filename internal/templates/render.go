@@ -0,0 +1,236 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/tunnel"
+)
+
+// Rendered 模板渲染出的一条隧道
+type Rendered struct {
+	Key         string                     `json:"key"`
+	Request     tunnel.CreateTunnelRequest `json:"request"`
+	CommandLine string                     `json:"commandLine"`
+}
+
+// endpointResolver 按 ID 或名称查找主控，返回主控 ID 与地址
+type endpointResolver func(value string) (id int64, host string, err error)
+
+// portAllocator 分配在所有 endpointIDs 上均可用的端口，from 为起始端口（0 表示按允许范围）
+type portAllocator func(endpointIDs []int64, from int) (int, error)
+
+// render 按参数值渲染模板，未提供的参数使用默认值
+func (t *Template) render(values map[string]string, resolve endpointResolver, alloc portAllocator, now time.Time) ([]Rendered, error) {
+	vars := map[string]string{
+		"ts":       strconv.FormatInt(now.Unix(), 10),
+		"template": t.Name,
+	}
+	hosts := make(map[string]string)
+
+	var errs []string
+	var autos []Param
+	declared := make(map[string]bool, len(t.Params))
+	for _, p := range t.Params {
+		declared[p.Name] = true
+		raw := strings.TrimSpace(values[p.Name])
+		if raw == "" {
+			raw = p.Default
+		}
+		if raw == "" && p.Type != ParamTLS && p.Type != ParamLogLevel {
+			if p.Required {
+				errs = append(errs, fmt.Sprintf("参数 %s: 必填", p.Name))
+			}
+			vars[p.Name] = ""
+			continue
+		}
+
+		if p.Type == ParamEndpoint {
+			id, host, err := resolve(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("参数 %s: %v", p.Name, err))
+				continue
+			}
+			vars[p.Name] = strconv.FormatInt(id, 10)
+			hosts[p.Name] = host
+			continue
+		}
+		if p.isAuto(raw) {
+			autos = append(autos, p)
+			continue
+		}
+		v, err := p.normalize(raw)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("参数 %s: %v", p.Name, err))
+			continue
+		}
+		vars[p.Name] = v
+	}
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		errs = append(errs, "未声明的参数: "+strings.Join(unknown, ", "))
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+
+	sub := func(s string) string {
+		return placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+			sm := placeholderPattern.FindStringSubmatch(m)
+			if sm[1] != "" {
+				return hosts[sm[2]]
+			}
+			return vars[sm[2]]
+		})
+	}
+
+	for _, p := range autos {
+		port, err := t.allocPort(p, sub, resolve, alloc)
+		if err != nil {
+			return nil, fmt.Errorf("参数 %s: %v", p.Name, err)
+		}
+		vars[p.Name] = strconv.Itoa(port)
+	}
+
+	out := make([]Rendered, 0, len(t.Tunnels))
+	names := make(map[string]string)
+	for _, d := range t.Tunnels {
+		req, err := d.request(sub, resolve)
+		if err == nil {
+			if other, ok := names[req.Name]; ok {
+				err = fmt.Errorf("名称 %s 与隧道 %s 重复", req.Name, other)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("隧道 %s: %v", d.Key, err))
+			continue
+		}
+		names[req.Name] = d.Key
+		out = append(out, Rendered{Key: d.Key, Request: req, CommandLine: req.CommandURL().String()})
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+// allocPort 为取值 auto 的端口参数分配端口：参数需直接作为隧道端口，且至少有一条隧道在本地监听；
+// 多条隧道监听时端口需在各自主控上均可用
+func (t *Template) allocPort(p Param, sub func(string) string, resolve endpointResolver, alloc portAllocator) (int, error) {
+	var endpoints []int64
+	for _, d := range t.Tunnels {
+		m := placeholderPattern.FindStringSubmatch(strings.TrimSpace(d.TunnelPort))
+		if m == nil || m[0] != strings.TrimSpace(d.TunnelPort) || m[1] != "" || m[2] != p.Name {
+			continue
+		}
+		if !tunnel.ListensLocally(tunnel.TunnelMode(sub(d.Mode)), sub(d.TunnelAddress)) {
+			continue
+		}
+		id, _, err := resolve(sub(d.Endpoint))
+		if err != nil {
+			return 0, err
+		}
+		endpoints = append(endpoints, id)
+	}
+	if len(endpoints) == 0 {
+		return 0, errors.New("没有以该参数作为监听端口的隧道，无法自动分配")
+	}
+	from := 0
+	if p.Min != nil {
+		from = *p.Min
+	}
+	port, err := alloc(endpoints, from)
+	if err != nil {
+		return 0, err
+	}
+	if p.Max != nil && port > *p.Max {
+		return 0, fmt.Errorf("%d-%d 内没有可用端口", from, *p.Max)
+	}
+	return port, nil
+}
+
+// request 渲染为创建隧道请求
+func (d TunnelDef) request(sub func(string) string, resolve endpointResolver) (tunnel.CreateTunnelRequest, error) {
+	req := tunnel.CreateTunnelRequest{
+		Name:          strings.TrimSpace(sub(d.Name)),
+		Mode:          sub(d.Mode),
+		TunnelAddress: sub(d.TunnelAddress),
+		TargetAddress: sub(d.TargetAddress),
+		TLSMode:       tunnel.TLSMode(sub(d.TLSMode)),
+		CertPath:      sub(d.CertPath),
+		KeyPath:       sub(d.KeyPath),
+		LogLevel:      tunnel.LogLevel(sub(d.LogLevel)),
+	}
+	if req.Name == "" {
+		return req, errors.New("名称为空")
+	}
+	if req.Mode != string(tunnel.ModeServer) && req.Mode != string(tunnel.ModeClient) {
+		return req, fmt.Errorf("模式无效: %q", req.Mode)
+	}
+	if req.TLSMode == "" {
+		req.TLSMode = tunnel.TLSModeInherit
+	}
+	if req.LogLevel == "" {
+		req.LogLevel = tunnel.LogLevelInherit
+	}
+
+	id, _, err := resolve(sub(d.Endpoint))
+	if err != nil {
+		return req, err
+	}
+	req.EndpointID = id
+
+	ints := []struct {
+		name     string
+		value    string
+		dst      *int
+		required bool
+	}{
+		{"tunnelPort", d.TunnelPort, &req.TunnelPort, true},
+		{"targetPort", d.TargetPort, &req.TargetPort, true},
+		{"min", d.Min, &req.Min, false},
+		{"max", d.Max, &req.Max, false},
+	}
+	for _, f := range ints {
+		v := strings.TrimSpace(sub(f.value))
+		if v == "" {
+			if f.required {
+				return req, fmt.Errorf("%s 为空", f.name)
+			}
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return req, fmt.Errorf("%s 不是整数: %q", f.name, v)
+		}
+		*f.dst = n
+	}
+
+	if len(d.ExtraParams) > 0 {
+		req.ExtraParams = make(map[string]string, len(d.ExtraParams))
+		for k, v := range d.ExtraParams {
+			req.ExtraParams[k] = sub(v)
+		}
+	}
+	if len(d.Labels) > 0 {
+		req.Labels = make(labels.Set, len(d.Labels))
+		for k, v := range d.Labels {
+			req.Labels[k] = sub(v)
+		}
+	}
+	if err := validateRendered(req.ExtraParams, req.Labels); err != nil {
+		return req, err
+	}
+	return req, req.CommandURL().Validate()
+}
@@ -0,0 +1,404 @@
+package templates
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/tunnel"
+)
+
+// 模板错误
+var (
+	ErrNotFound = errors.New("模板不存在")
+	ErrBuiltin  = errors.New("内置模板不可修改或删除")
+)
+
+// Service 隧道模板服务
+type Service struct {
+	db      *sql.DB
+	tunnels *tunnel.Service
+}
+
+// NewService 创建隧道模板服务
+func NewService(db *sql.DB, tunnels *tunnel.Service) *Service {
+	return &Service{db: db, tunnels: tunnels}
+}
+
+// EnsureBuiltins 写入内置模板，已存在时以当前版本的定义覆盖
+func (s *Service) EnsureBuiltins() error {
+	for _, t := range builtinTemplates() {
+		def, err := encodeDefinition(&t)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		res, err := s.db.Exec(`UPDATE "TunnelTemplate" SET description = ?, definition = ?, builtin = ?, updatedAt = ? WHERE name = ?`,
+			t.Description, def, true, now, t.Name)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			continue
+		}
+		if _, err := s.db.Exec(`INSERT INTO "TunnelTemplate" (name, description, builtin, definition, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)`,
+			t.Name, t.Description, true, def, now, now); err != nil {
+			return err
+		}
+		log.Infof("[Template] 已写入内置模板 %s", t.Name)
+	}
+	return nil
+}
+
+// List 返回所有模板（内置模板在前）
+func (s *Service) List() ([]Template, error) {
+	rows, err := s.db.Query(`SELECT id, name, description, builtin, definition, createdAt, updatedAt FROM "TunnelTemplate" ORDER BY builtin DESC, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Template
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// Get 按 ID 获取模板
+func (s *Service) Get(id int64) (*Template, error) {
+	return s.getBy("id = ?", id)
+}
+
+// GetByName 按名称获取模板
+func (s *Service) GetByName(name string) (*Template, error) {
+	return s.getBy("name = ?", name)
+}
+
+func (s *Service) getBy(cond string, arg interface{}) (*Template, error) {
+	row := s.db.QueryRow(`SELECT id, name, description, builtin, definition, createdAt, updatedAt FROM "TunnelTemplate" WHERE `+cond, arg)
+	t, err := scanTemplate(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+// Create 创建模板
+func (s *Service) Create(t Template) (*Template, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(t.Name, 0); err != nil {
+		return nil, err
+	}
+	def, err := encodeDefinition(&t)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if _, err := s.db.Exec(`INSERT INTO "TunnelTemplate" (name, description, builtin, definition, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)`,
+		t.Name, t.Description, false, def, now, now); err != nil {
+		return nil, err
+	}
+	log.Infof("[Template] 创建模板 %s", t.Name)
+	return s.GetByName(t.Name)
+}
+
+// Update 更新模板（内置模板不可修改）
+func (s *Service) Update(id int64, t Template) (*Template, error) {
+	current, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Builtin {
+		return nil, ErrBuiltin
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(t.Name, id); err != nil {
+		return nil, err
+	}
+	def, err := encodeDefinition(&t)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Exec(`UPDATE "TunnelTemplate" SET name = ?, description = ?, definition = ?, updatedAt = ? WHERE id = ?`,
+		t.Name, t.Description, def, time.Now(), id); err != nil {
+		return nil, err
+	}
+	log.Infof("[Template] 更新模板 %s", t.Name)
+	return s.Get(id)
+}
+
+// Delete 删除模板（内置模板不可删除）
+func (s *Service) Delete(id int64) error {
+	current, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if current.Builtin {
+		return ErrBuiltin
+	}
+	if _, err := s.db.Exec(`DELETE FROM "TunnelTemplate" WHERE id = ?`, id); err != nil {
+		return err
+	}
+	log.Infof("[Template] 删除模板 %s", current.Name)
+	return nil
+}
+
+// checkName 检查模板名称是否被其它模板占用
+func (s *Service) checkName(name string, exceptID int64) error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "TunnelTemplate" WHERE name = ? AND id <> ?`, name, exceptID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("模板名称已存在")
+	}
+	return nil
+}
+
+// Render 按参数渲染模板，不创建隧道
+func (s *Service) Render(t *Template, values map[string]string) ([]Rendered, error) {
+	return t.render(values, s.resolveEndpoint(), s.portAllocator(), time.Now())
+}
+
+// TunnelValidation 模板中单条隧道的预检结果
+type TunnelValidation struct {
+	Key string `json:"key"`
+	*tunnel.Validation
+}
+
+// Validation 模板预检结果，渲染失败时 Errors 记录在 params 字段下
+type Validation struct {
+	Valid   bool                `json:"valid"`
+	Errors  []tunnel.FieldIssue `json:"errors"`
+	Tunnels []TunnelValidation  `json:"tunnels"`
+}
+
+// Validate 渲染模板并预检其中每条隧道，不创建隧道
+func (s *Service) Validate(t *Template, values map[string]string) (*Validation, error) {
+	out := &Validation{Errors: []tunnel.FieldIssue{}, Tunnels: []TunnelValidation{}}
+	rendered, err := s.Render(t, values)
+	if err != nil {
+		out.Errors = append(out.Errors, tunnel.FieldIssue{Field: "params", Message: err.Error()})
+		return out, nil
+	}
+	reqs := make([]tunnel.CreateTunnelRequest, len(rendered))
+	for i, r := range rendered {
+		reqs[i] = r.Request
+	}
+	results, err := s.tunnels.ValidateBatch(reqs)
+	if err != nil {
+		return nil, err
+	}
+	out.Valid = true
+	for i, v := range results {
+		out.Tunnels = append(out.Tunnels, TunnelValidation{Key: rendered[i].Key, Validation: v})
+		out.Valid = out.Valid && v.Valid
+	}
+	return out, nil
+}
+
+// InstanceResult 实例化结果中的单条隧道
+type InstanceResult struct {
+	Key        string `json:"key"`
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	EndpointID int64  `json:"endpointId"`
+	InstanceID string `json:"instanceId,omitempty"`
+}
+
+// Instance 模板实例化结果
+type Instance struct {
+	Tunnels []InstanceResult `json:"tunnels"`
+	// Pair 模板恰好生成一条 server 与一条 client 隧道时自动关联的隧道对
+	Pair *tunnel.Pair `json:"pair,omitempty"`
+}
+
+// Instantiate 渲染模板并以 saga 方式创建隧道：任一步失败时删除此前已在主控上创建的实例。
+// 模板恰好包含一条 server 与一条 client 隧道时关联为隧道对，pairName 为空时自动命名
+func (s *Service) Instantiate(t *Template, values map[string]string, pairName string) (*Instance, error) {
+	rendered, err := s.Render(t, values)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("[Template] 实例化模板 %s: %d 条隧道", t.Name, len(rendered))
+	reqs := make([]tunnel.CreateTunnelRequest, len(rendered))
+	for i, r := range rendered {
+		reqs[i] = r.Request
+		reqs[i].Actor = "template:" + t.Name
+	}
+	tunnels, err := s.tunnels.CreateTunnels(reqs)
+	if err != nil {
+		log.Errorf("[Template] 实例化模板 %s 失败: %v", t.Name, err)
+		return nil, err
+	}
+
+	inst := &Instance{Tunnels: make([]InstanceResult, len(tunnels))}
+	for i, tun := range tunnels {
+		inst.Tunnels[i] = InstanceResult{
+			Key:        rendered[i].Key,
+			ID:         tun.ID,
+			Name:       tun.Name,
+			EndpointID: tun.EndpointID,
+			InstanceID: tun.InstanceID,
+		}
+	}
+
+	server, client := pairSides(tunnels)
+	if server == nil || client == nil {
+		return inst, nil
+	}
+	if pairName == "" {
+		pairName = fmt.Sprintf("%s-%d", t.Name, server.ID)
+	}
+	inst.Pair, err = s.tunnels.CreatePair(tunnel.CreatePairRequest{
+		Name:           pairName,
+		ServerTunnelID: server.ID,
+		ClientTunnelID: client.ID,
+		Template:       t.Name,
+	})
+	if err != nil {
+		log.Errorf("[Template] 创建隧道对 %s 失败，回滚已创建的隧道: %v", pairName, err)
+		if rbErr := s.tunnels.RollbackTunnels(tunnels); rbErr != nil {
+			return nil, fmt.Errorf("创建隧道对失败: %v；%v", err, rbErr)
+		}
+		return nil, fmt.Errorf("创建隧道对失败: %w", err)
+	}
+	return inst, nil
+}
+
+// pairSides 隧道中恰好有一条 server 与一条 client 时返回二者
+func pairSides(tunnels []*tunnel.Tunnel) (server, client *tunnel.Tunnel) {
+	if len(tunnels) != 2 {
+		return nil, nil
+	}
+	for _, t := range tunnels {
+		switch t.Mode {
+		case tunnel.ModeServer:
+			server = t
+		case tunnel.ModeClient:
+			client = t
+		}
+	}
+	return server, client
+}
+
+// portAllocator 按主控端口池分配端口，同一次渲染内分配过的端口不会重复使用
+func (s *Service) portAllocator() portAllocator {
+	pools := make(map[int64]*tunnel.PortPool)
+	return func(endpointIDs []int64, from int) (int, error) {
+		for _, id := range endpointIDs {
+			if pools[id] != nil {
+				continue
+			}
+			pool, err := s.tunnels.PortPool(id, 0, true)
+			if err != nil {
+				return 0, err
+			}
+			pools[id] = pool
+		}
+		for {
+			port, err := pools[endpointIDs[0]].Next(from)
+			if err != nil {
+				return 0, err
+			}
+			free := true
+			for _, id := range endpointIDs[1:] {
+				if pools[id].Check(port) != nil {
+					free = false
+					break
+				}
+			}
+			if free {
+				for _, id := range endpointIDs {
+					pools[id].Take(port, "")
+				}
+				return port, nil
+			}
+			if port < from {
+				return 0, errors.New("主控上没有可用端口")
+			}
+			from = port + 1
+		}
+	}
+}
+
+// resolveEndpoint 按 ID 或名称查找主控，同一次渲染内缓存结果
+func (s *Service) resolveEndpoint() endpointResolver {
+	type entry struct {
+		id   int64
+		host string
+	}
+	cache := make(map[string]entry)
+	return func(value string) (int64, string, error) {
+		value = strings.TrimSpace(value)
+		if e, ok := cache[value]; ok {
+			return e.id, e.host, nil
+		}
+
+		var e entry
+		var endpointURL string
+		var err error
+		if id, convErr := strconv.ParseInt(value, 10, 64); convErr == nil {
+			err = s.db.QueryRow(`SELECT id, url FROM "Endpoint" WHERE id = ?`, id).Scan(&e.id, &endpointURL)
+		} else {
+			err = s.db.QueryRow(`SELECT id, url FROM "Endpoint" WHERE name = ?`, value).Scan(&e.id, &endpointURL)
+		}
+		if err == sql.ErrNoRows {
+			return 0, "", fmt.Errorf("主控 %s 不存在", value)
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		e.host = nodepassurl.EndpointHost(endpointURL)
+		cache[value] = e
+		return e.id, e.host, nil
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTemplate(row rowScanner) (*Template, error) {
+	var t Template
+	var description sql.NullString
+	var def string
+	if err := row.Scan(&t.ID, &t.Name, &description, &t.Builtin, &def, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	t.Description = description.String
+	var d definition
+	if err := json.Unmarshal([]byte(def), &d); err != nil {
+		return nil, fmt.Errorf("模板 %s 定义解析失败: %w", t.Name, err)
+	}
+	t.Params, t.Tunnels = d.Params, d.Tunnels
+	if t.Params == nil {
+		t.Params = []Param{}
+	}
+	return &t, nil
+}
+
+func encodeDefinition(t *Template) (string, error) {
+	data, err := json.Marshal(definition{Params: t.Params, Tunnels: t.Tunnels})
+	return string(data), err
+}
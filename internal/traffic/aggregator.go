@@ -0,0 +1,334 @@
+package traffic
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/eventbus"
+	log "NodePassDash/internal/log"
+)
+
+// Config 汇总任务配置
+type Config struct {
+	// FlushInterval 内存中的增量写入数据库的间隔
+	FlushInterval time.Duration
+	// 各粒度数据保留时长，超出后删除（降采样：细粒度数据仅保留较短时间）
+	MinuteRetention time.Duration
+	HourRetention   time.Duration
+	DayRetention    time.Duration
+}
+
+// DefaultConfig 默认配置：分钟数据保留 2 天，小时数据 45 天，天数据 2 年
+func DefaultConfig() Config {
+	return Config{
+		FlushInterval:   10 * time.Second,
+		MinuteRetention: 48 * time.Hour,
+		HourRetention:   45 * 24 * time.Hour,
+		DayRetention:    2 * 365 * 24 * time.Hour,
+	}
+}
+
+// instanceKey 实例标识
+type instanceKey struct {
+	endpointID int64
+	instanceID string
+}
+
+// counter 实例最近一次的累计计数
+type counter struct {
+	time                       time.Time
+	tcpRx, tcpTx, udpRx, udpTx int64
+}
+
+// bucketKey 汇总桶标识
+type bucketKey struct {
+	instanceKey
+	res    Resolution
+	bucket time.Time
+}
+
+// Aggregator 流量汇总任务：订阅采样事件，计算增量并定期写入汇总表
+type Aggregator struct {
+	db  *sql.DB
+	cfg Config
+
+	mu       sync.Mutex
+	counters map[instanceKey]*counter
+	dirty    map[instanceKey]struct{}
+	pending  map[bucketKey]*Point
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAggregator 创建流量汇总任务
+func NewAggregator(db *sql.DB, cfg Config) *Aggregator {
+	def := DefaultConfig()
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.MinuteRetention <= 0 {
+		cfg.MinuteRetention = def.MinuteRetention
+	}
+	if cfg.HourRetention <= 0 {
+		cfg.HourRetention = def.HourRetention
+	}
+	if cfg.DayRetention <= 0 {
+		cfg.DayRetention = def.DayRetention
+	}
+	return &Aggregator{
+		db:       db,
+		cfg:      cfg,
+		counters: make(map[instanceKey]*counter),
+		dirty:    make(map[instanceKey]struct{}),
+		pending:  make(map[bucketKey]*Point),
+	}
+}
+
+// Start 加载持久化的计数基线并订阅事件总线中的流量采样
+func (a *Aggregator) Start(bus *eventbus.Bus) error {
+	if err := a.loadCounters(); err != nil {
+		return err
+	}
+
+	events, cancel := bus.Subscribe(eventbus.TopicTunnelTraffic, 4096)
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+
+	go func() {
+		defer close(a.done)
+		defer cancel()
+
+		flushTicker := time.NewTicker(a.cfg.FlushInterval)
+		defer flushTicker.Stop()
+		pruneTicker := time.NewTicker(time.Hour)
+		defer pruneTicker.Stop()
+
+		for {
+			select {
+			case <-a.stop:
+				a.flush()
+				return
+			case ev := <-events:
+				if s, ok := ev.Data.(Sample); ok {
+					a.Observe(s)
+				}
+			case <-flushTicker.C:
+				a.flush()
+			case <-pruneTicker.C:
+				a.prune()
+			}
+		}
+	}()
+	log.Infof("[Traffic]流量汇总任务已启动，已加载 %d 个实例计数", len(a.counters))
+	return nil
+}
+
+// Stop 停止汇总任务并写入剩余增量
+func (a *Aggregator) Stop() {
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+// Observe 处理一次采样：与上次累计计数比较得到增量，计入各粒度的汇总桶
+func (a *Aggregator) Observe(s Sample) {
+	if s.InstanceID == "" {
+		return
+	}
+	if s.Time.IsZero() {
+		s.Time = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := instanceKey{s.EndpointID, s.InstanceID}
+	prev, ok := a.counters[key]
+	cur := &counter{time: s.Time, tcpRx: s.TCPRx, tcpTx: s.TCPTx, udpRx: s.UDPRx, udpTx: s.UDPTx}
+	a.counters[key] = cur
+	a.dirty[key] = struct{}{}
+
+	if !ok {
+		// 首次见到该实例，仅记录基线，避免把历史累计值计为一次增量
+		return
+	}
+	if s.Time.Before(prev.time) {
+		// 乱序到达的旧采样，保留原计数
+		a.counters[key] = prev
+		return
+	}
+
+	var d Point
+	if s.TCPRx < prev.tcpRx || s.TCPTx < prev.tcpTx || s.UDPRx < prev.udpRx || s.UDPTx < prev.udpTx {
+		// 计数回退说明实例已重启，计数从 0 重新开始
+		d = Point{TCPRx: s.TCPRx, TCPTx: s.TCPTx, UDPRx: s.UDPRx, UDPTx: s.UDPTx}
+	} else {
+		d = Point{
+			TCPRx: s.TCPRx - prev.tcpRx,
+			TCPTx: s.TCPTx - prev.tcpTx,
+			UDPRx: s.UDPRx - prev.udpRx,
+			UDPTx: s.UDPTx - prev.udpTx,
+		}
+	}
+
+	for _, res := range []Resolution{ResolutionMinute, ResolutionHour, ResolutionDay} {
+		bk := bucketKey{instanceKey: key, res: res, bucket: res.Truncate(s.Time)}
+		p, ok := a.pending[bk]
+		if !ok {
+			p = &Point{Time: bk.bucket}
+			a.pending[bk] = p
+		}
+		p.TCPRx += d.TCPRx
+		p.TCPTx += d.TCPTx
+		p.UDPRx += d.UDPRx
+		p.UDPTx += d.UDPTx
+		p.Samples++
+	}
+}
+
+// loadCounters 从数据库加载各实例的计数基线，保证重启后增量连续
+func (a *Aggregator) loadCounters() error {
+	rows, err := a.db.Query(`SELECT endpointId, instanceId, eventTime, tcpRx, tcpTx, udpRx, udpTx FROM "TrafficCounter"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for rows.Next() {
+		var key instanceKey
+		c := &counter{}
+		if err := rows.Scan(&key.endpointID, &key.instanceID, &c.time, &c.tcpRx, &c.tcpTx, &c.udpRx, &c.udpTx); err != nil {
+			return err
+		}
+		a.counters[key] = c
+	}
+	return rows.Err()
+}
+
+// flush 将内存中的增量与计数基线写入数据库
+func (a *Aggregator) flush() {
+	a.mu.Lock()
+	if len(a.pending) == 0 && len(a.dirty) == 0 {
+		a.mu.Unlock()
+		return
+	}
+	pending := a.pending
+	a.pending = make(map[bucketKey]*Point)
+	counters := make(map[instanceKey]counter, len(a.dirty))
+	for key := range a.dirty {
+		counters[key] = *a.counters[key]
+	}
+	a.dirty = make(map[instanceKey]struct{})
+	a.mu.Unlock()
+
+	if err := a.write(pending, counters); err != nil {
+		log.Warnf("[Traffic]写入流量汇总失败: %v", err)
+		// 写入失败时将数据放回，等待下次重试
+		a.mu.Lock()
+		for bk, p := range pending {
+			if cur, ok := a.pending[bk]; ok {
+				cur.TCPRx += p.TCPRx
+				cur.TCPTx += p.TCPTx
+				cur.UDPRx += p.UDPRx
+				cur.UDPTx += p.UDPTx
+				cur.Samples += p.Samples
+			} else {
+				a.pending[bk] = p
+			}
+		}
+		for key := range counters {
+			a.dirty[key] = struct{}{}
+		}
+		a.mu.Unlock()
+	}
+}
+
+// write 在单个事务中写入汇总桶与计数基线
+func (a *Aggregator) write(pending map[bucketKey]*Point, counters map[instanceKey]counter) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 先累加更新，不存在时再插入（兼容 SQLite / PostgreSQL / MySQL）
+	for bk, p := range pending {
+		table := `"` + bk.res.table() + `"`
+		res, err := tx.Exec(`UPDATE `+table+` SET
+				tcpRx = tcpRx + ?, tcpTx = tcpTx + ?, udpRx = udpRx + ?, udpTx = udpTx + ?, samples = samples + ?
+			WHERE endpointId = ? AND instanceId = ? AND bucket = ?`,
+			p.TCPRx, p.TCPTx, p.UDPRx, p.UDPTx, p.Samples, bk.endpointID, bk.instanceID, bk.bucket)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO `+table+` (endpointId, instanceId, bucket, tcpRx, tcpTx, udpRx, udpTx, samples)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			bk.endpointID, bk.instanceID, bk.bucket, p.TCPRx, p.TCPTx, p.UDPRx, p.UDPTx, p.Samples)
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, c := range counters {
+		res, err := tx.Exec(`UPDATE "TrafficCounter" SET eventTime = ?, tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ?
+			WHERE endpointId = ? AND instanceId = ?`,
+			c.time.UTC(), c.tcpRx, c.tcpTx, c.udpRx, c.udpTx, key.endpointID, key.instanceID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO "TrafficCounter" (endpointId, instanceId, eventTime, tcpRx, tcpTx, udpRx, udpTx)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			key.endpointID, key.instanceID, c.time.UTC(), c.tcpRx, c.tcpTx, c.udpRx, c.udpTx)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prune 按各粒度的保留时长删除过期汇总数据，并清理长期未更新的计数基线
+func (a *Aggregator) prune() {
+	now := time.Now()
+	rules := []struct {
+		table  string
+		column string
+		cutoff time.Time
+	}{
+		{"TrafficMinute", "bucket", now.Add(-a.cfg.MinuteRetention).UTC()},
+		{"TrafficHour", "bucket", now.Add(-a.cfg.HourRetention).UTC()},
+		{"TrafficDay", "bucket", now.Add(-a.cfg.DayRetention).UTC()},
+		{"TrafficCounter", "eventTime", now.Add(-a.cfg.HourRetention).UTC()},
+	}
+	for _, rule := range rules {
+		res, err := a.db.Exec(`DELETE FROM "`+rule.table+`" WHERE `+rule.column+` < ?`, rule.cutoff)
+		if err != nil {
+			log.Warnf("[Traffic]清理 %s 失败: %v", rule.table, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Infof("[Traffic]已清理 %s 过期数据 %d 行", rule.table, n)
+		}
+	}
+
+	// 删除内存中已被清理的计数
+	a.mu.Lock()
+	cutoff := now.Add(-a.cfg.HourRetention)
+	for key, c := range a.counters {
+		if _, isDirty := a.dirty[key]; !isDirty && c.time.Before(cutoff) {
+			delete(a.counters, key)
+		}
+	}
+	a.mu.Unlock()
+}
@@ -0,0 +1,127 @@
+// Package traffic 将 NodePass 上报的累计流量计数转换为分时段增量，
+// 并按分钟 / 小时 / 天三个粒度汇总存储，供仪表盘与隧道详情查询。
+package traffic
+
+import "time"
+
+// Sample 单次流量采样（实例累计计数）
+type Sample struct {
+	EndpointID int64
+	InstanceID string
+	Time       time.Time
+	TCPRx      int64
+	TCPTx      int64
+	UDPRx      int64
+	UDPTx      int64
+}
+
+// Resolution 汇总粒度
+type Resolution string
+
+const (
+	ResolutionMinute Resolution = "minute"
+	ResolutionHour   Resolution = "hour"
+	ResolutionDay    Resolution = "day"
+)
+
+// table 返回粒度对应的汇总表名
+func (r Resolution) table() string {
+	switch r {
+	case ResolutionMinute:
+		return "TrafficMinute"
+	case ResolutionDay:
+		return "TrafficDay"
+	default:
+		return "TrafficHour"
+	}
+}
+
+// step 返回粒度对应的时间步长（天粒度按 24 小时计）
+func (r Resolution) step() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionDay:
+		return 24 * time.Hour
+	default:
+		return time.Hour
+	}
+}
+
+// Truncate 将时间截断到粒度边界，天粒度按本地时区的零点计算；结果统一为 UTC 便于存储比较
+func (r Resolution) Truncate(t time.Time) time.Time {
+	switch r {
+	case ResolutionMinute:
+		return t.Truncate(time.Minute).UTC()
+	case ResolutionDay:
+		local := t.Local()
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local).UTC()
+	default:
+		return t.Truncate(time.Hour).UTC()
+	}
+}
+
+// next 返回下一个粒度边界
+func (r Resolution) next(t time.Time) time.Time {
+	if r == ResolutionDay {
+		local := t.Local()
+		return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, time.Local).UTC()
+	}
+	return t.Add(r.step())
+}
+
+// ParseResolution 解析汇总粒度，无效值返回 false
+func ParseResolution(s string) (Resolution, bool) {
+	switch Resolution(s) {
+	case ResolutionMinute, ResolutionHour, ResolutionDay:
+		return Resolution(s), true
+	}
+	return "", false
+}
+
+// ResolutionFor 根据查询时间跨度选择合适的粒度
+func ResolutionFor(span time.Duration) Resolution {
+	switch {
+	case span <= 6*time.Hour:
+		return ResolutionMinute
+	case span <= 7*24*time.Hour:
+		return ResolutionHour
+	default:
+		return ResolutionDay
+	}
+}
+
+// Point 时间序列中的单个点（该时段内的流量增量）
+type Point struct {
+	Time    time.Time `json:"time"`
+	TCPRx   int64     `json:"tcpRx"`
+	TCPTx   int64     `json:"tcpTx"`
+	UDPRx   int64     `json:"udpRx"`
+	UDPTx   int64     `json:"udpTx"`
+	Samples int64     `json:"samples"`
+}
+
+// Total 返回该时段的总流量
+func (p Point) Total() int64 {
+	return p.TCPRx + p.TCPTx + p.UDPRx + p.UDPTx
+}
+
+// Filter 查询过滤条件，零值表示不过滤
+type Filter struct {
+	EndpointID int64
+	InstanceID string
+}
+
+// TunnelTraffic 隧道在某时间段内的流量汇总
+type TunnelTraffic struct {
+	TunnelID   int64  `json:"tunnelId"`
+	Name       string `json:"name"`
+	Mode       string `json:"mode"`
+	EndpointID int64  `json:"endpointId"`
+	InstanceID string `json:"instanceId"`
+	TCPRx      int64  `json:"tcpRx"`
+	TCPTx      int64  `json:"tcpTx"`
+	UDPRx      int64  `json:"udpRx"`
+	UDPTx      int64  `json:"udpTx"`
+	Total      int64  `json:"total"`
+}
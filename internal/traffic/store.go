@@ -0,0 +1,125 @@
+package traffic
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Store 流量汇总数据查询
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore 创建查询实例
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Trend 查询 [from, to) 内指定粒度的流量时间序列，缺失的时段补零
+func (s *Store) Trend(res Resolution, from, to time.Time, f Filter) ([]Point, error) {
+	start := res.Truncate(from)
+	end := to.UTC()
+
+	query := `SELECT bucket, SUM(tcpRx), SUM(tcpTx), SUM(udpRx), SUM(udpTx), SUM(samples)
+		FROM "` + res.table() + `" WHERE bucket >= ? AND bucket < ?`
+	args := []interface{}{start, end}
+	if f.EndpointID > 0 {
+		query += ` AND endpointId = ?`
+		args = append(args, f.EndpointID)
+	}
+	if f.InstanceID != "" {
+		query += ` AND instanceId = ?`
+		args = append(args, f.InstanceID)
+	}
+	query += ` GROUP BY bucket ORDER BY bucket`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byBucket := make(map[int64]Point)
+	for rows.Next() {
+		var p Point
+		if err := rows.Scan(&p.Time, &p.TCPRx, &p.TCPTx, &p.UDPRx, &p.UDPTx, &p.Samples); err != nil {
+			return nil, err
+		}
+		byBucket[p.Time.Unix()] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for t := start; t.Before(end); t = res.next(t) {
+		p, ok := byBucket[t.Unix()]
+		if !ok {
+			p = Point{Time: t}
+		}
+		p.Time = t.Local()
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// TopTunnels 查询自 since 起流量最高的 limit 个隧道
+// by 可选 total / tcp / udp / rx / tx，默认 total
+func (s *Store) TopTunnels(since time.Time, limit int, by string) ([]TunnelTraffic, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	orderExpr, err := orderExpression(by)
+	if err != nil {
+		return nil, err
+	}
+
+	// 时间跨度较短时使用小时表，否则使用天表
+	res := ResolutionHour
+	if time.Since(since) > 7*24*time.Hour {
+		res = ResolutionDay
+	}
+
+	rows, err := s.db.Query(`SELECT t.id, t.name, t.mode, t.endpointId, r.instanceId,
+			SUM(r.tcpRx) AS tcpRx, SUM(r.tcpTx) AS tcpTx, SUM(r.udpRx) AS udpRx, SUM(r.udpTx) AS udpTx
+		FROM "`+res.table()+`" r
+		JOIN "Tunnel" t ON t.endpointId = r.endpointId AND t.instanceId = r.instanceId
+		WHERE r.bucket >= ?
+		GROUP BY t.id, t.name, t.mode, t.endpointId, r.instanceId
+		ORDER BY `+orderExpr+` DESC
+		LIMIT ?`, res.Truncate(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []TunnelTraffic
+	for rows.Next() {
+		var t TunnelTraffic
+		if err := rows.Scan(&t.TunnelID, &t.Name, &t.Mode, &t.EndpointID, &t.InstanceID, &t.TCPRx, &t.TCPTx, &t.UDPRx, &t.UDPTx); err != nil {
+			return nil, err
+		}
+		t.Total = t.TCPRx + t.TCPTx + t.UDPRx + t.UDPTx
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// orderExpression 排序字段白名单
+func orderExpression(by string) (string, error) {
+	switch by {
+	case "", "total":
+		return "(SUM(r.tcpRx) + SUM(r.tcpTx) + SUM(r.udpRx) + SUM(r.udpTx))", nil
+	case "tcp":
+		return "(SUM(r.tcpRx) + SUM(r.tcpTx))", nil
+	case "udp":
+		return "(SUM(r.udpRx) + SUM(r.udpTx))", nil
+	case "rx":
+		return "(SUM(r.tcpRx) + SUM(r.udpRx))", nil
+	case "tx":
+		return "(SUM(r.tcpTx) + SUM(r.udpTx))", nil
+	}
+	return "", fmt.Errorf("无效的排序字段: %s", by)
+}
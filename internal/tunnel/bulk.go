@@ -0,0 +1,270 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/labels"
+)
+
+// 批量操作类型
+const (
+	BulkStart    = "start"
+	BulkStop     = "stop"
+	BulkRestart  = "restart"
+	BulkDelete   = "delete"   // 删除，不保留回收站记录
+	BulkRecycle  = "recycle"  // 删除并移入回收站
+	BulkLogLevel = "loglevel" // 修改日志级别
+)
+
+// 批量操作的并发限制（按端点计）
+const (
+	defaultBulkConcurrency = 4
+	maxBulkConcurrency     = 16
+)
+
+// bulkDeleteTimeout 批量删除时等待 SSE 同步的最长时间
+const bulkDeleteTimeout = 3 * time.Second
+
+// BulkSelector 批量操作的筛选条件，各条件取交集，空值表示不限
+type BulkSelector struct {
+	EndpointID int64  `json:"endpointId,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	// Name 名称通配符，支持 * 与 ?
+	Name string `json:"name,omitempty"`
+	// Labels 标签选择器，如 env=prod,team!=infra
+	Labels string `json:"labels,omitempty"`
+}
+
+// empty 是否未设置任何筛选条件
+func (sel *BulkSelector) empty() bool {
+	return sel == nil || *sel == BulkSelector{}
+}
+
+// BulkRequest 批量操作请求，IDs 与 Selector 至少指定一个（同时指定时取交集）
+type BulkRequest struct {
+	IDs      []int64       `json:"ids,omitempty"`
+	Selector *BulkSelector `json:"selector,omitempty"`
+	Action   string        `json:"action"`
+	// LogLevel action 为 loglevel 时的目标日志级别
+	LogLevel LogLevel `json:"logLevel,omitempty"`
+	// Concurrency 每个端点的并发数，默认 4，最大 16
+	Concurrency int `json:"concurrency,omitempty"`
+	// DryRun 仅返回匹配的隧道，不执行操作
+	DryRun bool `json:"dryRun,omitempty"`
+	// All 未指定 ID 且筛选条件为空时，需显式设为 true 才会停止或删除全部隧道
+	All bool `json:"all,omitempty"`
+	// Actor 操作者，由接口层填写，移入回收站时记录为 deletedBy
+	Actor string `json:"-"`
+}
+
+// BulkTarget 批量操作匹配到的隧道
+type BulkTarget struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	InstanceID string `json:"instanceId,omitempty"`
+	EndpointID int64  `json:"endpointId"`
+}
+
+// BulkResult 单个隧道的执行结果
+type BulkResult struct {
+	BulkTarget
+	Action   string `json:"action"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Validate 校验批量操作请求
+func (req *BulkRequest) Validate() error {
+	switch req.Action {
+	case BulkStart, BulkStop, BulkRestart, BulkDelete, BulkRecycle:
+	case BulkLogLevel:
+		switch req.LogLevel {
+		case LogLevelInherit, LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+		default:
+			return fmt.Errorf("无效的日志级别: %q", req.LogLevel)
+		}
+	default:
+		return fmt.Errorf("不支持的批量操作: %q", req.Action)
+	}
+	if len(req.IDs) == 0 && req.Selector == nil && !req.All {
+		return errors.New("需要指定隧道 ID 或筛选条件")
+	}
+	if len(req.IDs) == 0 && req.Selector.empty() && !req.All {
+		switch req.Action {
+		case BulkStop, BulkDelete, BulkRecycle:
+			return errors.New("筛选条件为空将匹配全部隧道，请指定筛选条件，或使用 all=true 操作全部隧道")
+		}
+	}
+	if req.Selector != nil && req.Selector.Name != "" {
+		if _, err := path.Match(req.Selector.Name, ""); err != nil {
+			return fmt.Errorf("无效的名称通配符: %q", req.Selector.Name)
+		}
+	}
+	if req.Selector != nil {
+		if _, err := labels.Parse(req.Selector.Labels); err != nil {
+			return err
+		}
+	}
+	if req.Concurrency < 0 {
+		return errors.New("并发数不能为负数")
+	}
+	return nil
+}
+
+// ResolveBulkTargets 返回批量操作匹配到的隧道
+func (s *Service) ResolveBulkTargets(req BulkRequest) (targets []BulkTarget, err error) {
+	query := `SELECT id, name, instanceId, endpointId, labels FROM "Tunnel"`
+	var conds []string
+	var args []interface{}
+	if len(req.IDs) > 0 {
+		conds = append(conds, "id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(req.IDs)), ", ")+")")
+		for _, id := range req.IDs {
+			args = append(args, id)
+		}
+	}
+	sel := req.Selector
+	var labelSel labels.Selector
+	if sel != nil {
+		if labelSel, err = labels.Parse(sel.Labels); err != nil {
+			return nil, err
+		}
+		if sel.EndpointID > 0 {
+			conds = append(conds, "endpointId = ?")
+			args = append(args, sel.EndpointID)
+		}
+		if sel.Status != "" {
+			conds = append(conds, "status = ?")
+			args = append(args, sel.Status)
+		}
+		if sel.Mode != "" {
+			conds = append(conds, "mode = ?")
+			args = append(args, sel.Mode)
+		}
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t BulkTarget
+		var instanceID, labelsVal sql.NullString
+		if err := rows.Scan(&t.ID, &t.Name, &instanceID, &t.EndpointID, &labelsVal); err != nil {
+			return nil, err
+		}
+		t.InstanceID = instanceID.String
+		if !labelSel.Matches(labels.Decode(labelsVal.String)) {
+			continue
+		}
+		if sel != nil && sel.Name != "" {
+			if ok, _ := path.Match(sel.Name, t.Name); !ok {
+				continue
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// BulkOperate 对匹配的隧道执行批量操作：不同端点并行，同一端点内按 Concurrency 限制并发。
+// onResult 在每个隧道完成后调用（串行），可用于流式输出，可为 nil
+func (s *Service) BulkOperate(req BulkRequest, onResult func(BulkResult)) ([]BulkResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	targets, err := s.ResolveBulkTargets(req)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := req.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	byEndpoint := make(map[int64][]BulkTarget)
+	for _, t := range targets {
+		byEndpoint[t.EndpointID] = append(byEndpoint[t.EndpointID], t)
+	}
+	log.Infof("[API] 批量%s隧道: %d 个，涉及 %d 个端点", req.Action, len(targets), len(byEndpoint))
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make([]BulkResult, 0, len(targets))
+	)
+	for _, list := range byEndpoint {
+		wg.Add(1)
+		go func(list []BulkTarget) {
+			defer wg.Done()
+			var epWG sync.WaitGroup
+			sem := make(chan struct{}, concurrency)
+			for _, t := range list {
+				epWG.Add(1)
+				sem <- struct{}{}
+				go func(t BulkTarget) {
+					defer func() {
+						<-sem
+						epWG.Done()
+					}()
+					res := s.bulkOne(req, t)
+					mu.Lock()
+					results = append(results, res)
+					if onResult != nil {
+						onResult(res)
+					}
+					mu.Unlock()
+				}(t)
+			}
+			epWG.Wait()
+		}(list)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// bulkOne 对单个隧道执行操作
+func (s *Service) bulkOne(req BulkRequest, t BulkTarget) BulkResult {
+	start := time.Now()
+	res := BulkResult{BulkTarget: t, Action: req.Action}
+
+	var err error
+	switch {
+	case t.InstanceID == "":
+		err = errors.New("隧道没有关联的实例ID")
+	case req.Action == BulkStart, req.Action == BulkStop, req.Action == BulkRestart:
+		err = s.ControlTunnel(TunnelActionRequest{InstanceID: t.InstanceID, Action: req.Action})
+	case req.Action == BulkDelete, req.Action == BulkRecycle:
+		err = s.DeleteTunnelAndWait(t.InstanceID, bulkDeleteTimeout, req.Action == BulkRecycle, req.Actor)
+	case req.Action == BulkLogLevel:
+		var tunnel *Tunnel
+		if tunnel, err = s.getTunnel(t.ID); err == nil {
+			tunnel.LogLevel = req.LogLevel
+			err = s.saveTunnel(tunnel, VersionUpdate, req.Actor, "批量修改日志级别")
+		}
+	}
+
+	res.Success = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.Duration = time.Since(start).Round(time.Millisecond).String()
+	return res
+}
@@ -0,0 +1,265 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/storage"
+)
+
+// ErrVersionNotFound 配置版本不存在
+var ErrVersionNotFound = errors.New("配置版本不存在")
+
+// 配置版本的变更来源
+const (
+	VersionCreate   = "create"   // 创建隧道
+	VersionUpdate   = "update"   // 编辑配置
+	VersionRename   = "rename"   // 重命名
+	VersionExternal = "external" // 主控侧变更（由 SSE 检测）
+	VersionRollback = "rollback" // 回滚到历史版本
+)
+
+// maxConfigVersions 每条隧道保留的最大版本数，超出时删除最旧的版本
+const maxConfigVersions = 100
+
+// ExternalChangeGrace 本地修改后的保护窗口：窗口内 SSE 事件中的旧命令行不视为主控侧变更，
+// 避免批量写入延迟导致的旧事件覆盖刚保存的配置
+const ExternalChangeGrace = 10 * time.Second
+
+// ConfigVersion 隧道配置的一个历史版本
+type ConfigVersion struct {
+	ID          int64     `json:"id"`
+	TunnelID    int64     `json:"tunnelId"`
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	CommandLine string    `json:"commandLine"`
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// VersionDiff 两个版本之间的差异
+type VersionDiff struct {
+	From    *ConfigVersion          `json:"from"`
+	To      *ConfigVersion          `json:"to"`
+	Changes []nodepassurl.FieldDiff `json:"changes"`
+}
+
+// versionStore 同时适用于 *sql.DB 与 *sql.Tx，便于在 SSE 事务中记录版本
+type versionStore interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// versionAttempts 并发写入导致版本号冲突时的最大尝试次数
+const versionAttempts = 3
+
+// RecordVersion 为隧道追加一个配置版本，返回新版本号。名称与命令行均与最新版本相同时不写入，返回 0。
+// 版本号在插入语句中按当前最大值分配，并发写入发生唯一约束冲突时重试；
+// 在事务中调用时冲突只回滚到保存点，不影响事务中的其它写入
+func RecordVersion(q versionStore, tunnelID int64, name, commandLine, action, actor, message string) (int, error) {
+	for attempt := 1; ; attempt++ {
+		version, err := insertVersion(q, tunnelID, name, commandLine, action, actor, message)
+		if err == nil || attempt >= versionAttempts || !storage.IsUniqueViolation(err) {
+			return version, err
+		}
+	}
+}
+
+func insertVersion(q versionStore, tunnelID int64, name, commandLine, action, actor, message string) (int, error) {
+	var latestName, latestCmd sql.NullString
+	err := q.QueryRow(`SELECT name, commandLine FROM "TunnelConfigVersion" WHERE tunnelId = ? ORDER BY version DESC LIMIT 1`, tunnelID).
+		Scan(&latestName, &latestCmd)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == nil && latestName.String == name && latestCmd.String == commandLine {
+		return 0, nil
+	}
+
+	tx, inTx := q.(*sql.Tx)
+	if inTx {
+		if _, err := tx.Exec(`SAVEPOINT tunnel_version`); err != nil {
+			return 0, err
+		}
+	}
+	res, err := q.Exec(`INSERT INTO "TunnelConfigVersion" (tunnelId, version, name, commandLine, action, actor, message, createdAt)
+		SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ?, ?, ?, ?, ? FROM "TunnelConfigVersion" WHERE tunnelId = ?`,
+		tunnelID, name, commandLine, action, nullableString(actor), nullableString(message), time.Now(), tunnelID)
+	if inTx {
+		if err != nil {
+			_, _ = tx.Exec(`ROLLBACK TO SAVEPOINT tunnel_version`)
+		}
+		_, _ = tx.Exec(`RELEASE SAVEPOINT tunnel_version`)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	if err := q.QueryRow(`SELECT version FROM "TunnelConfigVersion" WHERE id = ?`, id).Scan(&version); err != nil {
+		return 0, err
+	}
+	if version > maxConfigVersions {
+		_, _ = q.Exec(`DELETE FROM "TunnelConfigVersion" WHERE tunnelId = ? AND version <= ?`, tunnelID, version-maxConfigVersions)
+	}
+	return version, nil
+}
+
+// RecentlyChanged 判断隧道是否在 ExternalChangeGrace 内记录过本地版本
+func RecentlyChanged(q versionStore, tunnelID int64) (bool, error) {
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM "TunnelConfigVersion" WHERE tunnelId = ? AND action <> ? AND createdAt > ?`,
+		tunnelID, VersionExternal, time.Now().Add(-ExternalChangeGrace)).Scan(&n)
+	return n > 0, err
+}
+
+// recordVersion 记录版本，失败只写日志，不影响已完成的操作。返回新版本号，未写入时为 0
+func (s *Service) recordVersion(tunnelID int64, name, commandLine, action, actor, message string) int {
+	version, err := RecordVersion(s.db, tunnelID, name, commandLine, action, actor, message)
+	if err != nil {
+		log.Warnf("[API] 记录隧道 %d 配置版本失败: %v", tunnelID, err)
+	}
+	return version
+}
+
+// ListVersions 按版本号倒序返回隧道的配置历史
+func (s *Service) ListVersions(tunnelID int64) ([]ConfigVersion, error) {
+	rows, err := s.db.Query(`SELECT id, tunnelId, version, name, commandLine, action, actor, message, createdAt
+		FROM "TunnelConfigVersion" WHERE tunnelId = ? ORDER BY version DESC`, tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []ConfigVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion 获取隧道的指定版本
+func (s *Service) GetVersion(tunnelID int64, version int) (*ConfigVersion, error) {
+	row := s.db.QueryRow(`SELECT id, tunnelId, version, name, commandLine, action, actor, message, createdAt
+		FROM "TunnelConfigVersion" WHERE tunnelId = ? AND version = ?`, tunnelID, version)
+	v, err := scanVersion(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionNotFound
+	}
+	return v, err
+}
+
+// DiffVersions 比较隧道的两个版本，差异按命令行语义计算（忽略参数顺序），名称变化记为 name 字段
+func (s *Service) DiffVersions(tunnelID int64, from, to int) (*VersionDiff, error) {
+	a, err := s.GetVersion(tunnelID, from)
+	if err != nil {
+		return nil, fmt.Errorf("版本 %d: %w", from, err)
+	}
+	b, err := s.GetVersion(tunnelID, to)
+	if err != nil {
+		return nil, fmt.Errorf("版本 %d: %w", to, err)
+	}
+
+	changes := []nodepassurl.FieldDiff{}
+	if a.Name != b.Name {
+		changes = append(changes, nodepassurl.FieldDiff{Field: "name", From: a.Name, To: b.Name})
+	}
+	ua, errA := nodepassurl.Parse(a.CommandLine)
+	ub, errB := nodepassurl.Parse(b.CommandLine)
+	if errA != nil || errB != nil {
+		// 无法解析时退化为整行比较
+		if a.CommandLine != b.CommandLine {
+			changes = append(changes, nodepassurl.FieldDiff{Field: "commandLine", From: a.CommandLine, To: b.CommandLine})
+		}
+	} else {
+		changes = append(changes, nodepassurl.Diff(ua, ub)...)
+	}
+	return &VersionDiff{From: a, To: b, Changes: changes}, nil
+}
+
+// RollbackToVersion 将隧道配置回滚到指定版本：按该版本的命令行重新生成配置并通过 NodePass API 更新实例，
+// 名称与标签保持当前值。成功后追加一个 rollback 版本
+func (s *Service) RollbackToVersion(tunnelID int64, version int, actor string) error {
+	v, err := s.GetVersion(tunnelID, version)
+	if err != nil {
+		return err
+	}
+	u, err := nodepassurl.Parse(v.CommandLine)
+	if err != nil {
+		return fmt.Errorf("版本 %d 的命令行无效: %w", version, err)
+	}
+	t, err := s.getTunnel(tunnelID)
+	if err != nil {
+		return err
+	}
+	if u.Mode != string(t.Mode) {
+		return fmt.Errorf("版本 %d 的模式为 %s，与当前隧道不一致，无法回滚", version, u.Mode)
+	}
+
+	log.Infof("[API] 回滚隧道 %s 到版本 %d", t.Name, version)
+	// 以历史命令行为基础重新生成，保留其中未识别的参数
+	restored := requestFromURL(u, t.EndpointID, t.Name).tunnel()
+	restored.ID = t.ID
+	restored.InstanceID = t.InstanceID
+	restored.Labels = t.Labels
+	restored.CommandLine = v.CommandLine
+	if err := s.saveTunnel(&restored, VersionRollback, actor, fmt.Sprintf("回滚到版本 %d", version)); err != nil {
+		return err
+	}
+
+	_, _ = s.db.Exec(`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status, message) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Name, "rollback", "success", fmt.Sprintf("配置回滚到版本 %d", version))
+	return nil
+}
+
+// InheritVersions 将旧隧道的配置历史转移到重建后的新隧道，并以新隧道的当前配置追加一个 update 版本（message 为说明）。
+// 用于“删除旧实例 + 创建新实例”方式的编辑与迁移，使历史保持连续
+func (s *Service) InheritVersions(oldID, newID int64, actor, message string) error {
+	if oldID == newID {
+		return nil
+	}
+	t, err := s.getTunnel(newID)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 先移除新隧道创建时记录的版本，再按旧历史继续编号
+	if _, err := tx.Exec(`DELETE FROM "TunnelConfigVersion" WHERE tunnelId = ?`, newID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE "TunnelConfigVersion" SET tunnelId = ? WHERE tunnelId = ?`, newID, oldID); err != nil {
+		return err
+	}
+	if _, err := RecordVersion(tx, newID, t.Name, t.CommandLine, VersionUpdate, actor, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanVersion(row interface{ Scan(...interface{}) error }) (*ConfigVersion, error) {
+	var v ConfigVersion
+	var actor, message sql.NullString
+	if err := row.Scan(&v.ID, &v.TunnelID, &v.Version, &v.Name, &v.CommandLine, &v.Action, &actor, &message, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	v.Actor = actor.String
+	v.Message = message.String
+	return &v, nil
+}
@@ -0,0 +1,348 @@
+package tunnel
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/nodepassurl"
+	"NodePassDash/internal/pagination"
+	"NodePassDash/internal/storage"
+)
+
+// ListQuery 隧道列表查询条件，空值表示不限
+type ListQuery struct {
+	EndpointID int64
+	Mode       string
+	Status     string
+	// Search 名称包含的关键字（不区分大小写）
+	Search string
+	// MinTraffic / MaxTraffic 总流量范围（字节，含边界）
+	MinTraffic *int64
+	MaxTraffic *int64
+	// Labels 标签选择器，非空时在内存中筛选后再分页
+	Labels labels.Selector
+	pagination.Params
+}
+
+// ListResult 隧道列表查询结果
+type ListResult struct {
+	Tunnels    []TunnelWithStats `json:"tunnels"`
+	Total      int               `json:"total"`
+	Page       int               `json:"page,omitempty"`
+	Size       int               `json:"size,omitempty"`
+	TotalPages int               `json:"totalPages,omitempty"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// 默认排序：创建时间倒序
+const defaultTunnelSort = "createdAt"
+
+// tunnelSortFields 可排序字段
+var tunnelSortFields = map[string]pagination.Field{
+	"id":         {Expr: "t.id", Kind: pagination.KindInt},
+	"name":       {Expr: "t.name", Kind: pagination.KindString},
+	"mode":       {Expr: "t.mode", Kind: pagination.KindString},
+	"status":     {Expr: "t.status", Kind: pagination.KindString},
+	"endpointId": {Expr: "t.endpointId", Kind: pagination.KindInt},
+	"tunnelPort": {Expr: "t.tunnelPort", Kind: pagination.KindInt},
+	"traffic":    {Expr: "(t.tcpRx + t.tcpTx + t.udpRx + t.udpTx)", Kind: pagination.KindInt},
+	"createdAt":  {Expr: "t.createdAt", Kind: pagination.KindTime},
+	"updatedAt":  {Expr: "t.updatedAt", Kind: pagination.KindTime},
+}
+
+// sortValue 返回隧道在排序字段上的值，用于生成游标
+func (t *TunnelWithStats) sortValue(field string) interface{} {
+	switch field {
+	case "id":
+		return t.ID
+	case "name":
+		return t.Name
+	case "mode":
+		return string(t.Mode)
+	case "status":
+		return string(t.Status)
+	case "endpointId":
+		return t.EndpointID
+	case "tunnelPort":
+		return t.TunnelPort
+	case "traffic":
+		return t.Traffic.Total
+	case "updatedAt":
+		return t.UpdatedAt
+	}
+	return t.CreatedAt
+}
+
+// conditions 生成筛选条件（不含标签选择器）
+func (q ListQuery) conditions() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if q.EndpointID > 0 {
+		conds = append(conds, "t.endpointId = ?")
+		args = append(args, q.EndpointID)
+	}
+	if q.Mode != "" {
+		conds = append(conds, "t.mode = ?")
+		args = append(args, q.Mode)
+	}
+	if q.Status != "" {
+		conds = append(conds, "t.status = ?")
+		args = append(args, q.Status)
+	}
+	if q.Search != "" {
+		conds = append(conds, "LOWER(t.name) LIKE ?")
+		args = append(args, "%"+strings.ToLower(q.Search)+"%")
+	}
+	if q.MinTraffic != nil {
+		conds = append(conds, tunnelSortFields["traffic"].Expr+" >= ?")
+		args = append(args, *q.MinTraffic)
+	}
+	if q.MaxTraffic != nil {
+		conds = append(conds, tunnelSortFields["traffic"].Expr+" <= ?")
+		args = append(args, *q.MaxTraffic)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// ListTunnels 按条件查询隧道列表，支持偏移分页与游标分页
+func (s *Service) ListTunnels(q ListQuery) (*ListResult, error) {
+	sortName, desc := q.Sort, q.Desc
+	if sortName == "" {
+		sortName, desc = defaultTunnelSort, true
+	}
+	field, ok := tunnelSortFields[sortName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", pagination.ErrInvalidSort, sortName)
+	}
+	if field.Kind == pagination.KindTime {
+		field.Expr = storage.DialectOf(s.db).UnixTime(field.Expr)
+	}
+
+	where, args := q.conditions()
+	res := &ListResult{}
+
+	// 总数（不受游标影响）
+	if q.Paged() {
+		total, err := s.countTunnels(where, args, q.Labels)
+		if err != nil {
+			return nil, err
+		}
+		res.Total = total
+		res.Size = q.Size
+		res.TotalPages = pagination.TotalPages(total, q.Size)
+		if q.Cursor == "" {
+			res.Page = q.Page
+		}
+	}
+
+	dataWhere, dataArgs := where, args
+	if q.Cursor != "" {
+		c, err := pagination.DecodeCursor(q.Cursor)
+		if err != nil || c.Sort != sortName || c.Desc != desc {
+			return nil, pagination.ErrInvalidCursor
+		}
+		cond, condArgs, err := field.Keyset(c, "t.id")
+		if err != nil {
+			return nil, err
+		}
+		if dataWhere != "" {
+			dataWhere += " AND "
+		}
+		dataWhere += cond
+		dataArgs = append(append([]interface{}{}, args...), condArgs...)
+	}
+
+	query := `
+		SELECT
+			t.id, t.instanceId, t.name, t.endpointId, t.mode,
+			t.tunnelAddress, t.tunnelPort, t.targetAddress, t.targetPort,
+			t.tlsMode, t.certPath, t.keyPath, t.logLevel, t.commandLine,
+			t.status, t.min, t.max, t.extraParams, t.labels, t.managed, t.tcpRx, t.tcpTx, t.udpRx, t.udpTx,
+			t.createdAt, t.updatedAt,
+			e.name as endpointName
+		FROM "Tunnel" t
+		LEFT JOIN "Endpoint" e ON t.endpointId = e.id`
+	if dataWhere != "" {
+		query += " WHERE " + dataWhere
+	}
+	query += " ORDER BY " + field.OrderBy("t.id", desc)
+
+	// 多取一条判断是否还有下一页；有标签选择器时无法在 SQL 中分页
+	sqlLimit := q.Paged() && q.Labels.Empty()
+	if sqlLimit {
+		query += " LIMIT ? OFFSET ?"
+		dataArgs = append(dataArgs, q.Size+1, q.Offset())
+	}
+
+	tunnels, err := s.queryTunnels(query, dataArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !q.Labels.Empty() {
+		matched := tunnels[:0]
+		for _, t := range tunnels {
+			if q.Labels.Matches(t.Labels) {
+				matched = append(matched, t)
+			}
+		}
+		tunnels = matched
+		if q.Paged() {
+			offset := q.Offset()
+			if offset > len(tunnels) {
+				offset = len(tunnels)
+			}
+			tunnels = tunnels[offset:]
+		}
+	}
+
+	if q.Paged() && len(tunnels) > q.Size {
+		tunnels = tunnels[:q.Size]
+		last := tunnels[len(tunnels)-1]
+		res.NextCursor = pagination.Cursor{
+			Sort:  sortName,
+			Desc:  desc,
+			Value: field.Format(last.sortValue(sortName)),
+			ID:    last.ID,
+		}.Encode()
+	}
+	if !q.Paged() {
+		res.Total = len(tunnels)
+	}
+	res.Tunnels = tunnels
+	return res, nil
+}
+
+// countTunnels 统计符合条件的隧道数
+func (s *Service) countTunnels(where string, args []interface{}, sel labels.Selector) (int, error) {
+	if sel.Empty() {
+		query := `SELECT COUNT(*) FROM "Tunnel" t`
+		if where != "" {
+			query += " WHERE " + where
+		}
+		var total int
+		err := s.db.QueryRow(query, args...).Scan(&total)
+		return total, err
+	}
+
+	query := `SELECT t.labels FROM "Tunnel" t`
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var labelsNS sql.NullString
+		if err := rows.Scan(&labelsNS); err != nil {
+			return 0, err
+		}
+		if sel.Matches(labels.Decode(labelsNS.String)) {
+			total++
+		}
+	}
+	return total, rows.Err()
+}
+
+// queryTunnels 执行隧道列表查询并填充统计与展示字段
+func (s *Service) queryTunnels(query string, args ...interface{}) ([]TunnelWithStats, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tunnels []TunnelWithStats
+	for rows.Next() {
+		var t TunnelWithStats
+		var modeStr, statusStr, tlsModeStr, logLevelStr string
+		var instanceID sql.NullString
+		var certPathNS, keyPathNS sql.NullString
+		var endpointNameNS sql.NullString
+		var minNS, maxNS sql.NullInt64
+		var extraNS, labelsNS sql.NullString
+		err := rows.Scan(
+			&t.ID, &instanceID, &t.Name, &t.EndpointID, &modeStr,
+			&t.TunnelAddress, &t.TunnelPort, &t.TargetAddress, &t.TargetPort,
+			&tlsModeStr, &certPathNS, &keyPathNS, &logLevelStr, &t.CommandLine,
+			&statusStr, &minNS, &maxNS, &extraNS, &labelsNS, &t.Managed, &t.Traffic.TCPRx, &t.Traffic.TCPTx, &t.Traffic.UDPRx, &t.Traffic.UDPTx,
+			&t.CreatedAt, &t.UpdatedAt,
+			&endpointNameNS,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if instanceID.Valid {
+			t.InstanceID = instanceID.String
+		}
+		if certPathNS.Valid {
+			t.CertPath = certPathNS.String
+		}
+		if keyPathNS.Valid {
+			t.KeyPath = keyPathNS.String
+		}
+		if endpointNameNS.Valid {
+			t.EndpointName = endpointNameNS.String
+		}
+		if minNS.Valid {
+			t.Min = int(minNS.Int64)
+		}
+		if maxNS.Valid {
+			t.Max = int(maxNS.Int64)
+		}
+		t.ExtraParams = nodepassurl.DecodeExtra(extraNS.String)
+		t.Labels = labels.Decode(labelsNS.String)
+
+		t.Mode = TunnelMode(modeStr)
+		t.Status = TunnelStatus(statusStr)
+		t.TLSMode = TLSMode(tlsModeStr)
+		t.LogLevel = LogLevel(logLevelStr)
+
+		// 计算总流量
+		t.Traffic.Total = t.Traffic.TCPRx + t.Traffic.TCPTx + t.Traffic.UDPRx + t.Traffic.UDPTx
+
+		// 格式化流量数据
+		t.Traffic.Formatted.TCPRx = formatTrafficBytes(t.Traffic.TCPRx)
+		t.Traffic.Formatted.TCPTx = formatTrafficBytes(t.Traffic.TCPTx)
+		t.Traffic.Formatted.UDPRx = formatTrafficBytes(t.Traffic.UDPRx)
+		t.Traffic.Formatted.UDPTx = formatTrafficBytes(t.Traffic.UDPTx)
+		t.Traffic.Formatted.Total = formatTrafficBytes(t.Traffic.Total)
+
+		// 设置类型和头像
+		t.Type = string(t.Mode)
+		if t.Type == "server" {
+			t.Type = "服务端"
+		} else {
+			t.Type = "客户端"
+		}
+		if len(t.EndpointName) > 0 {
+			t.Avatar = string([]rune(t.EndpointName)[0])
+		}
+
+		// 设置状态信息
+		switch t.Status {
+		case StatusRunning:
+			t.StatusInfo.Type = "success"
+			t.StatusInfo.Text = "运行中"
+		case StatusError:
+			t.StatusInfo.Type = "warning"
+			t.StatusInfo.Text = "错误"
+		case StatusMissing:
+			t.StatusInfo.Type = "warning"
+			t.StatusInfo.Text = "实例丢失"
+		default:
+			t.StatusInfo.Type = "danger"
+			t.StatusInfo.Text = "已停止"
+		}
+
+		tunnels = append(tunnels, t)
+	}
+
+	return tunnels, rows.Err()
+}
@@ -0,0 +1,6 @@
+package tunnel
+
+import applog "NodePassDash/internal/log"
+
+// log 隧道子系统日志，级别可单独配置
+var log = applog.For(applog.SubsystemTunnel)
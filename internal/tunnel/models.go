@@ -2,6 +2,8 @@ package tunnel
 
 import (
 	"time"
+
+	"NodePassDash/internal/labels"
 )
 
 // TunnelStatus 隧道状态枚举
@@ -11,6 +13,7 @@ const (
 	StatusRunning TunnelStatus = "running"
 	StatusStopped TunnelStatus = "stopped"
 	StatusError   TunnelStatus = "error"
+	StatusMissing TunnelStatus = "missing" // 主控上已不存在该实例（由对账任务标记）
 )
 
 // TunnelMode 隧道模式枚举
@@ -44,25 +47,28 @@ const (
 
 // Tunnel 隧道基本信息
 type Tunnel struct {
-	ID            int64        `json:"id"`
-	InstanceID    string       `json:"instanceId"`
-	Name          string       `json:"name"`
-	EndpointID    int64        `json:"endpointId"`
-	Mode          TunnelMode   `json:"mode"`
-	TunnelAddress string       `json:"tunnelAddress"`
-	TunnelPort    int          `json:"tunnelPort"`
-	TargetAddress string       `json:"targetAddress"`
-	TargetPort    int          `json:"targetPort"`
-	TLSMode       TLSMode      `json:"tlsMode"`
-	CertPath      string       `json:"certPath,omitempty"`
-	KeyPath       string       `json:"keyPath,omitempty"`
-	LogLevel      LogLevel     `json:"logLevel"`
-	CommandLine   string       `json:"commandLine"`
-	Min           int          `json:"min,omitempty"`
-	Max           int          `json:"max,omitempty"`
-	Status        TunnelStatus `json:"status"`
-	CreatedAt     time.Time    `json:"createdAt"`
-	UpdatedAt     time.Time    `json:"updatedAt"`
+	ID            int64             `json:"id"`
+	InstanceID    string            `json:"instanceId"`
+	Name          string            `json:"name"`
+	EndpointID    int64             `json:"endpointId"`
+	Mode          TunnelMode        `json:"mode"`
+	TunnelAddress string            `json:"tunnelAddress"`
+	TunnelPort    int               `json:"tunnelPort"`
+	TargetAddress string            `json:"targetAddress"`
+	TargetPort    int               `json:"targetPort"`
+	TLSMode       TLSMode           `json:"tlsMode"`
+	CertPath      string            `json:"certPath,omitempty"`
+	KeyPath       string            `json:"keyPath,omitempty"`
+	LogLevel      LogLevel          `json:"logLevel"`
+	CommandLine   string            `json:"commandLine"`
+	Min           int               `json:"min,omitempty"`
+	Max           int               `json:"max,omitempty"`
+	ExtraParams   map[string]string `json:"extraParams,omitempty"`
+	Labels        labels.Set        `json:"labels,omitempty"`
+	Managed       bool              `json:"managed"` // 由声明式配置管理
+	Status        TunnelStatus      `json:"status"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
 }
 
 // TunnelWithStats 带统计信息的隧道
@@ -106,6 +112,14 @@ type CreateTunnelRequest struct {
 	LogLevel      LogLevel `json:"logLevel"`
 	Min           int      `json:"min,omitempty"`
 	Max           int      `json:"max,omitempty"`
+	// ExtraParams 未单独建模的实例参数，原样追加到命令行
+	ExtraParams map[string]string `json:"extraParams,omitempty"`
+	// Labels 键值标签
+	Labels labels.Set `json:"labels,omitempty"`
+	// Actor 操作者，记录到配置历史
+	Actor string `json:"-"`
+	// IgnorePortPolicy 仅检查端口占用，不检查允许范围与保留端口（恢复原有隧道时使用）
+	IgnorePortPolicy bool `json:"-"`
 }
 
 // UpdateTunnelRequest 更新隧道请求
@@ -122,6 +136,12 @@ type UpdateTunnelRequest struct {
 	LogLevel      LogLevel `json:"logLevel,omitempty"`
 	Min           int      `json:"min,omitempty"`
 	Max           int      `json:"max,omitempty"`
+	// ExtraParams 为 nil 时保持不变，非 nil 时整体替换（空 map 表示清空）
+	ExtraParams map[string]string `json:"extraParams,omitempty"`
+	// Labels 为 nil 时保持不变，非 nil 时整体替换
+	Labels labels.Set `json:"labels,omitempty"`
+	// Actor 操作者，记录到配置历史
+	Actor string `json:"-"`
 }
 
 // TunnelActionRequest 隧道操作请求
@@ -130,10 +150,14 @@ type TunnelActionRequest struct {
 	Action     string `json:"action" validate:"required,oneof=start stop restart"`
 }
 
+// ManagedDriftWarning 手动修改受管理隧道时返回的提示
+const ManagedDriftWarning = "该隧道由声明式配置管理，手动修改将与配置产生差异，并在下次 apply 时被覆盖"
+
 // TunnelResponse API 响应
 type TunnelResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
 	Error   string      `json:"error,omitempty"`
 	Tunnel  interface{} `json:"tunnel,omitempty"`
+	Warning string      `json:"warning,omitempty"`
 }
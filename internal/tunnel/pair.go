@@ -0,0 +1,357 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrPairNotFound 隧道对不存在
+var ErrPairNotFound = errors.New("隧道对不存在")
+
+// 隧道对状态
+const (
+	PairRunning = "running" // 两端均运行中
+	PairStopped = "stopped" // 两端均已停止
+	PairPartial = "partial" // 两端状态不一致
+	PairBroken  = "broken"  // 任一端隧道已不存在
+)
+
+// pairDeleteTimeout 删除隧道对时等待 SSE 同步的最长时间
+const pairDeleteTimeout = 3 * time.Second
+
+// PairSide 隧道对中一端的摘要，隧道已被删除时为 nil
+type PairSide struct {
+	ID           int64        `json:"id"`
+	InstanceID   string       `json:"instanceId"`
+	Name         string       `json:"name"`
+	EndpointID   int64        `json:"endpointId"`
+	EndpointName string       `json:"endpointName"`
+	Status       TunnelStatus `json:"status"`
+	TunnelPort   int          `json:"tunnelPort"`
+}
+
+// Pair 由 server 与 client 两条隧道组成的隧道对，启停、重命名与删除同时作用于两端
+type Pair struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	ServerTunnelID int64     `json:"serverTunnelId"`
+	ClientTunnelID int64     `json:"clientTunnelId"`
+	Template       string    `json:"template,omitempty"`
+	Status         string    `json:"status"`
+	Server         *PairSide `json:"server"`
+	Client         *PairSide `json:"client"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// CreatePairRequest 关联已有隧道为隧道对
+type CreatePairRequest struct {
+	Name           string `json:"name"`
+	ServerTunnelID int64  `json:"serverTunnelId"`
+	ClientTunnelID int64  `json:"clientTunnelId"`
+	Template       string `json:"template,omitempty"`
+}
+
+// sides 按操作顺序返回两端：启动时先 server 后 client，停止 / 删除时反之
+func (p *Pair) sides(serverFirst bool) []*PairSide {
+	if serverFirst {
+		return []*PairSide{p.Server, p.Client}
+	}
+	return []*PairSide{p.Client, p.Server}
+}
+
+// ListPairs 返回所有隧道对
+func (s *Service) ListPairs() ([]Pair, error) {
+	rows, err := s.db.Query(`SELECT id, name, serverTunnelId, clientTunnelId, template, createdAt, updatedAt FROM "TunnelPair" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []Pair
+	for rows.Next() {
+		p, err := scanPair(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pairs = append(pairs, *p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range pairs {
+		if err := s.fillPair(&pairs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return pairs, nil
+}
+
+// GetPair 按 ID 获取隧道对
+func (s *Service) GetPair(id int64) (*Pair, error) {
+	row := s.db.QueryRow(`SELECT id, name, serverTunnelId, clientTunnelId, template, createdAt, updatedAt FROM "TunnelPair" WHERE id = ?`, id)
+	p, err := scanPair(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrPairNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, s.fillPair(p)
+}
+
+// CreatePair 将一条 server 隧道与一条 client 隧道关联为隧道对
+func (s *Service) CreatePair(req CreatePairRequest) (*Pair, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, errors.New("缺少隧道对名称")
+	}
+	server, err := s.getTunnel(req.ServerTunnelID)
+	if err != nil {
+		return nil, fmt.Errorf("server 端: %w", err)
+	}
+	client, err := s.getTunnel(req.ClientTunnelID)
+	if err != nil {
+		return nil, fmt.Errorf("client 端: %w", err)
+	}
+	if server.Mode != ModeServer {
+		return nil, fmt.Errorf("隧道 %s 不是 server 模式", server.Name)
+	}
+	if client.Mode != ModeClient {
+		return nil, fmt.Errorf("隧道 %s 不是 client 模式", client.Name)
+	}
+
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "TunnelPair" WHERE name = ?`, req.Name).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("隧道对名称已存在")
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "TunnelPair" WHERE serverTunnelId IN (?, ?) OR clientTunnelId IN (?, ?)`,
+		server.ID, client.ID, server.ID, client.ID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("隧道已属于其它隧道对")
+	}
+
+	now := time.Now()
+	res, err := s.db.Exec(`INSERT INTO "TunnelPair" (name, serverTunnelId, clientTunnelId, template, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?)`,
+		req.Name, server.ID, client.ID, req.Template, now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[API] 创建隧道对 %s: server=%s client=%s", req.Name, server.Name, client.Name)
+	return s.GetPair(id)
+}
+
+// ControlPair 启动 / 停止 / 重启隧道对：启动与重启先 server 后 client，停止先 client 后 server。
+// 某一端失败时立即返回，不回退已完成的一端
+func (s *Service) ControlPair(id int64, action string) error {
+	p, err := s.GetPair(id)
+	if err != nil {
+		return err
+	}
+	if p.Status == PairBroken {
+		return fmt.Errorf("隧道对 %s 不完整，无法%s", p.Name, action)
+	}
+	log.Infof("[API] 控制隧道对 %s => %s", p.Name, action)
+	for _, side := range p.sides(action != "stop") {
+		if err := s.ControlTunnel(TunnelActionRequest{InstanceID: side.InstanceID, Action: action}); err != nil {
+			return fmt.Errorf("%s: %w", side.Name, err)
+		}
+	}
+	return nil
+}
+
+// RenamePair 重命名隧道对，两端隧道分别重命名为 <name>-server 与 <name>-client
+func (s *Service) RenamePair(id int64, name, actor string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("缺少隧道对名称")
+	}
+	p, err := s.GetPair(id)
+	if err != nil {
+		return err
+	}
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "TunnelPair" WHERE name = ? AND id <> ?`, name, id).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("隧道对名称已存在")
+	}
+
+	// 依次重命名两端，失败时恢复已重命名的一端
+	var renamed []*PairSide
+	for _, side := range []*PairSide{p.Server, p.Client} {
+		if side == nil {
+			continue
+		}
+		newName := name + "-" + sideSuffix(p, side)
+		if side.Name == newName {
+			continue
+		}
+		if err := s.RenameTunnel(side.ID, newName, actor); err != nil {
+			for _, r := range renamed {
+				_ = s.RenameTunnel(r.ID, r.Name, actor)
+			}
+			return fmt.Errorf("%s: %w", side.Name, err)
+		}
+		renamed = append(renamed, side)
+	}
+
+	if _, err := s.db.Exec(`UPDATE "TunnelPair" SET name = ?, updatedAt = ? WHERE id = ?`, name, time.Now(), id); err != nil {
+		return err
+	}
+	log.Infof("[API] 重命名隧道对 %s => %s", p.Name, name)
+	return nil
+}
+
+// DeletePair 删除隧道对及两端隧道（先 client 后 server），recycle 为 true 时移入回收站
+func (s *Service) DeletePair(id int64, recycle bool, actor string) error {
+	p, err := s.GetPair(id)
+	if err != nil {
+		return err
+	}
+	log.Infof("[API] 删除隧道对 %s", p.Name)
+	for _, side := range p.sides(false) {
+		if side == nil {
+			continue
+		}
+		if err := s.DeleteTunnelAndWait(side.InstanceID, pairDeleteTimeout, recycle, actor); err != nil {
+			return fmt.Errorf("%s: %w", side.Name, err)
+		}
+	}
+	_, err = s.db.Exec(`DELETE FROM "TunnelPair" WHERE id = ?`, id)
+	return err
+}
+
+// UnlinkPair 解除隧道对关联，保留两端隧道
+func (s *Service) UnlinkPair(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM "TunnelPair" WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPairNotFound
+	}
+	return nil
+}
+
+// PairOf 返回隧道所在的隧道对（不加载两端状态），不属于隧道对时返回 nil
+func (s *Service) PairOf(tunnelID int64) (*Pair, error) {
+	row := s.db.QueryRow(`SELECT id, name, serverTunnelId, clientTunnelId, template, createdAt, updatedAt FROM "TunnelPair" WHERE serverTunnelId = ? OR clientTunnelId = ?`, tunnelID, tunnelID)
+	p, err := scanPair(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// InheritPair 将旧隧道删除前所在的隧道对 p 关联到重建后的新隧道（保留隧道对的 ID、名称与创建时间）。
+// 用于“删除旧实例 + 创建新实例”方式的编辑（删除旧隧道时隧道对可能已被解除，也可能仍指向旧隧道），p 为 nil 时不做处理
+func (s *Service) InheritPair(p *Pair, oldID, newID int64) error {
+	if p == nil || oldID == newID {
+		return nil
+	}
+	serverID, clientID := p.ServerTunnelID, p.ClientTunnelID
+	switch oldID {
+	case serverID:
+		serverID = newID
+	case clientID:
+		clientID = newID
+	default:
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM "TunnelPair" WHERE id = ?`, p.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO "TunnelPair" (id, name, serverTunnelId, clientTunnelId, template, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, serverID, clientID, nullableString(p.Template), p.CreatedAt, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// unlinkTunnel 隧道被删除后解除其所在隧道对
+func (s *Service) unlinkTunnel(tunnelID int64) {
+	_, _ = s.db.Exec(`DELETE FROM "TunnelPair" WHERE serverTunnelId = ? OR clientTunnelId = ?`, tunnelID, tunnelID)
+}
+
+// fillPair 加载两端隧道并计算隧道对状态
+func (s *Service) fillPair(p *Pair) error {
+	var err error
+	if p.Server, err = s.pairSide(p.ServerTunnelID); err != nil {
+		return err
+	}
+	if p.Client, err = s.pairSide(p.ClientTunnelID); err != nil {
+		return err
+	}
+
+	switch {
+	case p.Server == nil || p.Client == nil:
+		p.Status = PairBroken
+	case p.Server.Status == StatusRunning && p.Client.Status == StatusRunning:
+		p.Status = PairRunning
+	case p.Server.Status == StatusStopped && p.Client.Status == StatusStopped:
+		p.Status = PairStopped
+	default:
+		p.Status = PairPartial
+	}
+	return nil
+}
+
+// pairSide 加载隧道摘要，隧道不存在时返回 nil
+func (s *Service) pairSide(id int64) (*PairSide, error) {
+	var side PairSide
+	var instanceID, endpointName sql.NullString
+	var status string
+	err := s.db.QueryRow(`
+		SELECT t.id, t.instanceId, t.name, t.endpointId, e.name, t.status, t.tunnelPort
+		FROM "Tunnel" t
+		LEFT JOIN "Endpoint" e ON t.endpointId = e.id
+		WHERE t.id = ?`, id).Scan(&side.ID, &instanceID, &side.Name, &side.EndpointID, &endpointName, &status, &side.TunnelPort)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	side.InstanceID = instanceID.String
+	side.EndpointName = endpointName.String
+	side.Status = TunnelStatus(status)
+	return &side, nil
+}
+
+// sideSuffix 返回隧道在隧道对中的角色
+func sideSuffix(p *Pair, side *PairSide) string {
+	if side.ID == p.ServerTunnelID {
+		return "server"
+	}
+	return "client"
+}
+
+func scanPair(row interface{ Scan(...interface{}) error }) (*Pair, error) {
+	var p Pair
+	var template sql.NullString
+	if err := row.Scan(&p.ID, &p.Name, &p.ServerTunnelID, &p.ClientTunnelID, &template, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.Template = template.String
+	return &p, nil
+}
@@ -0,0 +1,470 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/nodepassurl"
+)
+
+// 端口占用来源
+const (
+	PortSourceTunnel   = "tunnel"   // Tunnel 表中的隧道
+	PortSourceInstance = "instance" // 主控上存在但未记录的实例
+)
+
+// 端口不可用的原因
+const (
+	PortInUse      = "in_use"
+	PortReserved   = "reserved"
+	PortNotAllowed = "not_allowed"
+)
+
+// suggestFrom 未指定起始端口且没有允许范围时，建议端口从此开始查找
+const suggestFrom = 10000
+
+// ListensLocally 判断隧道端口是否在所属主控上监听：server 模式总是监听，
+// client 模式仅在未指定隧道地址（单端转发）时监听，否则隧道端口属于远端 server
+func ListensLocally(mode TunnelMode, tunnelAddress string) bool {
+	return mode == ModeServer || tunnelAddress == ""
+}
+
+// PortRange 端口范围（含两端）
+type PortRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// PortRanges 端口范围列表，文本形式为 "10000-20000,30000"
+type PortRanges []PortRange
+
+// ParsePortRanges 解析 "10000-20000,30000" 形式的端口范围，空字符串返回空列表
+func ParsePortRanges(s string) (PortRanges, error) {
+	var out PortRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		a, err1 := strconv.Atoi(from)
+		b, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || a < 1 || b > 65535 || a > b {
+			return nil, fmt.Errorf("无效的端口范围 %q", part)
+		}
+		out = append(out, PortRange{From: a, To: b})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].From < out[j].From })
+	return out, nil
+}
+
+// Contains 端口是否位于任一范围内
+func (r PortRanges) Contains(port int) bool {
+	for _, pr := range r {
+		if port >= pr.From && port <= pr.To {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PortRanges) String() string {
+	parts := make([]string, len(r))
+	for i, pr := range r {
+		if pr.From == pr.To {
+			parts[i] = strconv.Itoa(pr.From)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", pr.From, pr.To)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// MarshalText 以文本形式序列化，便于在 JSON 与配置中使用
+func (r PortRanges) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText 解析文本形式的端口范围
+func (r *PortRanges) UnmarshalText(b []byte) error {
+	v, err := ParsePortRanges(string(b))
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// PortPolicy 主控的端口限制：Allowed 为空表示不限制，Reserved 中的端口不可使用
+type PortPolicy struct {
+	Allowed  PortRanges `json:"allowed"`
+	Reserved PortRanges `json:"reserved"`
+}
+
+// PortSettings 端点单独设置的端口范围，nil 表示使用全局配置
+type PortSettings struct {
+	Allowed  *PortRanges `json:"allowed"`
+	Reserved *PortRanges `json:"reserved"`
+}
+
+// PortUsage 主控上被隧道监听的端口
+type PortUsage struct {
+	Port       int    `json:"port"`
+	Source     string `json:"source"`
+	Mode       string `json:"mode"`
+	TunnelID   int64  `json:"tunnelId,omitempty"`
+	Name       string `json:"name,omitempty"`
+	InstanceID string `json:"instanceId,omitempty"`
+}
+
+// PortInventory 主控端口清单
+type PortInventory struct {
+	EndpointID int64        `json:"endpointId"`
+	Settings   PortSettings `json:"settings"`
+	Policy     PortPolicy   `json:"policy"`
+	Used       []PortUsage  `json:"used"`
+	// Conflicts 被多条隧道或实例同时监听的端口
+	Conflicts []int `json:"conflicts,omitempty"`
+	// LiveError 获取主控实例列表失败的原因，此时清单仅包含数据库中的隧道
+	LiveError string `json:"liveError,omitempty"`
+}
+
+// PortError 隧道端口不可用
+type PortError struct {
+	Port   int    `json:"port"`
+	Reason string `json:"reason"`
+	// Owner 占用端口的隧道或实例
+	Owner string `json:"owner,omitempty"`
+	// Suggestion 建议改用的空闲端口，0 表示没有
+	Suggestion int `json:"suggestion,omitempty"`
+}
+
+func (e *PortError) Error() string {
+	var msg string
+	switch e.Reason {
+	case PortInUse:
+		msg = fmt.Sprintf("端口 %d 已被 %s 占用", e.Port, e.Owner)
+	case PortReserved:
+		msg = fmt.Sprintf("端口 %d 为保留端口", e.Port)
+	default:
+		msg = fmt.Sprintf("端口 %d 不在允许的范围内", e.Port)
+	}
+	if e.Suggestion > 0 {
+		msg += fmt.Sprintf("，可使用端口 %d", e.Suggestion)
+	}
+	return msg
+}
+
+// PortPool 主控端口分配视图，用于预检与建议空闲端口
+type PortPool struct {
+	policy PortPolicy
+	used   map[int]string
+}
+
+// NewPortPool 按端口限制创建不含占用记录的端口池
+func NewPortPool(policy PortPolicy) *PortPool {
+	return &PortPool{policy: policy, used: make(map[int]string)}
+}
+
+// Check 检查端口能否使用，可用时返回 nil
+func (p *PortPool) Check(port int) *PortError {
+	if owner, ok := p.used[port]; ok {
+		return &PortError{Port: port, Reason: PortInUse, Owner: owner}
+	}
+	if p.policy.Reserved.Contains(port) {
+		return &PortError{Port: port, Reason: PortReserved}
+	}
+	if len(p.policy.Allowed) > 0 && !p.policy.Allowed.Contains(port) {
+		return &PortError{Port: port, Reason: PortNotAllowed}
+	}
+	return nil
+}
+
+// Take 将端口记为 owner 占用
+func (p *PortPool) Take(port int, owner string) {
+	p.used[port] = owner
+}
+
+// Claim 检查端口可用后记为 owner 占用
+func (p *PortPool) Claim(port int, owner string) *PortError {
+	if err := p.Check(port); err != nil {
+		return err
+	}
+	p.Take(port, owner)
+	return nil
+}
+
+// Next 从 from 开始（含）查找可用端口，到达 65535 后从头继续；from 为 0 时从允许范围的起点开始
+func (p *PortPool) Next(from int) (int, error) {
+	if from <= 0 {
+		from = suggestFrom
+		if len(p.policy.Allowed) > 0 {
+			from = p.policy.Allowed[0].From
+		}
+	}
+	for port := from; port <= 65535; port++ {
+		if p.Check(port) == nil {
+			return port, nil
+		}
+	}
+	for port := 1024; port < from; port++ {
+		if p.Check(port) == nil {
+			return port, nil
+		}
+	}
+	return 0, errors.New("主控上没有可用端口")
+}
+
+// Suggest 从 from 开始建议 count 个可用端口
+func (p *PortPool) Suggest(from, count int) ([]int, error) {
+	pool := &PortPool{policy: p.policy, used: make(map[int]string, len(p.used)+count)}
+	for port, owner := range p.used {
+		pool.used[port] = owner
+	}
+	ports := make([]int, 0, count)
+	for len(ports) < count {
+		port, err := pool.Next(from)
+		if err != nil {
+			if len(ports) > 0 {
+				return ports, nil
+			}
+			return nil, err
+		}
+		pool.Take(port, "")
+		ports = append(ports, port)
+		from = port + 1
+	}
+	return ports, nil
+}
+
+// GlobalPortPool 按全局端口限制创建空端口池，用于尚未写入数据库的端点（如导入）
+func (s *Service) GlobalPortPool() *PortPool {
+	return NewPortPool(PortPolicy{Allowed: s.cfg.AllowedPorts, Reserved: s.cfg.ReservedPorts})
+}
+
+// PortPolicy 返回主控生效的端口限制：允许范围取端点设置，未设置时使用全局配置；
+// 保留范围为全局与端点设置的并集
+func (s *Service) PortPolicy(endpointID int64) (PortSettings, PortPolicy, error) {
+	var allowed, reserved sql.NullString
+	err := s.db.QueryRow(`SELECT allowedPorts, reservedPorts FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&allowed, &reserved)
+	if err == sql.ErrNoRows {
+		return PortSettings{}, PortPolicy{}, errors.New("指定的端点不存在")
+	}
+	if err != nil {
+		return PortSettings{}, PortPolicy{}, err
+	}
+
+	var settings PortSettings
+	policy := PortPolicy{Allowed: s.cfg.AllowedPorts, Reserved: append(PortRanges{}, s.cfg.ReservedPorts...)}
+	if allowed.Valid {
+		r, _ := ParsePortRanges(allowed.String)
+		settings.Allowed = &r
+		policy.Allowed = r
+	}
+	if reserved.Valid {
+		r, _ := ParsePortRanges(reserved.String)
+		settings.Reserved = &r
+		policy.Reserved = append(policy.Reserved, r...)
+	}
+	return settings, policy, nil
+}
+
+// SetPortSettings 设置端点的端口范围，nil 表示恢复使用全局配置
+func (s *Service) SetPortSettings(endpointID int64, settings PortSettings) error {
+	value := func(r *PortRanges) interface{} {
+		if r == nil {
+			return nil
+		}
+		return r.String()
+	}
+	res, err := s.db.Exec(`UPDATE "Endpoint" SET allowedPorts = ?, reservedPorts = ? WHERE id = ?`,
+		value(settings.Allowed), value(settings.Reserved), endpointID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("指定的端点不存在")
+	}
+	return nil
+}
+
+// PortInventory 汇总主控上被监听的端口：数据库中的隧道，以及 live 为 true 时主控上未记录的实例
+func (s *Service) PortInventory(endpointID int64, live bool) (*PortInventory, error) {
+	settings, policy, err := s.PortPolicy(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	var client *nodepass.Client
+	if live {
+		if client, err = s.endpointClient(endpointID); err != nil {
+			return nil, err
+		}
+	}
+	inv := &PortInventory{EndpointID: endpointID, Settings: settings, Policy: policy}
+	inv.Used, err = s.portUsage(endpointID, 0, client)
+	if err != nil && inv.Used == nil {
+		return nil, err
+	}
+	if err != nil {
+		inv.LiveError = err.Error()
+	}
+
+	count := make(map[int]int, len(inv.Used))
+	for _, u := range inv.Used {
+		count[u.Port]++
+		if count[u.Port] == 2 {
+			inv.Conflicts = append(inv.Conflicts, u.Port)
+		}
+	}
+	sort.Ints(inv.Conflicts)
+	return inv, nil
+}
+
+// PortPool 返回主控的端口池，excludeID 对应的隧道（及其实例）不计入占用；live 为 true 时包含主控上未记录的实例
+func (s *Service) PortPool(endpointID, excludeID int64, live bool) (*PortPool, error) {
+	var client *nodepass.Client
+	if live {
+		var err error
+		if client, err = s.endpointClient(endpointID); err != nil {
+			return nil, err
+		}
+	}
+	return s.portPool(endpointID, excludeID, client)
+}
+
+// portPool 构建端口池；client 不为空时尝试读取主控实例，失败时仅使用数据库记录
+func (s *Service) portPool(endpointID, excludeID int64, client *nodepass.Client) (*PortPool, error) {
+	_, policy, err := s.PortPolicy(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.portUsage(endpointID, excludeID, client)
+	if used == nil && err != nil {
+		return nil, err
+	}
+	if err != nil {
+		log.Warnf("[API] 获取主控 %d 实例列表失败，端口检查仅使用本地记录: %v", endpointID, err)
+	}
+	return usagePool(policy, used), nil
+}
+
+// usagePool 按端口限制与占用记录创建端口池
+func usagePool(policy PortPolicy, used []PortUsage) *PortPool {
+	pool := NewPortPool(policy)
+	for _, u := range used {
+		owner := u.Name
+		if owner == "" {
+			owner = "实例 " + u.InstanceID
+		}
+		pool.Take(u.Port, owner)
+	}
+	return pool
+}
+
+// SuggestPorts 在主控上建议 count 个可用的隧道端口，from 为起始端口（0 表示按允许范围）
+func (s *Service) SuggestPorts(endpointID int64, from, count int) ([]int, error) {
+	pool, err := s.PortPool(endpointID, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return pool.Suggest(from, count)
+}
+
+// CheckPort 端口预检，excludeID 为正在修改的隧道；端口不可用时返回 *PortError（附带建议端口）
+func (s *Service) CheckPort(endpointID, excludeID int64, mode TunnelMode, tunnelAddress string, port int) error {
+	if port <= 0 || !ListensLocally(mode, tunnelAddress) {
+		return nil
+	}
+	client, err := s.endpointClient(endpointID)
+	if err != nil {
+		return err
+	}
+	return s.checkPort(endpointID, excludeID, client, mode, tunnelAddress, port)
+}
+
+// checkPort 创建 / 更新前的端口预检：端口需在允许范围内、不在保留范围且未被其它隧道或实例监听
+func (s *Service) checkPort(endpointID, excludeID int64, client *nodepass.Client, mode TunnelMode, tunnelAddress string, port int) error {
+	if port <= 0 || !ListensLocally(mode, tunnelAddress) {
+		return nil
+	}
+	pool, err := s.portPool(endpointID, excludeID, client)
+	if err != nil {
+		return err
+	}
+	if perr := pool.Check(port); perr != nil {
+		perr.Suggestion, _ = pool.Next(port + 1)
+		return perr
+	}
+	return nil
+}
+
+// portUsage 读取数据库中监听端口的隧道；client 不为空时追加主控上未记录的实例。
+// 读取主控失败时返回数据库结果与错误
+func (s *Service) portUsage(endpointID, excludeID int64, client *nodepass.Client) ([]PortUsage, error) {
+	rows, err := s.db.Query(`SELECT id, name, mode, instanceId, tunnelAddress, tunnelPort FROM "Tunnel" WHERE endpointId = ? ORDER BY id`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	used := []PortUsage{}
+	known := make(map[string]bool)
+	for rows.Next() {
+		var id int64
+		var name, mode string
+		var instanceID, address sql.NullString
+		var port int
+		if err := rows.Scan(&id, &name, &mode, &instanceID, &address, &port); err != nil {
+			return nil, err
+		}
+		if instanceID.String != "" {
+			known[instanceID.String] = true
+		}
+		if id == excludeID || port == 0 || !ListensLocally(TunnelMode(mode), address.String) {
+			continue
+		}
+		used = append(used, PortUsage{Port: port, Source: PortSourceTunnel, Mode: mode, TunnelID: id, Name: name, InstanceID: instanceID.String})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return used, nil
+	}
+
+	instances, err := client.GetInstances()
+	if err != nil {
+		return used, err
+	}
+	for _, inst := range instances {
+		if inst.Type == "" || known[inst.ID] {
+			continue
+		}
+		u, err := nodepassurl.Parse(inst.URL)
+		if err != nil || u.TunnelPort == 0 || !ListensLocally(TunnelMode(inst.Type), u.TunnelAddress) {
+			continue
+		}
+		used = append(used, PortUsage{Port: u.TunnelPort, Source: PortSourceInstance, Mode: inst.Type, InstanceID: inst.ID})
+	}
+	return used, nil
+}
+
+// endpointClient 创建主控 API 客户端
+func (s *Service) endpointClient(endpointID int64) (*nodepass.Client, error) {
+	var url, apiPath, apiKey string
+	err := s.db.QueryRow(`SELECT url, apiPath, apiKey FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&url, &apiPath, &apiKey)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("指定的端点不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nodepass.NewClient(url, apiPath, apiKey, nil), nil
+}
@@ -0,0 +1,158 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"NodePassDash/internal/labels"
+	"NodePassDash/internal/nodepassurl"
+)
+
+// ErrRecycleNotFound 回收站记录不存在
+var ErrRecycleNotFound = errors.New("回收站记录不存在")
+
+// maxNameSuffix 自动重命名时尝试的最大序号
+const maxNameSuffix = 100
+
+// RestoreRequest 从回收站恢复隧道
+type RestoreRequest struct {
+	// EndpointID 恢复到的主控，为 0 时使用原主控
+	EndpointID int64 `json:"endpointId,omitempty"`
+	// Name 恢复后的名称，为空时沿用原名称；原名称已被占用时自动追加 -restored 后缀
+	Name string `json:"name,omitempty"`
+	// IgnorePortPolicy 仅检查端口占用，不检查允许范围与保留端口（撤销操作时恢复原隧道使用）
+	IgnorePortPolicy bool `json:"-"`
+}
+
+// RestoreResult 恢复结果
+type RestoreResult struct {
+	Tunnel *Tunnel `json:"tunnel"`
+	// Renamed 是否因名称冲突自动重命名
+	Renamed bool `json:"renamed"`
+	// PreviousInstanceID 回收前的实例 ID
+	PreviousInstanceID string `json:"previousInstanceId,omitempty"`
+	// RelinkedLogs 关联到新实例的历史 SSE 记录数
+	RelinkedLogs int64 `json:"relinkedLogs"`
+}
+
+// RestoreRecycled 按主控 endpointID 回收站中记录保存的命令行，在原主控（或指定主控）上重新创建实例，
+// 将历史 SSE 记录关联到新实例后删除回收站记录
+func (s *Service) RestoreRecycled(endpointID, recycleID int64, req RestoreRequest) (*RestoreResult, error) {
+	var rec struct {
+		Name        string
+		EndpointID  int64
+		CommandLine string
+		InstanceID  sql.NullString
+		Labels      sql.NullString
+	}
+	err := s.db.QueryRow(`SELECT name, endpointId, commandLine, instanceId, labels FROM "TunnelRecycle" WHERE id = ? AND endpointId = ?`, recycleID, endpointID).
+		Scan(&rec.Name, &rec.EndpointID, &rec.CommandLine, &rec.InstanceID, &rec.Labels)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecycleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := nodepassurl.Parse(rec.CommandLine)
+	if err != nil {
+		return nil, fmt.Errorf("回收站记录的命令行无效: %w", err)
+	}
+
+	target := req.EndpointID
+	if target == 0 {
+		target = rec.EndpointID
+	}
+
+	name, renamed, err := s.restoreName(rec.Name, strings.TrimSpace(req.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("[API] 从回收站恢复隧道 %s => 主控 %d, 名称 %s", rec.Name, target, name)
+	create := requestFromURL(u, target, name)
+	create.Labels = labels.Decode(rec.Labels.String)
+	create.IgnorePortPolicy = req.IgnorePortPolicy
+	t, err := s.createTunnel(create, u)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RestoreResult{Tunnel: t, Renamed: renamed, PreviousInstanceID: rec.InstanceID.String}
+
+	// 关联历史日志并移除回收站记录
+	tx, err := s.db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+	if rec.InstanceID.Valid && rec.InstanceID.String != "" {
+		r, err := tx.Exec(`UPDATE "EndpointSSE" SET endpointId = ?, instanceId = ? WHERE endpointId = ? AND instanceId = ?`,
+			target, t.InstanceID, rec.EndpointID, rec.InstanceID.String)
+		if err != nil {
+			return res, err
+		}
+		res.RelinkedLogs, _ = r.RowsAffected()
+	}
+	if _, err := tx.Exec(`DELETE FROM "TunnelRecycle" WHERE id = ?`, recycleID); err != nil {
+		return res, err
+	}
+	if err := tx.Commit(); err != nil {
+		return res, err
+	}
+
+	msg := fmt.Sprintf("从回收站恢复（原实例 %s）", rec.InstanceID.String)
+	if renamed {
+		msg += fmt.Sprintf("，原名称 %s 已被占用", rec.Name)
+	}
+	_, _ = s.db.Exec(`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status, message) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Name, "restore", "success", msg)
+	return res, nil
+}
+
+// restoreName 确定恢复后的名称：指定名称冲突时报错，沿用原名称冲突时追加 -restored[-N]
+func (s *Service) restoreName(original, requested string) (string, bool, error) {
+	if requested != "" {
+		taken, err := s.nameTaken(requested)
+		if err != nil {
+			return "", false, err
+		}
+		if taken {
+			return "", false, errors.New("隧道名称已存在")
+		}
+		return requested, false, nil
+	}
+
+	taken, err := s.nameTaken(original)
+	if err != nil || !taken {
+		return original, false, err
+	}
+	name, err := s.uniqueName(original, "-restored")
+	return name, err == nil, err
+}
+
+// uniqueName 生成未被占用的名称：依次尝试 <base><suffix>、<base><suffix>-2 ...
+func (s *Service) uniqueName(base, suffix string) (string, error) {
+	for i := 1; i <= maxNameSuffix; i++ {
+		candidate := base + suffix
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%s-%d", base, suffix, i)
+		}
+		taken, err := s.nameTaken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("无法为 %s 生成可用名称，请指定新名称", base)
+}
+
+func (s *Service) nameTaken(name string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Tunnel" WHERE name = ?)`, name).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,98 @@
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+
+	"NodePassDash/internal/nodepass"
+)
+
+// CreateError 多隧道创建失败：记录失败的步骤以及回滚情况
+type CreateError struct {
+	// Step 失败的步骤（从 1 开始）
+	Step int
+	Name string
+	Err  error
+	// RolledBack 已回滚（远端实例与本地记录均已删除）的隧道名称
+	RolledBack []string
+	// RollbackErrors 回滚失败的隧道及原因，这些实例可能仍残留在主控上
+	RollbackErrors []string
+}
+
+func (e *CreateError) Error() string {
+	msg := fmt.Sprintf("创建隧道 %s 失败: %v", e.Name, e.Err)
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf("，已回滚 %d 条隧道", len(e.RolledBack))
+	}
+	if len(e.RollbackErrors) > 0 {
+		msg += "；回滚失败: " + strings.Join(e.RollbackErrors, "; ")
+	}
+	return msg
+}
+
+func (e *CreateError) Unwrap() error { return e.Err }
+
+// CreateTunnels 依次创建多条隧道（可跨主控）。任一步失败时按相反顺序删除此前已创建的实例，
+// 返回 *CreateError；全部成功时按请求顺序返回创建结果
+func (s *Service) CreateTunnels(reqs []CreateTunnelRequest) ([]*Tunnel, error) {
+	created := make([]*Tunnel, 0, len(reqs))
+	for i, req := range reqs {
+		log.Infof("[API] 批量创建步骤%d/%d: %s", i+1, len(reqs), req.Name)
+		t, err := s.CreateTunnel(req)
+		if err != nil {
+			log.Errorf("[API] 创建隧道 %s 失败，开始回滚: %v", req.Name, err)
+			cerr := &CreateError{Step: i + 1, Name: req.Name, Err: err}
+			cerr.RolledBack, cerr.RollbackErrors = s.rollback(created)
+			return nil, cerr
+		}
+		created = append(created, t)
+	}
+	return created, nil
+}
+
+// RollbackTunnels 删除已创建的隧道（用于创建后续步骤失败时的补偿），返回汇总错误
+func (s *Service) RollbackTunnels(created []*Tunnel) error {
+	if _, failed := s.rollback(created); len(failed) > 0 {
+		return fmt.Errorf("回滚失败: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// rollback 按相反顺序删除隧道实例及本地记录
+func (s *Service) rollback(created []*Tunnel) (done, failed []string) {
+	for i := len(created) - 1; i >= 0; i-- {
+		t := created[i]
+		if err := s.rollbackTunnel(t, "批量创建失败，已回滚"); err != nil {
+			log.Errorf("[API] 回滚隧道 %s 失败: %v", t.Name, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", t.Name, err))
+			continue
+		}
+		log.Infof("[API] 已回滚隧道 %s", t.Name)
+		done = append(done, t.Name)
+	}
+	return done, failed
+}
+
+// rollbackTunnel 删除远端实例后移除本地记录，message 写入操作日志；远端删除失败时保留本地记录以便人工处理
+func (s *Service) rollbackTunnel(t *Tunnel, message string) error {
+	var url, apiPath, apiKey string
+	if err := s.db.QueryRow(`SELECT url, apiPath, apiKey FROM "Endpoint" WHERE id = ?`, t.EndpointID).
+		Scan(&url, &apiPath, &apiKey); err != nil {
+		return err
+	}
+	npClient := nodepass.NewClient(url, apiPath, apiKey, nil)
+	if err := npClient.DeleteInstance(t.InstanceID); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = ?`, t.ID); err != nil {
+		return err
+	}
+	_, _ = s.db.Exec(`DELETE FROM "EndpointSSE" WHERE instanceId = ?`, t.InstanceID)
+	_, _ = s.db.Exec(`UPDATE "Endpoint" SET tunnelCount = (
+		SELECT COUNT(*) FROM "Tunnel" WHERE endpointId = ?
+	) WHERE id = ?`, t.EndpointID, t.EndpointID)
+	_, _ = s.db.Exec(`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status, message) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Name, "rollback", "success", message)
+	return nil
+}
@@ -0,0 +1,75 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/nodepassurl"
+)
+
+// schemaTTL 主控参数声明的缓存时长
+const schemaTTL = 10 * time.Minute
+
+type schemaEntry struct {
+	schema    nodepassurl.Schema
+	fetchedAt time.Time
+}
+
+// schemaCache 按端点缓存主控声明的扩展参数
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[int64]schemaEntry
+}
+
+// paramSchema 获取端点声明的扩展参数；主控不支持 /info 或未声明时返回 nil（仅校验参数名）
+func (s *Service) paramSchema(endpointID int64, client *nodepass.Client) nodepassurl.Schema {
+	s.schemas.mu.Lock()
+	entry, ok := s.schemas.entries[endpointID]
+	s.schemas.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < schemaTTL {
+		return entry.schema
+	}
+
+	var schema nodepassurl.Schema
+	if info, err := client.GetInfo(); err != nil {
+		log.Debugf("[Master-%d] 获取主控信息失败，跳过扩展参数校验: %v", endpointID, err)
+	} else {
+		schema = info.Params
+	}
+
+	s.schemas.mu.Lock()
+	if s.schemas.entries == nil {
+		s.schemas.entries = make(map[int64]schemaEntry)
+	}
+	s.schemas.entries[endpointID] = schemaEntry{schema: schema, fetchedAt: time.Now()}
+	s.schemas.mu.Unlock()
+	return schema
+}
+
+// validateExtraParams 校验扩展参数，无参数时不访问主控
+func (s *Service) validateExtraParams(endpointID int64, client *nodepass.Client, mode string, params map[string]string) error {
+	if len(params) == 0 {
+		return nil
+	}
+	return s.paramSchema(endpointID, client).Validate(mode, params)
+}
+
+// ValidateExtraParams 按端点声明校验扩展参数，供创建前的预检使用
+func (s *Service) ValidateExtraParams(endpointID int64, mode string, params map[string]string) error {
+	if len(params) == 0 {
+		return nil
+	}
+	var endpointURL, endpointAPIPath, endpointAPIKey string
+	err := s.db.QueryRow(`SELECT url, apiPath, apiKey FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&endpointURL, &endpointAPIPath, &endpointAPIKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("指定的端点不存在")
+		}
+		return err
+	}
+	client := nodepass.NewClient(endpointURL, endpointAPIPath, endpointAPIKey, nil)
+	return s.validateExtraParams(endpointID, client, mode, params)
+}
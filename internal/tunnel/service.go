@@ -1,20 +1,35 @@
 package tunnel
 
 import (
-	log "NodePassDash/internal/log"
 	"database/sql"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"NodePassDash/internal/labels"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/nodepassurl"
 )
 
+// Config 隧道服务配置
+type Config struct {
+	// AllowedPorts 允许隧道监听的端口范围，为空表示不限制；端点可单独设置
+	AllowedPorts PortRanges
+	// ReservedPorts 禁止隧道监听的端口范围，与端点的设置合并生效
+	ReservedPorts PortRanges
+}
+
+// DefaultConfig 默认不限制隧道端口
+func DefaultConfig() Config {
+	return Config{}
+}
+
 // Service 隧道管理服务
 type Service struct {
-	db *sql.DB
+	db      *sql.DB
+	cfg     Config
+	schemas schemaCache
 }
 
 // OperationLog 操作日志结构
@@ -28,238 +43,32 @@ type OperationLog struct {
 	CreatedAt  time.Time      `json:"createdAt"`
 }
 
-// parsedURL 表示解析后的隧道 URL 各字段（与 SSE 模块保持一致）
-type parsedURL struct {
-	TunnelAddress string
-	TunnelPort    string
-	TargetAddress string
-	TargetPort    string
-	TLSMode       string
-	LogLevel      string
-	CertPath      string
-	KeyPath       string
-	Min           string
-	Max           string
-}
-
-// parseInstanceURL 解析隧道实例 URL（简化实现，与 SSE 保持一致）
-func parseInstanceURL(raw, mode string) parsedURL {
-	// 默认值
-	res := parsedURL{
-		TLSMode:  "inherit",
-		LogLevel: "inherit",
-		CertPath: "",
-		KeyPath:  "",
-	}
-
-	if raw == "" {
-		return res
-	}
-
-	// 去除协议部分 protocol://
-	if idx := strings.Index(raw, "://"); idx != -1 {
-		raw = raw[idx+3:]
-	}
-
-	// 分离查询参数
-	var queryPart string
-	if qIdx := strings.Index(raw, "?"); qIdx != -1 {
-		queryPart = raw[qIdx+1:]
-		raw = raw[:qIdx]
-	}
-
-	// 分离路径
-	var hostPart, pathPart string
-	if pIdx := strings.Index(raw, "/"); pIdx != -1 {
-		hostPart = raw[:pIdx]
-		pathPart = raw[pIdx+1:]
-	} else {
-		hostPart = raw
-	}
-
-	// 解析 hostPart -> tunnelAddress:tunnelPort
-	if hostPart != "" {
-		if strings.Contains(hostPart, ":") {
-			parts := strings.SplitN(hostPart, ":", 2)
-			res.TunnelAddress = parts[0]
-			res.TunnelPort = parts[1]
-		} else {
-			if _, err := strconv.Atoi(hostPart); err == nil {
-				res.TunnelPort = hostPart
-			} else {
-				res.TunnelAddress = hostPart
-			}
-		}
-	}
-
-	// 解析 pathPart -> targetAddress:targetPort
-	if pathPart != "" {
-		if strings.Contains(pathPart, ":") {
-			parts := strings.SplitN(pathPart, ":", 2)
-			res.TargetAddress = parts[0]
-			res.TargetPort = parts[1]
-		} else {
-			if _, err := strconv.Atoi(pathPart); err == nil {
-				res.TargetPort = pathPart
-			} else {
-				res.TargetAddress = pathPart
-			}
-		}
-	}
-
-	// 解析查询参数
-	if queryPart != "" {
-		for _, kv := range strings.Split(queryPart, "&") {
-			if kv == "" {
-				continue
-			}
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			key, val := parts[0], parts[1]
-			switch key {
-			case "tls":
-				if mode == "server" {
-					switch val {
-					case "0":
-						res.TLSMode = "mode0"
-					case "1":
-						res.TLSMode = "mode1"
-					case "2":
-						res.TLSMode = "mode2"
-					}
-				}
-			case "log":
-				res.LogLevel = strings.ToLower(val)
-			case "crt":
-				res.CertPath = val
-			case "key":
-				res.KeyPath = val
-			case "min":
-				res.Min = val
-			case "max":
-				res.Max = val
-			}
-		}
-	}
-
-	return res
-}
-
 // NewService 创建隧道服务实例
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(db *sql.DB, cfg Config) *Service {
+	return &Service{db: db, cfg: cfg}
 }
 
 // GetTunnels 获取所有隧道列表
 func (s *Service) GetTunnels() ([]TunnelWithStats, error) {
 	// log.Debugf("[API] 获取所有隧道列表")
-	query := `
-		SELECT 
-			t.id, t.instanceId, t.name, t.endpointId, t.mode,
-			t.tunnelAddress, t.tunnelPort, t.targetAddress, t.targetPort,
-			t.tlsMode, t.certPath, t.keyPath, t.logLevel, t.commandLine,
-			t.status, t.min, t.max, t.tcpRx, t.tcpTx, t.udpRx, t.udpTx,
-			t.createdAt, t.updatedAt,
-			e.name as endpointName
-		FROM "Tunnel" t
-		LEFT JOIN "Endpoint" e ON t.endpointId = e.id
-		ORDER BY t.createdAt DESC
-	`
-
-	rows, err := s.db.Query(query)
+	res, err := s.ListTunnels(ListQuery{})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var tunnels []TunnelWithStats
-	for rows.Next() {
-		var t TunnelWithStats
-		var modeStr, statusStr, tlsModeStr, logLevelStr string
-		var instanceID sql.NullString
-		var certPathNS, keyPathNS sql.NullString
-		var endpointNameNS sql.NullString
-		var minNS, maxNS sql.NullInt64
-		err := rows.Scan(
-			&t.ID, &instanceID, &t.Name, &t.EndpointID, &modeStr,
-			&t.TunnelAddress, &t.TunnelPort, &t.TargetAddress, &t.TargetPort,
-			&tlsModeStr, &certPathNS, &keyPathNS, &logLevelStr, &t.CommandLine,
-			&statusStr, &minNS, &maxNS, &t.Traffic.TCPRx, &t.Traffic.TCPTx, &t.Traffic.UDPRx, &t.Traffic.UDPTx,
-			&t.CreatedAt, &t.UpdatedAt,
-			&endpointNameNS,
-		)
-		if err != nil {
-			return nil, err
-		}
-		if instanceID.Valid {
-			t.InstanceID = instanceID.String
-		}
-		if certPathNS.Valid {
-			t.CertPath = certPathNS.String
-		}
-		if keyPathNS.Valid {
-			t.KeyPath = keyPathNS.String
-		}
-		if endpointNameNS.Valid {
-			t.EndpointName = endpointNameNS.String
-		}
-		if minNS.Valid {
-			t.Min = int(minNS.Int64)
-		}
-		if maxNS.Valid {
-			t.Max = int(maxNS.Int64)
-		}
-
-		t.Mode = TunnelMode(modeStr)
-		t.Status = TunnelStatus(statusStr)
-		t.TLSMode = TLSMode(tlsModeStr)
-		t.LogLevel = LogLevel(logLevelStr)
-
-		// 计算总流量
-		t.Traffic.Total = t.Traffic.TCPRx + t.Traffic.TCPTx + t.Traffic.UDPRx + t.Traffic.UDPTx
-
-		// 格式化流量数据
-		t.Traffic.Formatted.TCPRx = formatTrafficBytes(t.Traffic.TCPRx)
-		t.Traffic.Formatted.TCPTx = formatTrafficBytes(t.Traffic.TCPTx)
-		t.Traffic.Formatted.UDPRx = formatTrafficBytes(t.Traffic.UDPRx)
-		t.Traffic.Formatted.UDPTx = formatTrafficBytes(t.Traffic.UDPTx)
-		t.Traffic.Formatted.Total = formatTrafficBytes(t.Traffic.Total)
-
-		// 设置类型和头像
-		t.Type = string(t.Mode)
-		if t.Type == "server" {
-			t.Type = "服务端"
-		} else {
-			t.Type = "客户端"
-		}
-		if len(t.EndpointName) > 0 {
-			t.Avatar = string([]rune(t.EndpointName)[0])
-		}
-
-		// 设置状态信息
-		switch t.Status {
-		case StatusRunning:
-			t.StatusInfo.Type = "success"
-			t.StatusInfo.Text = "运行中"
-		case StatusError:
-			t.StatusInfo.Type = "warning"
-			t.StatusInfo.Text = "错误"
-		default:
-			t.StatusInfo.Type = "danger"
-			t.StatusInfo.Text = "已停止"
-		}
-
-		tunnels = append(tunnels, t)
-	}
-
-	return tunnels, nil
+	return res.Tunnels, nil
 }
 
 // CreateTunnel 创建新隧道
 func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
+	return s.createTunnel(req, nil)
+}
+
+// createTunnel 创建隧道，base 不为空时以其为基础生成命令行（保留其中未识别的参数）
+func (s *Service) createTunnel(req CreateTunnelRequest, base *nodepassurl.URL) (*Tunnel, error) {
 	log.Infof("[API] 创建隧道: %v", req.Name)
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
 	// 检查端点是否存在
 	var endpointURL, endpointAPIPath, endpointAPIKey string
 	err := s.db.QueryRow(
@@ -283,57 +92,28 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		return nil, errors.New("隧道名称已存在")
 	}
 
-	// 构建命令行
-	commandLine := fmt.Sprintf("%s://%s:%d/%s:%d",
-		req.Mode,
-		req.TunnelAddress,
-		req.TunnelPort,
-		req.TargetAddress,
-		req.TargetPort,
-	)
-
-	// 添加查询参数
-	var queryParams []string
-
-	if req.LogLevel != LogLevelInherit {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", req.LogLevel))
+	if err := req.Labels.Validate(); err != nil {
+		return nil, err
 	}
 
-	if req.Mode == "server" && req.TLSMode != TLSModeInherit {
-		var tlsModeNum string
-		switch req.TLSMode {
-		case TLSMode0:
-			tlsModeNum = "0"
-		case TLSMode1:
-			tlsModeNum = "1"
-		case TLSMode2:
-			tlsModeNum = "2"
-		}
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", tlsModeNum))
-
-		if req.TLSMode == TLSMode2 && req.CertPath != "" && req.KeyPath != "" {
-			queryParams = append(queryParams,
-				fmt.Sprintf("crt=%s", req.CertPath),
-				fmt.Sprintf("key=%s", req.KeyPath),
-			)
-		}
+	// 校验扩展参数
+	npClient := nodepass.NewClient(endpointURL, endpointAPIPath, endpointAPIKey, nil)
+	if err := s.validateExtraParams(req.EndpointID, npClient, req.Mode, req.ExtraParams); err != nil {
+		return nil, err
 	}
-
-	if req.Mode == "client" {
-		if req.Min > 0 {
-			queryParams = append(queryParams, fmt.Sprintf("min=%d", req.Min))
-		}
-		if req.Max > 0 {
-			queryParams = append(queryParams, fmt.Sprintf("max=%d", req.Max))
+	if err := s.checkPort(req.EndpointID, 0, npClient, TunnelMode(req.Mode), req.TunnelAddress, req.TunnelPort); err != nil {
+		var perr *PortError
+		if !req.IgnorePortPolicy || !errors.As(err, &perr) || perr.Reason == PortInUse {
+			return nil, err
 		}
 	}
 
-	if len(queryParams) > 0 {
-		commandLine += "?" + strings.Join(queryParams, "&")
-	}
+	// 构建命令行
+	cmd := commandURL(base, req.tunnel())
+	commandLine := cmd.String()
+	extraParams := cmd.ExtraMap()
 
 	// 使用 NodePass 客户端创建实例
-	npClient := nodepass.NewClient(endpointURL, endpointAPIPath, endpointAPIKey, nil)
 	instanceID, remoteStatus, err := npClient.CreateInstance(commandLine)
 	if err != nil {
 		return nil, err
@@ -354,9 +134,9 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 				instanceId, name, endpointId, mode,
 				tunnelAddress, tunnelPort, targetAddress, targetPort,
 				tlsMode, certPath, keyPath, logLevel, commandLine,
-				min, max,
+				min, max, extraParams, labels,
 				status, createdAt, updatedAt
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`,
 			instanceID,
 			req.Name,
@@ -383,6 +163,8 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 				}
 				return nil
 			}(),
+			nodepassurl.EncodeExtra(extraParams),
+			labels.Encode(req.Labels),
 			"running",
 			now,
 			now,
@@ -396,9 +178,11 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 			return nil, err
 		}
 	} else {
-		// 已存在，仅更新名称（其余字段由 SSE 写入保持）
-		_, err := s.db.Exec(`UPDATE "Tunnel" SET name = ?, updatedAt = ? WHERE id = ?`,
+		// 已存在，仅更新名称、扩展参数与标签（其余字段由 SSE 写入保持）
+		_, err := s.db.Exec(`UPDATE "Tunnel" SET name = ?, extraParams = ?, labels = ?, updatedAt = ? WHERE id = ?`,
 			req.Name,
+			nodepassurl.EncodeExtra(extraParams),
+			labels.Encode(req.Labels),
 			now,
 			existingID,
 		)
@@ -422,6 +206,7 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.recordVersion(existingID, req.Name, commandLine, VersionCreate, req.Actor, "")
 
 	return &Tunnel{
 		ID:            existingID,
@@ -443,6 +228,8 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		UpdatedAt:     now,
 		Min:           req.Min,
 		Max:           req.Max,
+		ExtraParams:   extraParams,
+		Labels:        req.Labels,
 	}, nil
 }
 
@@ -497,6 +284,7 @@ func (s *Service) DeleteTunnel(instanceID string) error {
 	if affected == 0 {
 		return errors.New("隧道不存在")
 	}
+	s.unlinkTunnel(tunnel.ID)
 
 	// 记录操作日志
 	_, err = s.db.Exec(`
@@ -651,44 +439,11 @@ func formatTrafficBytes(bytes int64) string {
 // UpdateTunnel 更新隧道配置
 func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 	log.Infof("[API] 更新隧道: %v", req.ID)
-	// 检查隧道是否存在
-	var exists bool
-	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Tunnel" WHERE id = ?)`, req.ID).Scan(&exists)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		return errors.New("隧道不存在")
-	}
-
-	// 获取当前隧道信息
-	var tunnel Tunnel
-	err = s.db.QueryRow(`
-		SELECT 
-			id, instanceId, name, endpointId, mode,
-			tunnelAddress, tunnelPort, targetAddress, targetPort,
-			tlsMode, certPath, keyPath, logLevel, commandLine
-		FROM "Tunnel" 
-		WHERE id = ?
-	`, req.ID).Scan(
-		&tunnel.ID, &tunnel.InstanceID, &tunnel.Name, &tunnel.EndpointID, &tunnel.Mode,
-		&tunnel.TunnelAddress, &tunnel.TunnelPort, &tunnel.TargetAddress, &tunnel.TargetPort,
-		&tunnel.TLSMode, &tunnel.CertPath, &tunnel.KeyPath, &tunnel.LogLevel, &tunnel.CommandLine,
-	)
+	tunnel, err := s.getTunnel(req.ID)
 	if err != nil {
 		return err
 	}
 
-	// 获取端点信息
-	var endpointURL, endpointAPIPath, endpointAPIKey string
-	err = s.db.QueryRow(`SELECT url, apiPath, apiKey FROM "Endpoint" WHERE id = ?`, tunnel.EndpointID).Scan(&endpointURL, &endpointAPIPath, &endpointAPIKey)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return errors.New("指定的端点不存在")
-		}
-		return err
-	}
-
 	// 更新隧道信息
 	if req.Name != "" {
 		tunnel.Name = req.Name
@@ -718,48 +473,157 @@ func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 		tunnel.LogLevel = req.LogLevel
 	}
 
-	// 构建命令行
-	commandLine := fmt.Sprintf("%s://%s:%d/%s:%d",
-		tunnel.Mode,
-		tunnel.TunnelAddress,
-		tunnel.TunnelPort,
-		tunnel.TargetAddress,
-		tunnel.TargetPort,
-	)
+	if req.Min > 0 {
+		tunnel.Min = req.Min
+	}
+	if req.Max > 0 {
+		tunnel.Max = req.Max
+	}
+	if req.ExtraParams != nil {
+		tunnel.ExtraParams = req.ExtraParams
+	}
+	if req.Labels != nil {
+		tunnel.Labels = req.Labels
+	}
+	if err := tunnel.request().Validate(); err != nil {
+		return err
+	}
 
-	// 添加查询参数
-	var queryParams []string
+	return s.saveTunnel(tunnel, VersionUpdate, req.Actor, "")
+}
+
+// ReplaceTunnel 以完整配置覆盖隧道（未提供的字段视为清空），不支持修改模式与所属端点
+func (s *Service) ReplaceTunnel(id int64, req CreateTunnelRequest) error {
+	log.Infof("[API] 覆盖隧道配置: %v", id)
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	tunnel, err := s.getTunnel(id)
+	if err != nil {
+		return err
+	}
+	if string(tunnel.Mode) != req.Mode || tunnel.EndpointID != req.EndpointID {
+		return errors.New("修改模式或端点需要重建隧道")
+	}
+
+	tunnel.Name = req.Name
+	tunnel.TunnelAddress = req.TunnelAddress
+	tunnel.TunnelPort = req.TunnelPort
+	tunnel.TargetAddress = req.TargetAddress
+	tunnel.TargetPort = req.TargetPort
+	tunnel.TLSMode = req.TLSMode
+	tunnel.CertPath = req.CertPath
+	tunnel.KeyPath = req.KeyPath
+	tunnel.LogLevel = req.LogLevel
+	tunnel.Min = req.Min
+	tunnel.Max = req.Max
+	tunnel.ExtraParams = req.ExtraParams
+	if tunnel.ExtraParams == nil {
+		tunnel.ExtraParams = map[string]string{}
+	}
+	// 标签不属于实例配置，未提供时保持不变
+	if req.Labels != nil {
+		tunnel.Labels = req.Labels
+	}
+	return s.saveTunnel(tunnel, VersionUpdate, req.Actor, "")
+}
 
-	if tunnel.LogLevel != LogLevelInherit {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", tunnel.LogLevel))
+// getTunnel 读取隧道配置
+func (s *Service) getTunnel(id int64) (*Tunnel, error) {
+	var tunnel Tunnel
+	var instanceID, certPath, keyPath, extraVal, labelsVal sql.NullString
+	var minVal, maxVal sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT 
+			id, instanceId, name, endpointId, mode,
+			tunnelAddress, tunnelPort, targetAddress, targetPort,
+			tlsMode, certPath, keyPath, logLevel, commandLine, min, max, extraParams, labels, managed
+		FROM "Tunnel" 
+		WHERE id = ?
+	`, id).Scan(
+		&tunnel.ID, &instanceID, &tunnel.Name, &tunnel.EndpointID, &tunnel.Mode,
+		&tunnel.TunnelAddress, &tunnel.TunnelPort, &tunnel.TargetAddress, &tunnel.TargetPort,
+		&tunnel.TLSMode, &certPath, &keyPath, &tunnel.LogLevel, &tunnel.CommandLine,
+		&minVal, &maxVal, &extraVal, &labelsVal, &tunnel.Managed,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("隧道不存在")
+		}
+		return nil, err
 	}
+	tunnel.InstanceID = instanceID.String
+	tunnel.CertPath = certPath.String
+	tunnel.KeyPath = keyPath.String
+	tunnel.Min = int(minVal.Int64)
+	tunnel.Max = int(maxVal.Int64)
+	tunnel.ExtraParams = nodepassurl.DecodeExtra(extraVal.String)
+	tunnel.Labels = labels.Decode(labelsVal.String)
+	return &tunnel, nil
+}
 
-	if tunnel.Mode == ModeServer && tunnel.TLSMode != TLSModeInherit {
-		var tlsModeNum string
-		switch tunnel.TLSMode {
-		case TLSMode0:
-			tlsModeNum = "0"
-		case TLSMode1:
-			tlsModeNum = "1"
-		case TLSMode2:
-			tlsModeNum = "2"
+// saveTunnel 重新生成命令行，写入数据库并同步到主控；action、actor 与 message 记录到配置历史
+func (s *Service) saveTunnel(tunnel *Tunnel, action, actor, message string) error {
+	// 获取端点信息
+	var endpointURL, endpointAPIPath, endpointAPIKey string
+	err := s.db.QueryRow(`SELECT url, apiPath, apiKey FROM "Endpoint" WHERE id = ?`, tunnel.EndpointID).Scan(&endpointURL, &endpointAPIPath, &endpointAPIKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("指定的端点不存在")
 		}
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", tlsModeNum))
+		return err
+	}
 
-		if tunnel.TLSMode == TLSMode2 && tunnel.CertPath != "" && tunnel.KeyPath != "" {
-			queryParams = append(queryParams,
-				fmt.Sprintf("crt=%s", tunnel.CertPath),
-				fmt.Sprintf("key=%s", tunnel.KeyPath),
-			)
+	if err := tunnel.Labels.Validate(); err != nil {
+		return err
+	}
+	npClient := nodepass.NewClient(endpointURL, endpointAPIPath, endpointAPIKey, nil)
+	if err := s.validateExtraParams(tunnel.EndpointID, npClient, string(tunnel.Mode), tunnel.ExtraParams); err != nil {
+		return err
+	}
+	old, err := s.getTunnel(tunnel.ID)
+	if err != nil {
+		return err
+	}
+	// 仅在监听端口变化时预检，避免已有冲突阻塞其它字段的修改
+	if old.TunnelPort != tunnel.TunnelPort || ListensLocally(tunnel.Mode, tunnel.TunnelAddress) != ListensLocally(old.Mode, old.TunnelAddress) {
+		if err := s.checkPort(tunnel.EndpointID, tunnel.ID, npClient, tunnel.Mode, tunnel.TunnelAddress, tunnel.TunnelPort); err != nil {
+			return err
 		}
 	}
 
-	if len(queryParams) > 0 {
-		commandLine += "?" + strings.Join(queryParams, "&")
+	// 构建命令行：以原命令行为基础，保留其中未识别的参数
+	base, err := nodepassurl.Parse(tunnel.CommandLine)
+	if err != nil {
+		base = nil
+	}
+	cmd := commandURL(base, *tunnel)
+	tunnel.CommandLine = cmd.String()
+	tunnel.ExtraParams = cmd.ExtraMap()
+
+	if err := s.writeTunnel(tunnel); err != nil {
+		return err
 	}
+	// 先于远端更新记录版本，使保护窗口覆盖更新期间到达的旧事件
+	version := s.recordVersion(tunnel.ID, tunnel.Name, tunnel.CommandLine, action, actor, message)
 
-	// 更新数据库
-	_, err = s.db.Exec(`
+	// 调用 NodePass API 更新隧道实例，失败时恢复原记录并删除刚记录的版本
+	if err := npClient.UpdateInstance(tunnel.InstanceID, tunnel.CommandLine); err != nil {
+		if restoreErr := s.writeTunnel(old); restoreErr != nil {
+			log.Errorf("[API] 恢复隧道 %s 原配置失败: %v", old.Name, restoreErr)
+		}
+		if version > 0 {
+			_, _ = s.db.Exec(`DELETE FROM "TunnelConfigVersion" WHERE tunnelId = ? AND version = ?`, tunnel.ID, version)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// writeTunnel 将隧道配置写入数据库
+func (s *Service) writeTunnel(tunnel *Tunnel) error {
+	_, err := s.db.Exec(`
 		UPDATE "Tunnel" SET
 			name = ?,
 			tunnelAddress = ?,
@@ -771,6 +635,10 @@ func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 			keyPath = ?,
 			logLevel = ?,
 			commandLine = ?,
+			min = ?,
+			max = ?,
+			extraParams = ?,
+			labels = ?,
 			updatedAt = ?
 		WHERE id = ?
 	`,
@@ -783,23 +651,60 @@ func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 		tunnel.CertPath,
 		tunnel.KeyPath,
 		tunnel.LogLevel,
-		commandLine,
+		tunnel.CommandLine,
+		nullableInt(tunnel.Min),
+		nullableInt(tunnel.Max),
+		nodepassurl.EncodeExtra(tunnel.ExtraParams),
+		labels.Encode(tunnel.Labels),
 		time.Now(),
 		tunnel.ID,
 	)
-	if err != nil {
-		return err
+	return err
+}
+
+// SetManaged 标记隧道是否由声明式配置管理
+func (s *Service) SetManaged(id int64, managed bool) error {
+	_, err := s.db.Exec(`UPDATE "Tunnel" SET managed = ? WHERE id = ?`, managed, id)
+	return err
+}
+
+// GetLabels 读取隧道标签
+func (s *Service) GetLabels(id int64) (labels.Set, error) {
+	var val sql.NullString
+	if err := s.db.QueryRow(`SELECT labels FROM "Tunnel" WHERE id = ?`, id).Scan(&val); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("隧道不存在")
+		}
+		return nil, err
 	}
+	return labels.Decode(val.String), nil
+}
 
-	// 调用 NodePass API 更新隧道实例
-	npClient := nodepass.NewClient(endpointURL, endpointAPIPath, endpointAPIKey, nil)
-	if err := npClient.UpdateInstance(tunnel.InstanceID, commandLine); err != nil {
+// SetLabels 整体替换隧道标签，仅修改本地记录
+func (s *Service) SetLabels(id int64, set labels.Set) error {
+	if err := set.Validate(); err != nil {
 		return err
 	}
-
+	result, err := s.db.Exec(`UPDATE "Tunnel" SET labels = ?, updatedAt = ? WHERE id = ?`, labels.Encode(set), time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("隧道不存在")
+	}
 	return nil
 }
 
+// IsManaged 判断隧道是否由声明式配置管理
+func (s *Service) IsManaged(id int64) (bool, error) {
+	var managed bool
+	err := s.db.QueryRow(`SELECT managed FROM "Tunnel" WHERE id = ?`, id).Scan(&managed)
+	if err == sql.ErrNoRows {
+		return false, errors.New("隧道不存在")
+	}
+	return managed, err
+}
+
 // GetOperationLogs 获取最近 limit 条隧道操作日志
 func (s *Service) GetOperationLogs(limit int) ([]OperationLog, error) {
 	if limit <= 0 {
@@ -840,8 +745,9 @@ func (s *Service) GetInstanceIDByTunnelID(id int64) (string, error) {
 
 // DeleteTunnelAndWait 触发远端删除后等待数据库记录被移除
 // 该方法不会主动删除本地记录，而是假设有其它进程 (如 SSE 监听) 负责删除
-// timeout 为等待的最长时长
-func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration, recycle bool) error {
+// timeout 为等待的最长时长，为 0 时不等待（如命令行模式下没有 SSE 监听）直接删除本地记录；
+// actor 为操作者，移入回收站时记录为 deletedBy
+func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration, recycle bool, actor string) error {
 	log.Infof("[API] 删除隧道: %v", instanceID)
 	// 获取隧道及端点信息（与 DeleteTunnel 中相同，但不删除本地记录）
 	var tunnel struct {
@@ -873,10 +779,12 @@ func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration,
 	if recycle {
 		_, _ = s.db.Exec(`INSERT INTO "TunnelRecycle" (
 			name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode,
-			certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max
+			certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max, extraParams, labels,
+			deletedAt, deletedBy
 		) SELECT name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode,
-			certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max
-		FROM "Tunnel" WHERE instanceId = ?`, instanceID)
+			certPath, keyPath, logLevel, commandLine, instanceId, tcpRx, tcpTx, udpRx, udpTx, min, max, extraParams, labels,
+			?, ?
+		FROM "Tunnel" WHERE instanceId = ?`, time.Now(), nullableString(actor), instanceID)
 	}
 
 	// 调用 NodePass API 删除实例
@@ -893,13 +801,19 @@ func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration,
 			return err
 		}
 		if !exists {
+			s.unlinkTunnel(tunnel.ID)
 			return nil // 删除完成
 		}
 		time.Sleep(200 * time.Millisecond)
 	}
 
 	// 超时仍未删除，执行本地强制删除并刷新计数
-	log.Warnf("[API] 等待删除超时，执行本地删除: %v", instanceID)
+	message := "远端删除超时，本地强制删除"
+	if timeout > 0 {
+		log.Warnf("[API] 等待删除超时，执行本地删除: %v", instanceID)
+	} else {
+		message = "远端删除成功，同步删除本地记录"
+	}
 
 	// 删除隧道记录
 	result, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = ?`, tunnel.ID)
@@ -911,6 +825,7 @@ func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration,
 	if rows == 0 {
 		return errors.New("隧道删除失败")
 	}
+	s.unlinkTunnel(tunnel.ID)
 
 	if !recycle {
 		_, _ = s.db.Exec(`DELETE FROM "EndpointSSE" WHERE instanceId = ?`, instanceID)
@@ -929,14 +844,14 @@ func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration,
 		tunnel.Name,
 		"delete",
 		"success",
-		"远端删除超时，本地强制删除",
+		message,
 	)
 
 	return nil
 }
 
-// RenameTunnel 仅修改隧道名称，不调用远端 API
-func (s *Service) RenameTunnel(id int64, newName string) error {
+// RenameTunnel 仅修改隧道名称，不调用远端 API；actor 记录到配置历史
+func (s *Service) RenameTunnel(id int64, newName, actor string) error {
 	log.Infof("[API] 重命名隧道: %v", newName)
 
 	// 检查名称重复
@@ -960,6 +875,10 @@ func (s *Service) RenameTunnel(id int64, newName string) error {
 
 	// 记录操作日志
 	_, _ = s.db.Exec(`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status, message) VALUES (?, ?, ?, ?, ?)`, id, newName, "rename", "success", "重命名成功")
+	var commandLine string
+	if err := s.db.QueryRow(`SELECT commandLine FROM "Tunnel" WHERE id = ?`, id).Scan(&commandLine); err == nil {
+		s.recordVersion(id, newName, commandLine, VersionRename, actor, "")
+	}
 
 	return nil
 }
@@ -970,38 +889,22 @@ func (s *Service) DB() *sql.DB {
 }
 
 // QuickCreateTunnel 根据完整 URL 快速创建隧道实例 (server://addr:port/target:port?params)
-func (s *Service) QuickCreateTunnel(endpointID int64, rawURL string, name string) error {
-	// 粗解析协议
-	idx := strings.Index(rawURL, "://")
-	if idx == -1 {
-		return errors.New("无效的隧道URL")
+// URL 中未识别的参数会原样保留在命令行中；actor 记录到配置历史
+func (s *Service) QuickCreateTunnel(endpointID int64, rawURL string, name, actor string) error {
+	u, err := nodepassurl.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if err := u.Validate(); err != nil {
+		return err
 	}
-	mode := rawURL[:idx]
-	cfg := parseInstanceURL(rawURL, mode) // 复用 sse 里的同名私有函数，此处复制实现
-
-	// 端口转换
-	tp, _ := strconv.Atoi(cfg.TunnelPort)
-	sp, _ := strconv.Atoi(cfg.TargetPort)
 
 	finalName := name
 	if strings.TrimSpace(finalName) == "" {
 		finalName = fmt.Sprintf("auto-%d-%d", endpointID, time.Now().Unix())
 	}
-	req := CreateTunnelRequest{
-		Name:          finalName,
-		EndpointID:    endpointID,
-		Mode:          mode,
-		TunnelAddress: cfg.TunnelAddress,
-		TunnelPort:    tp,
-		TargetAddress: cfg.TargetAddress,
-		TargetPort:    sp,
-		TLSMode:       TLSMode(cfg.TLSMode),
-		CertPath:      cfg.CertPath,
-		KeyPath:       cfg.KeyPath,
-		LogLevel:      LogLevel(cfg.LogLevel),
-		Min:           func() int { v, _ := strconv.Atoi(cfg.Min); return v }(),
-		Max:           func() int { v, _ := strconv.Atoi(cfg.Max); return v }(),
-	}
-	_, err := s.CreateTunnel(req)
+	req := requestFromURL(u, endpointID, finalName)
+	req.Actor = actor
+	_, err = s.createTunnel(req, u)
 	return err
 }
@@ -0,0 +1,252 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/nodepassurl"
+)
+
+const (
+	// defaultVerifyTimeout 迁移时等待目标实例上报运行状态的默认时长
+	defaultVerifyTimeout = 15 * time.Second
+	// verifyInterval 轮询目标实例状态的间隔
+	verifyInterval = 300 * time.Millisecond
+	// moveDeleteTimeout 迁移时删除源隧道等待 SSE 同步的最长时间
+	moveDeleteTimeout = 3 * time.Second
+)
+
+// CloneRequest 将隧道配置复制到另一个主控
+type CloneRequest struct {
+	// EndpointID 目标主控
+	EndpointID int64 `json:"endpointId"`
+	// Name 新隧道名称，为空时使用 <原名称>-copy
+	Name string `json:"name,omitempty"`
+	// TunnelPort 指定目标隧道端口，为 0 时沿用原端口
+	TunnelPort int `json:"tunnelPort,omitempty"`
+	// RemapPort 端口在目标主控上不可用（被占用、保留或不在允许范围）时自动顺延到下一个可用端口
+	RemapPort bool   `json:"remapPort,omitempty"`
+	Actor     string `json:"-"`
+}
+
+// MoveRequest 将隧道迁移到另一个主控
+type MoveRequest struct {
+	EndpointID int64 `json:"endpointId"`
+	TunnelPort int   `json:"tunnelPort,omitempty"`
+	RemapPort  bool  `json:"remapPort,omitempty"`
+	// Recycle 源隧道移入回收站而非直接删除
+	Recycle bool `json:"recycle,omitempty"`
+	// VerifyTimeout 等待目标实例运行的秒数，为 0 时使用默认值
+	VerifyTimeout int    `json:"verifyTimeout,omitempty"`
+	Actor         string `json:"-"`
+}
+
+// TransferResult 克隆 / 迁移结果
+type TransferResult struct {
+	Tunnel   *Tunnel `json:"tunnel"`
+	SourceID int64   `json:"sourceId"`
+	// PortRemapped 端口是否因冲突被自动调整，OriginalPort 为调整前的端口
+	PortRemapped bool `json:"portRemapped"`
+	OriginalPort int  `json:"originalPort,omitempty"`
+	// Warning 迁移已完成但需人工关注的问题
+	Warning string `json:"warning,omitempty"`
+}
+
+// CloneTunnel 在目标主控上按源隧道的配置创建新隧道，源隧道保持不变
+func (s *Service) CloneTunnel(id int64, req CloneRequest) (*TransferResult, error) {
+	src, err := s.getTunnel(id)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		if name, err = s.uniqueName(src.Name, "-copy"); err != nil {
+			return nil, err
+		}
+	}
+
+	create, res, err := s.transferRequest(src, req.EndpointID, name, req.TunnelPort, req.RemapPort)
+	if err != nil {
+		return nil, err
+	}
+	create.Actor = req.Actor
+	log.Infof("[API] 克隆隧道 %s => 主控 %d, 名称 %s", src.Name, req.EndpointID, name)
+	if res.Tunnel, err = s.CreateTunnel(create); err != nil {
+		return nil, err
+	}
+	_, _ = s.db.Exec(`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status, message) VALUES (?, ?, ?, ?, ?)`,
+		res.Tunnel.ID, res.Tunnel.Name, "clone", "success", fmt.Sprintf("从隧道 %s 克隆", src.Name))
+	return res, nil
+}
+
+// MoveTunnel 将隧道迁移到目标主控：先以临时名称在目标主控创建实例并等待 SSE 上报运行状态，
+// 失败时删除目标实例并保持源隧道不变；成功后删除（或回收）源隧道，目标隧道改回原名称并继承隧道对与配置历史
+func (s *Service) MoveTunnel(id int64, req MoveRequest) (*TransferResult, error) {
+	src, err := s.getTunnel(id)
+	if err != nil {
+		return nil, err
+	}
+	if src.InstanceID == "" {
+		return nil, errors.New("隧道没有关联的实例ID")
+	}
+	if src.EndpointID == req.EndpointID {
+		return nil, errors.New("目标主控与源主控相同")
+	}
+	tempName, err := s.uniqueName(src.Name, "-moving")
+	if err != nil {
+		return nil, err
+	}
+
+	create, res, err := s.transferRequest(src, req.EndpointID, tempName, req.TunnelPort, req.RemapPort)
+	if err != nil {
+		return nil, err
+	}
+	create.Actor = req.Actor
+	log.Infof("[API] 迁移隧道 %s => 主控 %d", src.Name, req.EndpointID)
+	target, err := s.CreateTunnel(create)
+	if err != nil {
+		return nil, fmt.Errorf("在目标主控创建实例失败: %w", err)
+	}
+
+	timeout := defaultVerifyTimeout
+	if req.VerifyTimeout > 0 {
+		timeout = time.Duration(req.VerifyTimeout) * time.Second
+	}
+	if err := s.waitRunning(target.ID, timeout); err != nil {
+		log.Errorf("[API] 迁移隧道 %s 失败，回滚目标实例: %v", src.Name, err)
+		if rerr := s.rollbackTunnel(target, "迁移失败，已回滚"); rerr != nil {
+			return nil, fmt.Errorf("目标实例未能运行: %v；回滚失败，实例 %s 可能残留在目标主控: %v", err, target.InstanceID, rerr)
+		}
+		return nil, fmt.Errorf("目标实例未能运行，已回滚: %w", err)
+	}
+
+	// 隧道对改为关联新隧道，避免删除源隧道时解除关联
+	paired, err := s.relinkPair(src.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	if paired && src.Mode == ModeServer {
+		res.Warning = "隧道对中 client 端仍连接原主控地址，请更新其隧道地址"
+	}
+
+	if err := s.DeleteTunnelAndWait(src.InstanceID, moveDeleteTimeout, req.Recycle, req.Actor); err != nil {
+		log.Errorf("[API] 迁移隧道 %s 后删除源隧道失败: %v", src.Name, err)
+		res.Tunnel = target
+		res.Warning = fmt.Sprintf("目标隧道已运行，但删除源隧道失败: %v；目标隧道暂以 %s 命名，请手动处理源隧道", err, tempName)
+		return res, nil
+	}
+
+	if err := s.RenameTunnel(target.ID, src.Name, req.Actor); err != nil {
+		res.Warning = fmt.Sprintf("目标隧道改回原名称失败: %v", err)
+	} else {
+		target.Name = src.Name
+	}
+	if err := s.InheritVersions(src.ID, target.ID, req.Actor, fmt.Sprintf("从主控 %d 迁移", src.EndpointID)); err != nil {
+		log.Warnf("[API] 迁移隧道 %s 转移配置历史失败: %v", src.Name, err)
+	}
+	if src.Managed {
+		_ = s.SetManaged(target.ID, true)
+		target.Managed = true
+	}
+	target.Status = StatusRunning
+	res.Tunnel = target
+
+	_, _ = s.db.Exec(`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status, message) VALUES (?, ?, ?, ?, ?)`,
+		target.ID, target.Name, "move", "success", fmt.Sprintf("从主控 %d 迁移到主控 %d", src.EndpointID, req.EndpointID))
+	return res, nil
+}
+
+// transferRequest 按源隧道的命令行生成目标主控上的创建请求，并预检目标主控的端口
+func (s *Service) transferRequest(src *Tunnel, endpointID int64, name string, port int, remap bool) (CreateTunnelRequest, *TransferResult, error) {
+	if endpointID == 0 {
+		return CreateTunnelRequest{}, nil, errors.New("缺少目标主控")
+	}
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Endpoint" WHERE id = ?)`, endpointID).Scan(&exists); err != nil {
+		return CreateTunnelRequest{}, nil, err
+	}
+	if !exists {
+		return CreateTunnelRequest{}, nil, errors.New("指定的端点不存在")
+	}
+
+	u, err := nodepassurl.Parse(src.CommandLine)
+	if err != nil {
+		return CreateTunnelRequest{}, nil, fmt.Errorf("源隧道命令行无效: %w", err)
+	}
+	req := requestFromURL(u, endpointID, name)
+	req.Labels = src.Labels
+	if port > 0 {
+		req.TunnelPort = port
+	}
+
+	res := &TransferResult{SourceID: src.ID}
+	if !ListensLocally(TunnelMode(req.Mode), req.TunnelAddress) {
+		return req, res, nil
+	}
+	pool, err := s.PortPool(endpointID, 0, true)
+	if err != nil {
+		return CreateTunnelRequest{}, nil, err
+	}
+	perr := pool.Check(req.TunnelPort)
+	if perr == nil {
+		return req, res, nil
+	}
+	if !remap {
+		perr.Suggestion, _ = pool.Next(req.TunnelPort + 1)
+		return CreateTunnelRequest{}, nil, fmt.Errorf("目标主控%w", perr)
+	}
+	free, err := pool.Next(req.TunnelPort + 1)
+	if err != nil {
+		return CreateTunnelRequest{}, nil, err
+	}
+	res.PortRemapped = true
+	res.OriginalPort = req.TunnelPort
+	req.TunnelPort = free
+	return req, res, nil
+}
+
+// waitRunning 等待 SSE 上报隧道的运行状态：只有收到过事件（lastEventTime 非空）时状态才可信
+func (s *Service) waitRunning(id int64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var status string
+		var eventTime sql.NullTime
+		err := s.db.QueryRow(`SELECT status, lastEventTime FROM "Tunnel" WHERE id = ?`, id).Scan(&status, &eventTime)
+		if err == sql.ErrNoRows {
+			return errors.New("目标隧道已被删除")
+		}
+		if err != nil {
+			return err
+		}
+		if eventTime.Valid {
+			switch TunnelStatus(status) {
+			case StatusRunning:
+				return nil
+			case StatusError, StatusStopped:
+				return fmt.Errorf("目标实例状态为 %s", status)
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s 内未收到目标实例的运行状态", timeout)
+		}
+		time.Sleep(verifyInterval)
+	}
+}
+
+// relinkPair 将隧道对中的 oldID 替换为 newID，返回隧道是否属于某个隧道对
+func (s *Service) relinkPair(oldID, newID int64) (bool, error) {
+	res, err := s.db.Exec(`UPDATE "TunnelPair" SET
+		serverTunnelId = CASE WHEN serverTunnelId = ? THEN ? ELSE serverTunnelId END,
+		clientTunnelId = CASE WHEN clientTunnelId = ? THEN ? ELSE clientTunnelId END,
+		updatedAt = ?
+		WHERE serverTunnelId = ? OR clientTunnelId = ?`,
+		oldID, newID, oldID, newID, time.Now(), oldID, oldID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
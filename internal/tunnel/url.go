@@ -0,0 +1,122 @@
+package tunnel
+
+import "NodePassDash/internal/nodepassurl"
+
+// commandURL 根据隧道配置生成实例 URL。
+// base 为已有的实例 URL（如编辑前的命令行），其中未识别的参数与参数顺序会被保留，可为 nil；
+// t.ExtraParams 不为 nil 时替换 base 中的未识别参数
+func commandURL(base *nodepassurl.URL, t Tunnel) *nodepassurl.URL {
+	u := &nodepassurl.URL{}
+	if base != nil {
+		copied := *base
+		copied.Extra = append([]nodepassurl.Param(nil), base.Extra...)
+		u = &copied
+	}
+
+	u.Mode = string(t.Mode)
+	u.TunnelAddress = t.TunnelAddress
+	u.TunnelPort = t.TunnelPort
+	u.TargetAddress = t.TargetAddress
+	u.TargetPort = t.TargetPort
+	u.SetLogLevel(string(t.LogLevel))
+
+	u.TLS, u.Crt, u.Key = "", "", ""
+	if t.Mode == ModeServer && t.TLSMode != TLSModeInherit {
+		u.SetTLSMode(string(t.TLSMode))
+		if t.TLSMode == TLSMode2 && t.CertPath != "" && t.KeyPath != "" {
+			u.Crt, u.Key = t.CertPath, t.KeyPath
+		}
+	}
+
+	u.Min, u.Max = 0, 0
+	if t.Mode == ModeClient {
+		u.Min, u.Max = t.Min, t.Max
+	}
+
+	if t.ExtraParams != nil {
+		u.SetExtraMap(t.ExtraParams)
+	}
+	return u
+}
+
+// tunnel 将创建请求转换为隧道配置
+func (req CreateTunnelRequest) tunnel() Tunnel {
+	return Tunnel{
+		Name:          req.Name,
+		EndpointID:    req.EndpointID,
+		Mode:          TunnelMode(req.Mode),
+		TunnelAddress: req.TunnelAddress,
+		TunnelPort:    req.TunnelPort,
+		TargetAddress: req.TargetAddress,
+		TargetPort:    req.TargetPort,
+		TLSMode:       req.TLSMode,
+		CertPath:      req.CertPath,
+		KeyPath:       req.KeyPath,
+		LogLevel:      req.LogLevel,
+		Min:           req.Min,
+		Max:           req.Max,
+		ExtraParams:   req.ExtraParams,
+	}
+}
+
+// request 将隧道配置转换为创建请求，用于按创建规则校验编辑后的配置
+func (t Tunnel) request() CreateTunnelRequest {
+	return CreateTunnelRequest{
+		Name:          t.Name,
+		EndpointID:    t.EndpointID,
+		Mode:          string(t.Mode),
+		TunnelAddress: t.TunnelAddress,
+		TunnelPort:    t.TunnelPort,
+		TargetAddress: t.TargetAddress,
+		TargetPort:    t.TargetPort,
+		TLSMode:       t.TLSMode,
+		CertPath:      t.CertPath,
+		KeyPath:       t.KeyPath,
+		LogLevel:      t.LogLevel,
+		Min:           t.Min,
+		Max:           t.Max,
+		ExtraParams:   t.ExtraParams,
+		Labels:        t.Labels,
+	}
+}
+
+// requestFromURL 将实例 URL 转换为创建请求
+func requestFromURL(u *nodepassurl.URL, endpointID int64, name string) CreateTunnelRequest {
+	return CreateTunnelRequest{
+		Name:          name,
+		EndpointID:    endpointID,
+		Mode:          u.Mode,
+		TunnelAddress: u.TunnelAddress,
+		TunnelPort:    u.TunnelPort,
+		TargetAddress: u.TargetAddress,
+		TargetPort:    u.TargetPort,
+		TLSMode:       TLSMode(u.TLSMode()),
+		CertPath:      u.Crt,
+		KeyPath:       u.Key,
+		LogLevel:      LogLevel(u.LogLevel()),
+		Min:           u.Min,
+		Max:           u.Max,
+		ExtraParams:   u.ExtraMap(),
+	}
+}
+
+// CommandURL 按创建请求生成实例 URL（不访问数据库与主控）
+func (req CreateTunnelRequest) CommandURL() *nodepassurl.URL {
+	return commandURL(nil, req.tunnel())
+}
+
+// nullableString 空字符串写入 NULL
+func nullableString(v string) interface{} {
+	if v != "" {
+		return v
+	}
+	return nil
+}
+
+// nullableInt 0 视为未设置，写入 NULL
+func nullableInt(v int) interface{} {
+	if v > 0 {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/nodepassurl"
+)
+
+// FieldIssue 预检发现的问题，Field 为请求中的 JSON 字段名（为空表示整体问题）
+type FieldIssue struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// Suggestion 端口不可用时建议改用的端口
+	Suggestion int `json:"suggestion,omitempty"`
+}
+
+// Validation 创建 / 编辑隧道的预检结果，不访问主控写接口也不写数据库
+type Validation struct {
+	Valid    bool         `json:"valid"`
+	Errors   []FieldIssue `json:"errors"`
+	Warnings []FieldIssue `json:"warnings"`
+	// CommandLine 将提交给主控的实例 URL
+	CommandLine string `json:"commandLine,omitempty"`
+	// Parsed 从 CommandLine 解析回的配置，即主控实际生效的字段
+	Parsed *CreateTunnelRequest `json:"parsed,omitempty"`
+	// Changes 编辑时相对当前命令行的字段变化
+	Changes []nodepassurl.FieldDiff `json:"changes,omitempty"`
+}
+
+// Error 实现 error，带字段名
+func (i FieldIssue) Error() string {
+	if i.Field == "" {
+		return i.Message
+	}
+	return i.Field + ": " + i.Message
+}
+
+func newValidation() *Validation {
+	return &Validation{Errors: []FieldIssue{}, Warnings: []FieldIssue{}}
+}
+
+func (v *Validation) fail(field, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, FieldIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *Validation) warn(field, format string, args ...interface{}) {
+	v.Warnings = append(v.Warnings, FieldIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateCreate 预检创建隧道请求
+func (s *Service) ValidateCreate(req CreateTunnelRequest) (*Validation, error) {
+	return s.newValidator(0).check(req, nil)
+}
+
+// ValidateReplace 预检以 req 重建隧道 id（编辑接口），名称与端口不与隧道自身冲突
+func (s *Service) ValidateReplace(id int64, req CreateTunnelRequest) (*Validation, error) {
+	old, err := s.getTunnel(id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.newValidator(id).check(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if v.CommandLine != "" {
+		from, _ := nodepassurl.Parse(old.CommandLine)
+		to, _ := nodepassurl.Parse(v.CommandLine)
+		v.Changes = nodepassurl.Diff(from, to)
+	}
+	return v, nil
+}
+
+// ValidateQuickCreate 预检快速创建请求，URL 本身的错误归入 url 字段
+func (s *Service) ValidateQuickCreate(endpointID int64, rawURL, name string) (*Validation, error) {
+	u, err := nodepassurl.Parse(rawURL)
+	if err == nil {
+		err = u.Validate()
+	}
+	if err != nil {
+		v := newValidation()
+		v.fail("url", "%v", err)
+		return v, nil
+	}
+	return s.newValidator(0).check(requestFromURL(u, endpointID, name), u)
+}
+
+// ValidateBatch 按顺序预检一组创建请求，同时检查请求之间的名称与端口冲突
+func (s *Service) ValidateBatch(reqs []CreateTunnelRequest) ([]*Validation, error) {
+	val := s.newValidator(0)
+	out := make([]*Validation, len(reqs))
+	for i, req := range reqs {
+		v, err := val.check(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// validator 单次预检的上下文，批量预检时在请求之间共享名称与端口占用
+type validator struct {
+	s         *Service
+	excludeID int64
+	names     map[string]bool
+	endpoints map[int64]*validatedEndpoint
+}
+
+type validatedEndpoint struct {
+	status  string
+	client  *nodepass.Client
+	pool    *PortPool
+	warning string
+	err     error
+}
+
+func (s *Service) newValidator(excludeID int64) *validator {
+	return &validator{s: s, excludeID: excludeID, names: make(map[string]bool), endpoints: make(map[int64]*validatedEndpoint)}
+}
+
+// check 依次检查字段标签、模式与 TLS、连接池、名称、端点状态、扩展参数与端口，并生成命令行预览
+func (val *validator) check(req CreateTunnelRequest, base *nodepassurl.URL) (*Validation, error) {
+	v := newValidation()
+	v.checkFields(req)
+	mode := TunnelMode(req.Mode)
+
+	if req.Name != "" {
+		var exists bool
+		err := val.s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Tunnel" WHERE name = ? AND id != ?)`, req.Name, val.excludeID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if exists || val.names[req.Name] {
+			v.fail("name", "隧道名称已存在")
+		}
+		val.names[req.Name] = true
+	}
+
+	if req.EndpointID != 0 {
+		ep, err := val.endpoint(req.EndpointID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ep.err != nil:
+			v.fail("endpointId", "%v", ep.err)
+		default:
+			if ep.status != "ONLINE" {
+				v.fail("endpointId", "主控当前状态为 %s，无法创建实例", ep.status)
+			}
+			if ep.warning != "" {
+				v.warn("tunnelPort", "%s", ep.warning)
+			}
+			if len(req.ExtraParams) > 0 && ep.client != nil {
+				if err := val.s.paramSchema(req.EndpointID, ep.client).Validate(req.Mode, req.ExtraParams); err != nil {
+					v.fail("extraParams", "%v", err)
+				}
+			}
+			if req.TunnelPort > 0 && req.TunnelPort <= 65535 && ListensLocally(mode, req.TunnelAddress) {
+				if perr := ep.pool.Check(req.TunnelPort); perr != nil {
+					perr.Suggestion, _ = ep.pool.Next(req.TunnelPort + 1)
+					v.Errors = append(v.Errors, FieldIssue{Field: "tunnelPort", Message: perr.Error(), Suggestion: perr.Suggestion})
+				} else {
+					ep.pool.Take(req.TunnelPort, req.Name)
+				}
+			}
+		}
+	}
+
+	if mode == ModeServer || mode == ModeClient {
+		v.CommandLine = commandURL(base, req.tunnel()).String()
+		if u, err := nodepassurl.Parse(v.CommandLine); err == nil {
+			parsed := requestFromURL(u, req.EndpointID, req.Name)
+			v.Parsed = &parsed
+		}
+	}
+	v.Valid = len(v.Errors) == 0
+	return v, nil
+}
+
+// checkFields 检查不依赖数据库与主控的字段规则：字段标签、端口范围、TLS 与证书、日志级别、连接池、标签与扩展参数
+func (v *Validation) checkFields(req CreateTunnelRequest) {
+	v.Errors = append(v.Errors, checkTags(req)...)
+	mode := TunnelMode(req.Mode)
+
+	if req.TunnelPort < 0 || req.TunnelPort > 65535 {
+		v.fail("tunnelPort", "端口必须在 1-65535 之间")
+	}
+	if req.TargetPort < 0 || req.TargetPort > 65535 {
+		v.fail("targetPort", "端口必须在 1-65535 之间")
+	}
+
+	switch req.TLSMode {
+	case "", TLSModeInherit, TLSMode0, TLSMode1, TLSMode2:
+	default:
+		v.fail("tlsMode", "无效的 TLS 模式: %q", req.TLSMode)
+	}
+	if mode == ModeClient && req.TLSMode != "" && req.TLSMode != TLSModeInherit {
+		v.warn("tlsMode", "client 模式不支持 TLS 设置，将被忽略")
+	}
+	if mode == ModeServer && req.TLSMode == TLSMode2 {
+		if req.CertPath == "" {
+			v.fail("certPath", "TLS mode2 需要指定证书路径")
+		}
+		if req.KeyPath == "" {
+			v.fail("keyPath", "TLS mode2 需要指定私钥路径")
+		}
+	} else if req.CertPath != "" || req.KeyPath != "" {
+		v.warn("certPath", "证书与私钥仅在 server 模式的 TLS mode2 下使用，将被忽略")
+	}
+
+	if lvl := strings.ToLower(string(req.LogLevel)); lvl != "" && lvl != string(LogLevelInherit) && !containsString(nodepassurl.LogLevels, lvl) {
+		v.fail("logLevel", "无效的日志级别: %q", req.LogLevel)
+	}
+
+	if req.Min < 0 {
+		v.fail("min", "不能为负数")
+	}
+	if req.Max < 0 {
+		v.fail("max", "不能为负数")
+	}
+	if mode == ModeClient && req.Min > 0 && req.Max > 0 && req.Min > req.Max {
+		v.fail("min", "min (%d) 不能大于 max (%d)", req.Min, req.Max)
+	}
+	if mode == ModeServer && (req.Min > 0 || req.Max > 0) {
+		v.warn("min", "min / max 仅在 client 模式下使用，将被忽略")
+	}
+
+	if err := req.Labels.Validate(); err != nil {
+		v.fail("labels", "%v", err)
+	}
+	if err := nodepassurl.ValidateExtra(req.ExtraParams); err != nil {
+		v.fail("extraParams", "%v", err)
+	}
+}
+
+// Validate 按预检的字段规则校验创建 / 编辑请求，返回第一个错误，
+// 使实际执行与 validate 预检的结论一致
+func (req CreateTunnelRequest) Validate() error {
+	v := newValidation()
+	v.checkFields(req)
+	if len(v.Errors) > 0 {
+		return v.Errors[0]
+	}
+	return nil
+}
+
+// endpoint 读取端点状态并建立端口池；端点离线时仅按本地记录检查端口，不访问主控
+func (val *validator) endpoint(id int64) (*validatedEndpoint, error) {
+	if ep, ok := val.endpoints[id]; ok {
+		return ep, nil
+	}
+	ep := &validatedEndpoint{}
+	val.endpoints[id] = ep
+
+	var url, apiPath, apiKey string
+	err := val.s.db.QueryRow(`SELECT url, apiPath, apiKey, status FROM "Endpoint" WHERE id = ?`, id).Scan(&url, &apiPath, &apiKey, &ep.status)
+	if err == sql.ErrNoRows {
+		ep.err = errors.New("指定的端点不存在")
+		return ep, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ep.status == "ONLINE" {
+		ep.client = nodepass.NewClient(url, apiPath, apiKey, nil)
+	}
+
+	_, policy, err := val.s.PortPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+	used, err := val.s.portUsage(id, val.excludeID, ep.client)
+	if used == nil && err != nil {
+		return nil, err
+	}
+	if err != nil {
+		ep.warning = fmt.Sprintf("读取主控实例列表失败，端口仅按本地记录检查: %v", err)
+	} else if ep.client == nil {
+		ep.warning = "主控不在线，端口仅按本地记录检查"
+	}
+	ep.pool = usagePool(policy, used)
+	return ep, nil
+}
+
+// checkTags 按结构体字段的 validate 标签校验，支持 required、omitempty、oneof、min 与 max，字段名取 JSON 标签
+func checkTags(s interface{}) []FieldIssue {
+	var issues []FieldIssue
+	rv := reflect.Indirect(reflect.ValueOf(s))
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		fv := rv.Field(i)
+		for _, rule := range strings.Split(tag, ",") {
+			key, arg, _ := strings.Cut(rule, "=")
+			if key == "omitempty" && fv.IsZero() {
+				break
+			}
+			if msg := checkRule(fv, key, arg); msg != "" {
+				issues = append(issues, FieldIssue{Field: name, Message: msg})
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// checkRule 校验单条规则，通过时返回空字符串；未识别的规则忽略
+func checkRule(fv reflect.Value, key, arg string) string {
+	switch key {
+	case "required":
+		if fv.IsZero() {
+			return "不能为空"
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		if !containsString(options, fmt.Sprint(fv.Interface())) {
+			return "必须为 " + strings.Join(options, " / ") + " 之一"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return ""
+		}
+		var n float64
+		unit := ""
+		switch fv.Kind() {
+		case reflect.String:
+			n, unit = float64(utf8.RuneCountInString(fv.String())), "长度"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(fv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(fv.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = fv.Float()
+		case reflect.Slice, reflect.Map:
+			n, unit = float64(fv.Len()), "数量"
+		default:
+			return ""
+		}
+		if key == "min" && n < limit {
+			return fmt.Sprintf("%s不能小于 %s", unit, arg)
+		}
+		if key == "max" && n > limit {
+			return fmt.Sprintf("%s不能大于 %s", unit, arg)
+		}
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}